@@ -0,0 +1,55 @@
+//go:build linux
+
+package crun
+
+import (
+	"errors"
+	"sync"
+)
+
+// BatchJob is a container run by RunBatch.
+type BatchJob struct {
+	ID   string
+	Spec *ContainerSpec
+	IO   *IOConfig // may be nil, see RunWithIO
+}
+
+// BatchResult is the outcome of a BatchJob.
+type BatchResult struct {
+	ID       string
+	ExitCode int   // -1 if the container could not be run
+	Err      error // error running, waiting for or deleting the container
+}
+
+// RunBatch runs the jobs with RunWithIO, at most concurrency at a time (1 if
+// concurrency is less than 1), waits for each container to exit and deletes
+// it. It returns once every job is done, with the results in the order of
+// jobs. The specs are not closed.
+func (x *RuntimeContext) RunBatch(jobs []BatchJob, concurrency int) []BatchResult {
+	results := make([]BatchResult, len(jobs))
+	sem := make(chan struct{}, max(concurrency, 1))
+	var wg sync.WaitGroup
+	for i, job := range jobs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = x.runBatchJob(job)
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func (x *RuntimeContext) runBatchJob(job BatchJob) BatchResult {
+	res := BatchResult{ID: job.ID, ExitCode: -1}
+	result, err := x.RunWithIO(job.ID, job.Spec, job.IO)
+	if err != nil {
+		res.Err = err
+		return res
+	}
+	res.ExitCode, err = result.Wait()
+	res.Err = errors.Join(err, result.Container.Delete(true))
+	return res
+}
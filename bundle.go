@@ -0,0 +1,82 @@
+//go:build linux && cgo
+
+package crun
+
+/*
+#include "go_crun.h"
+*/
+import "C"
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"unsafe"
+)
+
+// WriteBundle writes spec to dir/config.json, creating dir if needed, so that
+// dir is an OCI bundle usable by RunBundle or other OCI runtimes. The root
+// filesystem is not copied: a relative root.path must exist under dir. The
+// JSON written is the one the spec was loaded from, so AddRootfsPrepare
+// callbacks and SetCgroupParent, which are not part of it, do not apply to the
+// bundle.
+func WriteBundle(dir string, spec *ContainerSpec) error {
+	if spec == nil || spec.c == nil {
+		return errors.New("libcrun: invalid container spec")
+	}
+	var data []byte
+	switch {
+	case spec.c.config_file_content != nil:
+		data = []byte(C.GoString(spec.c.config_file_content))
+	case spec.c.config_file != nil:
+		var err error
+		if data, err = os.ReadFile(C.GoString(spec.c.config_file)); err != nil {
+			return fmt.Errorf("libcrun: write bundle: %w", err)
+		}
+	default:
+		return errors.New("libcrun: write bundle: spec has no JSON source")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("libcrun: write bundle: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), data, 0644); err != nil {
+		return fmt.Errorf("libcrun: write bundle: %w", err)
+	}
+	return nil
+}
+
+// RunBundle runs the container described by the OCI bundle in bundleDir, like
+// crun run --bundle: the spec is read from bundleDir/config.json, a relative
+// root.path is resolved against bundleDir, and the bundle is reported in the
+// container state. Otherwise it behaves like RunWithIO.
+func (x *RuntimeContext) RunBundle(id, bundleDir string, ioCfg *IOConfig) (*RunResult, error) {
+	if x == nil || x.c == nil {
+		return nil, errors.New("libcrun: invalid runtime context")
+	}
+	bundle, err := filepath.Abs(bundleDir)
+	if err != nil {
+		return nil, fmt.Errorf("libcrun: run bundle: %w", err)
+	}
+	spec, err := LoadContainerSpecFromFile(filepath.Join(bundle, "config.json"))
+	if err != nil {
+		return nil, err
+	}
+	defer spec.Close()
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	spec.resolveRootPath(bundle)
+	return x.runWithIO(id, spec, ioCfg, RunOptions{bundle: bundle})
+}
+
+// resolveRootPath makes a relative root.path absolute against dir. The spec
+// must be valid.
+func (c *ContainerSpec) resolveRootPath(dir string) {
+	root := c.c.container_def.root
+	path := C.GoString(root.path)
+	if filepath.IsAbs(path) {
+		return
+	}
+	C.free(unsafe.Pointer(root.path))
+	root.path = C.CString(filepath.Join(dir, path))
+}
@@ -0,0 +1,297 @@
+//go:build linux
+
+package crun
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// cgroupRoot is the mount point of the cgroup filesystem.
+const cgroupRoot = "/sys/fs/cgroup"
+
+// freezeTimeout bounds how long the freezer fallback waits for cgroup.events to settle.
+const freezeTimeout = 2 * time.Second
+
+// isCgroupV2 reports whether the host uses the unified cgroup v2 hierarchy.
+func isCgroupV2() bool {
+	return isCgroupV2At(cgroupRoot)
+}
+
+// isCgroupV2At reports whether the cgroup filesystem mounted at root is the
+// unified cgroup v2 hierarchy.
+func isCgroupV2At(root string) bool {
+	_, err := os.Stat(filepath.Join(root, "cgroup.controllers"))
+	return err == nil
+}
+
+// warnIfCgroupV1 logs a warning through the log handler when the cgroup
+// filesystem at root is not cgroup v2, where libcrun cannot set up a cgroup
+// namespace correctly.
+func warnIfCgroupV1(root string) {
+	if !isCgroupV2At(root) {
+		logWarning("cgroup namespace requested but the host uses cgroup v1: libcrun only unshares the cgroup namespace correctly on cgroup v2")
+	}
+}
+
+// isFreezerUnsupported reports whether err is a libcrun pause/unpause failure
+// caused by missing freezer support rather than by the container state. ENOENT
+// is not one: it is what a missing or deleted container reports.
+func isFreezerUnsupported(err error) bool {
+	var e *Error
+	// ENOTSUP and EOPNOTSUPP are the same errno on Linux
+	return errors.As(err, &e) && e.Errno() == syscall.EOPNOTSUPP
+}
+
+// setCgroupFreeze freezes or thaws the cgroup v2 at path (relative to root) by
+// writing cgroup.freeze, then waits for cgroup.events to report the new state.
+func setCgroupFreeze(root, path string, freeze bool) error {
+	dir := filepath.Join(root, path)
+	value := "0"
+	if freeze {
+		value = "1"
+	}
+	if err := os.WriteFile(filepath.Join(dir, "cgroup.freeze"), []byte(value), 0644); err != nil {
+		return fmt.Errorf("libcrun: write cgroup.freeze: %w", err)
+	}
+
+	deadline := time.Now().Add(freezeTimeout)
+	for {
+		frozen, err := readCgroupFrozen(dir)
+		if err != nil {
+			// Older kernels without cgroup.events: trust the write
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if frozen == freeze {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("libcrun: timeout waiting for cgroup %q to reach frozen=%s", path, value)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// readCgroupFrozen parses the "frozen" key of cgroup.events in dir.
+func readCgroupFrozen(dir string) (bool, error) {
+	f, err := os.Open(filepath.Join(dir, "cgroup.events"))
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), " ")
+		if ok && key == "frozen" {
+			return value == "1", nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return false, err
+	}
+	return false, nil
+}
+
+// Cgroupv2Update describes a live resource update expressed in cgroup v2 terms.
+// It serializes to the "unified" map of the OCI resources, which libcrun writes
+// verbatim to the container's cgroup files. Zero values are left unchanged.
+type Cgroupv2Update struct {
+	CPUMax     string // cpu.max, e.g. "50000 100000" or "max 100000"
+	CPUWeight  uint64 // cpu.weight, 1-10000
+	MemoryMax  int64  // memory.max in bytes, -1 for "max"
+	MemoryHigh int64  // memory.high in bytes, -1 for "max"
+	IOMax      string // io.max for a single device, e.g. "8:0 rbps=1048576 wbps=max"
+}
+
+// Unified returns the cgroup v2 file to value map for the update.
+func (u Cgroupv2Update) Unified() map[string]string {
+	m := make(map[string]string)
+	if u.CPUMax != "" {
+		m["cpu.max"] = u.CPUMax
+	}
+	if u.CPUWeight != 0 {
+		m["cpu.weight"] = strconv.FormatUint(u.CPUWeight, 10)
+	}
+	if u.MemoryMax != 0 {
+		m["memory.max"] = cgroupLimitValue(u.MemoryMax)
+	}
+	if u.MemoryHigh != 0 {
+		m["memory.high"] = cgroupLimitValue(u.MemoryHigh)
+	}
+	if u.IOMax != "" {
+		m["io.max"] = u.IOMax
+	}
+	return m
+}
+
+// MarshalJSON encodes the update in the resources format libcrun expects.
+func (u Cgroupv2Update) MarshalJSON() ([]byte, error) {
+	return json.Marshal(specs.LinuxResources{Unified: u.Unified()})
+}
+
+// cgroupLimitValue formats a byte limit, mapping negative values to "max".
+func cgroupLimitValue(v int64) string {
+	if v < 0 {
+		return "max"
+	}
+	return strconv.FormatInt(v, 10)
+}
+
+// readCgroupResources reconstructs the resource limits applied to the cgroup v2
+// directory dir from its interface files. Files of disabled controllers are
+// skipped, leaving the matching fields nil.
+func readCgroupResources(dir string) (*specs.LinuxResources, error) {
+	read := func(name string) (string, bool, error) {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			return "", false, nil
+		}
+		if err != nil {
+			return "", false, err
+		}
+		return strings.TrimSpace(string(data)), true, nil
+	}
+	// limit reads a single "max"-or-number value, mapping "max" to -1.
+	limit := func(name string) (*int64, error) {
+		v, ok, err := read(name)
+		if err != nil || !ok {
+			return nil, err
+		}
+		n, err := parseCgroupLimit(v)
+		if err != nil {
+			return nil, fmt.Errorf("libcrun: parse %s: %w", name, err)
+		}
+		return &n, nil
+	}
+
+	res := &specs.LinuxResources{}
+
+	memLimit, err := limit("memory.max")
+	if err != nil {
+		return nil, err
+	}
+	memLow, err := limit("memory.low")
+	if err != nil {
+		return nil, err
+	}
+	swapMax, err := limit("memory.swap.max")
+	if err != nil {
+		return nil, err
+	}
+	if memLimit != nil {
+		res.Memory = &specs.LinuxMemory{Limit: memLimit, Reservation: memLow}
+		// OCI swap is memory+swap, cgroup v2 memory.swap.max is swap only
+		if swapMax != nil {
+			swap := int64(-1)
+			if *memLimit >= 0 && *swapMax >= 0 {
+				swap = *memLimit + *swapMax
+			}
+			res.Memory.Swap = &swap
+		}
+	}
+
+	cpu := &specs.LinuxCPU{}
+	if v, ok, err := read("cpu.max"); err != nil {
+		return nil, err
+	} else if ok {
+		quotaStr, periodStr, _ := strings.Cut(v, " ")
+		quota, err := parseCgroupLimit(quotaStr)
+		if err != nil {
+			return nil, fmt.Errorf("libcrun: parse cpu.max: %w", err)
+		}
+		period, err := strconv.ParseUint(periodStr, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("libcrun: parse cpu.max: %w", err)
+		}
+		cpu.Quota = &quota
+		cpu.Period = &period
+	}
+	if v, ok, err := read("cpu.weight"); err != nil {
+		return nil, err
+	} else if ok {
+		weight, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("libcrun: parse cpu.weight: %w", err)
+		}
+		shares := cpuWeightToShares(weight)
+		cpu.Shares = &shares
+		res.Unified = map[string]string{"cpu.weight": v}
+	}
+	if v, ok, err := read("cpuset.cpus"); err != nil {
+		return nil, err
+	} else if ok {
+		cpu.Cpus = v
+	}
+	if v, ok, err := read("cpuset.mems"); err != nil {
+		return nil, err
+	} else if ok {
+		cpu.Mems = v
+	}
+	if cpu.Quota != nil || cpu.Shares != nil || cpu.Cpus != "" || cpu.Mems != "" {
+		res.CPU = cpu
+	}
+
+	pids, err := limit("pids.max")
+	if err != nil {
+		return nil, err
+	}
+	if pids != nil {
+		res.Pids = &specs.LinuxPids{Limit: pids}
+	}
+	return res, nil
+}
+
+// parseCgroupLimit parses a cgroup v2 limit value, mapping "max" to -1.
+func parseCgroupLimit(v string) (int64, error) {
+	if v == "max" {
+		return -1, nil
+	}
+	return strconv.ParseInt(v, 10, 64)
+}
+
+// cpuSharesToWeight is libcrun's convert_shares_to_weight: the cpu.weight
+// written on cgroup v2 for CPU shares, from a quadratic fit in log2(shares)
+// through the minimum, default (1024 -> 100) and maximum of both ranges.
+func cpuSharesToWeight(shares uint64) uint64 {
+	switch {
+	case shares == 0:
+		return 0
+	case shares <= 2:
+		return 1
+	case shares >= 262144:
+		return 10000
+	}
+	l := math.Log2(float64(shares))
+	exponent := (l*l+125*l)/612.0 - 7.0/34.0
+	return uint64(math.Ceil(math.Pow(10, exponent)))
+}
+
+// cpuWeightToShares inverts cpuSharesToWeight, returning the smallest shares
+// value libcrun maps to weight (or to the next weight it can produce). The
+// conversion is lossy, so the result may differ slightly from the shares
+// originally requested, e.g. 1012 for the default 1024.
+func cpuWeightToShares(weight uint64) uint64 {
+	if weight == 0 {
+		return 0
+	}
+	// cpuSharesToWeight is non-decreasing over [2, 262144]
+	return 2 + uint64(sort.Search(262144-2, func(i int) bool {
+		return cpuSharesToWeight(uint64(i)+2) >= weight
+	}))
+}
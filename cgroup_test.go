@@ -0,0 +1,229 @@
+//go:build linux
+
+package crun
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestIsFreezerUnsupported(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&Error{Code: ErrUnknown, Message: "freezer", Status: 95}, true},  // ENOTSUP
+		{&Error{Code: ErrNotFound, Message: "freezer", Status: 2}, false}, // ENOENT: missing container
+		{&Error{Code: ErrPermissionDenied, Message: "freezer", Status: 1}, false},
+		{&Error{Code: ErrUnknown, Message: "freezer", Status: 0}, false},
+		{errors.New("plain error"), false},
+	}
+
+	for _, tt := range tests {
+		if got := isFreezerUnsupported(tt.err); got != tt.want {
+			t.Errorf("isFreezerUnsupported(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestSetCgroupFreeze(t *testing.T) {
+	root := t.TempDir()
+	dir := filepath.Join(root, "test.slice", "ctr")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Failed to create cgroup dir: %v", err)
+	}
+	// Simulate a kernel that reports the frozen state immediately
+	if err := os.WriteFile(filepath.Join(dir, "cgroup.events"), []byte("populated 1\nfrozen 1\n"), 0644); err != nil {
+		t.Fatalf("Failed to write cgroup.events: %v", err)
+	}
+
+	if err := setCgroupFreeze(root, "test.slice/ctr", true); err != nil {
+		t.Fatalf("setCgroupFreeze(true) failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "cgroup.freeze"))
+	if err != nil {
+		t.Fatalf("Failed to read cgroup.freeze: %v", err)
+	}
+	if string(data) != "1" {
+		t.Errorf("cgroup.freeze = %q, want 1", data)
+	}
+}
+
+func TestSetCgroupFreezeWithoutEvents(t *testing.T) {
+	root := t.TempDir()
+
+	if err := setCgroupFreeze(root, "", false); err != nil {
+		t.Fatalf("setCgroupFreeze(false) failed: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(root, "cgroup.freeze"))
+	if err != nil {
+		t.Fatalf("Failed to read cgroup.freeze: %v", err)
+	}
+	if string(data) != "0" {
+		t.Errorf("cgroup.freeze = %q, want 0", data)
+	}
+}
+
+func TestCgroupv2UpdateMarshalJSON(t *testing.T) {
+	u := Cgroupv2Update{
+		CPUMax:     "50000 100000",
+		CPUWeight:  200,
+		MemoryMax:  -1,
+		MemoryHigh: 256 * 1024 * 1024,
+		IOMax:      "8:0 rbps=1048576",
+	}
+
+	b, err := json.Marshal(u)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	var res specs.LinuxResources
+	if err := json.Unmarshal(b, &res); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	want := map[string]string{
+		"cpu.max":     "50000 100000",
+		"cpu.weight":  "200",
+		"memory.max":  "max",
+		"memory.high": "268435456",
+		"io.max":      "8:0 rbps=1048576",
+	}
+	if !reflect.DeepEqual(res.Unified, want) {
+		t.Errorf("Unified = %v, want %v", res.Unified, want)
+	}
+}
+
+func TestCgroupv2UpdateEmpty(t *testing.T) {
+	if got := (Cgroupv2Update{}).Unified(); len(got) != 0 {
+		t.Errorf("Unified() = %v, want empty", got)
+	}
+}
+
+func TestReadCgroupResources(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"memory.max":      "268435456\n",
+		"memory.low":      "0\n",
+		"memory.swap.max": "max\n",
+		"cpu.max":         "50000 100000\n",
+		"cpu.weight":      "100\n",
+		"cpuset.cpus":     "0-1\n",
+		"pids.max":        "100\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+
+	res, err := readCgroupResources(dir)
+	if err != nil {
+		t.Fatalf("readCgroupResources failed: %v", err)
+	}
+
+	if res.Memory == nil || *res.Memory.Limit != 268435456 || *res.Memory.Reservation != 0 || *res.Memory.Swap != -1 {
+		t.Errorf("Memory = %+v, want limit 268435456, reservation 0, unlimited swap", res.Memory)
+	}
+	if res.CPU == nil || *res.CPU.Quota != 50000 || *res.CPU.Period != 100000 {
+		t.Fatalf("CPU = %+v, want quota 50000 and period 100000", res.CPU)
+	}
+	if *res.CPU.Shares != 1012 || res.CPU.Cpus != "0-1" || res.CPU.Mems != "" {
+		t.Errorf("CPU = %+v, want shares 1012 from weight 100 and cpus 0-1", res.CPU)
+	}
+	if got := res.Unified["cpu.weight"]; got != "100" {
+		t.Errorf("Unified cpu.weight = %q, want %q", got, "100")
+	}
+	if res.Pids == nil || *res.Pids.Limit != 100 {
+		t.Errorf("Pids = %+v, want limit 100", res.Pids)
+	}
+}
+
+func TestReadCgroupResourcesMissingControllers(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "pids.max"), []byte("max\n"), 0644); err != nil {
+		t.Fatalf("Failed to write pids.max: %v", err)
+	}
+
+	res, err := readCgroupResources(dir)
+	if err != nil {
+		t.Fatalf("readCgroupResources failed: %v", err)
+	}
+	if res.Memory != nil || res.CPU != nil {
+		t.Errorf("Resources = %+v, want only pids", res)
+	}
+	if res.Pids == nil || *res.Pids.Limit != -1 {
+		t.Errorf("Pids = %+v, want unlimited", res.Pids)
+	}
+}
+
+func TestCPUWeightToShares(t *testing.T) {
+	// Weights computed by libcrun's convert_shares_to_weight
+	tests := []struct {
+		shares, weight, back uint64
+	}{
+		{0, 0, 0},
+		{2, 1, 2},
+		{100, 17, 95},
+		{256, 35, 256},
+		{1024, 100, 1012},
+		{4096, 303, 4092},
+		{262144, 10000, 262115},
+	}
+	for _, tt := range tests {
+		if got := cpuSharesToWeight(tt.shares); got != tt.weight {
+			t.Errorf("cpuSharesToWeight(%d) = %d, want %d", tt.shares, got, tt.weight)
+		}
+		if got := cpuWeightToShares(tt.weight); got != tt.back {
+			t.Errorf("cpuWeightToShares(%d) = %d, want %d", tt.weight, got, tt.back)
+		}
+	}
+	for shares := uint64(2); shares <= 262144; shares += 97 {
+		weight := cpuSharesToWeight(shares)
+		if back := cpuSharesToWeight(cpuWeightToShares(weight)); back != weight {
+			t.Errorf("Weight %d of shares %d maps back to weight %d", weight, shares, back)
+		}
+	}
+}
+
+func TestIsCgroupV2At(t *testing.T) {
+	root := t.TempDir()
+	if isCgroupV2At(root) {
+		t.Error("isCgroupV2At = true without cgroup.controllers")
+	}
+	if err := os.WriteFile(filepath.Join(root, "cgroup.controllers"), []byte("cpu memory pids\n"), 0644); err != nil {
+		t.Fatalf("Failed to write cgroup.controllers: %v", err)
+	}
+	if !isCgroupV2At(root) {
+		t.Error("isCgroupV2At = false with cgroup.controllers")
+	}
+}
+
+func TestWarnIfCgroupV1(t *testing.T) {
+	var entries []LogEntry
+	SetLogHandler(func(entry LogEntry) {
+		entries = append(entries, entry)
+	})
+	defer SetLogHandler(nil)
+
+	root := t.TempDir()
+	warnIfCgroupV1(root)
+	if len(entries) != 1 || entries[0].Verbosity != VerbosityWarning {
+		t.Fatalf("entries = %+v, want one warning on cgroup v1", entries)
+	}
+
+	if err := os.WriteFile(filepath.Join(root, "cgroup.controllers"), nil, 0644); err != nil {
+		t.Fatalf("Failed to write cgroup.controllers: %v", err)
+	}
+	warnIfCgroupV1(root)
+	if len(entries) != 1 {
+		t.Errorf("entries = %+v, want no warning on cgroup v2", entries)
+	}
+}
@@ -3,7 +3,19 @@
 package crun
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 )
@@ -24,9 +36,101 @@ func (c *Container) Kill(sig Signal) error {
 	return c.runtime.killContainer(c.ID, sig)
 }
 
-// Delete removes the container.
+// KillWait sends a signal to the container's init process and waits up to
+// timeout (forever if negative) for it to exit. It reports whether the process
+// exited; a process that ignores or handles the signal yields false, nil once
+// the timeout elapses. Like Stop, a container that exits before the signal is
+// delivered is not an error.
+func (c *Container) KillWait(sig Signal, timeout time.Duration) (bool, error) {
+	if err := c.Kill(sig); err != nil {
+		if err := c.stopErr(err); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	return c.waitExit(timeout)
+}
+
+// stopPollInterval is how often waiting for the container to exit polls it on
+// kernels without pidfd.
+const stopPollInterval = 20 * time.Millisecond
+
+// Stop gracefully stops the container: it sends the container's stop signal
+// (the StopSignalAnnotation, SIGTERM if unset) to the init process, waits up to
+// timeout for it to exit and then escalates to SIGKILL. It returns nil once the
+// container is no longer running. A zero timeout sends SIGKILL immediately.
+// Stopping a container that is not running is not an error; a paused container
+// is resumed after being signaled so the signal can be delivered.
+func (c *Container) Stop(timeout time.Duration) error {
+	state, err := c.State()
+	if err != nil {
+		return err
+	}
+	if state.Status == StatusStopped {
+		return nil
+	}
+
+	sig := SIGTERM
+	if s := state.Annotations[StopSignalAnnotation]; s != "" {
+		sig = Signal(s)
+	}
+	if timeout <= 0 {
+		sig = SIGKILL
+	}
+
+	// Signals to frozen processes stay pending until the cgroup is thawed
+	if err := c.Kill(sig); err != nil {
+		return c.stopErr(err)
+	}
+	if state.Status == StatusPaused {
+		if err := c.Unpause(); err != nil {
+			return c.stopErr(err)
+		}
+	}
+	if sig == SIGKILL {
+		return c.waitKilled()
+	}
+	if exited, err := c.waitExit(timeout); err != nil || exited {
+		return err
+	}
+
+	if err := c.Kill(SIGKILL); err != nil {
+		return c.stopErr(err)
+	}
+	return c.waitKilled()
+}
+
+// waitKilled waits for the container to exit after SIGKILL.
+func (c *Container) waitKilled() error {
+	// SIGKILL cannot be ignored, the wait only covers the kernel teardown
+	exited, err := c.waitExit(10 * time.Second)
+	if err != nil {
+		return err
+	}
+	if !exited {
+		return errors.New("libcrun: container still running after SIGKILL")
+	}
+	return nil
+}
+
+// stopErr ignores a kill failure caused by the container exiting in the meantime.
+func (c *Container) stopErr(killErr error) error {
+	if running, err := c.IsRunning(); err == nil && !running {
+		return nil
+	}
+	return killErr
+}
+
+// Delete removes the container. With force, a running container is killed
+// first and a container that no longer exists is not an error, so the
+// defer ctr.Delete(true) idiom stays quiet when the container was already
+// removed. Without force, deleting a missing container returns an error.
 func (c *Container) Delete(force bool) error {
-	return c.runtime.deleteContainer(c.ID, force)
+	err := c.runtime.deleteContainer(c.ID, force)
+	if err != nil && force && isNotExist(err) {
+		return nil
+	}
+	return err
 }
 
 // State returns the current state of the container.
@@ -39,19 +143,145 @@ func (c *Container) State() (*ContainerState, error) {
 	if err := json.Unmarshal([]byte(jsonStr), &state); err != nil {
 		return nil, err
 	}
+	// libcrun only reports annotations it could read back from its copy of
+	// config.json; fall back to the spec so what was set is always observable
+	if state.Annotations == nil {
+		if sp, err := c.specForState(&state); err == nil && len(sp.Annotations) > 0 {
+			state.Annotations = sp.Annotations
+		}
+	}
+	if state.Pid > 0 && (state.Status == StatusRunning || state.Status == StatusPaused) {
+		if started, err := processStartTime("/proc", state.Pid); err == nil {
+			state.Started = started
+		}
+	}
 	return &state, nil
 }
 
+// userHZ is the unit of the process start time in /proc/<pid>/stat. Linux
+// reports it in USER_HZ, which is fixed at 100 for the userspace ABI.
+const userHZ = 100
+
+// processStartTime returns the start time of pid, computed from its starttime
+// in <procRoot>/<pid>/stat and the boot time (btime) in <procRoot>/stat.
+func processStartTime(procRoot string, pid int) (time.Time, error) {
+	data, err := os.ReadFile(filepath.Join(procRoot, strconv.Itoa(pid), "stat"))
+	if err != nil {
+		return time.Time{}, err
+	}
+	// comm (field 2) may contain spaces, so start after its closing paren.
+	// starttime is field 22, i.e. the 20th field after comm.
+	i := bytes.LastIndexByte(data, ')')
+	if i < 0 {
+		return time.Time{}, fmt.Errorf("libcrun: malformed stat for pid %d", pid)
+	}
+	fields := strings.Fields(string(data[i+1:]))
+	if len(fields) < 20 {
+		return time.Time{}, fmt.Errorf("libcrun: malformed stat for pid %d", pid)
+	}
+	ticks, err := strconv.ParseUint(fields[19], 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("libcrun: parse starttime for pid %d: %w", pid, err)
+	}
+
+	stat, err := os.ReadFile(filepath.Join(procRoot, "stat"))
+	if err != nil {
+		return time.Time{}, err
+	}
+	for _, line := range strings.Split(string(stat), "\n") {
+		v, ok := strings.CutPrefix(line, "btime ")
+		if !ok {
+			continue
+		}
+		btime, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("libcrun: parse btime: %w", err)
+		}
+		since := time.Duration(ticks) * time.Second / userHZ
+		return time.Unix(btime, 0).Add(since), nil
+	}
+	return time.Time{}, errors.New("libcrun: btime not found in stat")
+}
+
 // StateJSON returns the raw JSON state of the container.
 func (c *Container) StateJSON() (string, error) {
 	return c.runtime.containerStateJSON(c.ID)
 }
 
+// Spec returns the OCI configuration the container was created with.
+// libcrun keeps a copy of config.json in the container's state directory, which
+// is preferred since the bundle may be shared or changed after creation; the
+// bundle's config.json (from State().Bundle) is used as a fallback.
+// Returns an error matching ErrContainerNotFound if the container or its
+// configuration does not exist.
+func (c *Container) Spec() (*specs.Spec, error) {
+	state, err := c.State()
+	if err != nil {
+		return nil, err
+	}
+	return c.specForState(state)
+}
+
+// specForState reads the configuration of the container in state.
+func (c *Container) specForState(state *ContainerState) (*specs.Spec, error) {
+	var paths []string
+	if dir, err := c.runtime.containerStateDir(c.ID); err == nil {
+		paths = append(paths, filepath.Join(dir, "config.json"))
+	}
+	if state.Bundle != "" {
+		paths = append(paths, filepath.Join(state.Bundle, "config.json"))
+	}
+
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var sp specs.Spec
+		if err := json.Unmarshal(data, &sp); err != nil {
+			return nil, fmt.Errorf("libcrun: parse %s: %w", p, err)
+		}
+		return &sp, nil
+	}
+	return nil, &Error{
+		Code:    ErrNotFound,
+		Message: fmt.Sprintf("config.json not found for container %q", c.ID),
+	}
+}
+
+// RootfsPath returns the host path of the container's root filesystem, e.g.
+// to inspect its files from the host. It is read from the container's
+// configuration (see Spec); a relative root path is resolved against the
+// bundle.
+func (c *Container) RootfsPath() (string, error) {
+	state, err := c.State()
+	if err != nil {
+		return "", err
+	}
+	sp, err := c.specForState(state)
+	if err != nil {
+		return "", err
+	}
+	if sp.Root == nil || sp.Root.Path == "" {
+		return "", fmt.Errorf("libcrun: container %q has no root path", c.ID)
+	}
+	if filepath.IsAbs(sp.Root.Path) {
+		return filepath.Clean(sp.Root.Path), nil
+	}
+	return filepath.Join(state.Bundle, sp.Root.Path), nil
+}
+
 // execConfig holds configuration for exec operations.
 type execConfig struct {
 	detach   bool
 	terminal bool
 	cwd      string
+	args     []string
+	env      []string
+	user     *specs.User
 }
 
 // ExecOption is a functional option for configuring exec operations.
@@ -72,29 +302,146 @@ func WithWorkingDir(cwd string) ExecOption {
 	return func(c *execConfig) { c.cwd = cwd }
 }
 
-// Exec executes a process in the container.
-func (c *Container) Exec(proc *specs.Process, opts ...ExecOption) error {
+// WithExecArgs sets the arguments of the exec process, replacing those of
+// the process passed to Exec or ExecStream.
+func WithExecArgs(args ...string) ExecOption {
+	return func(c *execConfig) { c.args = args }
+}
+
+// WithExecEnv sets an environment variable of the exec process, replacing
+// any value the process already has for key.
+func WithExecEnv(key, value string) ExecOption {
+	return func(c *execConfig) { c.env = append(c.env, key+"="+value) }
+}
+
+// WithExecUser runs the exec process as uid and gid.
+func WithExecUser(uid, gid uint32) ExecOption {
+	return func(c *execConfig) { c.user = &specs.User{UID: uid, GID: gid} }
+}
+
+// newExecConfig applies opts to a new execConfig.
+func newExecConfig(opts []ExecOption) *execConfig {
 	cfg := &execConfig{}
 	for _, opt := range opts {
 		opt(cfg)
 	}
+	return cfg
+}
 
-	// Apply options to the process
-	execProc := *proc // copy
-	if cfg.terminal {
+// process returns a copy of proc with the options applied. proc may be nil
+// if the arguments are set with WithExecArgs.
+func (c *execConfig) process(proc *specs.Process) (*specs.Process, error) {
+	var execProc specs.Process
+	if proc != nil {
+		execProc = *proc
+	}
+	if c.terminal {
 		execProc.Terminal = true
 	}
-	if cfg.cwd != "" {
-		execProc.Cwd = cfg.cwd
+	if c.cwd != "" {
+		execProc.Cwd = c.cwd
 	}
+	if execProc.Cwd == "" {
+		execProc.Cwd = "/"
+	}
+	if c.args != nil {
+		execProc.Args = c.args
+	}
+	if len(execProc.Args) == 0 {
+		return nil, errors.New("libcrun: exec process has no arguments")
+	}
+	if len(c.env) > 0 {
+		execProc.Env = mergeEnv(execProc.Env, c.env)
+	}
+	if c.user != nil {
+		execProc.User = *c.user
+	}
+	return &execProc, nil
+}
 
-	b, err := json.Marshal(&execProc)
+// mergeEnv returns env with the KEY=VALUE entries of overrides, replacing the
+// entries of env with the same key.
+func mergeEnv(env, overrides []string) []string {
+	merged := make([]string, 0, len(env)+len(overrides))
+	index := make(map[string]int, len(env)+len(overrides))
+	for _, kv := range append(slices.Clip(env), overrides...) {
+		key, _, _ := strings.Cut(kv, "=")
+		if i, ok := index[key]; ok {
+			merged[i] = kv
+			continue
+		}
+		index[key] = len(merged)
+		merged = append(merged, kv)
+	}
+	return merged
+}
+
+// Exec executes a process in the container.
+// Returns an error matching ErrNotRunning if the container is not running, or
+// ErrContainerPaused if it is paused.
+func (c *Container) Exec(proc *specs.Process, opts ...ExecOption) error {
+	execProc, err := newExecConfig(opts).process(proc)
+	if err != nil {
+		return err
+	}
+
+	b, err := json.Marshal(execProc)
 	if err != nil {
 		return err
 	}
+	if err := c.checkExecTarget(); err != nil {
+		return err
+	}
 	return c.runtime.execJSON(c.ID, string(b))
 }
 
+// checkExecTarget returns an error matching ErrNotRunning if the container is
+// created but not started or has stopped, or ErrContainerPaused if it is paused.
+// libcrun would otherwise join a created container's init or fail with an
+// unclassified error.
+func (c *Container) checkExecTarget() error {
+	state, err := c.State()
+	if err != nil {
+		return err
+	}
+	switch state.Status {
+	case StatusRunning:
+		return nil
+	case StatusPaused:
+		return &Error{Code: ErrPaused, Message: fmt.Sprintf("container %q is paused", c.ID)}
+	default:
+		return &Error{Code: ErrContainerNotRunning, Message: fmt.Sprintf("container %q is not running (%s)", c.ID, state.Status)}
+	}
+}
+
+// ExecStream executes a process in the container and streams its output.
+// stdout and stderr must be read (or closed) by the caller while the process runs,
+// otherwise it blocks once the pipe buffers fill up. wait blocks until the process
+// exits and returns its exit code; it can be called more than once. Cancelling
+// ctx kills the exec'd process; wait then returns ctx.Err() alongside the exit
+// code, unless the process had already exited.
+// WithDetach and WithExecTTY are not supported.
+func (c *Container) ExecStream(ctx context.Context, proc *specs.Process, opts ...ExecOption) (stdout, stderr io.ReadCloser, wait func() (int, error), err error) {
+	cfg := newExecConfig(opts)
+	if cfg.detach || cfg.terminal {
+		return nil, nil, nil, errors.New("libcrun: ExecStream does not support detached or TTY exec")
+	}
+
+	execProc, err := cfg.process(proc)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	b, err := json.Marshal(execProc)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if err := c.checkExecTarget(); err != nil {
+		return nil, nil, nil, err
+	}
+	return c.runtime.execStream(ctx, c.ID, string(b))
+}
+
 // UpdateResources updates the container's resource limits.
 func (c *Container) UpdateResources(res *specs.LinuxResources) error {
 	b, err := json.Marshal(res)
@@ -104,6 +451,63 @@ func (c *Container) UpdateResources(res *specs.LinuxResources) error {
 	return c.runtime.updateContainer(c.ID, string(b))
 }
 
+// UpdateResourcesJSON is like UpdateResources but takes the resources as a
+// JSON object in the OCI linux.resources format. Invalid JSON or unknown
+// fields make it fail without changing the container.
+func (c *Container) UpdateResourcesJSON(data string) error {
+	res, err := parseResourcesJSON(data)
+	if err != nil {
+		return err
+	}
+	return c.UpdateResources(res)
+}
+
+// UpdateCPUSet moves the running container to the given CPUs and memory nodes,
+// in cpuset list format (e.g. "0-1,4"). An empty value leaves that setting
+// unchanged. Unlike UpdateResources with a hand-built LinuxResources, no
+// other limit is touched.
+func (c *Container) UpdateCPUSet(cpus, mems string) error {
+	return c.UpdateResources(&specs.LinuxResources{
+		CPU: &specs.LinuxCPU{Cpus: cpus, Mems: mems},
+	})
+}
+
+// Update updates the container's resource limits using the same options as
+// spec creation, e.g. Update(WithMemoryLimit(128<<20), WithCPUShares(256)).
+// Only options setting Linux.Resources are accepted; any other option makes
+// Update fail without changing the container.
+func (c *Container) Update(opts ...SpecOption) error {
+	sp := &specs.Spec{}
+	for _, opt := range opts {
+		opt(sp)
+	}
+	var res *specs.LinuxResources
+	if sp.Linux != nil {
+		res = sp.Linux.Resources
+		sp.Linux.Resources = nil
+		if reflect.ValueOf(*sp.Linux).IsZero() {
+			sp.Linux = nil
+		}
+	}
+	if !reflect.ValueOf(*sp).IsZero() {
+		return errors.New("libcrun: Update only accepts resource options")
+	}
+	if res == nil {
+		return nil
+	}
+	return c.UpdateResources(res)
+}
+
+// UpdateV2 updates the container's resource limits using cgroup v2 semantics.
+// Requires a cgroup v2 host.
+func (c *Container) UpdateV2(u Cgroupv2Update) error {
+	b, err := json.Marshal(u)
+	if err != nil {
+		return err
+	}
+	return c.runtime.updateContainer(c.ID, string(b))
+}
+
 // Pause pauses/freezes the container.
 func (c *Container) Pause() error {
 	return c.runtime.pauseContainer(c.ID)
@@ -124,6 +528,71 @@ func (c *Container) IsRunning() (bool, error) {
 	return c.runtime.isContainerRunning(c.ID)
 }
 
+// ExitCode returns the exit code of the stopped container's init process, 128
+// plus the signal number if it was killed by a signal. It returns
+// ErrContainerIsRunning if the container is still running, and
+// ErrExitCodeUnavailable if the exit code is not known: libcrun does not record
+// it, so it is only available for containers started by Run, RunWithIO with
+// RunOptions.BeforeStart, or Create, unless detached.
+func (c *Container) ExitCode() (int, error) {
+	running, err := c.IsRunning()
+	if err != nil {
+		return -1, err
+	}
+	if running {
+		return -1, ErrContainerIsRunning
+	}
+	return c.runtime.containerExitCode(c.ID)
+}
+
+// Events streams cgroup events (OOM kills, populated and frozen state changes)
+// for the container by watching its cgroup v2 cgroup.events and memory.events
+// files with inotify. The channel is closed when ctx is canceled or the
+// container is deleted. Requires the unified cgroup v2 hierarchy.
+func (c *Container) Events(ctx context.Context) (<-chan Event, error) {
+	if !isCgroupV2() {
+		return nil, errors.New("libcrun: container events require cgroup v2")
+	}
+	dir, err := c.CgroupPath()
+	if err != nil {
+		return nil, err
+	}
+	return watchCgroupEvents(ctx, dir)
+}
+
+// EffectiveResources returns the resource limits actually applied to the
+// container, read back from its cgroup v2 files (memory.max, cpu.max,
+// cpu.weight, cpuset.cpus, pids.max, ...). A limit of -1 means unlimited.
+// CPU shares are converted back from cpu.weight and may differ slightly from
+// the requested value, so the raw cpu.weight is also reported in Unified.
+// Requires the unified cgroup v2 hierarchy.
+func (c *Container) EffectiveResources() (*specs.LinuxResources, error) {
+	if !isCgroupV2() {
+		return nil, errors.New("libcrun: effective resources require cgroup v2")
+	}
+	dir, err := c.CgroupPath()
+	if err != nil {
+		return nil, err
+	}
+	return readCgroupResources(dir)
+}
+
+// CgroupPath returns the absolute path of the container's cgroup directory
+// under /sys/fs/cgroup, from the cgroup path libcrun records in the container
+// status. It is meant for the unified cgroup v2 hierarchy: on cgroup v1 the
+// cgroup lives under each controller's mount point instead.
+// Returns an error if the container was created without a cgroup.
+func (c *Container) CgroupPath() (string, error) {
+	path, err := c.runtime.containerCgroupPath(c.ID)
+	if err != nil {
+		return "", err
+	}
+	if path == "" {
+		return "", fmt.Errorf("libcrun: container %q has no cgroup", c.ID)
+	}
+	return filepath.Join(cgroupRoot, path), nil
+}
+
 // PIDs returns the list of process IDs in the container.
 // If recurse is true, includes PIDs from child cgroups.
 func (c *Container) PIDs(recurse bool) ([]int, error) {
@@ -2,7 +2,15 @@
 
 package crun
 
-import "testing"
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
 
 func TestExecOptionWithDetach(t *testing.T) {
 	cfg := &execConfig{}
@@ -34,3 +42,86 @@ func TestExecOptionWithWorkingDir(t *testing.T) {
 	}
 }
 
+
+func TestExecOptionsBuildProcess(t *testing.T) {
+	base := &specs.Process{
+		Args: []string{"/bin/sh"},
+		Env:  []string{"PATH=/bin", "HOME=/root"},
+		Cwd:  "/srv",
+	}
+	cfg := newExecConfig([]ExecOption{
+		WithExecArgs("echo", "hi"),
+		WithExecEnv("HOME", "/home/app"),
+		WithExecEnv("LANG", "C"),
+		WithExecUser(1000, 100),
+	})
+	proc, err := cfg.process(base)
+	if err != nil {
+		t.Fatalf("process() error = %v", err)
+	}
+	if want := []string{"echo", "hi"}; !reflect.DeepEqual(proc.Args, want) {
+		t.Errorf("Args = %q, want %q", proc.Args, want)
+	}
+	if want := []string{"PATH=/bin", "HOME=/home/app", "LANG=C"}; !reflect.DeepEqual(proc.Env, want) {
+		t.Errorf("Env = %q, want %q", proc.Env, want)
+	}
+	if proc.User.UID != 1000 || proc.User.GID != 100 {
+		t.Errorf("User = %+v, want 1000:100", proc.User)
+	}
+	if proc.Cwd != "/srv" {
+		t.Errorf("Cwd = %q, want /srv", proc.Cwd)
+	}
+	if base.Env[1] != "HOME=/root" || base.Args[0] != "/bin/sh" {
+		t.Error("process() modified the base process")
+	}
+
+	// Options alone are enough to build a process
+	proc, err = newExecConfig([]ExecOption{WithExecArgs("true")}).process(nil)
+	if err != nil {
+		t.Fatalf("process(nil) error = %v", err)
+	}
+	if proc.Cwd != "/" {
+		t.Errorf("Cwd = %q, want /", proc.Cwd)
+	}
+	if _, err := newExecConfig(nil).process(nil); err == nil {
+		t.Error("process(nil) without arguments succeeded, want error")
+	}
+}
+
+func TestProcessStartTime(t *testing.T) {
+	procRoot := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(procRoot, "42"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// comm contains spaces and a paren; starttime (field 22) is 250 ticks
+	stat := "42 (my (odd) proc) S 1 42 42 0 -1 4194560 100 0 0 0 1 2 0 0 20 0 1 0 250 1000 10\n"
+	if err := os.WriteFile(filepath.Join(procRoot, "42", "stat"), []byte(stat), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(procRoot, "stat"), []byte("cpu  1 2 3\nbtime 1700000000\nprocesses 10\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := processStartTime(procRoot, 42)
+	if err != nil {
+		t.Fatalf("processStartTime failed: %v", err)
+	}
+	if want := time.Unix(1700000000, 0).Add(2500 * time.Millisecond); !got.Equal(want) {
+		t.Errorf("start time = %v, want %v", got, want)
+	}
+
+	if _, err := processStartTime(procRoot, 43); err == nil {
+		t.Error("processStartTime should fail for a missing pid")
+	}
+}
+
+func TestContainerUpdateRejectsNonResourceOptions(t *testing.T) {
+	c := &Container{ID: "test"}
+	if err := c.Update(WithMemoryLimit(1<<20), WithHostname("nope")); err == nil {
+		t.Error("Update with a non-resource option should fail")
+	}
+	// Without options there is nothing to update
+	if err := c.Update(); err != nil {
+		t.Errorf("Update() = %v, want nil", err)
+	}
+}
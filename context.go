@@ -0,0 +1,53 @@
+//go:build linux
+
+package crun
+
+import "context"
+
+// The Context variants below return ctx.Err() without calling libcrun when
+// ctx is already done. libcrun calls cannot be interrupted, so cancellation
+// is otherwise best effort: a call in progress runs to completion.
+
+// CreateContext is like Create but honors ctx. If ctx is done by the time
+// the container has been created, the container is deleted again and
+// ctx.Err() is returned, so a cancelled request leaves nothing behind.
+func (x *RuntimeContext) CreateContext(ctx context.Context, id string, spec *ContainerSpec, o CreateOptions) (*Container, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	ctr, err := x.Create(id, spec, o)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		_ = ctr.Delete(true)
+		return nil, err
+	}
+	return ctr, nil
+}
+
+// StartContext is like Start but returns ctx.Err() without starting the
+// container if ctx is already done.
+func (c *Container) StartContext(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.Start()
+}
+
+// DeleteContext is like Delete but returns ctx.Err() without deleting the
+// container if ctx is already done.
+func (c *Container) DeleteContext(ctx context.Context, force bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.Delete(force)
+}
+
+// StateContext is like State but returns ctx.Err() if ctx is already done.
+func (c *Container) StateContext(ctx context.Context) (*ContainerState, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.State()
+}
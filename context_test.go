@@ -0,0 +1,41 @@
+//go:build linux && cgo
+
+package crun
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestContextVariantsCanceled(t *testing.T) {
+	rc, err := NewRuntimeContext(RuntimeConfig{StateRoot: t.TempDir()})
+	if err != nil {
+		t.Fatalf("NewRuntimeContext failed: %v", err)
+	}
+	defer rc.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Reaching libcrun would fail differently: the spec is nil and the
+	// container does not exist
+	if _, err := rc.CreateContext(ctx, "ctx-test", nil, CreateOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("CreateContext error = %v, want context.Canceled", err)
+	}
+	ctr := rc.Get("ctx-test")
+	if err := ctr.StartContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("StartContext error = %v, want context.Canceled", err)
+	}
+	if err := ctr.DeleteContext(ctx, false); !errors.Is(err, context.Canceled) {
+		t.Errorf("DeleteContext error = %v, want context.Canceled", err)
+	}
+	if _, err := ctr.StateContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("StateContext error = %v, want context.Canceled", err)
+	}
+
+	// A live context reaches libcrun
+	if _, err := ctr.StateContext(context.Background()); !errors.Is(err, ErrContainerNotFound) {
+		t.Errorf("StateContext error = %v, want ErrContainerNotFound", err)
+	}
+}
@@ -3,15 +3,22 @@
 package crun
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"runtime"
+	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"testing"
 	"time"
 
@@ -25,6 +32,12 @@ import (
 //
 // Run with: sudo go test -v -tags=integration ./...
 
+func TestMain(m *testing.M) {
+	// The hooks of WithNetworkDevicesMoveBack run the test binary
+	NetnsHookMain()
+	os.Exit(m.Run())
+}
+
 func skipIfNotRoot(t *testing.T) {
 	if os.Getuid() != 0 {
 		t.Skip("Test requires root privileges")
@@ -53,14 +66,10 @@ func testRootfs(t *testing.T) string {
 }
 
 func testRuntimeContext(t *testing.T) *RuntimeContext {
-	stateRoot := filepath.Join(t.TempDir(), "state")
-	if err := os.MkdirAll(stateRoot, 0755); err != nil {
-		t.Fatalf("Failed to create state root: %v", err)
-	}
-
 	rc, err := NewRuntimeContext(RuntimeConfig{
-		Bundle:    t.TempDir(),
-		StateRoot: stateRoot,
+		Bundle:          t.TempDir(),
+		StateRoot:       filepath.Join(t.TempDir(), "state"),
+		CreateStateRoot: true,
 	})
 	if err != nil {
 		t.Fatalf("Failed to create RuntimeContext: %v", err)
@@ -154,52 +163,2227 @@ func TestIntegration_Run(t *testing.T) {
 	}
 }
 
-func TestIntegration_List(t *testing.T) {
+func TestIntegration_RunInheritStdio(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	// Redirect our own stdout to a file for the duration of the runs
+	out, err := os.Create(filepath.Join(t.TempDir(), "stdout"))
+	if err != nil {
+		t.Fatalf("Failed to create stdout file: %v", err)
+	}
+	defer out.Close()
+	saved, err := syscall.Dup(syscall.Stdout)
+	if err != nil {
+		t.Fatalf("Failed to save stdout: %v", err)
+	}
+	defer syscall.Close(saved)
+	if err := syscall.Dup3(int(out.Fd()), syscall.Stdout, 0); err != nil {
+		t.Fatalf("Failed to redirect stdout: %v", err)
+	}
+	defer syscall.Dup3(saved, syscall.Stdout, 0)
+
+	run := func(id, msg string, ioCfg *IOConfig) {
+		spec, err := NewSpec(false,
+			WithRootPath(rootfs),
+			WithContainerTTY(false),
+			WithArgs("/bin/echo", msg),
+		)
+		if err != nil {
+			t.Fatalf("Failed to create spec: %v", err)
+		}
+		defer spec.Close()
+
+		result, err := rc.RunWithIO(id, spec, ioCfg)
+		if err != nil {
+			t.Fatalf("Failed to run container: %v", err)
+		}
+		defer result.Container.Delete(true)
+		if exitCode, err := result.Wait(); err != nil || exitCode != 0 {
+			t.Fatalf("Wait() = %d, %v, want 0, nil", exitCode, err)
+		}
+	}
+	run("test-run-discard", "discarded", &IOConfig{})
+	run("test-run-inherit", "inherited", &IOConfig{InheritStdio: true})
+
+	if err := syscall.Dup3(saved, syscall.Stdout, 0); err != nil {
+		t.Fatalf("Failed to restore stdout: %v", err)
+	}
+	data, err := os.ReadFile(out.Name())
+	if err != nil {
+		t.Fatalf("Failed to read stdout file: %v", err)
+	}
+	if !strings.Contains(string(data), "inherited\n") {
+		t.Errorf("Parent stdout = %q, want the container output", data)
+	}
+	if strings.Contains(string(data), "discarded") {
+		t.Errorf("Parent stdout = %q, want nil Stdout without InheritStdio discarded", data)
+	}
+}
+
+func TestIntegration_RunBundle(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	// Classic bundle layout: config.json next to a relative rootfs
+	bundle := t.TempDir()
+	if err := os.Symlink(rootfs, filepath.Join(bundle, "rootfs")); err != nil {
+		t.Fatalf("Failed to link rootfs: %v", err)
+	}
+	spec, err := NewSpec(false,
+		WithRootPath("rootfs"),
+		WithContainerTTY(false),
+		WithArgs("/bin/sh", "-c", "echo hello from bundle"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+	if err := WriteBundle(bundle, spec); err != nil {
+		t.Fatalf("Failed to write bundle: %v", err)
+	}
+	if _, err := LoadContainerSpecFromFile(filepath.Join(bundle, "config.json")); err != nil {
+		t.Fatalf("Failed to load written config.json: %v", err)
+	}
+
+	var stdout bytes.Buffer
+	result, err := rc.RunBundle("test-run-bundle", bundle, &IOConfig{Stdout: &stdout})
+	if err != nil {
+		t.Fatalf("Failed to run bundle: %v", err)
+	}
+	defer result.Container.Delete(true)
+
+	exitCode, err := result.Wait()
+	if err != nil {
+		t.Fatalf("Failed to wait for container: %v", err)
+	}
+	if exitCode != 0 {
+		t.Errorf("Expected exit code 0, got %d", exitCode)
+	}
+	if got := strings.TrimSpace(stdout.String()); got != "hello from bundle" {
+		t.Errorf("Expected stdout 'hello from bundle', got %q", got)
+	}
+}
+
+func TestIntegration_RunDiscardsOutput(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	// 1MB is far more than a pipe buffer holds
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/sh", "-c", "head -c 1048576 /dev/zero; head -c 1048576 /dev/zero >&2"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := rc.Run("test-run-discard", spec, RunOptions{})
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Failed to run container: %v", err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("Run did not return: container output blocked it")
+	}
+
+	// Run deletes the container once it exits
+	if ids, _ := rc.ListIDs(); slices.Contains(ids, "test-run-discard") {
+		t.Errorf("Expected container to be deleted after Run, got %v", ids)
+	}
+}
+
+func TestIntegration_RunDetach(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	bgSpec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/sleep", "300"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer bgSpec.Close()
+
+	start := time.Now()
+	bg, err := rc.Run("test-run-detached", bgSpec, RunOptions{Detach: true})
+	if err != nil {
+		t.Fatalf("Failed to run detached container: %v", err)
+	}
+	defer bg.Delete(true)
+	if elapsed := time.Since(start); elapsed > 30*time.Second {
+		t.Errorf("Detached Run took %v, expected it to return once started", elapsed)
+	}
+	running, err := bg.IsRunning()
+	if err != nil {
+		t.Fatalf("Failed to check container: %v", err)
+	}
+	if !running {
+		t.Error("Expected detached container to be running after Run")
+	}
+
+	// The same context still runs containers in the foreground
+	fgSpec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/sh", "-c", "sleep 1; echo hello"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer fgSpec.Close()
+
+	var stdout bytes.Buffer
+	start = time.Now()
+	result, err := rc.RunWithIO("test-run-foreground", fgSpec, &IOConfig{Stdout: &stdout})
+	if err != nil {
+		t.Fatalf("Failed to run container: %v", err)
+	}
+	defer result.Container.Delete(true)
+	if _, err := result.Wait(); err != nil {
+		t.Fatalf("Failed to wait for container: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("Wait returned after %v, expected it to block until the container exited", elapsed)
+	}
+	if got := strings.TrimSpace(stdout.String()); got != "hello" {
+		t.Errorf("Expected stdout 'hello', got %q", got)
+	}
+}
+
+func TestIntegration_EnsureCreated(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/sleep", "300"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	first, created, err := rc.EnsureCreated("test-ensure-created", spec)
+	if err != nil {
+		t.Fatalf("Failed to create container: %v", err)
+	}
+	defer first.Delete(true)
+	if !created {
+		t.Error("Expected first EnsureCreated to create the container")
+	}
+
+	second, created, err := rc.EnsureCreated("test-ensure-created", spec)
+	if err != nil {
+		t.Fatalf("Failed to ensure existing container: %v", err)
+	}
+	if created {
+		t.Error("Expected second EnsureCreated to find the existing container")
+	}
+	if second.ID != first.ID {
+		t.Errorf("Expected container %q, got %q", first.ID, second.ID)
+	}
+	state, err := second.State()
+	if err != nil {
+		t.Fatalf("Failed to get state: %v", err)
+	}
+	if state.Status != StatusCreated {
+		t.Errorf("Status = %q, want %q", state.Status, StatusCreated)
+	}
+}
+
+func TestIntegration_RunReportsCreateErrors(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/sleep", "300"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	ctr, err := rc.Create("test-run-exists", spec, CreateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create container: %v", err)
+	}
+	defer ctr.Delete(true)
+
+	if _, err := rc.Run("test-run-exists", spec, RunOptions{}); !errors.Is(err, ErrContainerExists) {
+		t.Errorf("Expected ErrContainerExists, got %v", err)
+	}
+	if _, err := rc.RunWithIO("test-run-exists", spec, &IOConfig{}); !errors.Is(err, ErrContainerExists) {
+		t.Errorf("Expected ErrContainerExists from RunWithIO, got %v", err)
+	}
+}
+
+func TestIntegration_RunWithInit(t *testing.T) {
+	skipIfNotRoot(t)
+	initPath, err := FindInit()
+	if err != nil {
+		t.Skipf("Skipping: %v", err)
+	}
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	// The inner shell exits before its background child, which is reparented
+	// to PID 1 and must be reaped there once it exits
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/sh", "-c", `sh -c 'sleep 1 &'; sleep 2; grep -l '^State:.*Z' /proc/[0-9]*/status | wc -l`),
+		WithInit(initPath),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	var stdout, stderr bytes.Buffer
+	result, err := rc.RunWithIO("test-run-init", spec, &IOConfig{
+		Stdout: &stdout,
+		Stderr: &stderr,
+	})
+	if err != nil {
+		t.Fatalf("Failed to run container: %v", err)
+	}
+	defer result.Container.Delete(true)
+
+	exitCode, err := result.Wait()
+	if err != nil {
+		t.Fatalf("Failed to wait for container: %v", err)
+	}
+	if exitCode != 0 {
+		t.Fatalf("Expected exit code 0, got %d (stderr: %s)", exitCode, stderr.String())
+	}
+	if got := strings.TrimSpace(stdout.String()); got != "0" {
+		t.Errorf("Expected no zombies in the container, got %s", got)
+	}
+}
+
+func TestIntegration_RunFlushesWriters(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/sh", "-c", "echo hello; echo oops >&2"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	var stdout, stderr bytes.Buffer
+	result, err := rc.RunWithIO("test-run-flush", spec, &IOConfig{
+		Stdout: bufio.NewWriter(&stdout),
+		Stderr: bufio.NewWriter(&stderr),
+	})
+	if err != nil {
+		t.Fatalf("Failed to run container: %v", err)
+	}
+	defer result.Container.Delete(true)
+
+	if _, err := result.Wait(); err != nil {
+		t.Fatalf("Failed to wait for container: %v", err)
+	}
+	if got := stdout.String(); got != "hello\n" {
+		t.Errorf("stdout = %q, want %q", got, "hello\n")
+	}
+	if got := stderr.String(); got != "oops\n" {
+		t.Errorf("stderr = %q, want %q", got, "oops\n")
+	}
+}
+
+func TestIntegration_RunStdinLargeInput(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/cat"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	input := bytes.Repeat([]byte("0123456789abcdef"), 1<<16)
+	var stdout bytes.Buffer
+	result, err := rc.RunWithIO("test-stdin-large", spec, &IOConfig{
+		Stdin:  bytes.NewReader(input),
+		Stdout: &stdout,
+	})
+	if err != nil {
+		t.Fatalf("Failed to run container: %v", err)
+	}
+	defer result.Container.Delete(true)
+
+	exitCode, timedOut, err := result.WaitTimeout(30 * time.Second)
+	if err != nil {
+		t.Fatalf("Failed to wait for container: %v", err)
+	}
+	if timedOut {
+		t.Fatal("cat did not exit: stdin EOF was not delivered")
+	}
+	if exitCode != 0 {
+		t.Errorf("Expected exit code 0, got %d", exitCode)
+	}
+	if !bytes.Equal(stdout.Bytes(), input) {
+		t.Errorf("stdout has %d bytes, want the %d bytes written to stdin", stdout.Len(), len(input))
+	}
+}
+
+func TestIntegration_RunLargeOutputLateWait(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	const size = 10 * 1024 * 1024
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/head", "-c", strconv.Itoa(size), "/dev/zero"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	var stdout bytes.Buffer
+	result, err := rc.RunWithIO("test-large-output", spec, &IOConfig{Stdout: &stdout})
+	if err != nil {
+		t.Fatalf("Failed to run container: %v", err)
+	}
+	defer result.Container.Delete(true)
+
+	// The output is drained while nobody waits, so the container can finish
+	time.Sleep(time.Second)
+
+	exitCode, timedOut, err := result.WaitTimeout(30 * time.Second)
+	if err != nil {
+		t.Fatalf("Failed to wait for container: %v", err)
+	}
+	if timedOut {
+		t.Fatal("Container did not exit: output not drained")
+	}
+	if exitCode != 0 {
+		t.Errorf("Expected exit code 0, got %d", exitCode)
+	}
+	if stdout.Len() != size {
+		t.Errorf("stdout has %d bytes, want %d", stdout.Len(), size)
+	}
+}
+
+func TestIntegration_ForwardSignals(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	// As PID 1 the shell only reacts to signals it traps
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/sh", "-c", `trap "exit 7" TERM; echo ready; while true; do sleep 0.1; done`),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	stdoutR, stdoutW := io.Pipe()
+	defer stdoutR.Close()
+	result, err := rc.RunWithIO("test-forward-signals", spec, &IOConfig{Stdout: stdoutW})
+	if err != nil {
+		t.Fatalf("Failed to run container: %v", err)
+	}
+	defer result.Container.Delete(true)
+
+	stop := result.ForwardSignals()
+	defer stop()
+
+	line, err := bufio.NewReader(stdoutR).ReadString('\n')
+	if err != nil || line != "ready\n" {
+		t.Fatalf("Failed to read ready line: %q, %v", line, err)
+	}
+	go io.Copy(io.Discard, stdoutR)
+
+	// The signal is caught and relayed instead of terminating the test
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatalf("Failed to signal self: %v", err)
+	}
+
+	exitCode, timedOut, err := result.WaitTimeout(10 * time.Second)
+	if err != nil {
+		t.Fatalf("Failed to wait for container: %v", err)
+	}
+	if timedOut {
+		t.Fatal("Container did not exit after the forwarded SIGTERM")
+	}
+	if exitCode != 7 {
+		t.Errorf("Exit code = %d, want 7 from the SIGTERM trap", exitCode)
+	}
+	stdoutW.Close()
+}
+
+func TestIntegration_RunWaitTimeout(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/sleep", "5"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	result, err := rc.RunWithIO("test-wait-timeout", spec, &IOConfig{})
+	if err != nil {
+		t.Fatalf("Failed to run container: %v", err)
+	}
+	defer result.Container.Delete(true)
+
+	_, timedOut, err := result.WaitTimeout(100 * time.Millisecond)
+	if err != nil {
+		t.Fatalf("WaitTimeout failed: %v", err)
+	}
+	if !timedOut {
+		t.Fatal("Expected WaitTimeout to time out")
+	}
+
+	if err := result.Container.Kill(SIGKILL); err != nil {
+		t.Fatalf("Failed to kill container: %v", err)
+	}
+	if _, err := result.Wait(); err != nil {
+		t.Fatalf("Failed to wait for container: %v", err)
+	}
+}
+
+func TestIntegration_RootfsPrepare(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	const name = "libcrun-go-prepare-test"
+	t.Cleanup(func() { os.Remove(filepath.Join(rootfs, "tmp", name)) })
+
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/cat", "/tmp/"+name),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+	spec.AddRootfsPrepare(func(root string) error {
+		return os.WriteFile(filepath.Join(root, "tmp", name), []byte("prepared"), 0644)
+	})
+
+	var stdout bytes.Buffer
+	result, err := rc.RunWithIO("test-rootfs-prepare", spec, &IOConfig{Stdout: &stdout})
+	if err != nil {
+		t.Fatalf("Failed to run container: %v", err)
+	}
+	defer result.Container.Delete(true)
+
+	if exitCode, err := result.Wait(); err != nil || exitCode != 0 {
+		t.Fatalf("Wait = (%d, %v), want exit code 0", exitCode, err)
+	}
+	if got := stdout.String(); got != "prepared" {
+		t.Errorf("stdout = %q, want prepared", got)
+	}
+}
+
+func TestIntegration_RunWithStdoutFd(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/sh", "-c", "echo hi"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	out, err := os.Create(filepath.Join(t.TempDir(), "stdout.log"))
+	if err != nil {
+		t.Fatalf("Failed to create output file: %v", err)
+	}
+	defer out.Close()
+
+	// An fd and a writer for the same stream are rejected
+	if _, err := rc.RunWithIO("test-stdout-fd-invalid", spec, &IOConfig{
+		StdoutFd: int(out.Fd()),
+		Stdout:   io.Discard,
+	}); err == nil {
+		t.Fatal("Expected error when StdoutFd is set together with Stdout")
+	}
+
+	result, err := rc.RunWithIO("test-stdout-fd", spec, &IOConfig{StdoutFd: int(out.Fd())})
+	if err != nil {
+		t.Fatalf("Failed to run container: %v", err)
+	}
+	defer result.Container.Delete(true)
+
+	if exitCode, err := result.Wait(); err != nil || exitCode != 0 {
+		t.Fatalf("Wait = (%d, %v), want exit code 0", exitCode, err)
+	}
+	data, err := os.ReadFile(out.Name())
+	if err != nil {
+		t.Fatalf("Failed to read output file: %v", err)
+	}
+	if got := strings.TrimSpace(string(data)); got != "hi" {
+		t.Errorf("Output file = %q, want hi", got)
+	}
+}
+
+func TestIntegration_RunWithLogFile(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/sh", "-c", "echo out; echo err >&2"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	logFile := filepath.Join(t.TempDir(), "ctr.log")
+	result, err := rc.RunWithIO("test-log-file", spec, &IOConfig{LogFile: logFile})
+	if err != nil {
+		t.Fatalf("Failed to run container: %v", err)
+	}
+	defer result.Container.Delete(true)
+
+	if exitCode, err := result.Wait(); err != nil || exitCode != 0 {
+		t.Fatalf("Wait = (%d, %v), want exit code 0", exitCode, err)
+	}
+
+	got := map[string]string{}
+	for _, l := range readLogLines(t, logFile) {
+		if _, err := time.Parse(time.RFC3339Nano, l.Time); err != nil {
+			t.Errorf("Invalid time %q: %v", l.Time, err)
+		}
+		got[l.Stream] += l.Log
+	}
+	if got["stdout"] != "out\n" || got["stderr"] != "err\n" || len(got) != 2 {
+		t.Errorf("Log entries by stream = %q, want stdout %q and stderr %q", got, "out\n", "err\n")
+	}
+}
+
+func TestIntegration_RunCombinedOutput(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/sh", "-c", "echo out; echo err >&2"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	// Combined cannot be mixed with Stdout/Stderr
+	if _, err := rc.RunWithIO("test-combined-invalid", spec, &IOConfig{
+		Combined: io.Discard,
+		Stdout:   io.Discard,
+	}); err == nil {
+		t.Fatal("Expected error when Combined is set together with Stdout")
+	}
+
+	var combined bytes.Buffer
+	result, err := rc.RunWithIO("test-combined", spec, &IOConfig{
+		Combined: &combined,
+	})
+	if err != nil {
+		t.Fatalf("Failed to run container: %v", err)
+	}
+	defer result.Container.Delete(true)
+
+	exitCode, err := result.Wait()
+	if err != nil {
+		t.Fatalf("Failed to wait for container: %v", err)
+	}
+	if exitCode != 0 {
+		t.Errorf("Expected exit code 0, got %d", exitCode)
+	}
+
+	if got := combined.String(); got != "out\nerr\n" {
+		t.Errorf("Combined output = %q, want %q", got, "out\nerr\n")
+	}
+}
+
+func TestIntegration_RunBeforeStart(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	setupDir := t.TempDir()
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithAnnotation("test.before-start", "pending"),
+		WithMount(setupDir, "/setup", "bind", []string{"bind", "ro"}),
+		WithArgs("/bin/cat", "/setup/marker"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	var stdout bytes.Buffer
+	result, err := rc.RunWithIOOptions("test-before-start", spec, &IOConfig{Stdout: &stdout}, RunOptions{
+		BeforeStart: func(c *Container) error {
+			state, err := c.State()
+			if err != nil {
+				return err
+			}
+			if state.Status != StatusCreated {
+				return fmt.Errorf("status = %s, want %s", state.Status, StatusCreated)
+			}
+			// The container only sees the marker if the hook ran before start
+			return os.WriteFile(filepath.Join(setupDir, "marker"), []byte(state.Annotations["test.before-start"]), 0644)
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to run container: %v", err)
+	}
+	defer result.Container.Delete(true)
+
+	exitCode, err := result.Wait()
+	if err != nil {
+		t.Fatalf("Failed to wait for container: %v", err)
+	}
+	if exitCode != 0 {
+		t.Errorf("Expected exit code 0, got %d", exitCode)
+	}
+	if got := stdout.String(); got != "pending" {
+		t.Errorf("stdout = %q, want %q", got, "pending")
+	}
+
+	// A failing hook aborts the run and removes the container
+	hookErr := errors.New("setup failed")
+	_, err = rc.RunWithIOOptions("test-before-start-fail", spec, nil, RunOptions{
+		BeforeStart: func(*Container) error { return hookErr },
+	})
+	if !errors.Is(err, hookErr) {
+		t.Fatalf("RunWithIOOptions error = %v, want %v", err, hookErr)
+	}
+	if ids, _ := rc.ListIDs(); slices.Contains(ids, "test-before-start-fail") {
+		t.Error("Container still exists after failed BeforeStart")
+	}
+}
+
+func TestIntegration_RunAutoRemove(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/sh", "-c", "exit 3"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	result, err := rc.RunWithIOOptions("test-auto-remove", spec, nil, RunOptions{AutoRemove: true})
+	if err != nil {
+		t.Fatalf("Failed to run container: %v", err)
+	}
+	defer result.Container.Delete(true)
+
+	exitCode, err := result.Wait()
+	if err != nil {
+		t.Fatalf("Failed to wait for container: %v", err)
+	}
+	if exitCode != 3 {
+		t.Errorf("Expected exit code 3, got %d", exitCode)
+	}
+	ctrs, err := rc.List()
+	if err != nil {
+		t.Fatalf("Failed to list containers: %v", err)
+	}
+	for _, c := range ctrs {
+		if c.ID == "test-auto-remove" {
+			t.Error("Container still exists after Wait with AutoRemove")
+		}
+	}
+
+	// A second Wait does not try to delete it again
+	if _, err := result.Wait(); err != nil {
+		t.Errorf("Second Wait failed: %v", err)
+	}
+
+	if _, err := rc.RunWithIOOptions("test-auto-remove-detach", spec, nil, RunOptions{AutoRemove: true, Detach: true}); err == nil {
+		t.Error("RunWithIOOptions with AutoRemove and Detach succeeded, want error")
+	}
+}
+
+func TestIntegration_RunTaggedOutput(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/sh", "-c", "echo out1; echo err1 >&2; echo out2; echo err2 >&2"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	var got []string
+	result, err := rc.RunWithIO("test-tagged", spec, &IOConfig{
+		Stdout: streamRecorder{"stdout", &got},
+		Stderr: streamRecorder{"stderr", &got},
+		Tagged: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to run container: %v", err)
+	}
+	defer result.Container.Delete(true)
+
+	exitCode, err := result.Wait()
+	if err != nil {
+		t.Fatalf("Failed to wait for container: %v", err)
+	}
+	if exitCode != 0 {
+		t.Errorf("Expected exit code 0, got %d", exitCode)
+	}
+
+	// Only the order within each stream is guaranteed
+	var stdout, stderr string
+	for _, chunk := range got {
+		if s, ok := strings.CutPrefix(chunk, "stdout:"); ok {
+			stdout += s
+		} else if s, ok := strings.CutPrefix(chunk, "stderr:"); ok {
+			stderr += s
+		}
+	}
+	if stdout != "out1\nout2\n" || stderr != "err1\nerr2\n" {
+		t.Errorf("Tagged output = %q, want out1, out2 on stdout and err1, err2 on stderr", got)
+	}
+}
+
+func TestIntegration_List(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	// Initially empty
+	containers, err := rc.List()
+	if err != nil {
+		t.Fatalf("Failed to list containers: %v", err)
+	}
+	if len(containers) != 0 {
+		t.Errorf("Expected 0 containers, got %d", len(containers))
+	}
+
+	// Create a container
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/sleep", "30"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	ctr, err := rc.Create("test-list", spec, CreateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create container: %v", err)
+	}
+	defer ctr.Delete(true)
+
+	// Should have one container now
+	containers, err = rc.List()
+	if err != nil {
+		t.Fatalf("Failed to list containers: %v", err)
+	}
+	if len(containers) != 1 {
+		t.Errorf("Expected 1 container, got %d", len(containers))
+	}
+	if containers[0].ID != "test-list" {
+		t.Errorf("Container ID = %q, want test-list", containers[0].ID)
+	}
+}
+
+func TestIntegration_DeleteAll(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/sleep", "30"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	for i := 0; i < 3; i++ {
+		ctr, err := rc.Create(fmt.Sprintf("test-delete-all-%d", i), spec, CreateOptions{})
+		if err != nil {
+			t.Fatalf("Failed to create container: %v", err)
+		}
+		defer ctr.Delete(true)
+	}
+
+	deleted, errs := rc.DeleteAll(true)
+	if len(errs) != 0 {
+		t.Errorf("DeleteAll errors: %v", errs)
+	}
+	if deleted != 3 {
+		t.Errorf("DeleteAll deleted %d containers, want 3", deleted)
+	}
+
+	ids, err := rc.ListIDs()
+	if err != nil {
+		t.Fatalf("Failed to list containers: %v", err)
+	}
+	if len(ids) != 0 {
+		t.Errorf("Containers left after DeleteAll: %v", ids)
+	}
+}
+
+func TestIntegration_StateUptime(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/sleep", "30"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	ctr, err := rc.Create("test-uptime", spec, CreateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create container: %v", err)
+	}
+	defer ctr.Delete(true)
+
+	if err := ctr.Start(); err != nil {
+		t.Fatalf("Failed to start container: %v", err)
+	}
+	time.Sleep(time.Second)
+
+	state, err := ctr.State()
+	if err != nil {
+		t.Fatalf("Failed to get state: %v", err)
+	}
+	if state.Started.IsZero() {
+		t.Fatal("Started is zero for a running container")
+	}
+	// starttime has a 10ms resolution
+	if uptime := state.Uptime(); uptime < 950*time.Millisecond {
+		t.Errorf("Uptime() = %v, want >= 1s", uptime)
+	}
+}
+
+func TestIntegration_EffectiveResources(t *testing.T) {
+	skipIfNotRoot(t)
+	if !isCgroupV2() {
+		t.Skip("cgroup v2 not available")
+	}
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	const limit = 64 * 1024 * 1024
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithMemoryLimit(limit),
+		WithPidsLimit(50),
+		WithArgs("/bin/sleep", "30"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	ctr, err := rc.Create("test-effective-resources", spec, CreateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create container: %v", err)
+	}
+	defer ctr.Delete(true)
+
+	res, err := ctr.EffectiveResources()
+	if err != nil {
+		t.Fatalf("EffectiveResources failed: %v", err)
+	}
+	if res.Memory == nil || res.Memory.Limit == nil || *res.Memory.Limit != limit {
+		t.Errorf("Memory = %+v, want limit %d", res.Memory, limit)
+	}
+	if res.Pids == nil || res.Pids.Limit == nil || *res.Pids.Limit != 50 {
+		t.Errorf("Pids = %+v, want limit 50", res.Pids)
+	}
+}
+
+// TestIntegration_ConcurrentCreate creates containers from many goroutines on a
+// shared RuntimeContext. Run under -race to check the context is not mutated.
+func TestIntegration_ConcurrentCreate(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	const n = 20
+	var wg sync.WaitGroup
+	errs := make(chan error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			spec, err := NewSpec(false,
+				WithRootPath(rootfs),
+				WithContainerTTY(false),
+				WithArgs("/bin/sleep", "30"),
+			)
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer spec.Close()
+			if _, err := rc.Create(fmt.Sprintf("test-concurrent-create-%d", i), spec, CreateOptions{}); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	t.Cleanup(func() { rc.DeleteAll(true) })
+
+	for err := range errs {
+		t.Errorf("Create failed: %v", err)
+	}
+
+	ids, err := rc.ListIDs()
+	if err != nil {
+		t.Fatalf("Failed to list containers: %v", err)
+	}
+	slices.Sort(ids)
+	var want []string
+	for i := 0; i < n; i++ {
+		want = append(want, fmt.Sprintf("test-concurrent-create-%d", i))
+	}
+	slices.Sort(want)
+	if !slices.Equal(ids, want) {
+		t.Errorf("Containers = %v, want %v", ids, want)
+	}
+}
+
+func TestIntegration_Kill(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/sleep", "300"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	ctr, err := rc.Create("test-kill", spec, CreateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create container: %v", err)
+	}
+	defer ctr.Delete(true)
+
+	if err := ctr.Start(); err != nil {
+		t.Fatalf("Failed to start container: %v", err)
+	}
+
+	// Container should be running
+	running, err := ctr.IsRunning()
+	if err != nil {
+		t.Fatalf("Failed to check if running: %v", err)
+	}
+	if !running {
+		t.Error("Container should be running")
+	}
+
+	// Kill it
+	if err := ctr.Kill(SIGTERM); err != nil {
+		t.Fatalf("Failed to kill container: %v", err)
+	}
+}
+
+func TestIntegration_NamespacesFromPid(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	targetSpec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/sleep", "300"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer targetSpec.Close()
+
+	target, err := rc.Create("test-ns-target", targetSpec, CreateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create container: %v", err)
+	}
+	defer target.Delete(true)
+	if err := target.Start(); err != nil {
+		t.Fatalf("Failed to start container: %v", err)
+	}
+	state, err := target.State()
+	if err != nil {
+		t.Fatalf("Failed to get state: %v", err)
+	}
+	wantNet, err := os.Readlink(fmt.Sprintf("/proc/%d/ns/net", state.Pid))
+	if err != nil {
+		t.Fatalf("Failed to read target network namespace: %v", err)
+	}
+
+	nsOpt, err := WithNamespacesFromPid(state.Pid, specs.NetworkNamespace)
+	if err != nil {
+		t.Fatalf("WithNamespacesFromPid failed: %v", err)
+	}
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/readlink", "/proc/self/ns/net"),
+		nsOpt,
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	var stdout bytes.Buffer
+	result, err := rc.RunWithIO("test-ns-joiner", spec, &IOConfig{Stdout: &stdout})
+	if err != nil {
+		t.Fatalf("Failed to run container: %v", err)
+	}
+	defer result.Container.Delete(true)
+	if exitCode, err := result.Wait(); err != nil || exitCode != 0 {
+		t.Fatalf("Wait() = %d, %v; want 0, nil", exitCode, err)
+	}
+
+	if got := strings.TrimSpace(stdout.String()); got != wantNet {
+		t.Errorf("Network namespace = %q, want %q", got, wantNet)
+	}
+}
+
+func TestIntegration_KillWait(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/sleep", "300"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	ctr, err := rc.Create("test-kill-wait", spec, CreateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create container: %v", err)
+	}
+	defer ctr.Delete(true)
+
+	if err := ctr.Start(); err != nil {
+		t.Fatalf("Failed to start container: %v", err)
+	}
+
+	// SIGCONT does not terminate the process: the wait times out
+	exited, err := ctr.KillWait(SIGCONT, 200*time.Millisecond)
+	if err != nil {
+		t.Fatalf("KillWait(SIGCONT) failed: %v", err)
+	}
+	if exited {
+		t.Error("KillWait(SIGCONT) = true, want false")
+	}
+
+	exited, err = ctr.KillWait(SIGKILL, 2*time.Second)
+	if err != nil {
+		t.Fatalf("KillWait(SIGKILL) failed: %v", err)
+	}
+	if !exited {
+		t.Error("KillWait(SIGKILL) = false, want true")
+	}
+	if running, err := ctr.IsRunning(); err != nil || running {
+		t.Errorf("IsRunning() after KillWait = %v, %v; want false", running, err)
+	}
+}
+
+func TestIntegration_Stop(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/sh", "-c", "trap '' TERM; while true; do sleep 1; done"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	ctr, err := rc.Create("test-stop", spec, CreateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create container: %v", err)
+	}
+	defer ctr.Delete(true)
+
+	if err := ctr.Start(); err != nil {
+		t.Fatalf("Failed to start container: %v", err)
+	}
+
+	start := time.Now()
+	if err := ctr.Stop(200 * time.Millisecond); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond || elapsed > 5*time.Second {
+		t.Errorf("Stop took %v, want SIGKILL escalation shortly after 200ms", elapsed)
+	}
+
+	state, err := ctr.State()
+	if err != nil {
+		t.Fatalf("Failed to get state: %v", err)
+	}
+	if state.Status != StatusStopped {
+		t.Errorf("Status = %q, want %q", state.Status, StatusStopped)
+	}
+
+	// Stopping an already stopped container is a no-op
+	if err := ctr.Stop(time.Second); err != nil {
+		t.Errorf("Stop on stopped container failed: %v", err)
+	}
+}
+
+func TestIntegration_ContainerWait(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/sleep", "0.1"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	ctr, err := rc.Create("test-container-wait", spec, CreateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create container: %v", err)
+	}
+	defer ctr.Delete(true)
+
+	start := time.Now()
+	if err := ctr.Start(); err != nil {
+		t.Fatalf("Failed to start container: %v", err)
+	}
+	if err := ctr.Wait(); err != nil {
+		t.Fatalf("Failed to wait for container: %v", err)
+	}
+	elapsed := time.Since(start)
+
+	if running, err := ctr.IsRunning(); err != nil || running {
+		t.Errorf("Expected container to have exited after Wait, running=%v err=%v", running, err)
+	}
+	// Only a lower bound, as a loaded machine can be arbitrarily slow
+	if elapsed < 100*time.Millisecond {
+		t.Errorf("Wait returned %v after start, before the 100ms sleep ended", elapsed)
+	}
+
+	// Waiting on a stopped container returns immediately
+	start = time.Now()
+	if err := ctr.Wait(); err != nil {
+		t.Fatalf("Failed to wait for stopped container: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Wait on a stopped container took %v", elapsed)
+	}
+}
+
+func TestIntegration_ContainerExitCode(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/sh", "-c", "sleep 0.5; exit 9"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	ctr, err := rc.Create("test-container-exit-code", spec, CreateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create container: %v", err)
+	}
+	defer ctr.Delete(true)
+
+	if err := ctr.Start(); err != nil {
+		t.Fatalf("Failed to start container: %v", err)
+	}
+	if _, err := ctr.ExitCode(); !errors.Is(err, ErrContainerIsRunning) {
+		t.Errorf("ExitCode of a running container = %v, want ErrContainerIsRunning", err)
+	}
+	if err := ctr.Wait(); err != nil {
+		t.Fatalf("Failed to wait for container: %v", err)
+	}
+
+	// A fresh handle only has the container ID
+	code, err := rc.Get("test-container-exit-code").ExitCode()
+	if err != nil {
+		t.Fatalf("Failed to get exit code: %v", err)
+	}
+	if code != 9 {
+		t.Errorf("ExitCode = %d, want 9", code)
+	}
+}
+
+func TestIntegration_StopSignalAnnotation(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	// SIGTERM is ignored, only the configured stop signal ends the container
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/sh", "-c", "trap '' TERM; trap 'exit 0' INT; while true; do sleep 0.1; done"),
+		WithStopSignal(SIGINT),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	ctr, err := rc.Create("test-stop-signal", spec, CreateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create container: %v", err)
+	}
+	defer ctr.Delete(true)
+
+	if err := ctr.Start(); err != nil {
+		t.Fatalf("Failed to start container: %v", err)
+	}
+	// Give the shell time to install its traps
+	time.Sleep(200 * time.Millisecond)
+
+	start := time.Now()
+	if err := ctr.Stop(30 * time.Second); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Errorf("Stop took %v, want the stop signal to end the container before the timeout", elapsed)
+	}
+
+	state, err := ctr.State()
+	if err != nil {
+		t.Fatalf("Failed to get state: %v", err)
+	}
+	if state.Status != StatusStopped {
+		t.Errorf("Status = %q, want %q", state.Status, StatusStopped)
+	}
+}
+
+func TestIntegration_StateAnnotations(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/sleep", "300"),
+		WithAnnotation("k", "v"),
+		WithAnnotations(map[string]string{"owner": "tests", "purpose": "state"}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	ctr, err := rc.Create("test-state-annotations", spec, CreateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create container: %v", err)
+	}
+	defer ctr.Delete(true)
+
+	want := map[string]string{"k": "v", "owner": "tests", "purpose": "state"}
+	check := func(when string) {
+		t.Helper()
+		state, err := ctr.State()
+		if err != nil {
+			t.Fatalf("Failed to get state: %v", err)
+		}
+		for k, v := range want {
+			if got := state.Annotations[k]; got != v {
+				t.Errorf("%s: Annotations[%q] = %q, want %q (all: %v)", when, k, got, v, state.Annotations)
+			}
+		}
+	}
+	check("created")
+
+	if err := ctr.Start(); err != nil {
+		t.Fatalf("Failed to start container: %v", err)
+	}
+	check("running")
+}
+
+func TestIntegration_StopPaused(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/sh", "-c", "while true; do sleep 0.1; done"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	ctr, err := rc.Create("test-stop-paused", spec, CreateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create container: %v", err)
+	}
+	defer ctr.Delete(true)
+
+	if err := ctr.Start(); err != nil {
+		t.Fatalf("Failed to start container: %v", err)
+	}
+	if err := ctr.Pause(); err != nil {
+		t.Fatalf("Failed to pause container: %v", err)
+	}
+
+	if err := ctr.Stop(5 * time.Second); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+
+	state, err := ctr.State()
+	if err != nil {
+		t.Fatalf("Failed to get state: %v", err)
+	}
+	if state.Status != StatusStopped {
+		t.Errorf("Status = %q, want %q", state.Status, StatusStopped)
+	}
+}
+
+func TestIntegration_StopAlreadyStopped(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/true"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	result, err := rc.RunWithIO("test-stop-stopped", spec, &IOConfig{})
+	if err != nil {
+		t.Fatalf("Failed to run container: %v", err)
+	}
+	defer result.Container.Delete(true)
+
+	if _, err := result.Wait(); err != nil {
+		t.Fatalf("Failed to wait for container: %v", err)
+	}
+
+	if err := result.Container.Stop(time.Second); err != nil {
+		t.Errorf("Stop on stopped container failed: %v", err)
+	}
+	state, err := result.Container.State()
+	if err != nil {
+		t.Fatalf("Failed to get state: %v", err)
+	}
+	if state.Status != StatusStopped {
+		t.Errorf("Status = %q, want %q", state.Status, StatusStopped)
+	}
+}
+
+func TestIntegration_ContainerSpec(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithHostname("spec-lookup"),
+		WithArgs("/bin/sleep", "300"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	ctr, err := rc.Create("test-spec", spec, CreateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create container: %v", err)
+	}
+	defer ctr.Delete(true)
+
+	// Look the container up by ID only
+	sp, err := rc.Get("test-spec").Spec()
+	if err != nil {
+		t.Fatalf("Spec failed: %v", err)
+	}
+	if sp.Hostname != "spec-lookup" {
+		t.Errorf("Hostname = %q, want %q", sp.Hostname, "spec-lookup")
+	}
+
+	if _, err := rc.Get("nonexistent-container").Spec(); !errors.Is(err, ErrContainerNotFound) {
+		t.Errorf("Expected ErrContainerNotFound, got %v", err)
+	}
+}
+
+func TestIntegration_RootfsPath(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/sleep", "300"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	ctr, err := rc.Create("test-rootfs-path", spec, CreateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create container: %v", err)
+	}
+	defer ctr.Delete(true)
+
+	got, err := ctr.RootfsPath()
+	if err != nil {
+		t.Fatalf("RootfsPath failed: %v", err)
+	}
+	if got != filepath.Clean(rootfs) {
+		t.Errorf("RootfsPath() = %q, want %q", got, rootfs)
+	}
+	if _, err := os.Stat(filepath.Join(got, "bin/sh")); err != nil {
+		t.Errorf("bin/sh not found in the rootfs: %v", err)
+	}
+
+	if _, err := rc.Get("nonexistent-container").RootfsPath(); !errors.Is(err, ErrContainerNotFound) {
+		t.Errorf("Expected ErrContainerNotFound, got %v", err)
+	}
+}
+
+func TestIntegration_SetLogHandlerDuringRuns(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+	defer SetLogHandler(nil)
+
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/true"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	stop := make(chan struct{})
+	swapped := make(chan struct{})
+	go func() {
+		defer close(swapped)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if i%2 == 0 {
+				SetLogHandler(func(LogEntry) {})
+			} else {
+				SetLogHandler(nil)
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			id := fmt.Sprintf("test-loghandler-%d", i)
+			result, err := rc.RunWithIO(id, spec, nil)
+			if err != nil {
+				t.Errorf("RunWithIO %s failed: %v", id, err)
+				return
+			}
+			defer result.Container.Delete(true)
+			if _, err := result.Wait(); err != nil {
+				t.Errorf("Wait %s failed: %v", id, err)
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(stop)
+	<-swapped
+}
+
+func TestIntegration_EventsOOMKill(t *testing.T) {
+	skipIfNotRoot(t)
+	if !isCgroupV2() {
+		t.Skip("cgroup v2 not available")
+	}
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	limit := int64(16 * 1024 * 1024)
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithMemoryLimit(limit),
+		// Disallow swap so exceeding the limit triggers the OOM killer
+		func(sp *specs.Spec) { sp.Linux.Resources.Memory.Swap = &limit },
+		// tail buffers /dev/zero forever since it never sees a newline
+		WithArgs("/bin/sh", "-c", "tail /dev/zero; sleep 300"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	ctr, err := rc.Create("test-events-oom", spec, CreateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create container: %v", err)
+	}
+	defer ctr.Delete(true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	events, err := ctr.Events(ctx)
+	if err != nil {
+		t.Fatalf("Events failed: %v", err)
+	}
+
+	if err := ctr.Start(); err != nil {
+		t.Fatalf("Failed to start container: %v", err)
+	}
+
+	for e := range events {
+		if e.Type == EventOOMKill {
+			return
+		}
+	}
+	t.Fatal("Event channel closed without an OOMKill event")
+}
+
+func TestIntegration_NetworkDevicesMoveBack(t *testing.T) {
+	skipIfNotRoot(t)
+	for _, tool := range []string{"ip", "nsenter"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			t.Skipf("%s not available", tool)
+		}
+	}
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	const dev = "lcgodummy0"
+	if out, err := exec.Command("ip", "link", "add", dev, "type", "dummy").CombinedOutput(); err != nil {
+		t.Skipf("Cannot create dummy interface: %v: %s", err, out)
+	}
+	t.Cleanup(func() { exec.Command("ip", "link", "del", dev).Run() })
+
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithNetworkDevice(dev, "data0"),
+		WithNetworkDevicesMoveBack(),
+		WithArgs("/bin/sh", "-c", "test -e /sys/class/net/data0"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	result, err := rc.RunWithIO("test-netdev-moveback", spec, &IOConfig{})
+	if err != nil {
+		t.Fatalf("Failed to run container: %v", err)
+	}
+	exitCode, err := result.Wait()
+	if err != nil {
+		t.Fatalf("Failed to wait for container: %v", err)
+	}
+	if exitCode != 0 {
+		t.Errorf("Interface not visible in the container, exit code %d", exitCode)
+	}
+
+	// The poststop hook runs on delete
+	if err := result.Container.Delete(true); err != nil {
+		t.Fatalf("Failed to delete container: %v", err)
+	}
+	if out, err := exec.Command("ip", "link", "show", "dev", dev).CombinedOutput(); err != nil {
+		t.Errorf("Interface not returned to the host: %v: %s", err, out)
+	}
+
+	// A create failing after the namespace was pinned releases it
+	sp, err := DefaultSpec(false)
+	if err != nil {
+		t.Fatalf("Failed to get default spec: %v", err)
+	}
+	WithRootPath(rootfs)(sp)
+	WithContainerTTY(false)(sp)
+	WithNetworkDevice(dev, "data0")(sp)
+	WithNetworkDevicesMoveBack()(sp)
+	WithArgs("/bin/true")(sp)
+	sp.Hooks.CreateRuntime = append(sp.Hooks.CreateRuntime, specs.Hook{Path: "/bin/false"})
+	failing, err := NewContainerSpec(sp)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer failing.Close()
+
+	if _, err := rc.Create("test-netdev-moveback-fail", failing, CreateOptions{}); err == nil {
+		t.Fatal("Expected create with a failing createRuntime hook to fail")
+	}
+	if _, err := os.Stat(filepath.Join(netnsPinDir, "test-netdev-moveback-fail")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Network namespace still pinned after failed create: %v", err)
+	}
+	if out, err := exec.Command("ip", "link", "show", "dev", dev).CombinedOutput(); err != nil {
+		t.Errorf("Interface not returned to the host after failed create: %v: %s", err, out)
+	}
+}
+
+func TestIntegration_DeleteTwice(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/sleep", "300"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	ctr, err := rc.Create("test-delete-twice", spec, CreateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create container: %v", err)
+	}
+
+	if err := ctr.Delete(true); err != nil {
+		t.Fatalf("Failed to delete container: %v", err)
+	}
+	if err := ctr.Delete(true); err != nil {
+		t.Errorf("Expected second force delete to succeed, got %v", err)
+	}
+	if err := ctr.Delete(false); err == nil {
+		t.Error("Expected non-force delete of a deleted container to fail")
+	}
+}
+
+func TestIntegration_ContainerNotFound(t *testing.T) {
+	skipIfNotRoot(t)
+	rc := testRuntimeContext(t)
+
+	ctr := rc.Get("nonexistent-container")
+	_, err := ctr.State()
+
+	if err == nil {
+		t.Fatal("Expected error for nonexistent container")
+	}
+
+	if !errors.Is(err, ErrContainerNotFound) {
+		t.Errorf("Expected ErrContainerNotFound, got %v", err)
+	}
+}
+
+func TestIntegration_ExecNotRunning(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/sleep", "300"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	ctr, err := rc.Create("test-exec-not-running", spec, CreateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create container: %v", err)
+	}
+	defer ctr.Delete(true)
+
+	proc := &specs.Process{Args: []string{"/bin/true"}, Cwd: "/"}
+	if err := ctr.Exec(proc); !errors.Is(err, ErrNotRunning) {
+		t.Errorf("Exec on created container = %v, want ErrNotRunning", err)
+	}
+
+	if err := ctr.Start(); err != nil {
+		t.Fatalf("Failed to start container: %v", err)
+	}
+	if err := ctr.Pause(); err != nil {
+		t.Fatalf("Failed to pause container: %v", err)
+	}
+	defer ctr.Unpause()
+	if err := ctr.Exec(proc); !errors.Is(err, ErrContainerPaused) {
+		t.Errorf("Exec on paused container = %v, want ErrContainerPaused", err)
+	}
+}
+
+func TestIntegration_ExecStream(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/sleep", "300"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	ctr, err := rc.Create("test-exec-stream", spec, CreateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create container: %v", err)
+	}
+	defer ctr.Delete(true)
+
+	if err := ctr.Start(); err != nil {
+		t.Fatalf("Failed to start container: %v", err)
+	}
+
+	// The marker lets us find the exec'd shell in /proc after cancellation
+	const marker = "exec-stream-marker"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	stdout, stderr, wait, err := ctr.ExecStream(ctx, &specs.Process{
+		Args: []string{"/bin/sh", "-c", "i=0; while true; do echo line-$i; i=$((i+1)); sleep 0.1; done # " + marker},
+		Cwd:  "/",
+		Env:  []string{"PATH=/bin:/usr/bin"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to exec: %v", err)
+	}
+	defer stdout.Close()
+	defer stderr.Close()
+	go io.Copy(io.Discard, stderr)
+
+	scanner := bufio.NewScanner(stdout)
+	for i := 0; i < 3; i++ {
+		if !scanner.Scan() {
+			t.Fatalf("Expected line %d, got EOF (err: %v)", i, scanner.Err())
+		}
+		if got, want := scanner.Text(), fmt.Sprintf("line-%d", i); got != want {
+			t.Errorf("line %d = %q, want %q", i, got, want)
+		}
+	}
+
+	cancel()
+	go io.Copy(io.Discard, stdout)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := wait()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("wait() error = %v, want context.Canceled", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Timeout waiting for cancelled exec to exit")
+	}
+
+	// The exec'd process must be gone
+	entries, err := os.ReadDir("/proc")
+	if err != nil {
+		t.Fatalf("Failed to read /proc: %v", err)
+	}
+	for _, entry := range entries {
+		if _, err := strconv.Atoi(entry.Name()); err != nil {
+			continue
+		}
+		cmdline, err := os.ReadFile(filepath.Join("/proc", entry.Name(), "cmdline"))
+		if err == nil && bytes.Contains(cmdline, []byte(marker)) {
+			t.Errorf("Exec process %s still running after cancel", entry.Name())
+		}
+	}
+
+	// wait can be called again and returns the same result
+	if _, err := wait(); !errors.Is(err, context.Canceled) {
+		t.Errorf("Second wait() error = %v, want context.Canceled", err)
+	}
+
+	// A process that exited before ctx was cancelled reports its own status
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	stdout, stderr, wait, err = ctr.ExecStream(ctx2, &specs.Process{
+		Args: []string{"/bin/sh", "-c", "exit 3"},
+		Cwd:  "/",
+		Env:  []string{"PATH=/bin:/usr/bin"},
+	})
+	if err != nil {
+		cancel2()
+		t.Fatalf("Failed to exec: %v", err)
+	}
+	io.Copy(io.Discard, stdout)
+	io.Copy(io.Discard, stderr)
+	stdout.Close()
+	stderr.Close()
+	time.Sleep(100 * time.Millisecond)
+	cancel2()
+	if exitCode, err := wait(); err != nil || exitCode != 3 {
+		t.Errorf("wait() after exit and cancel = (%d, %v), want (3, nil)", exitCode, err)
+	}
+}
+
+func TestIntegration_ExecCmd(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/sleep", "300"),
+		WithEnv("PATH", "/bin:/usr/bin"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	ctr, err := rc.Create("test-exec-cmd", spec, CreateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create container: %v", err)
+	}
+	defer ctr.Delete(true)
+
+	if err := ctr.Start(); err != nil {
+		t.Fatalf("Failed to start container: %v", err)
+	}
+
+	out, err := ctr.ExecCmd("echo", "hi").Output()
+	if err != nil {
+		t.Fatalf("Failed to exec: %v", err)
+	}
+	if string(out) != "hi\n" {
+		t.Errorf("Output() = %q, want %q", out, "hi\n")
+	}
+
+	out, err = ctr.ExecCmd("/bin/sh", "-c", "echo $GREETING").With(WithExecEnv("GREETING", "hello")).Output()
+	if err != nil {
+		t.Fatalf("Failed to exec with env: %v", err)
+	}
+	if string(out) != "hello\n" {
+		t.Errorf("Output() with WithExecEnv = %q, want %q", out, "hello\n")
+	}
+
+	_, err = ctr.ExecCmd("/bin/sh", "-c", "echo oops >&2; exit 3").Output()
+	var exitErr *ExitError
+	if !errors.As(err, &exitErr) {
+		t.Fatalf("Output() error = %v, want *ExitError", err)
+	}
+	if exitErr.ExitCode != 3 || string(exitErr.Stderr) != "oops\n" {
+		t.Errorf("ExitError = {%d, %q}, want {3, %q}", exitErr.ExitCode, exitErr.Stderr, "oops\n")
+	}
+
+	// Output leaves the builder as is, so it can be run again
+	cmd := ctr.ExecCmd("echo", "again")
+	for i := 0; i < 2; i++ {
+		if out, err := cmd.Output(); err != nil || string(out) != "again\n" {
+			t.Errorf("Output() #%d = (%q, %v), want %q", i+1, out, err, "again\n")
+		}
+	}
+	if cmd.Stdout != nil || cmd.Stderr != nil {
+		t.Error("Output() should not set the builder's Stdout or Stderr")
+	}
+}
+
+func TestIntegration_WaitReady(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/sh", "-c", "sleep 0.5; touch /tmp/ready; sleep 300"),
+		WithEnv("PATH", "/bin:/usr/bin"),
+		// The rootfs is read-only
+		WithMount("tmpfs", "/tmp", "tmpfs", []string{"nosuid", "nodev", "mode=1777"}),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	ctr, err := rc.Create("test-wait-ready", spec, CreateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create container: %v", err)
+	}
+	defer ctr.Delete(true)
+
+	if err := ctr.Start(); err != nil {
+		t.Fatalf("Failed to start container: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := ctr.WaitReady(ctx, []string{"test", "-f", "/tmp/ready"}, 100*time.Millisecond); err != nil {
+		t.Fatalf("WaitReady failed: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("WaitReady took %v, want about 1s", elapsed)
+	}
+
+	// A probe that never succeeds runs until ctx is done
+	ctx, cancel = context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if err := ctr.WaitReady(ctx, []string{"false"}, 100*time.Millisecond); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("WaitReady with a failing probe = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestIntegration_UpdateResources(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/sleep", "300"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	ctr, err := rc.Create("test-update", spec, CreateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create container: %v", err)
+	}
+	defer ctr.Delete(true)
+
+	if err := ctr.Start(); err != nil {
+		t.Fatalf("Failed to start container: %v", err)
+	}
+
+	// Update memory limit
+	memLimit := int64(256 * 1024 * 1024)
+	err = ctr.UpdateResources(&specs.LinuxResources{
+		Memory: &specs.LinuxMemory{
+			Limit: &memLimit,
+		},
+	})
+	if err != nil {
+		t.Errorf("Failed to update resources: %v", err)
+	}
+
+	if err := ctr.UpdateResourcesJSON(`{"memory":{"limit":134217728}}`); err != nil {
+		t.Errorf("Failed to update resources from JSON: %v", err)
+	}
+	if err := ctr.UpdateResourcesJSON(`{"memory":`); err == nil {
+		t.Error("Expected error for malformed resources JSON")
+	}
+}
+
+func TestIntegration_Update(t *testing.T) {
+	skipIfNotRoot(t)
+	if !isCgroupV2() {
+		t.Skip("Test requires a cgroup v2 host")
+	}
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/sleep", "300"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	ctr, err := rc.Create("test-update-options", spec, CreateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create container: %v", err)
+	}
+	defer ctr.Delete(true)
+
+	if err := ctr.Start(); err != nil {
+		t.Fatalf("Failed to start container: %v", err)
+	}
+
+	const memLimit = 128 * 1024 * 1024
+	if err := ctr.Update(WithMemoryLimit(memLimit), WithCPUShares(256)); err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	res, err := ctr.EffectiveResources()
+	if err != nil {
+		t.Fatalf("EffectiveResources failed: %v", err)
+	}
+	if res.Memory == nil || res.Memory.Limit == nil || *res.Memory.Limit != memLimit {
+		t.Errorf("Memory = %+v, want limit %d", res.Memory, memLimit)
+	}
+	// Shares are stored as cpu.weight, which does not round trip exactly
+	if want := strconv.FormatUint(cpuSharesToWeight(256), 10); res.Unified["cpu.weight"] != want {
+		t.Errorf("cpu.weight = %q, want %s", res.Unified["cpu.weight"], want)
+	}
+	if res.CPU == nil || res.CPU.Shares == nil || *res.CPU.Shares != cpuWeightToShares(cpuSharesToWeight(256)) {
+		t.Errorf("CPU = %+v, want shares converted back from the weight of 256", res.CPU)
+	}
+}
+
+func TestIntegration_UpdateV2(t *testing.T) {
 	skipIfNotRoot(t)
+	if !isCgroupV2() {
+		t.Skip("Test requires a cgroup v2 host")
+	}
 	rootfs := testRootfs(t)
 	rc := testRuntimeContext(t)
 
-	// Initially empty
-	containers, err := rc.List()
-	if err != nil {
-		t.Fatalf("Failed to list containers: %v", err)
-	}
-	if len(containers) != 0 {
-		t.Errorf("Expected 0 containers, got %d", len(containers))
-	}
-
-	// Create a container
 	spec, err := NewSpec(false,
 		WithRootPath(rootfs),
 		WithContainerTTY(false),
-		WithArgs("/bin/sleep", "30"),
+		WithArgs("/bin/sleep", "300"),
 	)
 	if err != nil {
 		t.Fatalf("Failed to create spec: %v", err)
 	}
 	defer spec.Close()
 
-	ctr, err := rc.Create("test-list", spec, CreateOptions{})
+	ctr, err := rc.Create("test-update-v2", spec, CreateOptions{})
 	if err != nil {
 		t.Fatalf("Failed to create container: %v", err)
 	}
 	defer ctr.Delete(true)
 
-	// Should have one container now
-	containers, err = rc.List()
+	if err := ctr.Start(); err != nil {
+		t.Fatalf("Failed to start container: %v", err)
+	}
+
+	cgroupPath, err := rc.containerCgroupPath(ctr.ID)
 	if err != nil {
-		t.Fatalf("Failed to list containers: %v", err)
+		t.Fatalf("Failed to read cgroup path: %v", err)
 	}
-	if len(containers) != 1 {
-		t.Errorf("Expected 1 container, got %d", len(containers))
+	if cgroupPath == "" {
+		t.Skip("Container has no cgroup in this environment")
 	}
-	if containers[0].ID != "test-list" {
-		t.Errorf("Container ID = %q, want test-list", containers[0].ID)
+
+	memHigh := int64(64 * 1024 * 1024)
+	if err := ctr.UpdateV2(Cgroupv2Update{MemoryHigh: memHigh}); err != nil {
+		t.Fatalf("Failed to update resources: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(cgroupRoot, cgroupPath, "memory.high"))
+	if err != nil {
+		t.Fatalf("Failed to read memory.high: %v", err)
+	}
+	if got := strings.TrimSpace(string(data)); got != strconv.FormatInt(memHigh, 10) {
+		t.Errorf("memory.high = %q, want %d", got, memHigh)
 	}
 }
 
-func TestIntegration_Kill(t *testing.T) {
+func TestIntegration_UpdateCPUSet(t *testing.T) {
 	skipIfNotRoot(t)
+	if !isCgroupV2() {
+		t.Skip("Test requires a cgroup v2 host")
+	}
+	if runtime.NumCPU() < 2 {
+		t.Skip("Test requires at least 2 CPUs")
+	}
 	rootfs := testRootfs(t)
 	rc := testRuntimeContext(t)
 
@@ -207,13 +2391,17 @@ func TestIntegration_Kill(t *testing.T) {
 		WithRootPath(rootfs),
 		WithContainerTTY(false),
 		WithArgs("/bin/sleep", "300"),
+		func(sp *specs.Spec) {
+			ensureLinuxResources(sp)
+			sp.Linux.Resources.CPU = &specs.LinuxCPU{Cpus: "0"}
+		},
 	)
 	if err != nil {
 		t.Fatalf("Failed to create spec: %v", err)
 	}
 	defer spec.Close()
 
-	ctr, err := rc.Create("test-kill", spec, CreateOptions{})
+	ctr, err := rc.Create("test-update-cpuset", spec, CreateOptions{})
 	if err != nil {
 		t.Fatalf("Failed to create container: %v", err)
 	}
@@ -223,38 +2411,32 @@ func TestIntegration_Kill(t *testing.T) {
 		t.Fatalf("Failed to start container: %v", err)
 	}
 
-	// Container should be running
-	running, err := ctr.IsRunning()
+	cgroupPath, err := rc.containerCgroupPath(ctr.ID)
 	if err != nil {
-		t.Fatalf("Failed to check if running: %v", err)
+		t.Fatalf("Failed to read cgroup path: %v", err)
 	}
-	if !running {
-		t.Error("Container should be running")
+	if cgroupPath == "" {
+		t.Skip("Container has no cgroup in this environment")
 	}
-
-	// Kill it
-	if err := ctr.Kill(SIGTERM); err != nil {
-		t.Fatalf("Failed to kill container: %v", err)
+	cpusFile := filepath.Join(cgroupRoot, cgroupPath, "cpuset.cpus")
+	if _, err := os.Stat(cpusFile); os.IsNotExist(err) {
+		t.Skip("cpuset controller not enabled for the container cgroup")
 	}
-}
-
-func TestIntegration_ContainerNotFound(t *testing.T) {
-	skipIfNotRoot(t)
-	rc := testRuntimeContext(t)
-
-	ctr := rc.Get("nonexistent-container")
-	_, err := ctr.State()
 
-	if err == nil {
-		t.Fatal("Expected error for nonexistent container")
+	if err := ctr.UpdateCPUSet("0-1", ""); err != nil {
+		t.Fatalf("Failed to update cpuset: %v", err)
 	}
 
-	if !errors.Is(err, ErrContainerNotFound) {
-		t.Errorf("Expected ErrContainerNotFound, got %v", err)
+	data, err := os.ReadFile(cpusFile)
+	if err != nil {
+		t.Fatalf("Failed to read cpuset.cpus: %v", err)
+	}
+	if got := strings.TrimSpace(string(data)); got != "0-1" {
+		t.Errorf("cpuset.cpus = %q, want %q", got, "0-1")
 	}
 }
 
-func TestIntegration_UpdateResources(t *testing.T) {
+func TestIntegration_PauseUnpause(t *testing.T) {
 	skipIfNotRoot(t)
 	rootfs := testRootfs(t)
 	rc := testRuntimeContext(t)
@@ -269,7 +2451,7 @@ func TestIntegration_UpdateResources(t *testing.T) {
 	}
 	defer spec.Close()
 
-	ctr, err := rc.Create("test-update", spec, CreateOptions{})
+	ctr, err := rc.Create("test-pause", spec, CreateOptions{})
 	if err != nil {
 		t.Fatalf("Failed to create container: %v", err)
 	}
@@ -279,20 +2461,38 @@ func TestIntegration_UpdateResources(t *testing.T) {
 		t.Fatalf("Failed to start container: %v", err)
 	}
 
-	// Update memory limit
-	memLimit := int64(256 * 1024 * 1024)
-	err = ctr.UpdateResources(&specs.LinuxResources{
-		Memory: &specs.LinuxMemory{
-			Limit: &memLimit,
-		},
-	})
+	// Pause
+	if err := ctr.Pause(); err != nil {
+		t.Fatalf("Failed to pause container: %v", err)
+	}
+
+	state, err := ctr.State()
 	if err != nil {
-		t.Errorf("Failed to update resources: %v", err)
+		t.Fatalf("Failed to get state: %v", err)
+	}
+	if state.Status != StatusPaused {
+		t.Errorf("Status = %q, want %q", state.Status, StatusPaused)
+	}
+
+	// Unpause
+	if err := ctr.Unpause(); err != nil {
+		t.Fatalf("Failed to unpause container: %v", err)
+	}
+
+	state, err = ctr.State()
+	if err != nil {
+		t.Fatalf("Failed to get state: %v", err)
+	}
+	if state.Status != StatusRunning {
+		t.Errorf("Status = %q, want %q", state.Status, StatusRunning)
 	}
 }
 
-func TestIntegration_PauseUnpause(t *testing.T) {
+func TestIntegration_PauseUnpauseCgroupV2(t *testing.T) {
 	skipIfNotRoot(t)
+	if !isCgroupV2() {
+		t.Skip("Test requires a cgroup v2 host")
+	}
 	rootfs := testRootfs(t)
 	rc := testRuntimeContext(t)
 
@@ -306,7 +2506,7 @@ func TestIntegration_PauseUnpause(t *testing.T) {
 	}
 	defer spec.Close()
 
-	ctr, err := rc.Create("test-pause", spec, CreateOptions{})
+	ctr, err := rc.Create("test-pause-v2", spec, CreateOptions{})
 	if err != nil {
 		t.Fatalf("Failed to create container: %v", err)
 	}
@@ -316,7 +2516,14 @@ func TestIntegration_PauseUnpause(t *testing.T) {
 		t.Fatalf("Failed to start container: %v", err)
 	}
 
-	// Pause
+	cgroupPath, err := rc.containerCgroupPath(ctr.ID)
+	if err != nil {
+		t.Fatalf("Failed to read cgroup path: %v", err)
+	}
+	if cgroupPath == "" {
+		t.Skip("Container has no cgroup in this environment")
+	}
+
 	if err := ctr.Pause(); err != nil {
 		t.Fatalf("Failed to pause container: %v", err)
 	}
@@ -328,8 +2535,14 @@ func TestIntegration_PauseUnpause(t *testing.T) {
 	if state.Status != StatusPaused {
 		t.Errorf("Status = %q, want %q", state.Status, StatusPaused)
 	}
+	frozen, err := readCgroupFrozen(filepath.Join(cgroupRoot, cgroupPath))
+	if err != nil {
+		t.Fatalf("Failed to read cgroup.events: %v", err)
+	}
+	if !frozen {
+		t.Error("cgroup.events should report frozen 1 after Pause")
+	}
 
-	// Unpause
 	if err := ctr.Unpause(); err != nil {
 		t.Fatalf("Failed to unpause container: %v", err)
 	}
@@ -420,6 +2633,130 @@ func TestIntegration_PIDs(t *testing.T) {
 	}
 }
 
+func TestIntegration_CgroupPath(t *testing.T) {
+	skipIfNotRoot(t)
+	if !isCgroupV2() {
+		t.Skip("Skipping: cgroup v2 not available")
+	}
+	rootfs := testRootfs(t)
+
+	rc, err := NewRuntimeContext(RuntimeConfig{
+		Bundle:        t.TempDir(),
+		StateRoot:     t.TempDir(),
+		SystemdCgroup: true,
+	})
+	if err != nil {
+		t.Fatalf("Failed to create RuntimeContext: %v", err)
+	}
+	defer rc.Close()
+
+	spec, err := NewSpec(false,
+		WithRootPath(rootfs),
+		WithContainerTTY(false),
+		WithArgs("/bin/sleep", "300"),
+	)
+	if err != nil {
+		t.Fatalf("Failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	ctr, err := rc.Create("test-cgroup-path", spec, CreateOptions{})
+	if err != nil {
+		t.Fatalf("Failed to create container: %v", err)
+	}
+	defer ctr.Delete(true)
+
+	if err := ctr.Start(); err != nil {
+		t.Fatalf("Failed to start container: %v", err)
+	}
+
+	path, err := ctr.CgroupPath()
+	if err != nil {
+		t.Fatalf("Failed to get cgroup path: %v", err)
+	}
+	if !strings.HasPrefix(path, "/sys/fs/cgroup/") {
+		t.Errorf("Expected path under /sys/fs/cgroup, got %q", path)
+	}
+	if fi, err := os.Stat(path); err != nil || !fi.IsDir() {
+		t.Fatalf("Expected cgroup directory at %q: %v", path, err)
+	}
+
+	state, err := ctr.State()
+	if err != nil {
+		t.Fatalf("Failed to get state: %v", err)
+	}
+	procs, err := os.ReadFile(filepath.Join(path, "cgroup.procs"))
+	if err != nil {
+		t.Fatalf("Failed to read cgroup.procs: %v", err)
+	}
+	if !slices.Contains(strings.Fields(string(procs)), strconv.Itoa(state.Pid)) {
+		t.Errorf("Init PID %d not in %s/cgroup.procs: %q", state.Pid, path, procs)
+	}
+}
+
+func TestIntegration_CgroupParent(t *testing.T) {
+	skipIfNotRoot(t)
+	if !isCgroupV2() {
+		t.Skip("Skipping: cgroup v2 not available")
+	}
+	rootfs := testRootfs(t)
+
+	tests := []struct {
+		name    string
+		systemd bool
+		parent  string
+		suffix  string
+	}{
+		{name: "systemd", systemd: true, parent: "libcrun_go_test.slice", suffix: "/libcrun_go_test.slice/crungo-test-cgroup-parent.scope"},
+		{name: "cgroupfs", parent: "libcrun-go-test", suffix: "/libcrun-go-test/test-cgroup-parent"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc, err := NewRuntimeContext(RuntimeConfig{
+				Bundle:        t.TempDir(),
+				StateRoot:     t.TempDir(),
+				SystemdCgroup: tt.systemd,
+			})
+			if err != nil {
+				t.Fatalf("Failed to create RuntimeContext: %v", err)
+			}
+			defer rc.Close()
+
+			spec, err := NewSpec(false,
+				WithRootPath(rootfs),
+				WithContainerTTY(false),
+				WithArgs("/bin/sleep", "300"),
+			)
+			if err != nil {
+				t.Fatalf("Failed to create spec: %v", err)
+			}
+			defer spec.Close()
+			spec.SetCgroupParent(tt.parent)
+
+			ctr, err := rc.Create("test-cgroup-parent", spec, CreateOptions{})
+			if err != nil {
+				t.Fatalf("Failed to create container: %v", err)
+			}
+			defer ctr.Delete(true)
+
+			if err := ctr.Start(); err != nil {
+				t.Fatalf("Failed to start container: %v", err)
+			}
+
+			path, err := ctr.CgroupPath()
+			if err != nil {
+				t.Fatalf("Failed to get cgroup path: %v", err)
+			}
+			if !strings.HasSuffix(path, tt.suffix) {
+				t.Errorf("Expected cgroup path ending in %q, got %q", tt.suffix, path)
+			}
+			if fi, err := os.Stat(path); err != nil || !fi.IsDir() {
+				t.Errorf("Expected cgroup directory at %q: %v", path, err)
+			}
+		})
+	}
+}
+
 func TestIntegration_SpecOptions(t *testing.T) {
 	skipIfNotRoot(t)
 	rootfs := testRootfs(t)
@@ -539,6 +2876,120 @@ func TestIntegration_ParallelContainers(t *testing.T) {
 	}
 }
 
+func TestIntegration_RunBatch(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	const numJobs = 20
+	jobs := make([]BatchJob, numJobs)
+	outputs := make([]bytes.Buffer, numJobs)
+	for i := range jobs {
+		spec, err := NewSpec(false,
+			WithRootPath(rootfs),
+			WithContainerTTY(false),
+			WithArgs("/bin/sh", "-c", fmt.Sprintf("echo %d; exit %d", i, i%3)),
+		)
+		if err != nil {
+			t.Fatalf("Failed to create spec: %v", err)
+		}
+		defer spec.Close()
+		jobs[i] = BatchJob{
+			ID:   fmt.Sprintf("test-batch-%d", i),
+			Spec: spec,
+			IO:   &IOConfig{Stdout: &outputs[i]},
+		}
+	}
+
+	results := rc.RunBatch(jobs, 4)
+	if len(results) != numJobs {
+		t.Fatalf("RunBatch returned %d results, want %d", len(results), numJobs)
+	}
+	for i, res := range results {
+		if res.ID != jobs[i].ID {
+			t.Errorf("Result %d ID = %q, want %q", i, res.ID, jobs[i].ID)
+		}
+		if res.Err != nil {
+			t.Errorf("Job %d failed: %v", i, res.Err)
+			continue
+		}
+		if res.ExitCode != i%3 {
+			t.Errorf("Job %d exit code = %d, want %d", i, res.ExitCode, i%3)
+		}
+		if got := strings.TrimSpace(outputs[i].String()); got != strconv.Itoa(i) {
+			t.Errorf("Job %d output = %q, want %q", i, got, strconv.Itoa(i))
+		}
+	}
+
+	// Containers are deleted once done
+	if ids, err := rc.ListIDs(); err != nil || len(ids) != 0 {
+		t.Errorf("ListIDs() after RunBatch = %v, %v; want no containers", ids, err)
+	}
+}
+
+func TestIntegration_SharedReadonlyRootfs(t *testing.T) {
+	skipIfNotRoot(t)
+	rootfs := testRootfs(t)
+	rc := testRuntimeContext(t)
+
+	const numContainers = 2
+	var wg sync.WaitGroup
+	errChan := make(chan error, numContainers)
+
+	for i := 0; i < numContainers; i++ {
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+
+			// Writes to the shared root must fail, writes to the tmpfs must succeed
+			spec, err := NewSpec(false,
+				WithSharedRootfs(rootfs),
+				WithContainerTTY(false),
+				WithMount("tmpfs", "/tmp", "tmpfs", []string{"nosuid", "nodev", "mode=1777"}),
+				WithArgs("/bin/sh", "-c", fmt.Sprintf(
+					"touch /shared-%d 2>/dev/null && exit 10; echo container-%d > /tmp/out && cat /tmp/out", idx, idx)),
+			)
+			if err != nil {
+				errChan <- fmt.Errorf("container %d: failed to create spec: %w", idx, err)
+				return
+			}
+			defer spec.Close()
+
+			var stdout bytes.Buffer
+			result, err := rc.RunWithIO(
+				fmt.Sprintf("test-shared-rootfs-%d", idx),
+				spec,
+				&IOConfig{Stdout: &stdout},
+			)
+			if err != nil {
+				errChan <- fmt.Errorf("container %d: failed to run: %w", idx, err)
+				return
+			}
+			defer result.Container.Delete(true)
+
+			exitCode, err := result.Wait()
+			if err != nil {
+				errChan <- fmt.Errorf("container %d: failed to wait: %w", idx, err)
+				return
+			}
+			if exitCode != 0 {
+				errChan <- fmt.Errorf("container %d: exited with %d", idx, exitCode)
+				return
+			}
+			if got, want := strings.TrimSpace(stdout.String()), fmt.Sprintf("container-%d", idx); got != want {
+				errChan <- fmt.Errorf("container %d: stdout = %q, want %q", idx, got, want)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+	close(errChan)
+
+	for err := range errChan {
+		t.Errorf("shared rootfs container error: %v", err)
+	}
+}
+
 func TestIntegration_ContainerCrash(t *testing.T) {
 	skipIfNotRoot(t)
 	rootfs := testRootfs(t)
@@ -2,7 +2,11 @@
 
 package crun
 
-import "strings"
+import (
+	"errors"
+	"strings"
+	"syscall"
+)
 
 // ErrorCode represents specific error types from libcrun operations.
 type ErrorCode int
@@ -16,6 +20,9 @@ const (
 	ErrPermissionDenied
 	ErrContainerRunning
 	ErrContainerNotRunning
+	ErrPaused
+	ErrNoSpace
+	ErrOutOfMemory
 )
 
 // Sentinel errors for errors.Is() checks.
@@ -23,8 +30,17 @@ var (
 	ErrContainerNotFound    = &Error{Code: ErrNotFound, Message: "container not found"}
 	ErrContainerExists      = &Error{Code: ErrAlreadyExists, Message: "container already exists"}
 	ErrInvalidContainerSpec = &Error{Code: ErrInvalidSpec, Message: "invalid container spec"}
+	ErrNotRunning           = &Error{Code: ErrContainerNotRunning, Message: "container is not running"}
+	ErrContainerIsRunning   = &Error{Code: ErrContainerRunning, Message: "container is running"}
+	ErrContainerPaused      = &Error{Code: ErrPaused, Message: "container is paused"}
+	ErrNoSpaceLeft          = &Error{Code: ErrNoSpace, Message: "no space left on device"}
+	ErrNoMemory             = &Error{Code: ErrOutOfMemory, Message: "cannot allocate memory"}
 )
 
+// ErrExitCodeUnavailable is returned by Container.ExitCode when the exit code
+// of a stopped container was not recorded.
+var ErrExitCodeUnavailable = errors.New("libcrun: exit code not available")
+
 // Error wraps libcrun errors with structured error codes.
 type Error struct {
 	Code    ErrorCode
@@ -37,6 +53,9 @@ func (e *Error) Error() string { return e.Message }
 
 func (e *Error) Unwrap() error { return e.cause }
 
+// Errno returns the errno reported by libcrun, or 0 if there was none.
+func (e *Error) Errno() syscall.Errno { return syscall.Errno(e.Status) }
+
 func (e *Error) Is(target error) bool {
 	if t, ok := target.(*Error); ok {
 		return e.Code == t.Code
@@ -44,20 +63,41 @@ func (e *Error) Is(target error) bool {
 	return false
 }
 
+// isNotExist reports whether err says the container does not exist. libcrun
+// reports a missing state directory as ENOENT, whatever the message.
+func isNotExist(err error) bool {
+	if errors.Is(err, ErrContainerNotFound) {
+		return true
+	}
+	var e *Error
+	return errors.As(err, &e) && e.Errno() == syscall.ENOENT
+}
+
 // classifyError attempts to determine the error code from the error message.
 func classifyError(msg string, status int) ErrorCode {
 	lower := strings.ToLower(msg)
 	switch {
+	case status == int(syscall.ENOSPC) || strings.Contains(lower, "no space left"):
+		return ErrNoSpace
+	case status == int(syscall.ENOMEM) || strings.Contains(lower, "cannot allocate memory"):
+		return ErrOutOfMemory
 	case strings.Contains(lower, "not found") || strings.Contains(lower, "does not exist"):
 		return ErrNotFound
 	case strings.Contains(lower, "already exists"):
 		return ErrAlreadyExists
+	// Negated states first, so "is not paused" is not taken for "is paused"
+	case strings.Contains(lower, "is not running") || strings.Contains(lower, "is not created") ||
+		strings.Contains(lower, "is stopped"):
+		return ErrContainerNotRunning
+	case strings.Contains(lower, "is not paused") || strings.Contains(lower, "is not frozen"):
+		// Says what state the container is not in, not which one it is in
+		return ErrUnknown
+	case strings.Contains(lower, "is paused") || strings.Contains(lower, "is frozen"):
+		return ErrPaused
 	case strings.Contains(lower, "invalid") || strings.Contains(lower, "parse"):
 		return ErrInvalidSpec
-	case strings.Contains(lower, "permission") || status == 1 || status == 13: // EPERM, EACCES
+	case strings.Contains(lower, "permission") || status == int(syscall.EPERM) || status == int(syscall.EACCES):
 		return ErrPermissionDenied
-	case strings.Contains(lower, "not running"):
-		return ErrContainerNotRunning
 	case strings.Contains(lower, "running"):
 		return ErrContainerRunning
 	default:
@@ -4,6 +4,8 @@ package crun
 
 import (
 	"errors"
+	"fmt"
+	"syscall"
 	"testing"
 )
 
@@ -19,6 +21,36 @@ func TestErrorIs(t *testing.T) {
 	}
 }
 
+func TestErrorIsStateSentinels(t *testing.T) {
+	err := &Error{Code: classifyError("the container `test` is not running", 0), Message: "not running"}
+	if !errors.Is(err, ErrNotRunning) {
+		t.Error("Expected errors.Is(err, ErrNotRunning) to be true")
+	}
+	if errors.Is(err, ErrContainerPaused) {
+		t.Error("Expected errors.Is(err, ErrContainerPaused) to be false")
+	}
+
+	err = &Error{Code: classifyError("the container `test` is paused", 0), Message: "paused"}
+	if !errors.Is(err, ErrContainerPaused) {
+		t.Error("Expected errors.Is(err, ErrContainerPaused) to be true")
+	}
+}
+
+func TestErrorIsResourceSentinels(t *testing.T) {
+	err := &Error{Code: classifyError("write state file", int(syscall.ENOSPC)), Message: "no space"}
+	if !errors.Is(err, ErrNoSpaceLeft) {
+		t.Error("Expected errors.Is(err, ErrNoSpaceLeft) to be true")
+	}
+	if errors.Is(err, ErrNoMemory) {
+		t.Error("Expected errors.Is(err, ErrNoMemory) to be false")
+	}
+
+	err = &Error{Code: classifyError("clone: Cannot allocate memory", 0), Message: "no memory"}
+	if !errors.Is(fmt.Errorf("create: %w", err), ErrNoMemory) {
+		t.Error("Expected errors.Is(wrapped err, ErrNoMemory) to be true")
+	}
+}
+
 func TestErrorUnwrap(t *testing.T) {
 	cause := errors.New("underlying error")
 	err := &Error{Code: ErrNotFound, Message: "wrapper", cause: cause}
@@ -29,6 +61,38 @@ func TestErrorUnwrap(t *testing.T) {
 	}
 }
 
+func TestErrorErrno(t *testing.T) {
+	err := &Error{Code: ErrNoSpace, Message: "no space", Status: 28}
+	if err.Errno() != syscall.ENOSPC {
+		t.Errorf("Errno() = %v, want ENOSPC", err.Errno())
+	}
+	if !errors.Is(err.Errno(), syscall.ENOSPC) {
+		t.Error("Expected errors.Is(err.Errno(), syscall.ENOSPC) to be true")
+	}
+	if got := (&Error{}).Errno(); got != 0 {
+		t.Errorf("Errno() = %v, want 0 without a status", got)
+	}
+}
+
+func TestIsNotExist(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{err: &Error{Code: ErrNotFound, Message: "container `x` does not exist"}, want: true},
+		{err: &Error{Code: ErrUnknown, Message: "error opening file `status`: No such file or directory", Status: int(syscall.ENOENT)}, want: true},
+		{err: fmt.Errorf("wrapped: %w", &Error{Code: ErrNotFound}), want: true},
+		{err: &Error{Code: ErrContainerRunning, Message: "container is running"}, want: false},
+		{err: &Error{Code: ErrPermissionDenied, Status: int(syscall.EPERM)}, want: false},
+		{err: errors.New("libcrun: invalid runtime context"), want: false},
+	}
+	for _, tt := range tests {
+		if got := isNotExist(tt.err); got != tt.want {
+			t.Errorf("isNotExist(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
 func TestClassifyError(t *testing.T) {
 	tests := []struct {
 		msg    string
@@ -45,6 +109,19 @@ func TestClassifyError(t *testing.T) {
 		{"some error", 13, ErrPermissionDenied}, // EACCES
 		{"container is running", 0, ErrContainerRunning},
 		{"container is not running", 0, ErrContainerNotRunning},
+		{"the container `test` is not running", 1, ErrContainerNotRunning},
+		{"container `test` is not created", 0, ErrContainerNotRunning},
+		{"container `test` is stopped", 0, ErrContainerNotRunning},
+		{"the container `test` is paused", 0, ErrPaused},
+		{"cgroup is frozen", 0, ErrPaused},
+		{"the container `test` is not paused", 0, ErrUnknown},
+		{"container is not paused", 0, ErrUnknown},
+		{"cgroup is not frozen", 0, ErrUnknown},
+		{"process stopped by signal", 0, ErrUnknown},
+		{"write state file", 28, ErrNoSpace}, // ENOSPC
+		{"write: No space left on device", 0, ErrNoSpace},
+		{"allocate stack", 12, ErrOutOfMemory}, // ENOMEM
+		{"clone: Cannot allocate memory", 0, ErrOutOfMemory},
 		{"unknown error", 0, ErrUnknown},
 	}
 
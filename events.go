@@ -0,0 +1,196 @@
+//go:build linux
+
+package crun
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// EventType identifies a container cgroup event.
+type EventType string
+
+// Event types reported by Container.Events.
+const (
+	EventOOMKill     EventType = "oom_kill"    // a process was killed by the OOM killer
+	EventPopulated   EventType = "populated"   // the cgroup gained its first process
+	EventUnpopulated EventType = "unpopulated" // the last process in the cgroup exited
+	EventFrozen      EventType = "frozen"      // the container was paused
+	EventThawed      EventType = "thawed"      // the container was unpaused
+)
+
+// Event is a single container cgroup event.
+type Event struct {
+	Type EventType
+	Time time.Time
+}
+
+// cgroupEventFiles are the cgroup v2 files watched for events.
+var cgroupEventFiles = []string{"cgroup.events", "memory.events"}
+
+// cgroupEventState is the last observed value of the keys events are derived from.
+type cgroupEventState struct {
+	oomKills  uint64
+	populated bool
+	frozen    bool
+}
+
+// readCgroupEventState reads the event keys from cgroup.events and memory.events
+// in dir. Missing files (e.g. memory controller disabled) are ignored.
+func readCgroupEventState(dir string) (cgroupEventState, error) {
+	var st cgroupEventState
+	for _, name := range cgroupEventFiles {
+		kv, err := readCgroupKeyValues(filepath.Join(dir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return st, err
+		}
+		if v, ok := kv["oom_kill"]; ok {
+			st.oomKills = v
+		}
+		if v, ok := kv["populated"]; ok {
+			st.populated = v == 1
+		}
+		if v, ok := kv["frozen"]; ok {
+			st.frozen = v == 1
+		}
+	}
+	return st, nil
+}
+
+// readCgroupKeyValues parses a flat-keyed cgroup file ("key value" per line).
+func readCgroupKeyValues(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	kv := make(map[string]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(scanner.Text(), " ")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.ParseUint(value, 10, 64); err == nil {
+			kv[key] = n
+		}
+	}
+	return kv, scanner.Err()
+}
+
+// diffCgroupEventState returns the events implied by moving from prev to cur.
+func diffCgroupEventState(prev, cur cgroupEventState, now time.Time) []Event {
+	var events []Event
+	for i := prev.oomKills; i < cur.oomKills; i++ {
+		events = append(events, Event{Type: EventOOMKill, Time: now})
+	}
+	if cur.populated != prev.populated {
+		t := EventUnpopulated
+		if cur.populated {
+			t = EventPopulated
+		}
+		events = append(events, Event{Type: t, Time: now})
+	}
+	if cur.frozen != prev.frozen {
+		t := EventThawed
+		if cur.frozen {
+			t = EventFrozen
+		}
+		events = append(events, Event{Type: t, Time: now})
+	}
+	return events
+}
+
+// watchCgroupEvents watches the cgroup v2 directory dir with inotify and emits
+// an Event for every change of the OOM kill counter, populated or frozen state.
+// The channel is closed when ctx is canceled or the cgroup is removed.
+func watchCgroupEvents(ctx context.Context, dir string) (<-chan Event, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	// A non-blocking fd is registered with the runtime poller, so closing the
+	// file on cancellation unblocks the reader
+	f := os.NewFile(uintptr(fd), "inotify")
+
+	watches := 0
+	for _, name := range cgroupEventFiles {
+		_, err := syscall.InotifyAddWatch(fd, filepath.Join(dir, name), syscall.IN_MODIFY|syscall.IN_DELETE_SELF)
+		if errors.Is(err, syscall.ENOENT) {
+			continue
+		}
+		if err != nil {
+			f.Close()
+			return nil, os.NewSyscallError("inotify_add_watch", err)
+		}
+		watches++
+	}
+	if watches == 0 {
+		f.Close()
+		return nil, errors.New("libcrun: no cgroup event files found in " + dir)
+	}
+
+	prev, err := readCgroupEventState(dir)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	ch := make(chan Event, 16)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+		f.Close()
+	}()
+	go func() {
+		defer close(ch)
+		defer close(done)
+		buf := make([]byte, 4096)
+		for {
+			n, err := f.Read(buf)
+			if err != nil {
+				return // canceled (file closed) or inotify failure
+			}
+			removed := false
+			for off := 0; off+syscall.SizeofInotifyEvent <= n; {
+				ev := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[off]))
+				if ev.Mask&(syscall.IN_DELETE_SELF|syscall.IN_IGNORED) != 0 {
+					removed = true
+				}
+				off += syscall.SizeofInotifyEvent + int(ev.Len)
+			}
+			if removed {
+				// The container was deleted along with its cgroup
+				return
+			}
+
+			cur, err := readCgroupEventState(dir)
+			if err == nil {
+				for _, e := range diffCgroupEventState(prev, cur, time.Now()) {
+					select {
+					case ch <- e:
+					case <-ctx.Done():
+						return
+					}
+				}
+				prev = cur
+			}
+		}
+	}()
+	return ch, nil
+}
@@ -0,0 +1,117 @@
+//go:build linux
+
+package crun
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDiffCgroupEventState(t *testing.T) {
+	now := time.Now()
+	prev := cgroupEventState{oomKills: 1, populated: true}
+	cur := cgroupEventState{oomKills: 3, populated: false, frozen: true}
+
+	var got []EventType
+	for _, e := range diffCgroupEventState(prev, cur, now) {
+		if !e.Time.Equal(now) {
+			t.Errorf("Event time = %v, want %v", e.Time, now)
+		}
+		got = append(got, e.Type)
+	}
+	want := []EventType{EventOOMKill, EventOOMKill, EventUnpopulated, EventFrozen}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+
+	if events := diffCgroupEventState(cur, cur, now); len(events) != 0 {
+		t.Errorf("unchanged state produced events: %v", events)
+	}
+}
+
+func writeCgroupFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+}
+
+func receiveEvent(t *testing.T, ch <-chan Event) Event {
+	t.Helper()
+	select {
+	case e, ok := <-ch:
+		if !ok {
+			t.Fatal("Event channel closed unexpectedly")
+		}
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for event")
+	}
+	return Event{}
+}
+
+func TestWatchCgroupEvents(t *testing.T) {
+	dir := t.TempDir()
+	writeCgroupFile(t, dir, "cgroup.events", "populated 1\nfrozen 0\n")
+	writeCgroupFile(t, dir, "memory.events", "low 0\nhigh 0\nmax 0\noom 0\noom_kill 0\n")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ch, err := watchCgroupEvents(ctx, dir)
+	if err != nil {
+		t.Fatalf("watchCgroupEvents failed: %v", err)
+	}
+
+	writeCgroupFile(t, dir, "memory.events", "low 0\nhigh 0\nmax 3\noom 1\noom_kill 1\n")
+	if e := receiveEvent(t, ch); e.Type != EventOOMKill {
+		t.Errorf("Event = %v, want %v", e.Type, EventOOMKill)
+	}
+
+	writeCgroupFile(t, dir, "cgroup.events", "populated 1\nfrozen 1\n")
+	if e := receiveEvent(t, ch); e.Type != EventFrozen {
+		t.Errorf("Event = %v, want %v", e.Type, EventFrozen)
+	}
+
+	cancel()
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Error("Expected channel to be closed after cancel")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for channel close after cancel")
+	}
+}
+
+func TestWatchCgroupEventsRemoved(t *testing.T) {
+	dir := t.TempDir()
+	writeCgroupFile(t, dir, "cgroup.events", "populated 1\nfrozen 0\n")
+
+	ch, err := watchCgroupEvents(context.Background(), dir)
+	if err != nil {
+		t.Fatalf("watchCgroupEvents failed: %v", err)
+	}
+
+	// Simulate the cgroup being removed along with the container
+	if err := os.Remove(filepath.Join(dir, "cgroup.events")); err != nil {
+		t.Fatalf("Failed to remove cgroup.events: %v", err)
+	}
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Error("Expected channel to be closed after removal")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timeout waiting for channel close after removal")
+	}
+}
+
+func TestWatchCgroupEventsMissingFiles(t *testing.T) {
+	if _, err := watchCgroupEvents(context.Background(), t.TempDir()); err == nil {
+		t.Error("watchCgroupEvents should fail without cgroup event files")
+	}
+}
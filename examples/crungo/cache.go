@@ -0,0 +1,183 @@
+//go:build linux && cgo
+
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/partial"
+	"github.com/google/go-containerregistry/pkg/v1/types"
+)
+
+// PullPolicy controls when image layers are downloaded.
+type PullPolicy string
+
+// Pull policies accepted by --pull.
+const (
+	PullAlways  PullPolicy = "always"  // download every layer, refreshing the cache
+	PullMissing PullPolicy = "missing" // download only layers not in the cache
+	PullNever   PullPolicy = "never"   // never contact the registry, use the cache only
+)
+
+// imageCache is a content-addressed cache of extracted image layers, stored
+// under layers/<digest>, and of the manifest and config of images pulled from
+// a registry, stored under images/<hash of the reference>.
+type imageCache struct {
+	dir string
+}
+
+// defaultImageCache returns the cache under $XDG_CACHE_HOME/crungo
+// (~/.cache/crungo if unset).
+func defaultImageCache() (*imageCache, error) {
+	base, err := os.UserCacheDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to locate cache directory: %w", err)
+	}
+	return &imageCache{dir: filepath.Join(base, "crungo")}, nil
+}
+
+// layerDir returns the directory a layer is extracted to.
+func (c *imageCache) layerDir(digest v1.Hash) string {
+	return filepath.Join(c.dir, "layers", digest.String())
+}
+
+// imageDir returns the directory holding the metadata of a registry image.
+func (c *imageCache) imageDir(ref string) string {
+	sum := sha256.Sum256([]byte(ref))
+	return filepath.Join(c.dir, "images", hex.EncodeToString(sum[:]))
+}
+
+// layer returns the cached directory of layer, downloading and extracting it
+// first if it is not cached or policy is PullAlways. fetched reports whether
+// the layer was downloaded.
+func (c *imageCache) layer(layer v1.Layer, policy PullPolicy) (dir string, fetched bool, err error) {
+	digest, err := layer.Digest()
+	if err != nil {
+		return "", false, fmt.Errorf("failed to get layer digest: %w", err)
+	}
+	dir = c.layerDir(digest)
+	if policy != PullAlways {
+		if _, err := os.Stat(dir); err == nil {
+			return dir, false, nil
+		}
+	}
+	if policy == PullNever {
+		return "", false, fmt.Errorf("layer %s is not cached", digest)
+	}
+
+	// Extract next to the final location and rename, so an interrupted
+	// extraction never leaves a partial layer in the cache
+	if err := os.MkdirAll(filepath.Dir(dir), 0755); err != nil {
+		return "", false, fmt.Errorf("failed to create layer cache: %w", err)
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(dir), ".extract-*")
+	if err != nil {
+		return "", false, fmt.Errorf("failed to create layer cache: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+	if err := extractLayerWithProgress(layer, tmp); err != nil {
+		return "", false, err
+	}
+	if err := os.RemoveAll(dir); err != nil {
+		return "", false, fmt.Errorf("failed to replace cached layer: %w", err)
+	}
+	if err := os.Rename(tmp, dir); err != nil {
+		return "", false, fmt.Errorf("failed to cache layer: %w", err)
+	}
+	return dir, true, nil
+}
+
+// saveImage records the manifest and config of a registry image, so it can be
+// run with PullNever without contacting the registry.
+func (c *imageCache) saveImage(ref string, img v1.Image) error {
+	manifest, err := img.RawManifest()
+	if err != nil {
+		return err
+	}
+	config, err := img.RawConfigFile()
+	if err != nil {
+		return err
+	}
+	dir := c.imageDir(ref)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "manifest.json"), manifest, 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, "config.json"), config, 0644)
+}
+
+// loadImage returns a registry image recorded by saveImage. Its layers can
+// only be used through the cache: reading their contents fails.
+func (c *imageCache) loadImage(ref string) (v1.Image, error) {
+	dir := c.imageDir(ref)
+	manifest, err := os.ReadFile(filepath.Join(dir, "manifest.json"))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("image %s is not cached", ref)
+		}
+		return nil, err
+	}
+	config, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		return nil, err
+	}
+	parsed, err := v1.ParseManifest(strings.NewReader(string(manifest)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid cached manifest for %s: %w", ref, err)
+	}
+	return partial.CompressedToImage(&cachedImage{manifest: manifest, parsed: parsed, config: config})
+}
+
+// cachedImage is an image whose manifest and config come from the cache.
+type cachedImage struct {
+	manifest []byte
+	parsed   *v1.Manifest
+	config   []byte
+}
+
+func (i *cachedImage) RawConfigFile() ([]byte, error) { return i.config, nil }
+
+func (i *cachedImage) MediaType() (types.MediaType, error) {
+	if i.parsed.MediaType != "" {
+		return i.parsed.MediaType, nil
+	}
+	return types.OCIManifestSchema1, nil
+}
+
+func (i *cachedImage) RawManifest() ([]byte, error) { return i.manifest, nil }
+
+func (i *cachedImage) LayerByDigest(h v1.Hash) (partial.CompressedLayer, error) {
+	for _, desc := range i.parsed.Layers {
+		if desc.Digest == h {
+			return &cachedLayer{desc: desc}, nil
+		}
+	}
+	return nil, fmt.Errorf("layer %s not found in manifest", h)
+}
+
+// cachedLayer describes a layer of a cachedImage. Its contents are not
+// available, only its extracted directory in the cache.
+type cachedLayer struct {
+	desc v1.Descriptor
+}
+
+func (l *cachedLayer) Digest() (v1.Hash, error) { return l.desc.Digest, nil }
+
+func (l *cachedLayer) Compressed() (io.ReadCloser, error) {
+	return nil, fmt.Errorf("layer %s is not cached", l.desc.Digest)
+}
+
+func (l *cachedLayer) Size() (int64, error) { return l.desc.Size, nil }
+
+func (l *cachedLayer) MediaType() (types.MediaType, error) { return l.desc.MediaType, nil }
@@ -0,0 +1,218 @@
+//go:build linux && cgo
+
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+// countingLayer counts the downloads of a layer.
+type countingLayer struct {
+	v1.Layer
+	fetches *int
+}
+
+func (l *countingLayer) Compressed() (io.ReadCloser, error) {
+	*l.fetches++
+	return l.Layer.Compressed()
+}
+
+func (l *countingLayer) Uncompressed() (io.ReadCloser, error) {
+	*l.fetches++
+	return l.Layer.Uncompressed()
+}
+
+// countingImage is an image whose layers count their downloads.
+type countingImage struct {
+	v1.Image
+	fetches int
+}
+
+func (i *countingImage) Layers() ([]v1.Layer, error) {
+	layers, err := i.Image.Layers()
+	if err != nil {
+		return nil, err
+	}
+	for n, l := range layers {
+		layers[n] = &countingLayer{Layer: l, fetches: &i.fetches}
+	}
+	return layers, nil
+}
+
+// tarLayer builds a layer from name/content pairs.
+func tarLayer(t *testing.T, files ...string) v1.Layer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for i := 0; i < len(files); i += 2 {
+		content := []byte(files[i+1])
+		if err := tw.WriteHeader(&tar.Header{Name: files[i], Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatalf("failed to write tar header: %v", err)
+		}
+		if _, err := tw.Write(content); err != nil {
+			t.Fatalf("failed to write tar content: %v", err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("failed to close tar: %v", err)
+	}
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	})
+	if err != nil {
+		t.Fatalf("failed to create layer: %v", err)
+	}
+	return layer
+}
+
+func TestExtractImageUsesLayerCache(t *testing.T) {
+	img := &countingImage{Image: testImage(t)}
+	cache := &imageCache{dir: t.TempDir()}
+
+	first := t.TempDir()
+	if err := extractImage(img, first, cache, PullMissing); err != nil {
+		t.Fatalf("extractImage() error = %v", err)
+	}
+	if img.fetches != 1 {
+		t.Fatalf("fetches after first pull = %d, want 1", img.fetches)
+	}
+
+	second := t.TempDir()
+	if err := extractImage(img, second, cache, PullMissing); err != nil {
+		t.Fatalf("extractImage() error = %v", err)
+	}
+	if img.fetches != 1 {
+		t.Errorf("fetches after second pull = %d, want 1 (layer should come from the cache)", img.fetches)
+	}
+	content, err := os.ReadFile(filepath.Join(second, "hello.txt"))
+	if err != nil || string(content) != "hello from layer\n" {
+		t.Errorf("hello.txt = %q, %v, want the layer content", content, err)
+	}
+
+	if err := extractImage(img, t.TempDir(), cache, PullAlways); err != nil {
+		t.Fatalf("extractImage(always) error = %v", err)
+	}
+	if img.fetches != 2 {
+		t.Errorf("fetches after --pull=always = %d, want 2", img.fetches)
+	}
+
+	if err := extractImage(img, t.TempDir(), &imageCache{dir: t.TempDir()}, PullNever); err == nil {
+		t.Error("extractImage(never) with an empty cache should fail")
+	}
+}
+
+func TestExtractImageAppliesWhiteouts(t *testing.T) {
+	img, err := mutate.AppendLayers(empty.Image,
+		tarLayer(t, "keep.txt", "keep", "gone.txt", "gone", "dir/old.txt", "old"),
+		tarLayer(t, ".wh.gone.txt", "", "dir/.wh..wh..opq", "", "dir/new.txt", "new"),
+	)
+	if err != nil {
+		t.Fatalf("failed to build image: %v", err)
+	}
+
+	rootfs := t.TempDir()
+	if err := extractImage(img, rootfs, &imageCache{dir: t.TempDir()}, PullMissing); err != nil {
+		t.Fatalf("extractImage() error = %v", err)
+	}
+
+	for path, want := range map[string]bool{
+		"keep.txt":         true,
+		"gone.txt":         false,
+		"dir/old.txt":      false,
+		"dir/new.txt":      true,
+		".wh.gone.txt":     false,
+		"dir/.wh..wh..opq": false,
+	} {
+		_, err := os.Lstat(filepath.Join(rootfs, path))
+		if exists := err == nil; exists != want {
+			t.Errorf("%s exists = %v, want %v", path, exists, want)
+		}
+	}
+}
+
+func TestImageCacheNeverPull(t *testing.T) {
+	img := testImage(t)
+	cache := &imageCache{dir: t.TempDir()}
+	const ref = "registry.example.com/crungo/fixture:latest"
+
+	if _, err := cache.loadImage(ref); err == nil {
+		t.Fatal("loadImage() of an image never pulled should fail")
+	}
+
+	if err := cache.saveImage(ref, img); err != nil {
+		t.Fatalf("saveImage() error = %v", err)
+	}
+	if err := extractImage(img, t.TempDir(), cache, PullMissing); err != nil {
+		t.Fatalf("extractImage() error = %v", err)
+	}
+
+	cached, err := cache.loadImage(ref)
+	if err != nil {
+		t.Fatalf("loadImage() error = %v", err)
+	}
+	cfg, err := cached.ConfigFile()
+	if err != nil {
+		t.Fatalf("ConfigFile() error = %v", err)
+	}
+	if len(cfg.Config.Cmd) == 0 || cfg.Config.Cmd[0] != "/bin/cat" {
+		t.Errorf("cached Config.Cmd = %v, want the image command", cfg.Config.Cmd)
+	}
+
+	rootfs := t.TempDir()
+	if err := extractImage(cached, rootfs, cache, PullNever); err != nil {
+		t.Fatalf("extractImage(never) error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(rootfs, "hello.txt")); err != nil {
+		t.Errorf("hello.txt missing from rootfs built from the cache: %v", err)
+	}
+}
+
+func TestExtractImageSymlinkEscape(t *testing.T) {
+	hostDir := t.TempDir()
+	hostFile := filepath.Join(hostDir, "passwd")
+	if err := os.WriteFile(hostFile, []byte("host"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first layer plants a symlink to the host, the second writes through it
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{Name: "etc", Typeflag: tar.TypeSymlink, Linkname: hostDir, Mode: 0777}); err != nil {
+		t.Fatalf("failed to write tar header: %v", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("failed to close tar: %v", err)
+	}
+	symlinkLayer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	})
+	if err != nil {
+		t.Fatalf("failed to create layer: %v", err)
+	}
+	img, err := mutate.AppendLayers(empty.Image, symlinkLayer, tarLayer(t, "etc/passwd", "pwned"))
+	if err != nil {
+		t.Fatalf("failed to build image: %v", err)
+	}
+
+	rootfs := t.TempDir()
+	if err := extractImage(img, rootfs, &imageCache{dir: t.TempDir()}, PullMissing); err != nil {
+		t.Fatalf("extractImage() error = %v", err)
+	}
+	if content, err := os.ReadFile(hostFile); err != nil || string(content) != "host" {
+		t.Errorf("host file = %q, %v, want it untouched", content, err)
+	}
+	// The directory of the upper layer replaces the symlink, as with ApplyLayerDir
+	if content, err := os.ReadFile(filepath.Join(rootfs, "etc", "passwd")); err != nil || string(content) != "pwned" {
+		t.Errorf("etc/passwd = %q, %v, want it written inside the rootfs", content, err)
+	}
+}
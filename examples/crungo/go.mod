@@ -2,12 +2,17 @@ module github.com/danielealbano/libcrun-go/examples/crungo
 
 go 1.25
 
-replace github.com/danielealbano/libcrun-go => ../..
+replace (
+	github.com/danielealbano/libcrun-go => ../..
+	github.com/danielealbano/libcrun-go/image => ../../image
+)
 
 require (
 	github.com/danielealbano/libcrun-go v0.0.0-00010101000000-000000000000
+	github.com/danielealbano/libcrun-go/image v0.0.0-00010101000000-000000000000
 	github.com/google/go-containerregistry v0.20.7
 	github.com/spf13/cobra v1.10.2
+	golang.org/x/term v0.38.0
 )
 
 require (
@@ -20,11 +25,10 @@ require (
 	github.com/mitchellh/go-homedir v1.1.0 // indirect
 	github.com/opencontainers/go-digest v1.0.0 // indirect
 	github.com/opencontainers/image-spec v1.1.1 // indirect
-	github.com/opencontainers/runtime-spec v1.2.0 // indirect
+	github.com/opencontainers/runtime-spec v1.3.0 // indirect
 	github.com/sirupsen/logrus v1.9.3 // indirect
 	github.com/spf13/pflag v1.0.9 // indirect
 	github.com/vbatts/tar-split v0.12.2 // indirect
 	golang.org/x/sync v0.18.0 // indirect
 	golang.org/x/sys v0.39.0 // indirect
-	golang.org/x/term v0.38.0 // indirect
 )
@@ -0,0 +1,184 @@
+//go:build linux && cgo
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	crun "github.com/danielealbano/libcrun-go"
+)
+
+// HealthStatus is the health of a container with a health check.
+type HealthStatus string
+
+// Health statuses, as reported by Docker and Podman.
+const (
+	HealthStarting  HealthStatus = "starting"  // no check has completed yet
+	HealthHealthy   HealthStatus = "healthy"   // the last check passed
+	HealthUnhealthy HealthStatus = "unhealthy" // the last retries checks failed
+)
+
+// HealthAnnotation holds the last health status of a running container.
+const HealthAnnotation = "io.github.danielealbano.crungo.health"
+
+// healthState tracks consecutive health check failures.
+type healthState struct {
+	retries  int
+	failures int
+	status   HealthStatus
+}
+
+func newHealthState(retries int) *healthState {
+	return &healthState{retries: max(retries, 1), status: HealthStarting}
+}
+
+// record records the result of a check and reports whether the status changed.
+// The container becomes healthy on the first passing check and unhealthy once
+// retries checks in a row have failed.
+func (h *healthState) record(passed bool) bool {
+	prev := h.status
+	if passed {
+		h.failures = 0
+		h.status = HealthHealthy
+	} else {
+		h.failures++
+		if h.failures >= h.retries {
+			h.status = HealthUnhealthy
+		}
+	}
+	return h.status != prev
+}
+
+// monitorHealth runs check every interval until ctx is done, and calls changed
+// with the new status and the last check error on every transition. A check
+// is given up to interval to complete.
+func monitorHealth(ctx context.Context, interval time.Duration, retries int, check func(context.Context) error, changed func(HealthStatus, error)) {
+	state := newHealthState(retries)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		checkCtx, cancel := context.WithTimeout(ctx, interval)
+		err := check(checkCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return
+		}
+		if state.record(err == nil) {
+			changed(state.status, err)
+		}
+	}
+}
+
+// healthCheck returns a check running cmd with /bin/sh -c inside ctr, with
+// the environment and user of the container process.
+func healthCheck(ctr *crun.Container, cmd string) (func(context.Context) error, error) {
+	sp, err := ctr.Spec()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read container spec: %w", err)
+	}
+	if sp.Process == nil {
+		return nil, fmt.Errorf("container %s has no process", ctr.ID)
+	}
+	proc := *sp.Process
+	proc.Args = []string{"/bin/sh", "-c", cmd}
+	proc.Terminal = false
+	proc.ConsoleSize = nil
+
+	return func(ctx context.Context) error {
+		stdout, stderr, wait, err := ctr.ExecStream(ctx, &proc)
+		if err != nil {
+			return err
+		}
+		defer stdout.Close()
+		defer stderr.Close()
+		go io.Copy(io.Discard, stderr)
+		io.Copy(io.Discard, stdout)
+
+		exitCode, err := wait()
+		if err != nil {
+			return err
+		}
+		if exitCode != 0 {
+			return fmt.Errorf("health check exited with code %d", exitCode)
+		}
+		return nil
+	}, nil
+}
+
+// startHealthMonitor checks the health of ctr with cmd until the returned
+// function is called, printing transitions to stderr and recording the status
+// in the HealthAnnotation of the container's configuration in stateDir.
+func startHealthMonitor(ctr *crun.Container, stateDir, cmd string, interval time.Duration, retries int) (stop func(), err error) {
+	check, err := healthCheck(ctr, cmd)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		monitorHealth(ctx, interval, retries, check, func(status HealthStatus, err error) {
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Container %s is %s: %v\n", ctr.ID, status, err)
+			} else {
+				fmt.Fprintf(os.Stderr, "Container %s is %s\n", ctr.ID, status)
+			}
+			if err := setHealthAnnotation(filepath.Join(stateDir, ctr.ID), status); err != nil {
+				fmt.Fprintf(os.Stderr, "Warning: failed to record health status: %v\n", err)
+			}
+		})
+	}()
+	return func() {
+		cancel()
+		wg.Wait()
+	}, nil
+}
+
+// setHealthAnnotation sets HealthAnnotation in the config.json libcrun keeps
+// in the container state directory, which State and Spec report annotations
+// from. The file is replaced atomically so readers never see a partial write.
+func setHealthAnnotation(ctrStateDir string, status HealthStatus) error {
+	path := filepath.Join(ctrStateDir, "config.json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	// Decode loosely to preserve fields the spec types may not know about
+	var config map[string]any
+	if err := json.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	annotations, _ := config["annotations"].(map[string]any)
+	if annotations == nil {
+		annotations = make(map[string]any)
+	}
+	annotations[HealthAnnotation] = string(status)
+	config["annotations"] = annotations
+
+	data, err = json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,145 @@
+//go:build linux && cgo
+
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHealthStateRecord(t *testing.T) {
+	h := newHealthState(3)
+	if h.status != HealthStarting {
+		t.Fatalf("expected initial status %q, got %q", HealthStarting, h.status)
+	}
+
+	steps := []struct {
+		passed  bool
+		status  HealthStatus
+		changed bool
+	}{
+		{passed: false, status: HealthStarting, changed: false},
+		{passed: true, status: HealthHealthy, changed: true},
+		{passed: false, status: HealthHealthy, changed: false},
+		{passed: false, status: HealthHealthy, changed: false},
+		{passed: false, status: HealthUnhealthy, changed: true},
+		{passed: false, status: HealthUnhealthy, changed: false},
+		{passed: true, status: HealthHealthy, changed: true},
+		{passed: true, status: HealthHealthy, changed: false},
+	}
+	for i, step := range steps {
+		changed := h.record(step.passed)
+		if h.status != step.status || changed != step.changed {
+			t.Errorf("step %d: record(%v) = status %q, changed %v; want %q, %v",
+				i, step.passed, h.status, changed, step.status, step.changed)
+		}
+	}
+}
+
+func TestHealthStateStartingToUnhealthy(t *testing.T) {
+	h := newHealthState(2)
+	h.record(false)
+	if changed := h.record(false); !changed || h.status != HealthUnhealthy {
+		t.Errorf("expected unhealthy after 2 failures, got %q (changed %v)", h.status, changed)
+	}
+}
+
+func TestMonitorHealth(t *testing.T) {
+	// Pass once, fail twice, then pass again
+	results := []bool{true, false, false, true}
+	var mu sync.Mutex
+	var checks []time.Time
+	check := func(ctx context.Context) error {
+		mu.Lock()
+		defer mu.Unlock()
+		checks = append(checks, time.Now())
+		i := len(checks) - 1
+		if i >= len(results) || results[i] {
+			return nil
+		}
+		return errors.New("check failed")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	transitions := make(chan HealthStatus, 10)
+	const interval = 20 * time.Millisecond
+	start := time.Now()
+	done := make(chan struct{})
+	go func() {
+		monitorHealth(ctx, interval, 2, check, func(status HealthStatus, err error) {
+			if (status == HealthUnhealthy) != (err != nil) {
+				t.Errorf("status %q reported with error %v", status, err)
+			}
+			transitions <- status
+		})
+		close(done)
+	}()
+
+	var got []HealthStatus
+	for len(got) < 3 {
+		select {
+		case s := <-transitions:
+			got = append(got, s)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timed out waiting for transitions, got %v", got)
+		}
+	}
+	cancel()
+	<-done
+
+	want := []HealthStatus{HealthHealthy, HealthUnhealthy, HealthHealthy}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("transitions = %v, want %v", got, want)
+			break
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if first := checks[0].Sub(start); first < interval {
+		t.Errorf("first check ran after %v, expected at least one interval (%v)", first, interval)
+	}
+	for i := 1; i < len(checks); i++ {
+		if gap := checks[i].Sub(checks[i-1]); gap < interval/2 {
+			t.Errorf("checks %d and %d ran %v apart, expected about %v", i-1, i, gap, interval)
+		}
+	}
+}
+
+func TestSetHealthAnnotation(t *testing.T) {
+	dir := t.TempDir()
+	config := `{"ociVersion":"1.0.0","annotations":{"keep":"me"},"x-unknown":1}`
+	if err := os.WriteFile(filepath.Join(dir, "config.json"), []byte(config), 0600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+
+	if err := setHealthAnnotation(dir, HealthUnhealthy); err != nil {
+		t.Fatalf("failed to set health annotation: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		t.Fatalf("failed to read config: %v", err)
+	}
+	var got struct {
+		Annotations map[string]string `json:"annotations"`
+		Unknown     int               `json:"x-unknown"`
+	}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatalf("failed to parse config: %v", err)
+	}
+	if got.Annotations[HealthAnnotation] != string(HealthUnhealthy) {
+		t.Errorf("expected health annotation %q, got %q", HealthUnhealthy, got.Annotations[HealthAnnotation])
+	}
+	if got.Annotations["keep"] != "me" || got.Unknown != 1 {
+		t.Errorf("expected other fields to be preserved, got %s", data)
+	}
+}
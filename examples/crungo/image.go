@@ -3,27 +3,23 @@
 package main
 
 import (
-	"archive/tar"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
 
+	"github.com/danielealbano/libcrun-go/image"
 	"github.com/google/go-containerregistry/pkg/authn"
 	"github.com/google/go-containerregistry/pkg/name"
 	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
 	"github.com/google/go-containerregistry/pkg/v1/remote"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
 )
 
 // ImageConfig holds the extracted configuration from an OCI image.
-type ImageConfig struct {
-	Entrypoint []string
-	Cmd        []string
-	Env        []string
-	WorkingDir string
-	User       string
-}
+type ImageConfig = image.ImageConfig
 
 // PulledImage represents a pulled and extracted image.
 type PulledImage struct {
@@ -45,35 +41,42 @@ func formatBytes(bytes int64) string {
 	return fmt.Sprintf("%.1f %cB", float64(bytes)/float64(div), "KMGTPE"[exp])
 }
 
-// PullAndExtract pulls an OCI image and extracts it to a temporary directory.
+// Transport prefixes selecting a local image source instead of a registry.
+const (
+	ociLayoutPrefix     = "oci:"            // OCI image layout directory
+	ociArchivePrefix    = "oci-archive:"    // tarball of an OCI image layout
+	dockerArchivePrefix = "docker-archive:" // tarball written by `docker save`
+)
+
+// PullAndExtract pulls an OCI image and extracts it to a temporary directory,
+// downloading only the layers missing from the layer cache.
+// imageRef is a registry reference, or a local image prefixed with "oci:",
+// "oci-archive:" or "docker-archive:" followed by its path.
 // The caller is responsible for cleaning up the returned rootfs path.
 func PullAndExtract(imageRef string) (*PulledImage, error) {
-	// Parse the image reference
-	ref, err := name.ParseReference(imageRef)
-	if err != nil {
-		return nil, fmt.Errorf("invalid image reference %q: %w", imageRef, err)
-	}
-
-	fmt.Printf("Pulling image: %s\n", ref.Name())
+	return PullAndExtractWithPolicy(imageRef, PullMissing)
+}
 
-	// Pull the image using default keychain (reads ~/.docker/config.json)
-	img, err := remote.Image(ref, remote.WithAuthFromKeychain(authn.DefaultKeychain))
+// PullAndExtractWithPolicy is like PullAndExtract, with policy controlling
+// when layers are downloaded instead of taken from the layer cache.
+func PullAndExtractWithPolicy(imageRef string, policy PullPolicy) (*PulledImage, error) {
+	cache, err := defaultImageCache()
 	if err != nil {
-		return nil, fmt.Errorf("failed to pull image: %w", err)
+		return nil, err
 	}
+	return pullAndExtract(imageRef, cache, policy)
+}
 
-	// Get image config
-	configFile, err := img.ConfigFile()
+func pullAndExtract(imageRef string, cache *imageCache, policy PullPolicy) (*PulledImage, error) {
+	img, cleanup, err := loadImage(imageRef, cache, policy)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get image config: %w", err)
+		return nil, err
 	}
+	defer cleanup()
 
-	config := ImageConfig{
-		Entrypoint: configFile.Config.Entrypoint,
-		Cmd:        configFile.Config.Cmd,
-		Env:        configFile.Config.Env,
-		WorkingDir: configFile.Config.WorkingDir,
-		User:       configFile.Config.User,
+	config, err := image.ReadConfig(img)
+	if err != nil {
+		return nil, err
 	}
 
 	// Create temporary directory for rootfs
@@ -84,7 +87,7 @@ func PullAndExtract(imageRef string) (*PulledImage, error) {
 
 	// Extract layers with progress
 	fmt.Printf("Extracting to: %s\n", rootfs)
-	if err := extractImage(img, rootfs); err != nil {
+	if err := extractImage(img, rootfs, cache, policy); err != nil {
 		os.RemoveAll(rootfs)
 		return nil, fmt.Errorf("failed to extract image: %w", err)
 	}
@@ -102,164 +105,178 @@ func PullAndExtract(imageRef string) (*PulledImage, error) {
 	}, nil
 }
 
-// extractImage extracts all layers of an image to the target directory.
-func extractImage(img v1.Image, targetDir string) error {
-	layers, err := img.Layers()
-	if err != nil {
-		return fmt.Errorf("failed to get layers: %w", err)
-	}
-
-	totalLayers := len(layers)
-	fmt.Printf("Downloading and extracting %d layers:\n", totalLayers)
-
-	for i, layer := range layers {
-		layerNum := i + 1
-
-		// Get layer size for progress
-		size, _ := layer.Size()
-
-		fmt.Printf("  [%d/%d] Downloading %s... ", layerNum, totalLayers, formatBytes(size))
-
-		if err := extractLayerWithProgress(layer, targetDir, layerNum, totalLayers); err != nil {
-			fmt.Println("✗")
-			return fmt.Errorf("failed to extract layer %d: %w", layerNum, err)
+// loadImage resolves imageRef to an image, from the registry (or the cache,
+// with PullNever) or from a local OCI layout or archive. cleanup releases
+// temporary files backing the image and must be called once the image is no
+// longer used.
+func loadImage(imageRef string, cache *imageCache, policy PullPolicy) (img v1.Image, cleanup func(), err error) {
+	cleanup = func() {}
+
+	switch {
+	case strings.HasPrefix(imageRef, ociLayoutPrefix):
+		path := strings.TrimPrefix(imageRef, ociLayoutPrefix)
+		fmt.Printf("Loading OCI layout: %s\n", path)
+		img, err = imageFromLayout(path)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load OCI layout %q: %w", path, err)
 		}
-	}
-
-	return nil
-}
 
-// extractLayerWithProgress extracts a single layer with progress indication.
-func extractLayerWithProgress(layer v1.Layer, targetDir string, layerNum, totalLayers int) error {
-	reader, err := layer.Uncompressed()
-	if err != nil {
-		return fmt.Errorf("failed to get uncompressed layer: %w", err)
-	}
-	defer reader.Close()
-
-	tr := tar.NewReader(reader)
-
-	fileCount := 0
-	for {
-		header, err := tr.Next()
-		if err == io.EOF {
-			break
+	case strings.HasPrefix(imageRef, ociArchivePrefix):
+		path := strings.TrimPrefix(imageRef, ociArchivePrefix)
+		fmt.Printf("Loading OCI archive: %s\n", path)
+		dir, err := os.MkdirTemp("", "crungo-oci-*")
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create temp directory: %w", err)
 		}
+		cleanup = func() { os.RemoveAll(dir) }
+		if err := extractArchive(path, dir); err != nil {
+			cleanup()
+			return nil, nil, fmt.Errorf("failed to extract OCI archive %q: %w", path, err)
+		}
+		img, err = imageFromLayout(dir)
 		if err != nil {
-			return fmt.Errorf("failed to read tar entry: %w", err)
+			cleanup()
+			return nil, nil, fmt.Errorf("failed to load OCI archive %q: %w", path, err)
 		}
 
-		fileCount++
+	case strings.HasPrefix(imageRef, dockerArchivePrefix):
+		path := strings.TrimPrefix(imageRef, dockerArchivePrefix)
+		fmt.Printf("Loading docker archive: %s\n", path)
+		img, err = tarball.ImageFromPath(path, nil)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to load docker archive %q: %w", path, err)
+		}
 
-		// Handle whiteout files (deletions in overlay filesystem)
-		baseName := filepath.Base(header.Name)
-		if strings.HasPrefix(baseName, ".wh.") {
-			// This is a whiteout marker - delete the corresponding file
-			targetName := strings.TrimPrefix(baseName, ".wh.")
-			targetPath := filepath.Join(targetDir, filepath.Dir(header.Name), targetName)
-			os.RemoveAll(targetPath)
-			continue
+	default:
+		// Parse the image reference
+		ref, err := name.ParseReference(imageRef)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid image reference %q: %w", imageRef, err)
 		}
 
-		// Clean the path to prevent path traversal
-		cleanPath := filepath.Clean(header.Name)
-		if strings.HasPrefix(cleanPath, "..") {
-			continue // Skip paths that try to escape
+		if policy == PullNever {
+			fmt.Printf("Using cached image: %s\n", ref.Name())
+			img, err = cache.loadImage(ref.Name())
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to load image with --pull=never: %w", err)
+			}
+			break
 		}
 
-		targetPath := filepath.Join(targetDir, cleanPath)
+		fmt.Printf("Pulling image: %s\n", ref.Name())
 
-		switch header.Typeflag {
-		case tar.TypeDir:
-			if err := os.MkdirAll(targetPath, os.FileMode(header.Mode)); err != nil {
-				return fmt.Errorf("failed to create directory %s: %w", targetPath, err)
-			}
+		// Pull the image using default keychain (reads ~/.docker/config.json)
+		img, err = remote.Image(ref, remote.WithAuthFromKeychain(authn.DefaultKeychain))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to pull image: %w", err)
+		}
+		if err := cache.saveImage(ref.Name(), img); err != nil {
+			return nil, nil, fmt.Errorf("failed to cache image: %w", err)
+		}
+	}
 
-		case tar.TypeReg:
-			// Ensure parent directory exists
-			if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
-				return fmt.Errorf("failed to create parent directory for %s: %w", targetPath, err)
-			}
+	return img, cleanup, nil
+}
 
-			// Remove existing file if it exists (layers can overwrite)
-			os.Remove(targetPath)
+// imageFromLayout loads the image of an OCI layout directory. For multi-platform
+// layouts the image matching the host architecture is used.
+func imageFromLayout(path string) (v1.Image, error) {
+	idx, err := layout.ImageIndexFromPath(path)
+	if err != nil {
+		return nil, err
+	}
+	return imageFromIndex(idx)
+}
 
-			file, err := os.OpenFile(targetPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(header.Mode))
+// imageFromIndex returns the first image of idx for linux on the host
+// architecture (or without a platform), descending into nested indexes.
+func imageFromIndex(idx v1.ImageIndex) (v1.Image, error) {
+	manifest, err := idx.IndexManifest()
+	if err != nil {
+		return nil, err
+	}
+	for _, desc := range manifest.Manifests {
+		if p := desc.Platform; p != nil && (p.OS != "linux" || p.Architecture != runtime.GOARCH) {
+			continue
+		}
+		switch {
+		case desc.MediaType.IsImage():
+			return idx.Image(desc.Digest)
+		case desc.MediaType.IsIndex():
+			child, err := idx.ImageIndex(desc.Digest)
 			if err != nil {
-				return fmt.Errorf("failed to create file %s: %w", targetPath, err)
-			}
-
-			if _, err := io.Copy(file, tr); err != nil {
-				file.Close()
-				return fmt.Errorf("failed to write file %s: %w", targetPath, err)
+				return nil, err
 			}
-			file.Close()
-
-		case tar.TypeSymlink:
-			// Ensure parent directory exists
-			if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
-				return fmt.Errorf("failed to create parent directory for symlink %s: %w", targetPath, err)
+			if img, err := imageFromIndex(child); err == nil {
+				return img, nil
 			}
+		}
+	}
+	return nil, fmt.Errorf("no image for linux/%s in index", runtime.GOARCH)
+}
 
-			// Remove existing file/symlink if it exists
-			os.Remove(targetPath)
+// extractArchive extracts the tar archive at path to targetDir.
+func extractArchive(path, targetDir string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = image.ApplyLayer(f, targetDir)
+	return err
+}
 
-			if err := os.Symlink(header.Linkname, targetPath); err != nil {
-				return fmt.Errorf("failed to create symlink %s -> %s: %w", targetPath, header.Linkname, err)
-			}
+// extractImage composes the rootfs of an image in the target directory from
+// its layers, downloading and extracting to the cache the ones policy requires.
+func extractImage(img v1.Image, targetDir string, cache *imageCache, policy PullPolicy) error {
+	layers, err := img.Layers()
+	if err != nil {
+		return fmt.Errorf("failed to get layers: %w", err)
+	}
 
-		case tar.TypeLink:
-			// Ensure parent directory exists
-			if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
-				return fmt.Errorf("failed to create parent directory for hardlink %s: %w", targetPath, err)
-			}
+	totalLayers := len(layers)
+	fmt.Printf("Downloading and extracting %d layers:\n", totalLayers)
 
-			// Remove existing file if it exists
-			os.Remove(targetPath)
+	for i, layer := range layers {
+		layerNum := i + 1
 
-			linkTarget := filepath.Join(targetDir, header.Linkname)
-			if err := os.Link(linkTarget, targetPath); err != nil {
-				// If hard link fails, try copying the file
-				if copyErr := copyFile(linkTarget, targetPath); copyErr != nil {
-					return fmt.Errorf("failed to create hardlink %s -> %s: %w (copy also failed: %v)", targetPath, linkTarget, err, copyErr)
-				}
-			}
+		// Get layer size for progress
+		size, _ := layer.Size()
 
-		case tar.TypeChar, tar.TypeBlock:
-			// Skip device nodes - we can't create them without root and they're rarely needed
-			continue
+		fmt.Printf("  [%d/%d] %s... ", layerNum, totalLayers, formatBytes(size))
 
-		case tar.TypeFifo:
-			// Skip FIFOs
-			continue
+		dir, fetched, err := cache.layer(layer, policy)
+		if err != nil {
+			fmt.Println("✗")
+			return fmt.Errorf("failed to extract layer %d: %w", layerNum, err)
+		}
+		if !fetched {
+			fmt.Println("cached ✓")
+		}
+		if err := image.ApplyLayerDir(dir, targetDir); err != nil {
+			return fmt.Errorf("failed to apply layer %d: %w", layerNum, err)
 		}
 	}
 
-	fmt.Printf("extracted %d files ✓\n", fileCount)
 	return nil
 }
 
-// copyFile copies a file from src to dst.
-func copyFile(src, dst string) error {
-	srcFile, err := os.Open(src)
-	if err != nil {
-		return err
-	}
-	defer srcFile.Close()
-
-	srcInfo, err := srcFile.Stat()
+// extractLayerWithProgress downloads a single layer and extracts it, keeping
+// its whiteout markers, with progress indication.
+func extractLayerWithProgress(layer v1.Layer, targetDir string) error {
+	reader, err := layer.Uncompressed()
 	if err != nil {
-		return err
+		return fmt.Errorf("failed to get uncompressed layer: %w", err)
 	}
+	defer reader.Close()
 
-	dstFile, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, srcInfo.Mode())
+	fileCount, err := image.ExtractLayer(reader, targetDir)
 	if err != nil {
 		return err
 	}
-	defer dstFile.Close()
 
-	_, err = io.Copy(dstFile, srcFile)
-	return err
+	fmt.Printf("extracted %d files ✓\n", fileCount)
+	return nil
 }
 
 // ensurePasswd creates a minimal /etc/passwd file if it doesn't exist.
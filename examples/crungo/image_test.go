@@ -3,9 +3,21 @@
 package main
 
 import (
+	"archive/tar"
+	"bytes"
+	"io"
 	"os"
 	"path/filepath"
+	"reflect"
+	"runtime"
 	"testing"
+
+	"github.com/google/go-containerregistry/pkg/name"
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/layout"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
 )
 
 func TestParseImageRef(t *testing.T) {
@@ -154,3 +166,117 @@ func containsAt(s, substr string, start int) bool {
 	return false
 }
 
+// testImage builds a single-layer image containing /hello.txt.
+func testImage(t *testing.T) v1.Image {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	content := []byte("hello from layer\n")
+	if err := tw.WriteHeader(&tar.Header{Name: "hello.txt", Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg}); err != nil {
+		t.Fatalf("failed to write tar header: %v", err)
+	}
+	if _, err := tw.Write(content); err != nil {
+		t.Fatalf("failed to write tar content: %v", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("failed to close tar: %v", err)
+	}
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(buf.Bytes())), nil
+	})
+	if err != nil {
+		t.Fatalf("failed to create layer: %v", err)
+	}
+
+	img, err := mutate.AppendLayers(empty.Image, layer)
+	if err != nil {
+		t.Fatalf("failed to append layer: %v", err)
+	}
+	cfg, err := img.ConfigFile()
+	if err != nil {
+		t.Fatalf("failed to get config: %v", err)
+	}
+	cfg = cfg.DeepCopy()
+	cfg.OS = "linux"
+	cfg.Architecture = runtime.GOARCH
+	cfg.Config.Cmd = []string{"/bin/cat", "/hello.txt"}
+	cfg.Config.Env = []string{"FIXTURE=1"}
+	cfg.Config.WorkingDir = "/"
+	img, err = mutate.ConfigFile(img, cfg)
+	if err != nil {
+		t.Fatalf("failed to set config: %v", err)
+	}
+	return img
+}
+
+// tarDir writes the contents of dir to a tar archive at path.
+func tarDir(t *testing.T, dir, path string) {
+	t.Helper()
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatalf("failed to create archive: %v", err)
+	}
+	defer f.Close()
+	tw := tar.NewWriter(f)
+	if err := tw.AddFS(os.DirFS(dir)); err != nil {
+		t.Fatalf("failed to write archive: %v", err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("failed to close archive: %v", err)
+	}
+}
+
+func TestPullAndExtractLocal(t *testing.T) {
+	img := testImage(t)
+	dir := t.TempDir()
+
+	layoutDir := filepath.Join(dir, "layout")
+	p, err := layout.Write(layoutDir, empty.Index)
+	if err != nil {
+		t.Fatalf("failed to create OCI layout: %v", err)
+	}
+	if err := p.AppendImage(img); err != nil {
+		t.Fatalf("failed to write OCI layout: %v", err)
+	}
+
+	ociArchive := filepath.Join(dir, "oci.tar")
+	tarDir(t, layoutDir, ociArchive)
+
+	dockerArchive := filepath.Join(dir, "docker.tar")
+	if err := tarball.WriteToFile(dockerArchive, name.MustParseReference("crungo/fixture:latest"), img); err != nil {
+		t.Fatalf("failed to write docker archive: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		ref  string
+	}{
+		{"oci layout", "oci:" + layoutDir},
+		{"oci archive", "oci-archive:" + ociArchive},
+		{"docker archive", "docker-archive:" + dockerArchive},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ref := tt.ref
+			pulled, err := PullAndExtract(ref)
+			if err != nil {
+				t.Fatalf("PullAndExtract(%q) error = %v", ref, err)
+			}
+			defer os.RemoveAll(pulled.RootFS)
+
+			content, err := os.ReadFile(filepath.Join(pulled.RootFS, "hello.txt"))
+			if err != nil {
+				t.Fatalf("failed to read extracted file: %v", err)
+			}
+			if string(content) != "hello from layer\n" {
+				t.Errorf("hello.txt = %q, want %q", content, "hello from layer\n")
+			}
+			if want := []string{"/bin/cat", "/hello.txt"}; !reflect.DeepEqual(pulled.Config.Cmd, want) {
+				t.Errorf("Config.Cmd = %v, want %v", pulled.Config.Cmd, want)
+			}
+			if want := []string{"FIXTURE=1"}; !reflect.DeepEqual(pulled.Config.Env, want) {
+				t.Errorf("Config.Env = %v, want %v", pulled.Config.Env, want)
+			}
+		})
+	}
+}
@@ -4,10 +4,16 @@ package main
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	crun "github.com/danielealbano/libcrun-go"
 )
@@ -318,6 +324,87 @@ func TestRunWithHostNetwork(t *testing.T) {
 	}
 }
 
+func TestRunWithBridgeNetworkPublishedPort(t *testing.T) {
+	if _, err := exec.LookPath("slirp4netns"); err != nil {
+		t.Skip("slirp4netns not found in PATH")
+	}
+
+	pulled, err := PullAndExtract("alpine:latest")
+	if err != nil {
+		t.Fatalf("failed to pull image: %v", err)
+	}
+	defer os.RemoveAll(pulled.RootFS)
+
+	stateRoot, err := os.MkdirTemp("", "crungo-test-*")
+	if err != nil {
+		t.Fatalf("failed to create state root: %v", err)
+	}
+	defer os.RemoveAll(stateRoot)
+
+	rc, err := crun.NewRuntimeContext(crun.RuntimeConfig{
+		StateRoot: stateRoot,
+	})
+	if err != nil {
+		t.Fatalf("failed to create runtime context: %v", err)
+	}
+	defer rc.Close()
+
+	// Container ports below 1024 need privileges the container lacks in a
+	// network namespace it does not own
+	const hostPort = 18080
+	network, err := setupBridgeNetwork([]PortMapping{{HostPort: hostPort, ContainerPort: 8080, Proto: "tcp"}})
+	if err != nil {
+		t.Fatalf("failed to set up bridge network: %v", err)
+	}
+	defer network.Close()
+
+	server := `while true; do printf 'HTTP/1.0 200 OK\r\nContent-Length: 5\r\n\r\nhello' | nc -l -p 8080; done`
+	opts := append([]crun.SpecOption{
+		crun.WithRootPath(pulled.RootFS),
+		crun.WithArgs("sh", "-c", server),
+		crun.WithContainerTTY(false),
+		crun.WithEnv("HOME", "/root"),
+	}, network.specOptions()...)
+	spec, err := crun.NewSpec(true, opts...)
+	if err != nil {
+		t.Fatalf("failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	var stderr bytes.Buffer
+	result, err := rc.RunWithIO("test-bridge", spec, &crun.IOConfig{
+		Stderr: &stderr,
+	})
+	if err != nil {
+		t.Fatalf("failed to run container: %v", err)
+	}
+	defer result.Container.Delete(true)
+	defer result.Container.Kill(crun.SIGKILL)
+
+	// Poll until the server is listening
+	url := fmt.Sprintf("http://127.0.0.1:%d/", hostPort)
+	var body []byte
+	deadline := time.Now().Add(15 * time.Second)
+	for {
+		resp, err := http.Get(url)
+		if err == nil {
+			body, err = io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err == nil && len(body) > 0 {
+				break
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("published port never answered: %v. stderr: %s", err, stderr.String())
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	if string(body) != "hello" {
+		t.Errorf("expected body 'hello', got %q", body)
+	}
+}
+
 func TestRunInteractiveStdin(t *testing.T) {
 	pulled, err := PullAndExtract("alpine:latest")
 	if err != nil {
@@ -378,3 +465,196 @@ func TestRunInteractiveStdin(t *testing.T) {
 	}
 }
 
+
+// runKept runs name to completion without removing it, like --rm=false.
+func runKept(t *testing.T, rc *crun.RuntimeContext, name, rootfs string, replace bool) error {
+	t.Helper()
+	spec, err := crun.NewSpec(true,
+		crun.WithRootPath(rootfs),
+		crun.WithArgs("true"),
+		crun.WithContainerTTY(false),
+	)
+	if err != nil {
+		t.Fatalf("failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	result, err := createNamed(rc, name, replace, func() (*crun.RunResult, error) {
+		return rc.RunWithIO(name, spec, &crun.IOConfig{})
+	})
+	if err != nil {
+		return err
+	}
+	if _, err := result.Wait(); err != nil {
+		t.Fatalf("failed to wait for container: %v", err)
+	}
+	return nil
+}
+
+func TestRunNameCollision(t *testing.T) {
+	pulled, err := PullAndExtract("alpine:latest")
+	if err != nil {
+		t.Fatalf("failed to pull image: %v", err)
+	}
+	defer os.RemoveAll(pulled.RootFS)
+
+	stateRoot, err := os.MkdirTemp("", "crungo-test-*")
+	if err != nil {
+		t.Fatalf("failed to create state root: %v", err)
+	}
+	defer os.RemoveAll(stateRoot)
+
+	rc, err := crun.NewRuntimeContext(crun.RuntimeConfig{
+		StateRoot: stateRoot,
+	})
+	if err != nil {
+		t.Fatalf("failed to create runtime context: %v", err)
+	}
+	defer rc.Close()
+
+	if err := runKept(t, rc, "test-collision", pulled.RootFS, false); err != nil {
+		t.Fatalf("failed to run container: %v", err)
+	}
+
+	err = runKept(t, rc, "test-collision", pulled.RootFS, false)
+	if !errors.Is(err, crun.ErrContainerExists) {
+		t.Fatalf("expected ErrContainerExists, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "--replace") {
+		t.Errorf("expected error to suggest --replace, got %q", err)
+	}
+
+	if err := runKept(t, rc, "test-collision", pulled.RootFS, true); err != nil {
+		t.Fatalf("failed to replace container: %v", err)
+	}
+	ids, err := rc.ListIDs()
+	if err != nil {
+		t.Fatalf("failed to list containers: %v", err)
+	}
+	if len(ids) != 1 || ids[0] != "test-collision" {
+		t.Errorf("expected only test-collision, got %v", ids)
+	}
+	// The rootfs was not extracted by crungo under this name, so it is kept
+	if _, err := os.Stat(pulled.RootFS); err != nil {
+		t.Errorf("expected rootfs to survive replace: %v", err)
+	}
+}
+
+func TestRunKeepContainer(t *testing.T) {
+	pulled, err := PullAndExtract("alpine:latest")
+	if err != nil {
+		t.Fatalf("failed to pull image: %v", err)
+	}
+	defer os.RemoveAll(pulled.RootFS)
+
+	stateRoot, err := os.MkdirTemp("", "crungo-test-*")
+	if err != nil {
+		t.Fatalf("failed to create state root: %v", err)
+	}
+	defer os.RemoveAll(stateRoot)
+
+	rc, err := crun.NewRuntimeContext(crun.RuntimeConfig{
+		StateRoot: stateRoot,
+	})
+	if err != nil {
+		t.Fatalf("failed to create runtime context: %v", err)
+	}
+	defer rc.Close()
+
+	if err := runKept(t, rc, "test-keep", pulled.RootFS, false); err != nil {
+		t.Fatalf("failed to run container: %v", err)
+	}
+
+	ctrs, err := rc.List()
+	if err != nil || len(ctrs) != 1 {
+		t.Fatalf("expected one container, got %v (%v)", ctrs, err)
+	}
+
+	removeOnExit = false
+	finishContainer(ctrs[0])
+	removeOnExit = true
+
+	state, err := ctrs[0].State()
+	if err != nil {
+		t.Fatalf("expected kept container to have state: %v", err)
+	}
+	if state.Status != crun.StatusStopped {
+		t.Errorf("expected stopped container, got %s", state.Status)
+	}
+	if _, err := os.Stat(pulled.RootFS); err != nil {
+		t.Errorf("expected rootfs to be kept: %v", err)
+	}
+
+	// --replace removes the kept container
+	if err := removeStoppedContainer(ctrs[0], state); err != nil {
+		t.Fatalf("failed to remove stopped container: %v", err)
+	}
+	if ids, _ := rc.ListIDs(); len(ids) != 0 {
+		t.Errorf("expected no containers after removal, got %v", ids)
+	}
+}
+
+func TestRunHealthCheck(t *testing.T) {
+	pulled, err := PullAndExtract("alpine:latest")
+	if err != nil {
+		t.Fatalf("failed to pull image: %v", err)
+	}
+	defer os.RemoveAll(pulled.RootFS)
+
+	stateRoot, err := os.MkdirTemp("", "crungo-test-*")
+	if err != nil {
+		t.Fatalf("failed to create state root: %v", err)
+	}
+	defer os.RemoveAll(stateRoot)
+
+	rc, err := crun.NewRuntimeContext(crun.RuntimeConfig{
+		StateRoot: stateRoot,
+	})
+	if err != nil {
+		t.Fatalf("failed to create runtime context: %v", err)
+	}
+	defer rc.Close()
+
+	spec, err := crun.NewSpec(true,
+		crun.WithRootPath(pulled.RootFS),
+		crun.WithArgs("sleep", "30"),
+		crun.WithContainerTTY(false),
+		crun.WithAnnotation(HealthAnnotation, string(HealthStarting)),
+	)
+	if err != nil {
+		t.Fatalf("failed to create spec: %v", err)
+	}
+	defer spec.Close()
+
+	result, err := rc.RunWithIO("test-health", spec, &crun.IOConfig{})
+	if err != nil {
+		t.Fatalf("failed to run container: %v", err)
+	}
+	defer result.Container.Delete(true)
+
+	// The check passes until the marker file exists
+	stop, err := startHealthMonitor(result.Container, stateRoot, "test ! -e /tmp/fail", 100*time.Millisecond, 2)
+	if err != nil {
+		t.Fatalf("failed to start health monitor: %v", err)
+	}
+	defer stop()
+
+	waitHealth := func(want HealthStatus) {
+		t.Helper()
+		deadline := time.Now().Add(10 * time.Second)
+		for time.Now().Before(deadline) {
+			state, err := result.Container.State()
+			if err == nil && state.Annotations[HealthAnnotation] == string(want) {
+				return
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		t.Fatalf("container did not become %s", want)
+	}
+	waitHealth(HealthHealthy)
+
+	if err := os.WriteFile(filepath.Join(pulled.RootFS, "tmp", "fail"), nil, 0644); err != nil {
+		t.Fatalf("failed to create marker: %v", err)
+	}
+	waitHealth(HealthUnhealthy)
+}
@@ -4,6 +4,7 @@ package main
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
 	"math/rand"
@@ -24,20 +25,33 @@ import (
 
 var (
 	// Run command flags
-	interactive   bool
-	tty           bool
-	envVars       []string
-	volumes       []string
-	user          string
-	cpus          string
-	memory        string
-	containerName string
-	workdir       string
-	entrypoint    string
-	netMode       string
-	crunDebug     bool
+	interactive    bool
+	tty            bool
+	envVars        []string
+	volumes        []string
+	devices        []string
+	user           string
+	cpus           string
+	memory         string
+	containerName  string
+	workdir        string
+	entrypoint     string
+	netMode        string
+	crunDebug      bool
+	pullPolicy     string
+	publish        []string
+	removeOnExit   bool
+	replace        bool
+	restartSpec    string
+	healthCmd      string
+	healthInterval time.Duration
+	healthRetries  int
 )
 
+// stateRoot is where crungo keeps container state, so containers kept with
+// --rm=false outlive the crungo process.
+const stateRoot = "/run/crungo"
+
 func main() {
 	rootCmd := &cobra.Command{
 		Use:   "crungo",
@@ -50,7 +64,12 @@ It supports pulling OCI images and running them with common container options.`,
 		Use:   "run [OPTIONS] IMAGE [COMMAND] [ARG...]",
 		Short: "Run a container from an image",
 		Long: `Pull an image (if not cached) and run a container.
-The container is automatically removed when it exits.`,
+The container is automatically removed when it exits, unless --rm=false.
+
+IMAGE is a registry reference or a local image:
+  oci:PATH                  OCI image layout directory
+  oci-archive:PATH.tar      tarball of an OCI image layout
+  docker-archive:PATH.tar   tarball written by docker save`,
 		Args: cobra.MinimumNArgs(1),
 		RunE: runContainer,
 	}
@@ -60,14 +79,23 @@ The container is automatically removed when it exits.`,
 	runCmd.Flags().BoolVarP(&tty, "tty", "t", false, "Allocate a pseudo-TTY")
 	runCmd.Flags().StringArrayVarP(&envVars, "env", "e", nil, "Set environment variables (KEY=VALUE)")
 	runCmd.Flags().StringArrayVarP(&volumes, "volume", "v", nil, "Bind mount a volume (host:container[:ro])")
+	runCmd.Flags().StringArrayVar(&devices, "device", nil, "Add a host device to the container (host[:container][:rwm])")
 	runCmd.Flags().StringVarP(&user, "user", "u", "", "Run as user (uid[:gid])")
 	runCmd.Flags().StringVar(&cpus, "cpus", "", "CPU limit (e.g., '0.5', '2')")
 	runCmd.Flags().StringVarP(&memory, "memory", "m", "", "Memory limit (e.g., '256m', '1g')")
 	runCmd.Flags().StringVar(&containerName, "name", "", "Container name (default: random)")
 	runCmd.Flags().StringVarP(&workdir, "workdir", "w", "", "Working directory inside the container")
 	runCmd.Flags().StringVar(&entrypoint, "entrypoint", "", "Override the image entrypoint")
-	runCmd.Flags().StringVar(&netMode, "net", "none", "Network mode: 'none' (isolated) or 'host' (share host network)")
+	runCmd.Flags().StringVar(&netMode, "net", "none", "Network mode: 'none' (isolated), 'host' (share host network) or 'bridge' (slirp4netns)")
+	runCmd.Flags().StringArrayVarP(&publish, "publish", "p", nil, "Publish a container port to the host (hostPort:containerPort[/proto]), requires --net=bridge")
 	runCmd.Flags().BoolVar(&crunDebug, "crun-debug", false, "Enable libcrun debug logs")
+	runCmd.Flags().BoolVar(&removeOnExit, "rm", true, "Remove the container and its rootfs when it exits")
+	runCmd.Flags().BoolVar(&replace, "replace", false, "Replace a stopped container with the same name")
+	runCmd.Flags().StringVar(&healthCmd, "health-cmd", "", "Command run with /bin/sh -c inside the container to check its health")
+	runCmd.Flags().DurationVar(&healthInterval, "health-interval", 30*time.Second, "Time between health checks")
+	runCmd.Flags().IntVar(&healthRetries, "health-retries", 3, "Consecutive failed health checks before the container is unhealthy")
+	runCmd.Flags().StringVar(&restartSpec, "restart", string(RestartNo), "Restart policy: 'no', 'on-failure[:maxretries]' or 'always'")
+	runCmd.Flags().StringVar(&pullPolicy, "pull", string(PullMissing), "Pull image layers: 'always', 'missing' (not cached) or 'never' (cache only)")
 
 	rootCmd.AddCommand(runCmd)
 
@@ -76,7 +104,7 @@ The container is automatically removed when it exits.`,
 	}
 }
 
-func runContainer(cmd *cobra.Command, args []string) error {
+func runContainer(cmd *cobra.Command, args []string) (err error) {
 	imageRef := args[0]
 	var containerCmd []string
 	if len(args) > 1 {
@@ -94,19 +122,32 @@ func runContainer(cmd *cobra.Command, args []string) error {
 		ctrName = generateName()
 	}
 
-	// Pull and extract image
-	pulled, err := PullAndExtract(imageRef)
+	policy, err := parsePullPolicy(pullPolicy)
 	if err != nil {
-		return fmt.Errorf("failed to pull image: %w", err)
+		return err
+	}
+	restart, err := parseRestartPolicy(restartSpec)
+	if err != nil {
+		return err
+	}
+	if tty && restart.Mode != RestartNo {
+		return fmt.Errorf("--restart is not supported with -t")
+	}
+	if healthCmd != "" && (healthInterval <= 0 || healthRetries < 1) {
+		return fmt.Errorf("--health-interval must be positive and --health-retries at least 1")
 	}
-	defer os.RemoveAll(pulled.RootFS)
 
-	// Create state root
-	stateRoot, err := os.MkdirTemp("", "crungo-state-*")
+	// Pull and extract image
+	pulled, err := PullAndExtractWithPolicy(imageRef, policy)
 	if err != nil {
-		return fmt.Errorf("failed to create state root: %w", err)
+		return fmt.Errorf("failed to pull image: %w", err)
 	}
-	defer os.RemoveAll(stateRoot)
+	// A kept container still needs its rootfs, unless it was never created
+	defer func() {
+		if removeOnExit || err != nil {
+			os.RemoveAll(pulled.RootFS)
+		}
+	}()
 
 	// Build spec options
 	specOpts, err := buildSpecOptions(pulled, containerCmd)
@@ -114,6 +155,18 @@ func runContainer(cmd *cobra.Command, args []string) error {
 		return fmt.Errorf("failed to build spec options: %w", err)
 	}
 
+	var ports []PortMapping
+	for _, p := range publish {
+		port, err := parsePortMapping(p)
+		if err != nil {
+			return err
+		}
+		ports = append(ports, port)
+	}
+	if len(ports) > 0 && netMode != "bridge" {
+		return fmt.Errorf("publishing ports requires --net=bridge")
+	}
+
 	// Handle network mode
 	switch netMode {
 	case "none":
@@ -125,20 +178,150 @@ func runContainer(cmd *cobra.Command, args []string) error {
 		specOpts = append(specOpts, crun.WithCapability(crun.CapNetRaw))
 		// Bind mount /etc/resolv.conf for DNS resolution
 		specOpts = append(specOpts, crun.WithMount("/etc/resolv.conf", "/etc/resolv.conf", "none", []string{"bind", "ro"}))
+	case "bridge":
+		// Own network namespace connected to the host through slirp4netns
+		network, err := setupBridgeNetwork(ports)
+		if err != nil {
+			return err
+		}
+		defer network.Close()
+		specOpts = append(specOpts, network.specOptions()...)
 	default:
-		return fmt.Errorf("invalid network mode %q: use 'none' or 'host'", netMode)
+		return fmt.Errorf("invalid network mode %q: use 'none', 'host' or 'bridge'", netMode)
+	}
+
+	if healthCmd != "" {
+		specOpts = append(specOpts, crun.WithAnnotation(HealthAnnotation, string(HealthStarting)))
 	}
 
 	// Choose execution mode based on flags
 	if tty {
 		// Real TTY mode: use console socket + Create/Start pattern
-		return runWithTTY(stateRoot, ctrName, specOpts)
+		return runWithTTY(ctrName, specOpts)
 	} else if interactive {
 		// Interactive without TTY: use RunWithIO with stdin
-		return runInteractiveNonTTY(stateRoot, ctrName, specOpts)
+		return runInteractiveNonTTY(ctrName, specOpts, restart)
 	}
 	// Non-interactive: use RunWithIO with buffered output
-	return runNonInteractive(stateRoot, ctrName, specOpts)
+	return runNonInteractive(ctrName, specOpts, restart)
+}
+
+// newRuntimeContext creates the runtime context for the crungo state root.
+func newRuntimeContext(consoleSocket string) (*crun.RuntimeContext, error) {
+	rc, err := crun.NewRuntimeContext(crun.RuntimeConfig{
+		StateRoot:       stateRoot,
+		CreateStateRoot: true,
+		ConsoleSocket:   consoleSocket,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create runtime context: %w", err)
+	}
+	return rc, nil
+}
+
+// createNamed calls create, which creates the container name. If the name is
+// already in use, it fails unless replace is set and the existing container
+// is stopped, in which case that container is removed and create retried.
+func createNamed[T any](rc *crun.RuntimeContext, name string, replace bool, create func() (T, error)) (T, error) {
+	v, err := create()
+	if !errors.Is(err, crun.ErrContainerExists) {
+		return v, err
+	}
+	if !replace {
+		return v, fmt.Errorf("container name %q is already in use, remove it or pass --replace: %w", name, err)
+	}
+	ctr := rc.Get(name)
+	state, err := ctr.State()
+	if err != nil {
+		return v, fmt.Errorf("failed to get state of container %q: %w", name, err)
+	}
+	if err := removeStoppedContainer(ctr, state); err != nil {
+		return v, err
+	}
+	return create()
+}
+
+// removeStoppedContainer deletes a stopped container and, if it was kept by
+// crungo, its rootfs.
+func removeStoppedContainer(ctr *crun.Container, state *crun.ContainerState) error {
+	if state.Status != crun.StatusStopped {
+		return fmt.Errorf("cannot replace container %q: it is %s", ctr.ID, state.Status)
+	}
+	var rootfs string
+	if sp, err := ctr.Spec(); err == nil && sp.Root != nil {
+		rootfs = sp.Root.Path
+	}
+	if err := ctr.Delete(false); err != nil {
+		return fmt.Errorf("failed to remove container %q: %w", ctr.ID, err)
+	}
+	// Only remove rootfs directories crungo extracted itself
+	if strings.HasPrefix(filepath.Base(rootfs), "crungo-rootfs-") {
+		os.RemoveAll(rootfs)
+	}
+	fmt.Fprintf(os.Stderr, "Replaced stopped container %s\n", ctr.ID)
+	return nil
+}
+
+// runWithRestarts runs the container with run and waits for it, deleting and
+// recreating it under the same name, with backoff, while restart asks for it.
+// exited is called after every run. It returns the exit code of the last run.
+func runWithRestarts(restart RestartPolicy, run func() (*crun.RunResult, error), exited func()) (int, error) {
+	for restarts := 0; ; restarts++ {
+		result, err := run()
+		if err != nil {
+			return 0, fmt.Errorf("failed to run container: %w", err)
+		}
+
+		stopHealth := watchHealth(result.Container)
+		exitCode, err := result.Wait()
+		stopHealth()
+		exited()
+		if err != nil || !restart.shouldRestart(exitCode, restarts) {
+			finishContainer(result.Container)
+			if err != nil {
+				return 0, fmt.Errorf("failed to wait for container: %w", err)
+			}
+			return exitCode, nil
+		}
+
+		if err := result.Container.Delete(true); err != nil {
+			return 0, fmt.Errorf("failed to delete container before restart: %w", err)
+		}
+		delay := restartDelay(restarts)
+		fmt.Fprintf(os.Stderr, "Container exited with code %d, restarting in %s (restart %d)\n", exitCode, delay, restarts+1)
+		time.Sleep(delay)
+	}
+}
+
+// watchHealth starts checking the health of ctr if --health-cmd is set, and
+// returns a function stopping the checks.
+func watchHealth(ctr *crun.Container) func() {
+	if healthCmd == "" {
+		return func() {}
+	}
+	stop, err := startHealthMonitor(ctr, stateRoot, healthCmd, healthInterval, healthRetries)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: health checks disabled: %v\n", err)
+		return func() {}
+	}
+	return stop
+}
+
+// finishContainer removes an exited container and its rootfs, unless it is
+// kept with --rm=false. It must be called before os.Exit, which skips defers.
+func finishContainer(ctr *crun.Container) {
+	var rootfs string
+	if sp, err := ctr.Spec(); err == nil && sp.Root != nil {
+		rootfs = sp.Root.Path
+	}
+	if !removeOnExit {
+		fmt.Fprintf(os.Stderr, "Container %s kept in %s (rootfs: %s)\n", ctr.ID, stateRoot, rootfs)
+		return
+	}
+	ctr.Delete(true)
+	if rootfs != "" {
+		os.RemoveAll(rootfs)
+	}
 }
 
 func buildSpecOptions(pulled *PulledImage, containerCmd []string) ([]crun.SpecOption, error) {
@@ -154,9 +337,21 @@ func buildSpecOptions(pulled *PulledImage, containerCmd []string) ([]crun.SpecOp
 	}
 	opts = append(opts, crun.WithArgs(finalCmd...))
 
+	// Keep image labels as annotations for provenance
+	if len(pulled.Config.Labels) > 0 {
+		opts = append(opts, crun.WithImageLabels(pulled.Config.Labels))
+	}
+
 	// Set TTY mode - when true, we'll use console socket for real PTY
 	opts = append(opts, crun.WithContainerTTY(tty))
 
+	// Start the PTY at the local terminal size to avoid a 0x0 first frame
+	if tty {
+		if width, height, err := term.GetSize(int(os.Stdin.Fd())); err == nil {
+			opts = append(opts, crun.WithConsoleSize(uint(height), uint(width)))
+		}
+	}
+
 	// Set working directory
 	wd := workdir
 	if wd == "" {
@@ -193,9 +388,7 @@ func buildSpecOptions(pulled *PulledImage, containerCmd []string) ([]crun.SpecOp
 			opts = append(opts, crun.WithEnv(parts[0], parts[1]))
 		} else {
 			// If no value, try to get from host environment
-			if val, ok := os.LookupEnv(parts[0]); ok {
-				opts = append(opts, crun.WithEnv(parts[0], val))
-			}
+			opts = append(opts, crun.WithEnvPassthrough(parts[0]))
 		}
 	}
 
@@ -255,6 +448,15 @@ func buildSpecOptions(pulled *PulledImage, containerCmd []string) ([]crun.SpecOp
 		opts = append(opts, crun.WithMount(source, volSpec.Dest, "none", mountOpts))
 	}
 
+	// Add devices
+	for _, dev := range devices {
+		devOpt, err := crun.WithDeviceSpec(dev)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, devOpt)
+	}
+
 	return opts, nil
 }
 
@@ -287,13 +489,11 @@ func determineCommand(config ImageConfig, containerCmd []string) []string {
 	return config.Cmd
 }
 
-func runNonInteractive(stateRoot, ctrName string, specOpts []crun.SpecOption) error {
+func runNonInteractive(ctrName string, specOpts []crun.SpecOption, restart RestartPolicy) error {
 	// Create runtime context (no console socket needed)
-	rc, err := crun.NewRuntimeContext(crun.RuntimeConfig{
-		StateRoot: stateRoot,
-	})
+	rc, err := newRuntimeContext("")
 	if err != nil {
-		return fmt.Errorf("failed to create runtime context: %w", err)
+		return err
 	}
 	defer rc.Close()
 
@@ -306,25 +506,24 @@ func runNonInteractive(stateRoot, ctrName string, specOpts []crun.SpecOption) er
 
 	var stdout, stderr bytes.Buffer
 
-	result, err := rc.RunWithIO(ctrName, spec, &crun.IOConfig{
-		Stdout: &stdout,
-		Stderr: &stderr,
+	exitCode, err := runWithRestarts(restart, func() (*crun.RunResult, error) {
+		return createNamed(rc, ctrName, replace, func() (*crun.RunResult, error) {
+			return rc.RunWithIO(ctrName, spec, &crun.IOConfig{
+				Stdout: &stdout,
+				Stderr: &stderr,
+			})
+		})
+	}, func() {
+		// Print output of every run
+		if stdout.Len() > 0 {
+			io.Copy(os.Stdout, &stdout)
+		}
+		if stderr.Len() > 0 {
+			io.Copy(os.Stderr, &stderr)
+		}
 	})
 	if err != nil {
-		return fmt.Errorf("failed to run container: %w", err)
-	}
-
-	exitCode, err := result.Wait()
-	if err != nil {
-		return fmt.Errorf("failed to wait for container: %w", err)
-	}
-
-	// Print output
-	if stdout.Len() > 0 {
-		io.Copy(os.Stdout, &stdout)
-	}
-	if stderr.Len() > 0 {
-		io.Copy(os.Stderr, &stderr)
+		return err
 	}
 
 	// Show exit code
@@ -337,13 +536,11 @@ func runNonInteractive(stateRoot, ctrName string, specOpts []crun.SpecOption) er
 	return nil
 }
 
-func runInteractiveNonTTY(stateRoot, ctrName string, specOpts []crun.SpecOption) error {
+func runInteractiveNonTTY(ctrName string, specOpts []crun.SpecOption, restart RestartPolicy) error {
 	// Create runtime context (no console socket needed)
-	rc, err := crun.NewRuntimeContext(crun.RuntimeConfig{
-		StateRoot: stateRoot,
-	})
+	rc, err := newRuntimeContext("")
 	if err != nil {
-		return fmt.Errorf("failed to create runtime context: %w", err)
+		return err
 	}
 	defer rc.Close()
 
@@ -354,18 +551,17 @@ func runInteractiveNonTTY(stateRoot, ctrName string, specOpts []crun.SpecOption)
 	}
 	defer spec.Close()
 
-	result, err := rc.RunWithIO(ctrName, spec, &crun.IOConfig{
-		Stdin:  os.Stdin,
-		Stdout: os.Stdout,
-		Stderr: os.Stderr,
-	})
+	exitCode, err := runWithRestarts(restart, func() (*crun.RunResult, error) {
+		return createNamed(rc, ctrName, replace, func() (*crun.RunResult, error) {
+			return rc.RunWithIO(ctrName, spec, &crun.IOConfig{
+				Stdin:  os.Stdin,
+				Stdout: os.Stdout,
+				Stderr: os.Stderr,
+			})
+		})
+	}, func() {})
 	if err != nil {
-		return fmt.Errorf("failed to run container: %w", err)
-	}
-
-	exitCode, err := result.Wait()
-	if err != nil {
-		return fmt.Errorf("failed to wait for container: %w", err)
+		return err
 	}
 
 	// Show exit code
@@ -379,7 +575,7 @@ func runInteractiveNonTTY(stateRoot, ctrName string, specOpts []crun.SpecOption)
 }
 
 // runWithTTY runs a container with a real PTY using console socket
-func runWithTTY(stateRoot, ctrName string, specOpts []crun.SpecOption) error {
+func runWithTTY(ctrName string, specOpts []crun.SpecOption) error {
 	// Create console socket for receiving PTY master fd
 	socketDir, err := os.MkdirTemp("", "crungo-console-*")
 	if err != nil {
@@ -395,12 +591,9 @@ func runWithTTY(stateRoot, ctrName string, specOpts []crun.SpecOption) error {
 	defer listener.Close()
 
 	// Create runtime context WITH console socket
-	rc, err := crun.NewRuntimeContext(crun.RuntimeConfig{
-		StateRoot:     stateRoot,
-		ConsoleSocket: socketPath,
-	})
+	rc, err := newRuntimeContext(socketPath)
 	if err != nil {
-		return fmt.Errorf("failed to create runtime context: %w", err)
+		return err
 	}
 	defer rc.Close()
 
@@ -426,11 +619,14 @@ func runWithTTY(stateRoot, ctrName string, specOpts []crun.SpecOption) error {
 	}()
 
 	// Create container (this triggers libcrun to send PTY fd over socket)
-	ctr, err := rc.Create(ctrName, spec, crun.CreateOptions{})
+	ctr, err := createNamed(rc, ctrName, replace, func() (*crun.Container, error) {
+		return rc.Create(ctrName, spec, crun.CreateOptions{})
+	})
 	if err != nil {
 		return fmt.Errorf("failed to create container: %w", err)
 	}
-	defer ctr.Delete(true)
+	var finish sync.Once
+	defer finish.Do(func() { finishContainer(ctr) })
 
 	// Wait for PTY connection
 	var ptyConn net.Conn
@@ -482,6 +678,8 @@ func runWithTTY(stateRoot, ctrName string, specOpts []crun.SpecOption) error {
 	if err := ctr.Start(); err != nil {
 		return fmt.Errorf("failed to start container: %w", err)
 	}
+	stopHealth := watchHealth(ctr)
+	defer stopHealth()
 
 	// Bidirectional copy between PTY and stdin/stdout
 	var wg sync.WaitGroup
@@ -499,23 +697,11 @@ func runWithTTY(stateRoot, ctrName string, specOpts []crun.SpecOption) error {
 		io.Copy(os.Stdout, ptyFile)
 	}()
 
-	// Wait for container to exit
+	// Wait for container to exit. The exit code is only known to the parent
+	// of the init process, so assume 0 if it stopped normally
 	exitCode := 0
-	for {
-		running, err := ctr.IsRunning()
-		if err != nil {
-			break
-		}
-		if !running {
-			// Get exit status
-			state, err := ctr.State()
-			if err == nil && state.Status == "stopped" {
-				// libcrun stores exit code in annotations or we can't get it easily
-				// For now, assume 0 if stopped normally
-			}
-			break
-		}
-		time.Sleep(100 * time.Millisecond)
+	if err := ctr.Wait(); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to wait for container: %v\n", err)
 	}
 
 	// Close PTY to unblock the copy goroutines
@@ -525,6 +711,9 @@ func runWithTTY(stateRoot, ctrName string, specOpts []crun.SpecOption) error {
 	// Restore terminal before printing
 	term.Restore(stdinFd, oldState)
 
+	stopHealth()
+	finish.Do(func() { finishContainer(ctr) })
+
 	// Show exit code
 	fmt.Fprintf(os.Stderr, "\nContainer exited with code %d\n", exitCode)
 
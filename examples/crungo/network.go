@@ -0,0 +1,195 @@
+//go:build linux && cgo
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"time"
+
+	crun "github.com/danielealbano/libcrun-go"
+)
+
+// slirpDNS is the DNS forwarder slirp4netns provides with --configure.
+const slirpDNS = "10.0.2.3"
+
+// bridgeNetwork is a network namespace connected to the host by slirp4netns,
+// with ports published through its API socket.
+type bridgeNetwork struct {
+	dir    string // holds the namespace file, API socket and resolv.conf
+	nsPath string // bind mount keeping the network namespace alive
+	slirp  *exec.Cmd
+}
+
+// setupBridgeNetwork creates a network namespace, starts slirp4netns on it
+// and publishes ports. Close releases everything.
+func setupBridgeNetwork(ports []PortMapping) (*bridgeNetwork, error) {
+	slirpPath, err := exec.LookPath("slirp4netns")
+	if err != nil {
+		return nil, errors.New("--net=bridge requires slirp4netns, which was not found in PATH (install the slirp4netns package)")
+	}
+
+	dir, err := os.MkdirTemp("", "crungo-net-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create network directory: %w", err)
+	}
+	n := &bridgeNetwork{dir: dir, nsPath: filepath.Join(dir, "netns")}
+
+	if err := createNetns(n.nsPath); err != nil {
+		n.Close()
+		return nil, fmt.Errorf("failed to create network namespace: %w", err)
+	}
+
+	resolv := fmt.Sprintf("nameserver %s\n", slirpDNS)
+	if err := os.WriteFile(filepath.Join(dir, "resolv.conf"), []byte(resolv), 0644); err != nil {
+		n.Close()
+		return nil, fmt.Errorf("failed to write resolv.conf: %w", err)
+	}
+
+	if err := n.startSlirp(slirpPath); err != nil {
+		n.Close()
+		return nil, err
+	}
+
+	for _, p := range ports {
+		if err := n.publish(p); err != nil {
+			n.Close()
+			return nil, fmt.Errorf("failed to publish port %d: %w", p.HostPort, err)
+		}
+	}
+	return n, nil
+}
+
+// createNetns creates a network namespace and bind mounts it at path.
+func createNetns(path string) error {
+	if err := os.WriteFile(path, nil, 0644); err != nil {
+		return err
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		// The thread is left in the new namespace and never unlocked, so it
+		// exits with the goroutine instead of going back to the scheduler
+		runtime.LockOSThread()
+		if err := syscall.Unshare(syscall.CLONE_NEWNET); err != nil {
+			errCh <- fmt.Errorf("unshare: %w", err)
+			return
+		}
+		src := fmt.Sprintf("/proc/self/task/%d/ns/net", syscall.Gettid())
+		if err := syscall.Mount(src, path, "", syscall.MS_BIND, ""); err != nil {
+			errCh <- fmt.Errorf("bind mount: %w", err)
+			return
+		}
+		errCh <- nil
+	}()
+	return <-errCh
+}
+
+// startSlirp starts slirp4netns on the namespace and waits until it is ready.
+func (n *bridgeNetwork) startSlirp(slirpPath string) error {
+	readyR, readyW, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	defer readyR.Close()
+
+	n.slirp = exec.Command(slirpPath,
+		"--configure",
+		"--mtu=65520",
+		"--disable-host-loopback",
+		"--netns-type=path",
+		"--api-socket", n.apiSocket(),
+		"--ready-fd=3",
+		n.nsPath, "tap0",
+	)
+	n.slirp.ExtraFiles = []*os.File{readyW}
+	n.slirp.Stderr = os.Stderr
+	if err := n.slirp.Start(); err != nil {
+		readyW.Close()
+		n.slirp = nil
+		return fmt.Errorf("failed to start slirp4netns: %w", err)
+	}
+	readyW.Close()
+
+	// slirp4netns writes "1" once the interface is configured
+	buf := make([]byte, 1)
+	readyR.SetReadDeadline(time.Now().Add(10 * time.Second))
+	if _, err := readyR.Read(buf); err != nil {
+		return fmt.Errorf("slirp4netns did not become ready: %w", err)
+	}
+	return nil
+}
+
+func (n *bridgeNetwork) apiSocket() string {
+	return filepath.Join(n.dir, "slirp.sock")
+}
+
+// publish forwards a host port to the container through the slirp4netns API.
+func (n *bridgeNetwork) publish(p PortMapping) error {
+	conn, err := net.Dial("unix", n.apiSocket())
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	req := map[string]any{
+		"execute": "add_hostfwd",
+		"arguments": map[string]any{
+			"proto":      p.Proto,
+			"host_addr":  "0.0.0.0",
+			"host_port":  p.HostPort,
+			"guest_port": p.ContainerPort,
+		},
+	}
+	if err := json.NewEncoder(conn).Encode(req); err != nil {
+		return err
+	}
+	// The API handles one request per connection
+	if uc, ok := conn.(*net.UnixConn); ok {
+		uc.CloseWrite()
+	}
+
+	line, err := bufio.NewReader(conn).ReadBytes('\n')
+	if err != nil && len(line) == 0 {
+		return fmt.Errorf("no response from slirp4netns: %w", err)
+	}
+	var resp struct {
+		Error *struct {
+			Desc string `json:"desc"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(line, &resp); err != nil {
+		return fmt.Errorf("invalid response from slirp4netns: %w", err)
+	}
+	if resp.Error != nil {
+		return errors.New(resp.Error.Desc)
+	}
+	return nil
+}
+
+// specOptions joins the container to the network namespace and points its
+// DNS at slirp4netns.
+func (n *bridgeNetwork) specOptions() []crun.SpecOption {
+	return []crun.SpecOption{
+		crun.WithNetworkNamespace(n.nsPath),
+		crun.WithMount(filepath.Join(n.dir, "resolv.conf"), "/etc/resolv.conf", "none", []string{"bind", "ro"}),
+	}
+}
+
+// Close stops slirp4netns and removes the network namespace.
+func (n *bridgeNetwork) Close() {
+	if n.slirp != nil {
+		n.slirp.Process.Kill()
+		n.slirp.Wait()
+	}
+	syscall.Unmount(n.nsPath, syscall.MNT_DETACH)
+	os.RemoveAll(n.dir)
+}
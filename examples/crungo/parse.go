@@ -189,3 +189,81 @@ func parseCPUs(spec string) (int64, error) {
 	return quota, nil
 }
 
+// parsePullPolicy parses the --pull flag value.
+func parsePullPolicy(s string) (PullPolicy, error) {
+	switch p := PullPolicy(strings.ToLower(s)); p {
+	case PullAlways, PullMissing, PullNever:
+		return p, nil
+	default:
+		return "", fmt.Errorf("invalid pull policy %q: use 'always', 'missing' or 'never'", s)
+	}
+}
+
+// PortMapping represents a port published with -p.
+type PortMapping struct {
+	HostPort      uint16
+	ContainerPort uint16
+	Proto         string // "tcp" or "udp"
+}
+
+// parsePortMapping parses a port specification in the format
+// "hostPort:containerPort[/proto]", e.g. "8080:80" or "5353:53/udp".
+func parsePortMapping(spec string) (PortMapping, error) {
+	ports, proto, hasProto := strings.Cut(spec, "/")
+	if !hasProto {
+		proto = "tcp"
+	}
+	proto = strings.ToLower(proto)
+	if proto != "tcp" && proto != "udp" {
+		return PortMapping{}, fmt.Errorf("invalid port spec %q: protocol must be 'tcp' or 'udp'", spec)
+	}
+
+	host, container, ok := strings.Cut(ports, ":")
+	if !ok {
+		return PortMapping{}, fmt.Errorf("invalid port spec %q: must be hostPort:containerPort[/proto]", spec)
+	}
+	hostPort, err := parsePort(host)
+	if err != nil {
+		return PortMapping{}, fmt.Errorf("invalid port spec %q: %w", spec, err)
+	}
+	containerPort, err := parsePort(container)
+	if err != nil {
+		return PortMapping{}, fmt.Errorf("invalid port spec %q: %w", spec, err)
+	}
+
+	return PortMapping{HostPort: hostPort, ContainerPort: containerPort, Proto: proto}, nil
+}
+
+// parsePort parses a port number in the 1-65535 range.
+func parsePort(s string) (uint16, error) {
+	port, err := strconv.ParseUint(s, 10, 16)
+	if err != nil || port == 0 {
+		return 0, fmt.Errorf("invalid port %q: must be 1-65535", s)
+	}
+	return uint16(port), nil
+}
+
+// parseRestartPolicy parses the --restart flag value: "no",
+// "on-failure[:maxretries]" or "always".
+func parseRestartPolicy(spec string) (RestartPolicy, error) {
+	mode, retries, hasRetries := strings.Cut(strings.ToLower(spec), ":")
+	switch RestartMode(mode) {
+	case RestartNo, RestartAlways:
+		if hasRetries {
+			return RestartPolicy{}, fmt.Errorf("invalid restart policy %q: maximum retries only apply to 'on-failure'", spec)
+		}
+		return RestartPolicy{Mode: RestartMode(mode)}, nil
+	case RestartOnFailure:
+		policy := RestartPolicy{Mode: RestartOnFailure}
+		if hasRetries {
+			n, err := strconv.Atoi(retries)
+			if err != nil || n < 0 {
+				return RestartPolicy{}, fmt.Errorf("invalid restart policy %q: maximum retries must be a non-negative number", spec)
+			}
+			policy.MaxRetries = n
+		}
+		return policy, nil
+	default:
+		return RestartPolicy{}, fmt.Errorf("invalid restart policy %q: use 'no', 'on-failure[:maxretries]' or 'always'", spec)
+	}
+}
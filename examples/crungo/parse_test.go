@@ -328,3 +328,86 @@ func TestParseCPUs(t *testing.T) {
 	}
 }
 
+
+func TestParsePullPolicy(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected PullPolicy
+		wantErr  bool
+	}{
+		{input: "always", expected: PullAlways},
+		{input: "missing", expected: PullMissing},
+		{input: "NEVER", expected: PullNever},
+		{input: "sometimes", wantErr: true},
+		{input: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parsePullPolicy(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parsePullPolicy(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("parsePullPolicy(%q) = %q, want %q", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestParsePortMapping(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected PortMapping
+		wantErr  bool
+	}{
+		{input: "8080:80", expected: PortMapping{HostPort: 8080, ContainerPort: 80, Proto: "tcp"}},
+		{input: "5353:53/udp", expected: PortMapping{HostPort: 5353, ContainerPort: 53, Proto: "udp"}},
+		{input: "443:8443/TCP", expected: PortMapping{HostPort: 443, ContainerPort: 8443, Proto: "tcp"}},
+		{input: "8080", wantErr: true},
+		{input: "0:80", wantErr: true},
+		{input: "8080:70000", wantErr: true},
+		{input: "8080:80/sctp", wantErr: true},
+		{input: "http:80", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parsePortMapping(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parsePortMapping(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("parsePortMapping(%q) = %+v, want %+v", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestParseRestartPolicy(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected RestartPolicy
+		wantErr  bool
+	}{
+		{input: "no", expected: RestartPolicy{Mode: RestartNo}},
+		{input: "always", expected: RestartPolicy{Mode: RestartAlways}},
+		{input: "on-failure", expected: RestartPolicy{Mode: RestartOnFailure}},
+		{input: "on-failure:5", expected: RestartPolicy{Mode: RestartOnFailure, MaxRetries: 5}},
+		{input: "ON-FAILURE:2", expected: RestartPolicy{Mode: RestartOnFailure, MaxRetries: 2}},
+		{input: "on-failure:-1", wantErr: true},
+		{input: "on-failure:many", wantErr: true},
+		{input: "always:3", wantErr: true},
+		{input: "unless-stopped", wantErr: true},
+		{input: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseRestartPolicy(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseRestartPolicy(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.expected {
+			t.Errorf("parseRestartPolicy(%q) = %+v, want %+v", tt.input, got, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+//go:build linux && cgo
+
+package main
+
+import "time"
+
+// RestartMode selects when an exited container is run again.
+type RestartMode string
+
+// Restart modes accepted by --restart.
+const (
+	RestartNo        RestartMode = "no"         // never restart
+	RestartOnFailure RestartMode = "on-failure" // restart on a non-zero exit code
+	RestartAlways    RestartMode = "always"     // restart whatever the exit code
+)
+
+// Backoff between restarts: doubled after every restart, up to the cap.
+const (
+	initialRestartDelay = 100 * time.Millisecond
+	maxRestartDelay     = 5 * time.Second
+)
+
+// RestartPolicy represents a parsed --restart flag.
+type RestartPolicy struct {
+	Mode       RestartMode
+	MaxRetries int // on-failure only, 0 means unlimited
+}
+
+// shouldRestart reports whether a container that exited with exitCode, after
+// having been restarted restarts times already, should be run again.
+func (p RestartPolicy) shouldRestart(exitCode, restarts int) bool {
+	switch p.Mode {
+	case RestartAlways:
+		return true
+	case RestartOnFailure:
+		return exitCode != 0 && (p.MaxRetries == 0 || restarts < p.MaxRetries)
+	default:
+		return false
+	}
+}
+
+// restartDelay returns how long to wait before the next restart, given how
+// many restarts happened already.
+func restartDelay(restarts int) time.Duration {
+	delay := initialRestartDelay
+	for i := 0; i < restarts && delay < maxRestartDelay; i++ {
+		delay *= 2
+	}
+	return min(delay, maxRestartDelay)
+}
@@ -0,0 +1,54 @@
+//go:build linux && cgo
+
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRestartPolicyShouldRestart(t *testing.T) {
+	tests := []struct {
+		policy   RestartPolicy
+		exitCode int
+		restarts int
+		expected bool
+	}{
+		{policy: RestartPolicy{Mode: RestartNo}, exitCode: 1, restarts: 0, expected: false},
+		{policy: RestartPolicy{Mode: RestartNo}, exitCode: 0, restarts: 0, expected: false},
+		{policy: RestartPolicy{Mode: RestartOnFailure}, exitCode: 0, restarts: 0, expected: false},
+		{policy: RestartPolicy{Mode: RestartOnFailure}, exitCode: 1, restarts: 0, expected: true},
+		{policy: RestartPolicy{Mode: RestartOnFailure}, exitCode: 137, restarts: 100, expected: true},
+		{policy: RestartPolicy{Mode: RestartOnFailure, MaxRetries: 3}, exitCode: 1, restarts: 2, expected: true},
+		{policy: RestartPolicy{Mode: RestartOnFailure, MaxRetries: 3}, exitCode: 1, restarts: 3, expected: false},
+		{policy: RestartPolicy{Mode: RestartOnFailure, MaxRetries: 3}, exitCode: 0, restarts: 1, expected: false},
+		{policy: RestartPolicy{Mode: RestartAlways}, exitCode: 0, restarts: 0, expected: true},
+		{policy: RestartPolicy{Mode: RestartAlways}, exitCode: 1, restarts: 50, expected: true},
+	}
+
+	for _, tt := range tests {
+		got := tt.policy.shouldRestart(tt.exitCode, tt.restarts)
+		if got != tt.expected {
+			t.Errorf("%+v.shouldRestart(%d, %d) = %v, want %v", tt.policy, tt.exitCode, tt.restarts, got, tt.expected)
+		}
+	}
+}
+
+func TestRestartDelay(t *testing.T) {
+	tests := []struct {
+		restarts int
+		expected time.Duration
+	}{
+		{restarts: 0, expected: 100 * time.Millisecond},
+		{restarts: 1, expected: 200 * time.Millisecond},
+		{restarts: 3, expected: 800 * time.Millisecond},
+		{restarts: 6, expected: maxRestartDelay},
+		{restarts: 1000, expected: maxRestartDelay},
+	}
+
+	for _, tt := range tests {
+		if got := restartDelay(tt.restarts); got != tt.expected {
+			t.Errorf("restartDelay(%d) = %v, want %v", tt.restarts, got, tt.expected)
+		}
+	}
+}
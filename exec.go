@@ -0,0 +1,133 @@
+//go:build linux
+
+package crun
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// ExitError is returned by ExecBuilder.Run and Output when the process exits
+// with a non-zero code.
+type ExitError struct {
+	ExitCode int
+	Stderr   []byte // the process stderr, captured by Output if Stderr is nil
+}
+
+func (e *ExitError) Error() string {
+	return fmt.Sprintf("libcrun: exec process exited with code %d", e.ExitCode)
+}
+
+// ExecBuilder runs a process in a container in the manner of exec.Cmd. The
+// process inherits the environment, user and working directory of the
+// container process; ExecOptions such as WithExecEnv or WithExecUser adjust
+// it. Create one with Container.ExecCmd.
+type ExecBuilder struct {
+	Stdout io.Writer // if nil, stdout is discarded
+	Stderr io.Writer // if nil, stderr is discarded
+
+	ctr  *Container
+	ctx  context.Context
+	args []string
+	opts []ExecOption
+}
+
+// ExecCmd returns an ExecBuilder running args in the container.
+func (c *Container) ExecCmd(args ...string) *ExecBuilder {
+	return &ExecBuilder{ctr: c, ctx: context.Background(), args: args}
+}
+
+// With adds exec options, e.g. WithExecEnv or WithWorkingDir.
+func (b *ExecBuilder) With(opts ...ExecOption) *ExecBuilder {
+	b.opts = append(b.opts, opts...)
+	return b
+}
+
+// Context sets the context of the process: cancelling it kills the process.
+func (b *ExecBuilder) Context(ctx context.Context) *ExecBuilder {
+	b.ctx = ctx
+	return b
+}
+
+// Run runs the process, copies its output to Stdout and Stderr and waits for
+// it to exit. A non-zero exit code is reported as an *ExitError.
+func (b *ExecBuilder) Run() error {
+	return b.run(b.Stdout, b.Stderr)
+}
+
+// run implements Run, copying the output to stdoutW and stderrW.
+func (b *ExecBuilder) run(stdoutW, stderrW io.Writer) error {
+	proc, err := b.process()
+	if err != nil {
+		return err
+	}
+	stdout, stderr, wait, err := b.ctr.ExecStream(b.ctx, proc, b.opts...)
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go copyExecOutput(&wg, stdoutW, stdout)
+	go copyExecOutput(&wg, stderrW, stderr)
+	wg.Wait()
+
+	exitCode, err := wait()
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		return &ExitError{ExitCode: exitCode}
+	}
+	return nil
+}
+
+// Output runs the process and returns its stdout, ignoring Stdout. If Stderr
+// is nil, stderr is captured into the *ExitError returned on a non-zero exit
+// code. The builder is left unchanged, so it can be run again.
+func (b *ExecBuilder) Output() ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	stderrW := b.Stderr
+	captureStderr := stderrW == nil
+	if captureStderr {
+		stderrW = &stderr
+	}
+	err := b.run(&stdout, stderrW)
+	var exitErr *ExitError
+	if errors.As(err, &exitErr) && captureStderr {
+		exitErr.Stderr = stderr.Bytes()
+	}
+	return stdout.Bytes(), err
+}
+
+// process returns the base process: the container process with the builder's
+// arguments, without a terminal.
+func (b *ExecBuilder) process() (*specs.Process, error) {
+	sp, err := b.ctr.Spec()
+	if err != nil {
+		return nil, err
+	}
+	var proc specs.Process
+	if sp.Process != nil {
+		proc = *sp.Process
+	}
+	proc.Args = b.args
+	proc.Terminal = false
+	proc.ConsoleSize = nil
+	return &proc, nil
+}
+
+func copyExecOutput(wg *sync.WaitGroup, dst io.Writer, src io.ReadCloser) {
+	defer wg.Done()
+	defer src.Close()
+	if dst == nil {
+		dst = io.Discard
+	}
+	io.Copy(dst, src)
+}
@@ -0,0 +1,78 @@
+//go:build linux && cgo
+
+package crun
+
+/*
+#include "go_crun.h"
+*/
+import "C"
+import (
+	"sync"
+	"unsafe"
+)
+
+// LibcrunVersion is the version of the bundled libcrun, the one
+// `crun --version` prints, e.g. "1.26". Include it in bug reports.
+var LibcrunVersion = C.GoString(C.go_crun_version())
+
+// Version returns the version of the bundled libcrun, see LibcrunVersion.
+func (rc *RuntimeContext) Version() string {
+	return LibcrunVersion
+}
+
+// RuntimeFeatures describes what the bundled libcrun supports, as reported by
+// `crun features`.
+type RuntimeFeatures struct {
+	OCIVersionMin string   // oldest OCI runtime spec version accepted
+	OCIVersionMax string   // newest OCI runtime spec version supported
+	Hooks         []string // supported hook types, e.g. "prestart"
+	MountOptions  []string // recognized mount options
+	Namespaces    []string // supported namespace types
+	Capabilities  []string // known capabilities
+}
+
+// Features returns the features of the bundled libcrun. They are queried once
+// and cached; the returned value must not be modified.
+func Features() (*RuntimeFeatures, error) {
+	return loadFeatures()
+}
+
+var loadFeatures = sync.OnceValues(func() (*RuntimeFeatures, error) {
+	var err C.libcrun_error_t
+	info := C.go_crun_features(&err)
+	if info == nil {
+		return nil, fromLibcrunErr(&err)
+	}
+	defer C.go_crun_free_features(info)
+
+	return &RuntimeFeatures{
+		OCIVersionMin: C.GoString(info.oci_version_min),
+		OCIVersionMax: C.GoString(info.oci_version_max),
+		Hooks:         goStrv(info.hooks),
+		MountOptions:  goStrv(info.mount_options),
+		Namespaces:    goStrv(info.linux.namespaces),
+		Capabilities:  goStrv(info.linux.capabilities),
+	}, nil
+})
+
+// SupportedOCIVersion returns the newest OCI runtime spec version the bundled
+// libcrun supports, or "" if its features cannot be queried.
+func SupportedOCIVersion() string {
+	f, err := Features()
+	if err != nil {
+		return ""
+	}
+	return f.OCIVersionMax
+}
+
+// goStrv converts a NULL-terminated C string array to a slice.
+func goStrv(v **C.char) []string {
+	if v == nil {
+		return nil
+	}
+	var out []string
+	for p := v; *p != nil; p = (**C.char)(unsafe.Add(unsafe.Pointer(p), unsafe.Sizeof(*p))) {
+		out = append(out, C.GoString(*p))
+	}
+	return out
+}
@@ -0,0 +1,38 @@
+//go:build linux && cgo
+
+package crun
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestFeatures(t *testing.T) {
+	f, err := Features()
+	if err != nil {
+		t.Fatalf("Features failed: %v", err)
+	}
+	if !ociVersionPattern.MatchString(f.OCIVersionMax) {
+		t.Errorf("OCIVersionMax = %q, want an x.y.z version", f.OCIVersionMax)
+	}
+	if len(f.Namespaces) == 0 {
+		t.Error("Expected supported namespaces")
+	}
+	if got := SupportedOCIVersion(); got != f.OCIVersionMax {
+		t.Errorf("SupportedOCIVersion() = %q, want %q", got, f.OCIVersionMax)
+	}
+
+	// The supported version is accepted by WithOCIVersion
+	if _, err := WithOCIVersion(SupportedOCIVersion()); err != nil {
+		t.Errorf("WithOCIVersion(SupportedOCIVersion()) failed: %v", err)
+	}
+}
+
+func TestLibcrunVersion(t *testing.T) {
+	if !regexp.MustCompile(`^\d+\.\d+`).MatchString(LibcrunVersion) {
+		t.Errorf("LibcrunVersion = %q, want a version like 1.26", LibcrunVersion)
+	}
+	if got := (&RuntimeContext{}).Version(); got != LibcrunVersion {
+		t.Errorf("Version() = %q, want %q", got, LibcrunVersion)
+	}
+}
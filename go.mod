@@ -2,4 +2,4 @@ module github.com/danielealbano/libcrun-go
 
 go 1.25
 
-require github.com/opencontainers/runtime-spec v1.2.0
+require github.com/opencontainers/runtime-spec v1.3.0
@@ -3,8 +3,12 @@
 
 #include <unistd.h>
 #include <fcntl.h>
+#include <dirent.h>
 #include <sys/wait.h>
 #include <stdint.h>
+#include <poll.h>
+#include <signal.h>
+#include <sys/prctl.h>
 
 // Forward declaration of the Go callback (defined via //export in runtime.go)
 extern void goLogCallback(uintptr_t handle, int errno_, const char *msg, int verbosity);
@@ -122,6 +126,24 @@ char* go_crun_spec_json(bool rootless, int *out_len, libcrun_error_t *err) {
   return buf;
 }
 
+// ---- Version ----
+const char* go_crun_version(void) {
+  return PACKAGE_VERSION;
+}
+
+// ---- Runtime features ----
+struct features_info_s* go_crun_features(libcrun_error_t *err) {
+  libcrun_context_t ctx = {0};
+  ctx.fifo_exec_wait_fd = -1;
+  struct features_info_s *info = NULL;
+  if (libcrun_container_get_features(&ctx, &info, err) < 0) return NULL;
+  return info;
+}
+
+void go_crun_free_features(struct features_info_s *info) {
+  cleanup_struct_features_free(&info);
+}
+
 // ---- List helper -> char** ----
 int go_crun_list(const char *state_root, char ***out, int *out_len, libcrun_error_t *err) {
   libcrun_container_list_t *lst = NULL, *it = NULL;
@@ -181,6 +203,24 @@ int go_crun_unpause(libcrun_context_t *ctx, const char *id, libcrun_error_t *err
   return libcrun_container_unpause(ctx, id, err);
 }
 
+// ---- Read the container cgroup path from its status ----
+char* go_crun_cgroup_path(const char *state_root, const char *id, libcrun_error_t *err) {
+  libcrun_container_status_t status = {0};
+  int rc = libcrun_read_container_status(&status, state_root, id, err);
+  if (rc < 0) return NULL;
+  char *path = strdup(status.cgroup_path ? status.cgroup_path : "");
+  libcrun_free_container_status(&status);
+  if (!path) libcrun_make_error(err, errno, "strdup failed");
+  return path;
+}
+
+// ---- Container state directory (holds libcrun's copy of config.json) ----
+char* go_crun_state_dir(const char *state_root, const char *id, libcrun_error_t *err) {
+  char *dir = NULL;
+  if (libcrun_get_state_directory(&dir, state_root, id, err) < 0) return NULL;
+  return dir;
+}
+
 // ---- Kill all processes ----
 int go_crun_killall(libcrun_context_t *ctx, const char *id, const char *signal, libcrun_error_t *err) {
   return libcrun_container_killall(ctx, id, signal, err);
@@ -203,6 +243,98 @@ int go_crun_is_running(const char *state_root, const char *id, libcrun_error_t *
   return running;
 }
 
+// ---- Exit code of a stopped container ----
+#define EXIT_CODE_FILE "exit-code"
+
+// Returns the exit code of a waitid result, mapping signals like a shell does.
+static int siginfo_exit_code(const siginfo_t *info) {
+  if (info->si_code == CLD_EXITED) return info->si_status;
+  return 128 + info->si_status;
+}
+
+int go_crun_exit_code(const char *state_root, const char *id, int *out_code, libcrun_error_t *err) {
+  char *dir = NULL;
+  if (libcrun_get_state_directory(&dir, state_root, id, err) < 0) return -1;
+  char *path = NULL;
+  int n = asprintf(&path, "%s/" EXIT_CODE_FILE, dir);
+  free(dir);
+  if (n < 0) return libcrun_make_error(err, errno, "asprintf failed");
+
+  // Recorded by go_crun_create_with_pipes, which reaps the container: the file
+  // is empty until it has
+  FILE *f = fopen(path, "re");
+  free(path);
+  if (f) {
+    int code;
+    int n = fscanf(f, "%d", &code);
+    fclose(f);
+    if (n == 1) {
+      *out_code = code;
+      return 0;
+    }
+    if (n == EOF) return 2;
+  }
+
+  // Otherwise the init may be an unreaped child of this process: peek at its
+  // exit status without reaping it
+  libcrun_container_status_t status = {0};
+  if (libcrun_read_container_status(&status, state_root, id, err) < 0) return -1;
+  pid_t pid = status.pid;
+  libcrun_free_container_status(&status);
+
+  siginfo_t info = {0};
+  int rc;
+  do {
+    rc = waitid(P_PID, pid, &info, WEXITED | WNOHANG | WNOWAIT);
+  } while (rc < 0 && errno == EINTR);
+  if (rc < 0 || info.si_pid != pid) return 1;
+  *out_code = siginfo_exit_code(&info);
+  return 0;
+}
+
+// Returns the path of the exit code file of the container plus suffix, or NULL.
+static char *exit_code_path(libcrun_context_t *ctx, const char *suffix) {
+  char *dir = NULL;
+  libcrun_error_t cerr = NULL;
+  if (libcrun_get_state_directory(&dir, ctx->state_root, ctx->id, &cerr) < 0) {
+    libcrun_error_release(&cerr);
+    return NULL;
+  }
+  char *path = NULL;
+  int n = asprintf(&path, "%s/" EXIT_CODE_FILE "%s", dir, suffix);
+  free(dir);
+  return n < 0 ? NULL : path;
+}
+
+// Marks the exit code of the container as pending for go_crun_exit_code, with
+// an empty file that write_exit_code replaces once the container is reaped.
+static void write_exit_code_pending(libcrun_context_t *ctx) {
+  char *path = exit_code_path(ctx, "");
+  if (path == NULL) return;
+  int fd = open(path, O_WRONLY | O_CREAT | O_TRUNC | O_CLOEXEC, 0644);
+  free(path);
+  if (fd >= 0) close(fd);
+}
+
+// Records the exit code of the container for go_crun_exit_code, atomically so
+// a reader sees either the pending marker or the code.
+static void write_exit_code(libcrun_context_t *ctx, int code) {
+  char *tmp = exit_code_path(ctx, ".tmp");
+  char *path = exit_code_path(ctx, "");
+  FILE *f = tmp ? fopen(tmp, "we") : NULL;
+  if (f) {
+    fprintf(f, "%d\n", code);
+    if (fclose(f) == 0 && path != NULL && rename(tmp, path) == 0) {
+      free(tmp);
+      free(path);
+      return;
+    }
+    unlink(tmp);
+  }
+  free(tmp);
+  free(path);
+}
+
 // ---- Read PIDs ----
 int go_crun_read_pids(libcrun_context_t *ctx, const char *id, int recurse, pid_t **out_pids, int *out_len, libcrun_error_t *err) {
   pid_t *pids = NULL;
@@ -217,8 +349,244 @@ void go_crun_free_pids(pid_t *pids) {
   if (pids) free(pids);
 }
 
-// ---- Run container with isolated I/O via fork ----
-int go_crun_run_with_pipes(
+// ---- Shared fork helpers for the *_with_pipes functions ----
+
+// Closes every fd above stderr except the given ones. Forked children never
+// exec, so O_CLOEXEC does not apply: without this they would keep the parent's
+// ends of the I/O pipes open (e.g. the write end of stdin, so the container
+// never sees EOF), including those of other containers started concurrently.
+static void close_inherited_fds(int keep1, int keep2, int keep3) {
+  DIR *dir = opendir("/proc/self/fd");
+  if (!dir) return;
+  int dir_fd = dirfd(dir);
+  struct dirent *de;
+  while ((de = readdir(dir)) != NULL) {
+    if (de->d_name[0] < '0' || de->d_name[0] > '9') continue;
+    int fd = atoi(de->d_name);
+    if (fd <= STDERR_FILENO || fd == dir_fd || fd == keep1 || fd == keep2 || fd == keep3) continue;
+    close(fd);
+  }
+  closedir(dir);
+}
+
+// Runs in the forked child: installs the log handler, redirects stdio and
+// closes every other inherited fd except log_fd, error_fd and keep_fd (-1 if
+// none). Reports the setup result on error_fd (0 on success, errno on failure)
+// and closes it; on failure the child exits.
+static void child_setup_stdio(int stdin_fd, int stdout_fd, int stderr_fd, int log_fd, int error_fd, int keep_fd) {
+  ssize_t ignored __attribute__((unused));
+
+  // Set up log handler for child process.
+  // The Go callback is not valid after fork, so we either:
+  // - Use log_write_to_pipe if log_fd >= 0 (parent will read from pipe)
+  // - Fall back to log_write_to_stderr otherwise
+  if (log_fd >= 0) {
+    crun_set_output_handler(log_write_to_pipe, (void *)(intptr_t)log_fd);
+  } else {
+    crun_set_output_handler(log_write_to_stderr, NULL);
+  }
+
+  // Redirect stdin
+  if (stdin_fd >= 0) {
+    if (dup2(stdin_fd, STDIN_FILENO) < 0) {
+      int e = errno;
+      ignored = write(error_fd, &e, sizeof(e));
+      _exit(1);
+    }
+    close(stdin_fd);
+  } else {
+    // Redirect stdin to /dev/null
+    int null_fd = open("/dev/null", O_RDONLY);
+    if (null_fd >= 0) {
+      dup2(null_fd, STDIN_FILENO);
+      close(null_fd);
+    }
+  }
+
+  // Redirect stdout
+  if (stdout_fd >= 0) {
+    if (dup2(stdout_fd, STDOUT_FILENO) < 0) {
+      int e = errno;
+      ignored = write(error_fd, &e, sizeof(e));
+      _exit(1);
+    }
+    // The same fd may be used for stderr too (combined output)
+    if (stdout_fd != stderr_fd) close(stdout_fd);
+  }
+
+  // Redirect stderr
+  if (stderr_fd >= 0) {
+    if (dup2(stderr_fd, STDERR_FILENO) < 0) {
+      int e = errno;
+      ignored = write(error_fd, &e, sizeof(e));
+      _exit(1);
+    }
+    close(stderr_fd);
+  }
+
+  close_inherited_fds(log_fd, error_fd, keep_fd);
+
+  // Signal success to parent (write 0)
+  int zero = 0;
+  ignored = write(error_fd, &zero, sizeof(zero));
+  close(error_fd);
+}
+
+// Runs in the parent: reads the child setup result from error_fd (and closes it).
+// On success stores the child pid in out_pid; on failure reaps the child.
+static int parent_check_child_setup(pid_t pid, int error_fd, pid_t *out_pid, libcrun_error_t *err) {
+  int child_errno = 0;
+  ssize_t n = read(error_fd, &child_errno, sizeof(child_errno));
+  close(error_fd);
+
+  if (n != sizeof(child_errno)) {
+    // Child died before writing
+    waitpid(pid, NULL, 0);
+    return libcrun_make_error(err, 0, "child process failed unexpectedly");
+  }
+
+  if (child_errno != 0) {
+    // Child failed during setup
+    waitpid(pid, NULL, 0);
+    return libcrun_make_error(err, child_errno, "child process setup failed");
+  }
+
+  *out_pid = pid;
+  return 0;
+}
+
+// Writes the whole buffer, retrying on EINTR and short writes.
+static int write_all(int fd, const void *buf, size_t len) {
+  const char *p = buf;
+  while (len > 0) {
+    ssize_t n = write(fd, p, len);
+    if (n < 0) {
+      if (errno == EINTR) continue;
+      return -1;
+    }
+    p += n;
+    len -= (size_t)n;
+  }
+  return 0;
+}
+
+// Multiplexes out_fd and err_fd onto mux_fd until both reach EOF.
+// Frame format: [stream:1][len:4][data:len], stream 1 = stdout, 2 = stderr.
+// Chunks are framed in the order the relay reads them. The two pipes are read
+// independently, so writes to stdout and stderr close together may be framed
+// out of order; the order within each stream is preserved.
+static void relay_tagged_output(int out_fd, int err_fd, int mux_fd) {
+  struct pollfd pfds[2] = { { out_fd, POLLIN, 0 }, { err_fd, POLLIN, 0 } };
+  int open_fds = 2;
+  bool mux_ok = true;
+  char buf[32768];
+
+  while (open_fds > 0) {
+    if (poll(pfds, 2, -1) < 0) {
+      if (errno == EINTR) continue;
+      break;
+    }
+    for (int i = 0; i < 2; i++) {
+      if (pfds[i].fd < 0 || pfds[i].revents == 0) continue;
+      ssize_t n = read(pfds[i].fd, buf, sizeof(buf));
+      if (n < 0 && errno == EINTR) continue;
+      if (n <= 0) {
+        close(pfds[i].fd);
+        pfds[i].fd = -1;
+        open_fds--;
+        continue;
+      }
+      // Keep draining after the reader goes away so the container never blocks
+      if (!mux_ok) continue;
+      uint8_t hdr[5];
+      uint32_t len = (uint32_t)n;
+      hdr[0] = (uint8_t)(i + 1);
+      memcpy(hdr + 1, &len, sizeof(len));
+      if (write_all(mux_fd, hdr, sizeof(hdr)) < 0 || write_all(mux_fd, buf, (size_t)n) < 0)
+        mux_ok = false;
+    }
+  }
+}
+
+// Forks the tagged output relay. On success the write ends for the container
+// stdout/stderr are stored in out_stdout_fd/out_stderr_fd and mux_fd is closed
+// in the caller. inherited lists fds (or -1) the relay must not keep open.
+static pid_t start_tagged_relay(int mux_fd, const int *inherited, int n_inherited, int *out_stdout_fd, int *out_stderr_fd) {
+  int out_pipe[2], err_pipe[2];
+  if (pipe(out_pipe) < 0) return -1;
+  if (pipe(err_pipe) < 0) {
+    close(out_pipe[0]);
+    close(out_pipe[1]);
+    return -1;
+  }
+
+  pid_t relay = fork();
+  if (relay < 0) {
+    close(out_pipe[0]);
+    close(out_pipe[1]);
+    close(err_pipe[0]);
+    close(err_pipe[1]);
+    return -1;
+  }
+
+  if (relay == 0) {
+    signal(SIGPIPE, SIG_IGN);
+    close(out_pipe[1]);
+    close(err_pipe[1]);
+    for (int i = 0; i < n_inherited; i++) {
+      if (inherited[i] >= 0) close(inherited[i]);
+    }
+    relay_tagged_output(out_pipe[0], err_pipe[0], mux_fd);
+    _exit(0);
+  }
+
+  close(out_pipe[0]);
+  close(err_pipe[0]);
+  close(mux_fd);
+  *out_stdout_fd = out_pipe[1];
+  *out_stderr_fd = err_pipe[1];
+  return relay;
+}
+
+// Reports the libcrun_container_create result to the parent.
+// Wire format: [failed:4][errno:4][msg_len:4][message:msg_len]
+// The message is formatted like go_crun_err_to_cstr, which also releases cerr.
+static void write_create_result(int fd, int rc, libcrun_error_t *cerr) {
+  int32_t failed = rc < 0 ? 1 : 0;
+  int status = 0;
+  char *msg = go_crun_err_to_cstr(cerr, &status);
+  int32_t e = (int32_t)status;
+  uint32_t len = msg ? (uint32_t)strlen(msg) : 0;
+  if (write_all(fd, &failed, sizeof(failed)) == 0 && write_all(fd, &e, sizeof(e)) == 0 &&
+      write_all(fd, &len, sizeof(len)) == 0 && len > 0)
+    write_all(fd, msg, len);
+  free(msg);
+}
+
+// Waits for the container init process and returns its exit code.
+static int wait_container_exit(libcrun_context_t *ctx) {
+  libcrun_container_status_t status = {0};
+  libcrun_error_t cerr = NULL;
+  if (libcrun_read_container_status(&status, ctx->state_root, ctx->id, &cerr) < 0) {
+    libcrun_error_release(&cerr);
+    return 1;
+  }
+  pid_t pid = status.pid;
+  libcrun_free_container_status(&status);
+
+  int wstatus;
+  pid_t ret;
+  do {
+    ret = waitpid(pid, &wstatus, 0);
+  } while (ret < 0 && errno == EINTR);
+  if (ret < 0) return 1;
+  if (WIFEXITED(wstatus)) return WEXITSTATUS(wstatus);
+  if (WIFSIGNALED(wstatus)) return 128 + WTERMSIG(wstatus);
+  return 1;
+}
+
+// ---- Create container with isolated I/O via fork ----
+int go_crun_create_with_pipes(
     libcrun_context_t *ctx,
     libcrun_container_t *container,
     unsigned int flags,
@@ -226,10 +594,11 @@ int go_crun_run_with_pipes(
     int stdout_fd,
     int stderr_fd,
     int log_fd,
+    int mux_fd,
+    int ready_fd,
     pid_t *out_pid,
     libcrun_error_t *err
 ) {
-  // Create a pipe to communicate errors from child to parent
   int error_pipe[2];
   if (pipe(error_pipe) < 0) {
     return libcrun_make_error(err, errno, "pipe failed");
@@ -244,97 +613,126 @@ int go_crun_run_with_pipes(
 
   if (pid == 0) {
     // Child process
-    close(error_pipe[0]); // Close read end
-    ssize_t ignored __attribute__((unused));
-
-    // Set up log handler for child process.
-    // The Go callback is not valid after fork, so we either:
-    // - Use log_write_to_pipe if log_fd >= 0 (parent will read from pipe)
-    // - Fall back to log_write_to_stderr otherwise
-    if (log_fd >= 0) {
-      crun_set_output_handler(log_write_to_pipe, (void *)(intptr_t)log_fd);
-    } else {
-      crun_set_output_handler(log_write_to_stderr, NULL);
-    }
-
-    // Redirect stdin
-    if (stdin_fd >= 0) {
-      if (dup2(stdin_fd, STDIN_FILENO) < 0) {
-        int e = errno;
-        ignored = write(error_pipe[1], &e, sizeof(e));
-        _exit(1);
-      }
-      close(stdin_fd);
-    } else {
-      // Redirect stdin to /dev/null
-      int null_fd = open("/dev/null", O_RDONLY);
-      if (null_fd >= 0) {
-        dup2(null_fd, STDIN_FILENO);
-        close(null_fd);
-      }
-    }
+    close(error_pipe[0]);
 
-    // Redirect stdout
-    if (stdout_fd >= 0) {
-      if (dup2(stdout_fd, STDOUT_FILENO) < 0) {
-        int e = errno;
-        ignored = write(error_pipe[1], &e, sizeof(e));
-        _exit(1);
-      }
-      close(stdout_fd);
+    // The container init must stay our descendant so its exit code can be reaped,
+    // even when libcrun double-forks (prefork)
+    if (prctl(PR_SET_CHILD_SUBREAPER, 1, 0, 0, 0) < 0) {
+      int e = errno;
+      ssize_t ignored __attribute__((unused)) = write(error_pipe[1], &e, sizeof(e));
+      _exit(1);
     }
 
-    // Redirect stderr
-    if (stderr_fd >= 0) {
-      if (dup2(stderr_fd, STDERR_FILENO) < 0) {
+    pid_t relay = -1;
+    if (mux_fd >= 0) {
+      int inherited[] = { error_pipe[1], stdin_fd, log_fd, ready_fd };
+      relay = start_tagged_relay(mux_fd, inherited, 4, &stdout_fd, &stderr_fd);
+      if (relay < 0) {
         int e = errno;
-        ignored = write(error_pipe[1], &e, sizeof(e));
+        ssize_t ignored __attribute__((unused)) = write(error_pipe[1], &e, sizeof(e));
         _exit(1);
       }
-      close(stderr_fd);
     }
+    child_setup_stdio(stdin_fd, stdout_fd, stderr_fd, log_fd, error_pipe[1], ready_fd);
 
-    // Signal success to parent (write 0)
-    int zero = 0;
-    ignored = write(error_pipe[1], &zero, sizeof(zero));
-    close(error_pipe[1]);
+    // Read before libcrun, which may set it for its own purposes
+    bool detach = ctx->detach;
 
-    // Run the container
     libcrun_error_t child_err = NULL;
-    int rc = libcrun_container_run(ctx, container, flags, &child_err);
-    if (child_err) {
-      libcrun_error_release(&child_err);
+    int rc = libcrun_container_create(ctx, container, flags, &child_err);
+    if (rc >= 0 && !detach)
+      write_exit_code_pending(ctx);
+    write_create_result(ready_fd, rc, &child_err);
+    close(ready_fd);
+
+    // Only the container keeps the I/O pipes open from here on
+    close(STDIN_FILENO);
+    close(STDOUT_FILENO);
+    close(STDERR_FILENO);
+
+    // Detached containers are left running, reparented to the nearest subreaper
+    int exit_code = rc < 0 ? 1 : detach ? 0 : wait_container_exit(ctx);
+    if (rc >= 0 && !detach)
+      write_exit_code(ctx, exit_code);
+    if (relay > 0) {
+      while (waitpid(relay, NULL, 0) < 0 && errno == EINTR)
+        ;
     }
-    // Exit with the container's exit code (rc is the exit status from libcrun)
-    _exit(rc < 0 ? 1 : rc);
+    _exit(exit_code);
   }
 
   // Parent process
-  close(error_pipe[1]); // Close write end
+  close(error_pipe[1]);
+  return parent_check_child_setup(pid, error_pipe[0], out_pid, err);
+}
 
-  // NOTE: Do NOT close stdin_fd/stdout_fd/stderr_fd here.
-  // Go owns these file descriptors and will close them via os.File.Close().
-  // Closing them here would cause double-close issues in concurrent scenarios.
+// ---- Exec a process in a container with isolated I/O via fork ----
+int go_crun_exec_with_pipes(
+    libcrun_context_t *ctx,
+    const char *id,
+    const char *json,
+    int stdin_fd,
+    int stdout_fd,
+    int stderr_fd,
+    int log_fd,
+    const char *pid_file,
+    pid_t *out_pid,
+    libcrun_error_t *err
+) {
+  // Parse before forking so spec errors are reported synchronously
+  char errbuf[1024] = {0};
+  yajl_val tree = yajl_tree_parse(json, errbuf, sizeof(errbuf));
+  if (!tree) return libcrun_make_error(err, 0, "cannot parse the data: `%s`", errbuf);
 
-  // Check if child setup succeeded
-  int child_errno = 0;
-  ssize_t n = read(error_pipe[0], &child_errno, sizeof(child_errno));
-  close(error_pipe[0]);
+  parser_error p_err = NULL;
+  struct parser_context pctx = { 0, stderr };
+  runtime_spec_schema_config_schema_process *proc =
+    make_runtime_spec_schema_config_schema_process(tree, &pctx, &p_err);
+  yajl_tree_free(tree);
 
-  if (n != sizeof(child_errno)) {
-    // Child died before writing
-    waitpid(pid, NULL, 0);
-    return libcrun_make_error(err, 0, "child process failed unexpectedly");
+  if (!proc) {
+    int rc = libcrun_make_error(err, 0, "cannot parse process: %s", p_err ? p_err : "unknown");
+    free(p_err);
+    return rc;
   }
 
-  if (child_errno != 0) {
-    // Child failed during setup
-    waitpid(pid, NULL, 0);
-    return libcrun_make_error(err, child_errno, "child process setup failed");
+  int error_pipe[2];
+  if (pipe(error_pipe) < 0) {
+    free_runtime_spec_schema_config_schema_process(proc);
+    return libcrun_make_error(err, errno, "pipe failed");
   }
 
-  *out_pid = pid;
-  return 0;
+  pid_t pid = fork();
+  if (pid < 0) {
+    close(error_pipe[0]);
+    close(error_pipe[1]);
+    free_runtime_spec_schema_config_schema_process(proc);
+    return libcrun_make_error(err, errno, "fork failed");
+  }
+
+  if (pid == 0) {
+    // Child process
+    close(error_pipe[0]);
+    child_setup_stdio(stdin_fd, stdout_fd, stderr_fd, log_fd, error_pipe[1], -1);
+
+    // The context is a private copy after fork: wait for the process and
+    // record its pid so the parent can signal it directly.
+    ctx->detach = false;
+    ctx->pid_file = pid_file;
+
+    libcrun_error_t child_err = NULL;
+    int rc = libcrun_container_exec(ctx, id, proc, &child_err);
+    if (child_err) {
+      libcrun_error_release(&child_err);
+    }
+    // Exit with the process exit code (rc is the exit status from libcrun)
+    _exit(rc < 0 ? 1 : rc);
+  }
+
+  // Parent process
+  close(error_pipe[1]);
+  free_runtime_spec_schema_config_schema_process(proc);
+  return parent_check_child_setup(pid, error_pipe[0], out_pid, err);
 }
 
 // ---- Wait for forked container child ----
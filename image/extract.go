@@ -0,0 +1,336 @@
+//go:build linux
+
+package image
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// Whiteout markers of the OCI image layer format.
+const (
+	whiteoutPrefix = ".wh."
+	opaqueWhiteout = ".wh..wh..opq" // hides the lower layer contents of its directory
+)
+
+// maxSymlinks bounds the symlinks followed while resolving a path, like the
+// kernel's limit.
+const maxSymlinks = 255
+
+// ApplyLayer extracts the layer tar stream r on top of the rootfs in dir,
+// removing the files its whiteouts hide, and returns the number of entries
+// read. Entries whose name leaves dir through ".." are rejected; symlinks are
+// resolved as if dir were the root, so no entry is written outside dir.
+// Device nodes and FIFOs are skipped.
+func ApplyLayer(r io.Reader, dir string) (int, error) {
+	return extractTar(r, dir, false)
+}
+
+// ExtractLayer is like ApplyLayer but keeps whiteouts as empty marker files
+// instead of applying them, e.g. to cache a layer and apply it later.
+func ExtractLayer(r io.Reader, dir string) (int, error) {
+	return extractTar(r, dir, true)
+}
+
+func extractTar(r io.Reader, dir string, keepWhiteouts bool) (int, error) {
+	tr := tar.NewReader(r)
+	written := make(map[string]bool) // entries of this layer, kept by opaque whiteouts
+
+	count := 0
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return count, fmt.Errorf("failed to read tar entry: %w", err)
+		}
+		count++
+
+		name, err := cleanName(header.Name)
+		if err != nil {
+			return count, err
+		}
+		if name == "" {
+			continue // the root itself
+		}
+		parent, err := secureJoin(dir, filepath.Dir(name))
+		if err != nil {
+			return count, err
+		}
+		base := filepath.Base(name)
+		targetPath := filepath.Join(parent, base)
+
+		if strings.HasPrefix(base, whiteoutPrefix) && !keepWhiteouts {
+			if base == opaqueWhiteout {
+				if err := removeLower(parent, filepath.Dir(name), written); err != nil {
+					return count, err
+				}
+			} else if err := os.RemoveAll(filepath.Join(parent, strings.TrimPrefix(base, whiteoutPrefix))); err != nil {
+				return count, fmt.Errorf("failed to apply whiteout %s: %w", name, err)
+			}
+			continue
+		}
+		written[name] = true
+
+		mode := os.FileMode(header.Mode).Perm()
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if fi, err := os.Lstat(targetPath); err == nil && !fi.IsDir() {
+				os.Remove(targetPath)
+			}
+			if err := os.MkdirAll(targetPath, mode); err != nil {
+				return count, fmt.Errorf("failed to create directory %s: %w", targetPath, err)
+			}
+
+		case tar.TypeReg:
+			if err := prepareTarget(parent, targetPath); err != nil {
+				return count, err
+			}
+			if err := writeFile(targetPath, tr, mode); err != nil {
+				return count, err
+			}
+
+		case tar.TypeSymlink:
+			// Created as is: the link is resolved inside the container, and
+			// only ever followed here by secureJoin
+			if err := prepareTarget(parent, targetPath); err != nil {
+				return count, err
+			}
+			if err := os.Symlink(header.Linkname, targetPath); err != nil {
+				return count, fmt.Errorf("failed to create symlink %s -> %s: %w", targetPath, header.Linkname, err)
+			}
+
+		case tar.TypeLink:
+			linkName, err := cleanName(header.Linkname)
+			if err != nil {
+				return count, err
+			}
+			linkParent, err := secureJoin(dir, filepath.Dir(linkName))
+			if err != nil {
+				return count, err
+			}
+			linkTarget := filepath.Join(linkParent, filepath.Base(linkName))
+			if err := prepareTarget(parent, targetPath); err != nil {
+				return count, err
+			}
+			if err := os.Link(linkTarget, targetPath); err != nil {
+				// Copy if the rootfs cannot hold hard links
+				if copyErr := copyFile(linkTarget, targetPath); copyErr != nil {
+					return count, fmt.Errorf("failed to create hardlink %s -> %s: %w (copy also failed: %v)", targetPath, linkTarget, err, copyErr)
+				}
+			}
+
+		case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+			// Device nodes need privileges and are provided by the runtime
+			continue
+		}
+	}
+	return count, nil
+}
+
+// cleanName returns the tar entry name as a clean path relative to the root,
+// "" for the root itself, rejecting names that escape it.
+func cleanName(name string) (string, error) {
+	clean := filepath.Clean(strings.TrimLeft(name, "/"))
+	if clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("invalid tar entry %q: path escapes the rootfs", name)
+	}
+	if clean == "." {
+		return "", nil
+	}
+	return clean, nil
+}
+
+// secureJoin resolves the relative path name under root, following symlinks
+// as if root were the filesystem root, so the result never leaves root.
+// Missing components are taken as is.
+func secureJoin(root, name string) (string, error) {
+	resolved := "/"
+	remaining := name
+	links := 0
+	for remaining != "" {
+		var part string
+		part, remaining, _ = strings.Cut(remaining, "/")
+		if part == "" || part == "." {
+			continue
+		}
+		if part == ".." {
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+		next := filepath.Join(resolved, part)
+		fi, err := os.Lstat(filepath.Join(root, next))
+		if err != nil || fi.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+		if links++; links > maxSymlinks {
+			return "", fmt.Errorf("failed to resolve %s: %w", name, syscall.ELOOP)
+		}
+		dest, err := os.Readlink(filepath.Join(root, next))
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(dest) {
+			resolved = "/"
+		}
+		remaining = dest + "/" + remaining
+	}
+	return filepath.Join(root, resolved), nil
+}
+
+// prepareTarget creates the parent directory of a new entry and removes
+// whatever the entry replaces, as later layers overwrite earlier ones.
+func prepareTarget(parent, targetPath string) error {
+	if err := os.MkdirAll(parent, 0755); err != nil {
+		return fmt.Errorf("failed to create parent directory for %s: %w", targetPath, err)
+	}
+	if err := os.RemoveAll(targetPath); err != nil {
+		return fmt.Errorf("failed to replace %s: %w", targetPath, err)
+	}
+	return nil
+}
+
+// writeFile creates path with the content of r. O_EXCL keeps a symlink
+// created since prepareTarget from redirecting the write.
+func writeFile(path string, r io.Reader, mode os.FileMode) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+	if err != nil {
+		return fmt.Errorf("failed to create file %s: %w", path, err)
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write file %s: %w", path, err)
+	}
+	return file.Close()
+}
+
+// removeLower removes the entries of dirPath (name in the layer) that this
+// layer did not write, for an opaque whiteout.
+func removeLower(dirPath, name string, written map[string]bool) error {
+	entries, err := os.ReadDir(dirPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to apply opaque whiteout in %s: %w", name, err)
+	}
+	for _, e := range entries {
+		if written[filepath.Join(name, e.Name())] {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(dirPath, e.Name())); err != nil {
+			return fmt.Errorf("failed to apply opaque whiteout in %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// copyFile copies the regular file src to dst.
+func copyFile(src, dst string) error {
+	// The link target is only resolved up to its parent: never follow it
+	srcFile, err := os.OpenFile(src, os.O_RDONLY|syscall.O_NOFOLLOW, 0)
+	if err != nil {
+		return err
+	}
+	defer srcFile.Close()
+
+	srcInfo, err := srcFile.Stat()
+	if err != nil {
+		return err
+	}
+	if !srcInfo.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", src)
+	}
+	return writeFile(dst, srcFile, srcInfo.Mode().Perm())
+}
+
+// ApplyLayerDir applies a layer extracted by ExtractLayer to layerDir,
+// whiteout markers included, on top of the rootfs in dir. Files are copied,
+// so layerDir can be shared, e.g. by a layer cache. Like ApplyLayer, paths are
+// resolved as if dir were the root, so a symlink created by an earlier layer
+// cannot redirect a write outside dir.
+func ApplyLayerDir(layerDir, dir string) error {
+	// Whiteouts first: they only hide lower layers, never this layer's files
+	err := filepath.WalkDir(layerDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !strings.HasPrefix(d.Name(), whiteoutPrefix) {
+			return err
+		}
+		rel, err := filepath.Rel(layerDir, path)
+		if err != nil {
+			return err
+		}
+		parent, err := secureJoin(dir, filepath.Dir(rel))
+		if err != nil {
+			return err
+		}
+		if d.Name() == opaqueWhiteout {
+			return removeLower(parent, filepath.Dir(rel), nil)
+		}
+		if err := os.RemoveAll(filepath.Join(parent, strings.TrimPrefix(d.Name(), whiteoutPrefix))); err != nil {
+			return fmt.Errorf("failed to apply whiteout %s: %w", rel, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return filepath.WalkDir(layerDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(layerDir, path)
+		if err != nil || rel == "." || strings.HasPrefix(d.Name(), whiteoutPrefix) {
+			return err
+		}
+		parent, err := secureJoin(dir, filepath.Dir(rel))
+		if err != nil {
+			return err
+		}
+		targetPath := filepath.Join(parent, d.Name())
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case d.IsDir():
+			if fi, err := os.Lstat(targetPath); err == nil && !fi.IsDir() {
+				os.Remove(targetPath)
+			}
+			if err := os.MkdirAll(targetPath, info.Mode().Perm()); err != nil {
+				return fmt.Errorf("failed to create directory %s: %w", targetPath, err)
+			}
+
+		case d.Type()&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			if err := prepareTarget(parent, targetPath); err != nil {
+				return err
+			}
+			if err := os.Symlink(link, targetPath); err != nil {
+				return fmt.Errorf("failed to create symlink %s -> %s: %w", targetPath, link, err)
+			}
+
+		case d.Type().IsRegular():
+			if err := prepareTarget(parent, targetPath); err != nil {
+				return err
+			}
+			if err := copyFile(path, targetPath); err != nil {
+				return fmt.Errorf("failed to copy %s: %w", targetPath, err)
+			}
+		}
+		return nil
+	})
+}
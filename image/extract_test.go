@@ -0,0 +1,411 @@
+//go:build linux
+
+package image
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+	"github.com/google/go-containerregistry/pkg/v1/empty"
+	"github.com/google/go-containerregistry/pkg/v1/mutate"
+	"github.com/google/go-containerregistry/pkg/v1/tarball"
+)
+
+// entry is a synthetic tar entry: a regular file unless typ or link is set.
+type entry struct {
+	name    string
+	content string
+	typ     byte
+	link    string
+}
+
+func tarStream(t *testing.T, entries ...entry) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0644, Typeflag: e.typ, Linkname: e.link}
+		switch {
+		case e.typ == tar.TypeDir:
+			hdr.Mode = 0755
+		case e.typ == 0:
+			hdr.Typeflag = tar.TypeReg
+			hdr.Size = int64(len(e.content))
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatalf("failed to write tar header: %v", err)
+		}
+		if hdr.Typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(e.content)); err != nil {
+				t.Fatalf("failed to write tar content: %v", err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatalf("failed to close tar: %v", err)
+	}
+	return &buf
+}
+
+func tarLayer(t *testing.T, entries ...entry) v1.Layer {
+	t.Helper()
+	data := tarStream(t, entries...).Bytes()
+	layer, err := tarball.LayerFromOpener(func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	})
+	if err != nil {
+		t.Fatalf("failed to create layer: %v", err)
+	}
+	return layer
+}
+
+func assertExists(t *testing.T, root string, want map[string]bool) {
+	t.Helper()
+	for path, exists := range want {
+		_, err := os.Lstat(filepath.Join(root, path))
+		if got := err == nil; got != exists {
+			t.Errorf("%s exists = %v, want %v", path, got, exists)
+		}
+	}
+}
+
+func TestApplyLayerWhiteouts(t *testing.T) {
+	rootfs := t.TempDir()
+	if _, err := ApplyLayer(tarStream(t,
+		entry{name: "keep.txt", content: "keep"},
+		entry{name: "gone.txt", content: "gone"},
+		entry{name: "gonedir/file", content: "x"},
+		entry{name: "opaque/old.txt", content: "old"},
+	), rootfs); err != nil {
+		t.Fatalf("ApplyLayer(lower) error = %v", err)
+	}
+
+	// The opaque marker comes after this layer's own file in the directory
+	n, err := ApplyLayer(tarStream(t,
+		entry{name: ".wh.gone.txt"},
+		entry{name: ".wh.gonedir"},
+		entry{name: "opaque/new.txt", content: "new"},
+		entry{name: "opaque/.wh..wh..opq"},
+	), rootfs)
+	if err != nil {
+		t.Fatalf("ApplyLayer(upper) error = %v", err)
+	}
+	if n != 4 {
+		t.Errorf("ApplyLayer() = %d entries, want 4", n)
+	}
+
+	assertExists(t, rootfs, map[string]bool{
+		"keep.txt":            true,
+		"gone.txt":            false,
+		"gonedir":             false,
+		"opaque/old.txt":      false,
+		"opaque/new.txt":      true,
+		".wh.gone.txt":        false,
+		"opaque/.wh..wh..opq": false,
+	})
+}
+
+func TestExtractLayerKeepsWhiteouts(t *testing.T) {
+	dir := t.TempDir()
+	if _, err := ExtractLayer(tarStream(t,
+		entry{name: ".wh.gone.txt"},
+		entry{name: "dir/.wh..wh..opq"},
+		entry{name: "dir/new.txt", content: "new"},
+	), dir); err != nil {
+		t.Fatalf("ExtractLayer() error = %v", err)
+	}
+	assertExists(t, dir, map[string]bool{
+		".wh.gone.txt":     true,
+		"dir/.wh..wh..opq": true,
+		"dir/new.txt":      true,
+	})
+}
+
+func TestApplyLayerRejectsParentPaths(t *testing.T) {
+	for _, name := range []string{"../escape.txt", "a/../../escape.txt", "..", "../.wh.victim"} {
+		parent := t.TempDir()
+		rootfs := filepath.Join(parent, "rootfs")
+		if err := os.Mkdir(rootfs, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(parent, "victim"), []byte("x"), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := ApplyLayer(tarStream(t, entry{name: name, content: "pwned"}), rootfs); err == nil {
+			t.Errorf("ApplyLayer(%q) succeeded, want error", name)
+		}
+		assertExists(t, parent, map[string]bool{"escape.txt": false, "victim": true})
+	}
+
+	// Leading slashes and inner ".." that stay inside are fine
+	rootfs := t.TempDir()
+	if _, err := ApplyLayer(tarStream(t,
+		entry{name: "/abs.txt", content: "abs"},
+		entry{name: "a/../inner.txt", content: "inner"},
+	), rootfs); err != nil {
+		t.Fatalf("ApplyLayer() error = %v", err)
+	}
+	assertExists(t, rootfs, map[string]bool{"abs.txt": true, "inner.txt": true})
+}
+
+func TestApplyLayerSymlinks(t *testing.T) {
+	parent := t.TempDir()
+	outside := filepath.Join(parent, "outside")
+	rootfs := filepath.Join(parent, "rootfs")
+	for _, dir := range []string{outside, rootfs} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := ApplyLayer(tarStream(t,
+		entry{name: "etc", typ: tar.TypeDir},
+		entry{name: "etc/target.txt", content: "target"},
+		entry{name: "etc/link", typ: tar.TypeSymlink, link: "target.txt"},
+		// Symlinks to the host are created as is...
+		entry{name: "abs", typ: tar.TypeSymlink, link: outside},
+		entry{name: "rel", typ: tar.TypeSymlink, link: "../../outside"},
+		// ...but resolved inside the rootfs when extracting through them
+		entry{name: "abs/file.txt", content: "abs"},
+		entry{name: "rel/file.txt", content: "rel"},
+		entry{name: "abs/.wh.victim"},
+		entry{name: "hard", typ: tar.TypeLink, link: "etc/target.txt"},
+	), rootfs); err != nil {
+		t.Fatalf("ApplyLayer() error = %v", err)
+	}
+
+	if link, err := os.Readlink(filepath.Join(rootfs, "etc/link")); err != nil || link != "target.txt" {
+		t.Errorf("etc/link = %q, %v, want target.txt", link, err)
+	}
+	if link, err := os.Readlink(filepath.Join(rootfs, "abs")); err != nil || link != outside {
+		t.Errorf("abs = %q, %v, want %q", link, err, outside)
+	}
+	entries, err := os.ReadDir(outside)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("extraction wrote %d entries outside the rootfs", len(entries))
+	}
+
+	// abs resolves to <rootfs><outside>, rel to <rootfs>/outside
+	content, err := os.ReadFile(filepath.Join(rootfs, outside, "file.txt"))
+	if err != nil || string(content) != "abs" {
+		t.Errorf("file through abs = %q, %v, want it inside the rootfs", content, err)
+	}
+	content, err = os.ReadFile(filepath.Join(rootfs, "outside", "file.txt"))
+	if err != nil || string(content) != "rel" {
+		t.Errorf("file through rel = %q, %v, want it inside the rootfs", content, err)
+	}
+	content, err = os.ReadFile(filepath.Join(rootfs, "hard"))
+	if err != nil || string(content) != "target" {
+		t.Errorf("hard = %q, %v, want the link target content", content, err)
+	}
+}
+
+func TestApplyLayerHardlinkToEscapingSymlink(t *testing.T) {
+	parent := t.TempDir()
+	rootfs := filepath.Join(parent, "rootfs")
+	if err := os.Mkdir(rootfs, 0755); err != nil {
+		t.Fatal(err)
+	}
+	secret := filepath.Join(parent, "secret")
+	if err := os.WriteFile(secret, []byte("secret"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// A hard link to a symlink links the symlink itself, never its host target
+	if _, err := ApplyLayer(tarStream(t,
+		entry{name: "evil", typ: tar.TypeSymlink, link: secret},
+		entry{name: "copy", typ: tar.TypeLink, link: "evil"},
+	), rootfs); err != nil {
+		t.Fatalf("ApplyLayer() error = %v", err)
+	}
+	fi, err := os.Lstat(filepath.Join(rootfs, "copy"))
+	if err != nil {
+		t.Fatalf("copy missing: %v", err)
+	}
+	if fi.Mode()&os.ModeSymlink == 0 {
+		t.Errorf("copy mode = %v, want a symlink", fi.Mode())
+	}
+}
+
+func TestSecureJoin(t *testing.T) {
+	root := t.TempDir()
+	for name, link := range map[string]string{"abs": "/etc", "up": "../../..", "loop": "loop"} {
+		if err := os.Symlink(link, filepath.Join(root, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "a/b", want: "a/b"},
+		{name: "abs/passwd", want: "etc/passwd"},
+		{name: "up/etc", want: "etc"},
+		{name: "../../x", want: "x"},
+	}
+	for _, tt := range tests {
+		got, err := secureJoin(root, tt.name)
+		if err != nil {
+			t.Errorf("secureJoin(%q) error = %v", tt.name, err)
+			continue
+		}
+		if want := filepath.Join(root, tt.want); got != want {
+			t.Errorf("secureJoin(%q) = %q, want %q", tt.name, got, want)
+		}
+	}
+	if _, err := secureJoin(root, "loop/x"); err == nil {
+		t.Error("secureJoin through a symlink loop succeeded, want error")
+	}
+}
+
+func TestExtractToRootfs(t *testing.T) {
+	img, err := mutate.AppendLayers(empty.Image,
+		tarLayer(t, entry{name: "bin/sh", content: "shell"}, entry{name: "tmp/old", content: "old"}),
+		tarLayer(t, entry{name: "tmp/.wh.old"}, entry{name: "etc/hostname", content: "box"}),
+	)
+	if err != nil {
+		t.Fatalf("failed to build image: %v", err)
+	}
+	img, err = mutate.Config(img, v1.Config{
+		Entrypoint: []string{"/bin/sh"},
+		Cmd:        []string{"-c", "true"},
+		Env:        []string{"PATH=/bin"},
+		WorkingDir: "/tmp",
+		User:       "1000",
+	})
+	if err != nil {
+		t.Fatalf("failed to set config: %v", err)
+	}
+
+	rootfs := t.TempDir()
+	config, err := ExtractToRootfs(img, rootfs)
+	if err != nil {
+		t.Fatalf("ExtractToRootfs() error = %v", err)
+	}
+	want := ImageConfig{
+		Entrypoint: []string{"/bin/sh"},
+		Cmd:        []string{"-c", "true"},
+		Env:        []string{"PATH=/bin"},
+		WorkingDir: "/tmp",
+		User:       "1000",
+	}
+	if !reflect.DeepEqual(config, want) {
+		t.Errorf("config = %+v, want %+v", config, want)
+	}
+	assertExists(t, rootfs, map[string]bool{"bin/sh": true, "etc/hostname": true, "tmp/old": false})
+}
+
+// escapeFixture returns a rootfs and a host file at <rootfs>/../../etc/passwd
+// that malicious layers try to overwrite.
+func escapeFixture(t *testing.T) (rootfs, hostFile string) {
+	t.Helper()
+	parent := t.TempDir()
+	rootfs = filepath.Join(parent, "var", "rootfs")
+	hostFile = filepath.Join(parent, "etc", "passwd")
+	for _, dir := range []string{rootfs, filepath.Dir(hostFile)} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.WriteFile(hostFile, []byte("root:x:0:0::/root:/bin/sh\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return rootfs, hostFile
+}
+
+func assertUntouched(t *testing.T, hostFile string) {
+	t.Helper()
+	content, err := os.ReadFile(hostFile)
+	if err != nil || string(content) != "root:x:0:0::/root:/bin/sh\n" {
+		t.Errorf("host file = %q, %v, want it untouched", content, err)
+	}
+}
+
+func TestApplyLayerMaliciousLayers(t *testing.T) {
+	t.Run("parent path", func(t *testing.T) {
+		rootfs, hostFile := escapeFixture(t)
+		if _, err := ApplyLayer(tarStream(t, entry{name: "../../etc/passwd", content: "pwned"}), rootfs); err == nil {
+			t.Error("ApplyLayer() succeeded, want the entry rejected")
+		}
+		assertUntouched(t, hostFile)
+	})
+
+	t.Run("symlink then write", func(t *testing.T) {
+		rootfs, hostFile := escapeFixture(t)
+		if _, err := ApplyLayer(tarStream(t,
+			entry{name: "etc", typ: tar.TypeSymlink, link: filepath.Dir(hostFile)},
+			entry{name: "etc/passwd", content: "pwned"},
+		), rootfs); err != nil {
+			t.Fatalf("ApplyLayer() error = %v", err)
+		}
+		assertUntouched(t, hostFile)
+	})
+
+	t.Run("symlink then write in a later layer", func(t *testing.T) {
+		rootfs, hostFile := escapeFixture(t)
+		if _, err := ApplyLayer(tarStream(t,
+			entry{name: "conf", typ: tar.TypeSymlink, link: "../../etc"},
+			entry{name: "passwd", typ: tar.TypeSymlink, link: hostFile},
+		), rootfs); err != nil {
+			t.Fatalf("ApplyLayer(lower) error = %v", err)
+		}
+		if _, err := ApplyLayer(tarStream(t,
+			entry{name: "conf/passwd", content: "pwned"},
+			entry{name: "passwd", content: "pwned"},
+			entry{name: "conf/.wh.passwd"},
+		), rootfs); err != nil {
+			t.Fatalf("ApplyLayer(upper) error = %v", err)
+		}
+		assertUntouched(t, hostFile)
+	})
+}
+
+func TestApplyLayerDir(t *testing.T) {
+	rootfs, hostFile := escapeFixture(t)
+
+	// The lower layer plants a symlink to the host, the upper one writes through it
+	lower, upper := t.TempDir(), t.TempDir()
+	if _, err := ExtractLayer(tarStream(t,
+		entry{name: "etc", typ: tar.TypeSymlink, link: filepath.Dir(hostFile)},
+		entry{name: "keep.txt", content: "keep"},
+		entry{name: "gone.txt", content: "gone"},
+		entry{name: "opaque/old.txt", content: "old"},
+	), lower); err != nil {
+		t.Fatalf("ExtractLayer(lower) error = %v", err)
+	}
+	if _, err := ExtractLayer(tarStream(t,
+		entry{name: "etc/passwd", content: "pwned"},
+		entry{name: ".wh.gone.txt"},
+		entry{name: "opaque/.wh..wh..opq"},
+		entry{name: "opaque/new.txt", content: "new"},
+	), upper); err != nil {
+		t.Fatalf("ExtractLayer(upper) error = %v", err)
+	}
+
+	for _, layer := range []string{lower, upper} {
+		if err := ApplyLayerDir(layer, rootfs); err != nil {
+			t.Fatalf("ApplyLayerDir(%s) error = %v", layer, err)
+		}
+	}
+	assertUntouched(t, hostFile)
+	assertExists(t, rootfs, map[string]bool{
+		"keep.txt":            true,
+		"gone.txt":            false,
+		".wh.gone.txt":        false,
+		"opaque/old.txt":      false,
+		"opaque/new.txt":      true,
+		"opaque/.wh..wh..opq": false,
+		"etc/passwd":          true,
+	})
+}
@@ -0,0 +1,67 @@
+//go:build linux
+
+// Package image extracts OCI images into root filesystems usable with
+// crun.WithRootPath. Extraction applies layer whiteouts and never writes
+// outside the target directory, whatever paths and symlinks the layers hold.
+package image
+
+import (
+	"fmt"
+
+	v1 "github.com/google/go-containerregistry/pkg/v1"
+)
+
+// ImageConfig holds the runtime configuration of an OCI image.
+type ImageConfig struct {
+	Entrypoint []string
+	Cmd        []string
+	Env        []string
+	WorkingDir string
+	User       string
+	Labels     map[string]string
+}
+
+// ReadConfig returns the runtime configuration of img.
+func ReadConfig(img v1.Image) (ImageConfig, error) {
+	configFile, err := img.ConfigFile()
+	if err != nil {
+		return ImageConfig{}, fmt.Errorf("failed to get image config: %w", err)
+	}
+	return ImageConfig{
+		Entrypoint: configFile.Config.Entrypoint,
+		Cmd:        configFile.Config.Cmd,
+		Env:        configFile.Config.Env,
+		WorkingDir: configFile.Config.WorkingDir,
+		User:       configFile.Config.User,
+		Labels:     configFile.Config.Labels,
+	}, nil
+}
+
+// ExtractToRootfs extracts the layers of img in order into dir, which must
+// exist, applying their whiteouts, and returns the image configuration.
+func ExtractToRootfs(img v1.Image, dir string) (ImageConfig, error) {
+	config, err := ReadConfig(img)
+	if err != nil {
+		return ImageConfig{}, err
+	}
+	layers, err := img.Layers()
+	if err != nil {
+		return ImageConfig{}, fmt.Errorf("failed to get layers: %w", err)
+	}
+	for i, layer := range layers {
+		if err := applyLayer(layer, dir); err != nil {
+			return ImageConfig{}, fmt.Errorf("failed to extract layer %d: %w", i+1, err)
+		}
+	}
+	return config, nil
+}
+
+func applyLayer(layer v1.Layer, dir string) error {
+	r, err := layer.Uncompressed()
+	if err != nil {
+		return fmt.Errorf("failed to get uncompressed layer: %w", err)
+	}
+	defer r.Close()
+	_, err = ApplyLayer(r, dir)
+	return err
+}
@@ -0,0 +1,72 @@
+//go:build linux
+
+package crun
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// RuntimeInfoResult describes the environment containers run in.
+type RuntimeInfoResult struct {
+	// Rootless is true when running as a non-root user or inside a user
+	// namespace, where containers need the rootless spec (NewSpec(true, ...)).
+	Rootless bool
+	// CgroupVersion is 2 on a unified cgroup v2 hierarchy, 1 otherwise.
+	// Some options only apply to one version, e.g. real-time CPU bandwidth
+	// to cgroup v1.
+	CgroupVersion int
+	// SystemdAvailable is true when the host was booted with systemd, so
+	// RuntimeConfig.SystemdCgroup can be used.
+	SystemdAvailable bool
+}
+
+// RuntimeInfo probes the host and reports the environment containers run in.
+func RuntimeInfo() (*RuntimeInfoResult, error) {
+	return runtimeInfo("/", os.Geteuid())
+}
+
+// runtimeInfo probes the host filesystem mounted at root.
+func runtimeInfo(root string, euid int) (*RuntimeInfoResult, error) {
+	inUserNS, err := inUserNamespace(filepath.Join(root, "proc", "self", "uid_map"))
+	if err != nil {
+		return nil, err
+	}
+
+	cgroupDir := filepath.Join(root, strings.TrimPrefix(cgroupRoot, "/"))
+	if _, err := os.Stat(cgroupDir); err != nil {
+		return nil, fmt.Errorf("libcrun: no cgroup filesystem: %w", err)
+	}
+	cgroupVersion := 1
+	if isCgroupV2At(cgroupDir) {
+		cgroupVersion = 2
+	}
+
+	// Like sd_booted(3)
+	_, err = os.Lstat(filepath.Join(root, "run", "systemd", "system"))
+
+	return &RuntimeInfoResult{
+		Rootless:         euid != 0 || inUserNS,
+		CgroupVersion:    cgroupVersion,
+		SystemdAvailable: err == nil,
+	}, nil
+}
+
+// inUserNamespace reports whether the uid_map at path is not the identity
+// mapping of the initial user namespace.
+func inUserNamespace(path string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		// Kernels without user namespaces
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	fields := strings.Fields(string(data))
+	initial := len(fields) == 3 && fields[0] == "0" && fields[1] == "0" && fields[2] == "4294967295"
+	return !initial, nil
+}
@@ -0,0 +1,104 @@
+//go:build linux
+
+package crun
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakeHostRoot creates a host filesystem with the given uid_map, cgroup
+// version (0 for none) and systemd marker.
+func fakeHostRoot(t *testing.T, uidMap string, cgroupVersion int, systemd bool) string {
+	t.Helper()
+	root := t.TempDir()
+	write := func(path, content string) {
+		full := filepath.Join(root, path)
+		if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", filepath.Dir(full), err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", full, err)
+		}
+	}
+	mkdir := func(path string) {
+		if err := os.MkdirAll(filepath.Join(root, path), 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", path, err)
+		}
+	}
+
+	if uidMap != "" {
+		write("proc/self/uid_map", uidMap)
+	}
+	switch cgroupVersion {
+	case 1:
+		mkdir("sys/fs/cgroup/memory")
+	case 2:
+		write("sys/fs/cgroup/cgroup.controllers", "cpu memory pids\n")
+	}
+	if systemd {
+		mkdir("run/systemd/system")
+	}
+	return root
+}
+
+func TestRuntimeInfo(t *testing.T) {
+	const initialMap = "         0          0 4294967295\n"
+	tests := []struct {
+		name string
+		root string
+		euid int
+		want RuntimeInfoResult
+	}{
+		{
+			name: "root on cgroup v2 with systemd",
+			root: fakeHostRoot(t, initialMap, 2, true),
+			want: RuntimeInfoResult{CgroupVersion: 2, SystemdAvailable: true},
+		},
+		{
+			name: "unprivileged user on cgroup v1",
+			root: fakeHostRoot(t, initialMap, 1, false),
+			euid: 1000,
+			want: RuntimeInfoResult{Rootless: true, CgroupVersion: 1},
+		},
+		{
+			name: "root in a user namespace",
+			root: fakeHostRoot(t, "         0       1000          1\n", 2, false),
+			want: RuntimeInfoResult{Rootless: true, CgroupVersion: 2},
+		},
+		{
+			name: "no user namespace support",
+			root: fakeHostRoot(t, "", 2, true),
+			want: RuntimeInfoResult{CgroupVersion: 2, SystemdAvailable: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := runtimeInfo(tt.root, tt.euid)
+			if err != nil {
+				t.Fatalf("runtimeInfo failed: %v", err)
+			}
+			if *got != tt.want {
+				t.Errorf("runtimeInfo = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+
+	if _, err := runtimeInfo(fakeHostRoot(t, initialMap, 0, false), 0); err == nil {
+		t.Error("runtimeInfo without a cgroup filesystem succeeded, want error")
+	}
+}
+
+func TestRuntimeInfoHost(t *testing.T) {
+	info, err := RuntimeInfo()
+	if err != nil {
+		t.Skipf("Skipping: %v", err)
+	}
+	if info.CgroupVersion != 1 && info.CgroupVersion != 2 {
+		t.Errorf("CgroupVersion = %d, want 1 or 2", info.CgroupVersion)
+	}
+	if os.Geteuid() != 0 && !info.Rootless {
+		t.Error("Rootless = false for a non-root user")
+	}
+}
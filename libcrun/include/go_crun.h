@@ -33,6 +33,13 @@ void go_crun_free_container(libcrun_container_t *ctr);
 char* go_crun_state_json(libcrun_context_t *ctx, const char *id, int *out_len, libcrun_error_t *err);
 char* go_crun_spec_json(bool rootless, int *out_len, libcrun_error_t *err);
 
+// Version of the bundled libcrun, as printed by crun --version
+const char* go_crun_version(void);
+
+// Runtime features, freed with go_crun_free_features
+struct features_info_s* go_crun_features(libcrun_error_t *err);
+void go_crun_free_features(struct features_info_s *info);
+
 // Container list helpers
 int go_crun_list(const char *state_root, char ***out, int *out_len, libcrun_error_t *err);
 void go_crun_free_strv(char **v, int n);
@@ -44,6 +51,12 @@ int go_crun_exec_json(libcrun_context_t *ctx, const char *id, const char *json,
 int go_crun_pause(libcrun_context_t *ctx, const char *id, libcrun_error_t *err);
 int go_crun_unpause(libcrun_context_t *ctx, const char *id, libcrun_error_t *err);
 
+// Read the container cgroup path (relative to the cgroup root) from its status
+char* go_crun_cgroup_path(const char *state_root, const char *id, libcrun_error_t *err);
+
+// Container state directory, where libcrun keeps its copy of config.json (caller frees)
+char* go_crun_state_dir(const char *state_root, const char *id, libcrun_error_t *err);
+
 // Kill all processes
 int go_crun_killall(libcrun_context_t *ctx, const char *id, const char *signal, libcrun_error_t *err);
 
@@ -53,15 +66,30 @@ int go_crun_update(libcrun_context_t *ctx, const char *id, const char *content,
 // Check if container is running
 int go_crun_is_running(const char *state_root, const char *id, libcrun_error_t *err);
 
+// Exit code of a stopped container, recorded when go_crun_create_with_pipes
+// reaped it or read from its init if it is an unreaped child of the caller.
+// Returns 0 with *out_code set, 1 if the exit code is not available, 2 if it is
+// yet to be recorded by go_crun_create_with_pipes, <0 on error.
+int go_crun_exit_code(const char *state_root, const char *id, int *out_code, libcrun_error_t *err);
+
 // Read PIDs
 int go_crun_read_pids(libcrun_context_t *ctx, const char *id, int recurse, pid_t **out_pids, int *out_len, libcrun_error_t *err);
 void go_crun_free_pids(pid_t *pids);
 
-// Run container with isolated I/O via fork
+// Create container with isolated I/O via fork, without starting it
 // stdin_fd, stdout_fd, stderr_fd: pipe fds (-1 = use /dev/null for stdin, inherit for stdout/stderr)
+// stdout_fd and stderr_fd may be the same fd to merge both streams
 // log_fd: write end of log pipe (-1 = use stderr for logs)
+// mux_fd: write end of a tagged output pipe (-1 = disabled); when set, stdout and
+//         stderr are multiplexed onto it as [stream:1][len:4][data] frames and
+//         stdout_fd/stderr_fd must be -1
+// The child stays alive as a subreaper and exits with the container's exit code
+// once it has been started and exits, or with 0 right after creating it if
+// ctx->detach is set.
+// ready_fd: write end of a pipe receiving the create result as
+//           [failed:4][errno:4][msg_len:4][message:msg_len]
 // out_pid: receives the forked child PID for later waitpid
-int go_crun_run_with_pipes(
+int go_crun_create_with_pipes(
     libcrun_context_t *ctx,
     libcrun_container_t *container,
     unsigned int flags,
@@ -69,6 +97,25 @@ int go_crun_run_with_pipes(
     int stdout_fd,
     int stderr_fd,
     int log_fd,
+    int mux_fd,
+    int ready_fd,
+    pid_t *out_pid,
+    libcrun_error_t *err
+);
+
+// Exec a process in a running container with isolated I/O via fork
+// json: runtime process JSON, parsed before forking
+// pid_file: path where libcrun writes the exec'd process pid (NULL = none)
+// out_pid: receives the forked child PID for later waitpid
+int go_crun_exec_with_pipes(
+    libcrun_context_t *ctx,
+    const char *id,
+    const char *json,
+    int stdin_fd,
+    int stdout_fd,
+    int stderr_fd,
+    int log_fd,
+    const char *pid_file,
     pid_t *out_pid,
     libcrun_error_t *err
 );
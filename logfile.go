@@ -0,0 +1,193 @@
+//go:build linux
+
+package crun
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// LogFormat is the format of the lines written to IOConfig.LogFile.
+type LogFormat string
+
+const (
+	// LogFormatJSON writes one {"time","stream","log"} JSON object per line,
+	// like Docker's json-file logging driver. This is the default.
+	LogFormatJSON LogFormat = "json"
+	// LogFormatText writes "<time> <stream> <line>" lines.
+	LogFormatText LogFormat = "text"
+)
+
+// containerLog writes the lines of the container's stdout and stderr to a log
+// file, rotating it when it grows over maxSize.
+type containerLog struct {
+	mu       sync.Mutex
+	path     string
+	format   LogFormat
+	maxSize  int64
+	maxFiles int
+	file     *os.File
+	size     int64
+	now      func() time.Time
+}
+
+// openContainerLog opens the log file configured in c for appending.
+func openContainerLog(c *IOConfig) (*containerLog, error) {
+	format := c.LogFormat
+	if format == "" {
+		format = LogFormatJSON
+	}
+	if format != LogFormatJSON && format != LogFormatText {
+		return nil, fmt.Errorf("libcrun: invalid IOConfig.LogFormat %q", c.LogFormat)
+	}
+	if c.LogMaxSize < 0 || c.LogMaxFiles < 0 {
+		return nil, errors.New("libcrun: IOConfig.LogMaxSize and LogMaxFiles cannot be negative")
+	}
+	l := &containerLog{
+		path:     c.LogFile,
+		format:   format,
+		maxSize:  c.LogMaxSize,
+		maxFiles: max(c.LogMaxFiles, 1),
+		now:      time.Now,
+	}
+	if err := l.open(os.O_APPEND); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *containerLog) open(flag int) error {
+	f, err := os.OpenFile(l.path, os.O_WRONLY|os.O_CREATE|flag, 0640)
+	if err != nil {
+		return fmt.Errorf("libcrun: open log file: %w", err)
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("libcrun: open log file: %w", err)
+	}
+	l.file, l.size = f, fi.Size()
+	return nil
+}
+
+// ioConfig returns a copy of c sending stdout and stderr to the log.
+func (l *containerLog) ioConfig(c *IOConfig) *IOConfig {
+	out := *c
+	out.Stdout = &logStream{log: l, name: "stdout"}
+	out.Stderr = &logStream{log: l, name: "stderr"}
+	return &out
+}
+
+// writeLine writes one entry for line, which includes its newline unless it
+// is the unterminated end of the stream.
+func (l *containerLog) writeLine(stream string, line []byte) error {
+	var entry []byte
+	ts := l.now().UTC().Format(time.RFC3339Nano)
+	if l.format == LogFormatText {
+		entry = append([]byte(ts+" "+stream+" "), line...)
+		if !bytes.HasSuffix(entry, []byte("\n")) {
+			entry = append(entry, '\n')
+		}
+	} else {
+		var err error
+		entry, err = json.Marshal(struct {
+			Time   string `json:"time"`
+			Stream string `json:"stream"`
+			Log    string `json:"log"`
+		}{ts, stream, string(line)})
+		if err != nil {
+			return err
+		}
+		entry = append(entry, '\n')
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return os.ErrClosed
+	}
+	if l.maxSize > 0 && l.size > 0 && l.size+int64(len(entry)) > l.maxSize {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := l.file.Write(entry)
+	l.size += int64(n)
+	return err
+}
+
+// rotate shifts path to path.1, path.1 to path.2 and so on, keeping maxFiles
+// files in total, and starts a new log file.
+func (l *containerLog) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	l.file = nil
+	for i := l.maxFiles - 1; i > 0; i-- {
+		src := l.path
+		if i > 1 {
+			src += "." + strconv.Itoa(i-1)
+		}
+		if err := os.Rename(src, l.path+"."+strconv.Itoa(i)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("libcrun: rotate log file: %w", err)
+		}
+	}
+	return l.open(os.O_TRUNC)
+}
+
+// Close closes the log file.
+func (l *containerLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+// maxLogLine is the longest entry a logStream writes: longer lines are split
+// into several entries, only the last of which ends with the newline, as
+// Docker does, so a stream without newlines cannot grow memory unbounded.
+const maxLogLine = 16 << 10
+
+// logStream splits the output of one stream into lines for the log.
+type logStream struct {
+	log     *containerLog
+	name    string
+	pending []byte // partial last line, shorter than maxLogLine
+}
+
+func (s *logStream) Write(p []byte) (int, error) {
+	s.pending = append(s.pending, p...)
+	for {
+		n := bytes.IndexByte(s.pending, '\n') + 1
+		if n == 0 || n > maxLogLine {
+			if len(s.pending) < maxLogLine {
+				return len(p), nil
+			}
+			n = maxLogLine
+		}
+		if err := s.log.writeLine(s.name, s.pending[:n]); err != nil {
+			return 0, err
+		}
+		s.pending = s.pending[n:]
+	}
+}
+
+// Flush logs the unterminated last line, if any.
+func (s *logStream) Flush() error {
+	if len(s.pending) == 0 {
+		return nil
+	}
+	line := s.pending
+	s.pending = nil
+	return s.log.writeLine(s.name, line)
+}
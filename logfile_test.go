@@ -0,0 +1,173 @@
+//go:build linux
+
+package crun
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+type logLine struct {
+	Time   string `json:"time"`
+	Stream string `json:"stream"`
+	Log    string `json:"log"`
+}
+
+func readLogLines(t *testing.T, path string) []logLine {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	var lines []logLine
+	for _, raw := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+		if raw == "" {
+			continue
+		}
+		var l logLine
+		if err := json.Unmarshal([]byte(raw), &l); err != nil {
+			t.Fatalf("Invalid log line %q: %v", raw, err)
+		}
+		lines = append(lines, l)
+	}
+	return lines
+}
+
+func TestContainerLogJSON(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ctr.log")
+	l, err := openContainerLog(&IOConfig{LogFile: path})
+	if err != nil {
+		t.Fatalf("openContainerLog failed: %v", err)
+	}
+	l.now = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) }
+	cfg := l.ioConfig(&IOConfig{LogFile: path})
+
+	// Lines split across writes are joined, several lines in a write split
+	cfg.Stdout.Write([]byte("hel"))
+	cfg.Stdout.Write([]byte("lo\nworld\n"))
+	cfg.Stderr.Write([]byte("oops\npartial"))
+	if err := flushWriters(cfg.Stdout, cfg.Stderr); err != nil {
+		t.Fatalf("flushWriters failed: %v", err)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	want := []logLine{
+		{"2024-01-02T03:04:05Z", "stdout", "hello\n"},
+		{"2024-01-02T03:04:05Z", "stdout", "world\n"},
+		{"2024-01-02T03:04:05Z", "stderr", "oops\n"},
+		{"2024-01-02T03:04:05Z", "stderr", "partial"},
+	}
+	got := readLogLines(t, path)
+	if len(got) != len(want) {
+		t.Fatalf("Log lines = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Line %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestContainerLogLongLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ctr.log")
+	l, err := openContainerLog(&IOConfig{LogFile: path})
+	if err != nil {
+		t.Fatalf("openContainerLog failed: %v", err)
+	}
+	cfg := l.ioConfig(&IOConfig{LogFile: path})
+
+	// A line over maxLogLine is split into entries as it is written, even
+	// before its newline arrives
+	long := strings.Repeat("x", 2*maxLogLine+10)
+	cfg.Stdout.Write([]byte(long[:maxLogLine+1]))
+	if lines := readLogLines(t, path); len(lines) != 1 || lines[0].Log != long[:maxLogLine] {
+		t.Fatalf("Log has %d entries, want the first %d bytes flushed", len(lines), maxLogLine)
+	}
+	cfg.Stdout.Write([]byte(long[maxLogLine+1:] + "\nshort\n"))
+	if err := l.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	want := []string{long[:maxLogLine], long[maxLogLine : 2*maxLogLine], long[2*maxLogLine:] + "\n", "short\n"}
+	got := readLogLines(t, path)
+	if len(got) != len(want) {
+		t.Fatalf("Log has %d entries, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Log != want[i] {
+			t.Errorf("Entry %d has %d bytes, want %d", i, len(got[i].Log), len(want[i]))
+		}
+	}
+}
+
+func TestContainerLogText(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ctr.log")
+	l, err := openContainerLog(&IOConfig{LogFile: path, LogFormat: LogFormatText})
+	if err != nil {
+		t.Fatalf("openContainerLog failed: %v", err)
+	}
+	l.now = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) }
+	if err := l.writeLine("stderr", []byte("boom\n")); err != nil {
+		t.Fatalf("writeLine failed: %v", err)
+	}
+	l.Close()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read log file: %v", err)
+	}
+	if want := "2024-01-02T03:04:05Z stderr boom\n"; string(data) != want {
+		t.Errorf("Log = %q, want %q", data, want)
+	}
+}
+
+func TestContainerLogRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ctr.log")
+	l, err := openContainerLog(&IOConfig{LogFile: path, LogFormat: LogFormatText, LogMaxSize: 100, LogMaxFiles: 3})
+	if err != nil {
+		t.Fatalf("openContainerLog failed: %v", err)
+	}
+	defer l.Close()
+
+	// Each entry is 50 bytes: two fit in a file
+	l.now = func() time.Time { return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC) }
+	line := []byte(strings.Repeat("x", 50-len("2024-01-02T03:04:05Z stdout \n")) + "\n")
+	for i := 0; i < 7; i++ {
+		if err := l.writeLine("stdout", line); err != nil {
+			t.Fatalf("writeLine %d failed: %v", i, err)
+		}
+	}
+
+	for name, size := range map[string]int64{"ctr.log": 50, "ctr.log.1": 100, "ctr.log.2": 100} {
+		fi, err := os.Stat(filepath.Join(filepath.Dir(path), name))
+		if err != nil {
+			t.Errorf("Stat %s failed: %v", name, err)
+			continue
+		}
+		if fi.Size() != size {
+			t.Errorf("%s size = %d, want %d", name, fi.Size(), size)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("%s.3 exists, want at most 3 files", path)
+	}
+}
+
+func TestContainerLogInvalidConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ctr.log")
+	if _, err := openContainerLog(&IOConfig{LogFile: path, LogFormat: "xml"}); err == nil {
+		t.Error("openContainerLog with an unknown format succeeded, want error")
+	}
+	if _, err := openContainerLog(&IOConfig{LogFile: path, LogMaxSize: -1}); err == nil {
+		t.Error("openContainerLog with a negative size succeeded, want error")
+	}
+	if err := (&IOConfig{LogFile: path, Stdout: os.Stdout}).validateFds(); err == nil {
+		t.Error("validateFds with LogFile and Stdout succeeded, want error")
+	}
+}
@@ -0,0 +1,122 @@
+//go:build linux
+
+package crun
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// nsProcNames maps OCI namespace types to their /proc/<pid>/ns entry names.
+var nsProcNames = map[specs.LinuxNamespaceType]string{
+	specs.PIDNamespace:     "pid",
+	specs.NetworkNamespace: "net",
+	specs.MountNamespace:   "mnt",
+	specs.IPCNamespace:     "ipc",
+	specs.UTSNamespace:     "uts",
+	specs.UserNamespace:    "user",
+	specs.CgroupNamespace:  "cgroup",
+	specs.TimeNamespace:    "time",
+}
+
+// SupportedNamespaces probes the host kernel and reports, for every OCI
+// namespace type, whether a container can create it. Use it as a pre-flight
+// check before adding namespaces to a spec (e.g. user namespaces on hosts
+// where they are disabled).
+func SupportedNamespaces() (map[specs.LinuxNamespaceType]bool, error) {
+	return supportedNamespaces("/proc", os.Geteuid())
+}
+
+func supportedNamespaces(procRoot string, euid int) (map[specs.LinuxNamespaceType]bool, error) {
+	nsDir := filepath.Join(procRoot, "self", "ns")
+	if _, err := os.Stat(nsDir); err != nil {
+		return nil, err
+	}
+
+	out := make(map[specs.LinuxNamespaceType]bool, len(nsProcNames))
+	for typ, name := range nsProcNames {
+		_, err := os.Lstat(filepath.Join(nsDir, name))
+		out[typ] = err == nil
+	}
+
+	if out[specs.UserNamespace] {
+		enabled, err := userNamespacesEnabled(procRoot, euid)
+		if err != nil {
+			return nil, err
+		}
+		out[specs.UserNamespace] = enabled
+	}
+	return out, nil
+}
+
+// userNamespacesEnabled checks the sysctls that can disable user namespaces
+// even when the kernel supports them.
+func userNamespacesEnabled(procRoot string, euid int) (bool, error) {
+	max, err := readSysctlInt(filepath.Join(procRoot, "sys", "user", "max_user_namespaces"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+	if err == nil && max == 0 {
+		return false, nil
+	}
+	if euid == 0 {
+		return true, nil
+	}
+	// Debian/Ubuntu knob restricting unprivileged user namespaces
+	clone, err := readSysctlInt(filepath.Join(procRoot, "sys", "kernel", "unprivileged_userns_clone"))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+	return err != nil || clone != 0, nil
+}
+
+func readSysctlInt(path string) (int64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseInt(strings.TrimSpace(string(data)), 10, 64)
+}
+
+// autoUserNamespaceSize is the number of subordinate IDs mapped by
+// WithAutoUserNamespace, matching the usual 65536-entry subuid allocation.
+const autoUserNamespaceSize = 65536
+
+// autoIDMappings returns the standard rootless mapping for a single ID: container
+// ID 0 maps to id, and container IDs 1..n map to the first subordinate range in
+// subIDPath (/etc/subuid or /etc/subgid format) owned by name or id.
+func autoIDMappings(subIDPath, name string, id uint32) ([]specs.LinuxIDMapping, error) {
+	data, err := os.ReadFile(subIDPath)
+	if err != nil {
+		return nil, err
+	}
+	idStr := strconv.FormatUint(uint64(id), 10)
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Split(strings.TrimSpace(line), ":")
+		if len(fields) != 3 || (fields[0] != name && fields[0] != idStr) {
+			continue
+		}
+		start, err := strconv.ParseUint(fields[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("libcrun: parse %s: %w", subIDPath, err)
+		}
+		count, err := strconv.ParseUint(fields[2], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("libcrun: parse %s: %w", subIDPath, err)
+		}
+		if count == 0 {
+			continue
+		}
+		return []specs.LinuxIDMapping{
+			{ContainerID: 0, HostID: id, Size: 1},
+			{ContainerID: 1, HostID: uint32(start), Size: uint32(min(count, autoUserNamespaceSize))},
+		}, nil
+	}
+	return nil, fmt.Errorf("libcrun: no subordinate ID range for %q in %s", name, subIDPath)
+}
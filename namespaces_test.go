@@ -0,0 +1,103 @@
+//go:build linux
+
+package crun
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestSupportedNamespaces(t *testing.T) {
+	got, err := SupportedNamespaces()
+	if err != nil {
+		t.Fatalf("SupportedNamespaces failed: %v", err)
+	}
+
+	// Every namespace type must be reported
+	if len(got) != len(nsProcNames) {
+		t.Errorf("SupportedNamespaces returned %d entries, want %d", len(got), len(nsProcNames))
+	}
+
+	// Namespaces available on any modern Linux host, including CI
+	for _, typ := range []specs.LinuxNamespaceType{
+		specs.PIDNamespace,
+		specs.NetworkNamespace,
+		specs.MountNamespace,
+		specs.IPCNamespace,
+		specs.UTSNamespace,
+	} {
+		if !got[typ] {
+			t.Errorf("Namespace %q should be supported", typ)
+		}
+	}
+}
+
+func TestSupportedNamespacesUserDisabled(t *testing.T) {
+	procRoot := t.TempDir()
+	nsDir := filepath.Join(procRoot, "self", "ns")
+	sysUser := filepath.Join(procRoot, "sys", "user")
+	for _, dir := range []string{nsDir, sysUser} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create %s: %v", dir, err)
+		}
+	}
+	for _, name := range []string{"pid", "user"} {
+		if err := os.WriteFile(filepath.Join(nsDir, name), nil, 0644); err != nil {
+			t.Fatalf("Failed to create ns entry: %v", err)
+		}
+	}
+	if err := os.WriteFile(filepath.Join(sysUser, "max_user_namespaces"), []byte("0\n"), 0644); err != nil {
+		t.Fatalf("Failed to write sysctl: %v", err)
+	}
+
+	got, err := supportedNamespaces(procRoot, 0)
+	if err != nil {
+		t.Fatalf("supportedNamespaces failed: %v", err)
+	}
+	if !got[specs.PIDNamespace] {
+		t.Error("pid namespace should be supported")
+	}
+	if got[specs.NetworkNamespace] {
+		t.Error("network namespace should not be supported")
+	}
+	if got[specs.UserNamespace] {
+		t.Error("user namespace should be reported unsupported when max_user_namespaces is 0")
+	}
+}
+
+func TestAutoIDMappings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "subuid")
+	content := "other:100000:65536\nalice:165536:65536\n1000:231072:131072\n"
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := autoIDMappings(path, "alice", 1000)
+	if err != nil {
+		t.Fatalf("autoIDMappings failed: %v", err)
+	}
+	want := []specs.LinuxIDMapping{
+		{ContainerID: 0, HostID: 1000, Size: 1},
+		{ContainerID: 1, HostID: 165536, Size: 65536},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mappings = %+v, want %+v", got, want)
+	}
+
+	// Numeric entries match by ID; larger ranges are capped
+	got, err = autoIDMappings(path, "", 1000)
+	if err != nil {
+		t.Fatalf("autoIDMappings failed: %v", err)
+	}
+	if got[1].HostID != 231072 || got[1].Size != 65536 {
+		t.Errorf("subordinate mapping = %+v, want 231072 capped to 65536", got[1])
+	}
+
+	if _, err := autoIDMappings(path, "bob", 1001); err == nil {
+		t.Error("autoIDMappings should fail without a subordinate range")
+	}
+}
@@ -0,0 +1,184 @@
+//go:build linux
+
+package crun
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+// netnsHookArg0 is the argv[0] the hooks of WithNetworkDevicesMoveBack run
+// the current executable with. NetnsHookMain recognizes it and runs the hook
+// instead of the program.
+const netnsHookArg0 = "libcrun-go-netns-hook"
+
+// NetnsHookMain runs the hooks of WithNetworkDevicesMoveBack, which start the
+// current executable as "libcrun-go-netns-hook". Programs using that option
+// must call it first thing in main: if the process was started as a hook, it
+// runs it and exits, reporting failures on stderr, and otherwise it returns.
+func NetnsHookMain() {
+	if len(os.Args) < 2 || os.Args[0] != netnsHookArg0 {
+		return
+	}
+	if err := runNetnsHook(os.Args[1], os.Args[2:], os.Stdin); err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %v\n", netnsHookArg0, err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
+
+// runNetnsHook runs the hook cmd with args, reading the container state from
+// stdin: "pin <dir> [<container name> <host name>]..." pins the network
+// namespace under dir along with the interfaces to move back, and
+// "release <dir>" moves them back and drops the pin.
+func runNetnsHook(cmd string, args []string, stdin io.Reader) error {
+	state, err := readHookState(stdin)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return errors.New("missing pin directory")
+	}
+	switch cmd {
+	case "pin":
+		return pinNetns(args[0], state, args[1:])
+	case "release":
+		return releaseNetnsPin(args[0], state.ID)
+	}
+	return fmt.Errorf("unknown hook %q", cmd)
+}
+
+// readHookState decodes the container state OCI hooks receive on stdin.
+func readHookState(r io.Reader) (*specs.State, error) {
+	var state specs.State
+	if err := json.NewDecoder(r).Decode(&state); err != nil {
+		return nil, fmt.Errorf("decode container state: %w", err)
+	}
+	if state.ID == "" || strings.ContainsRune(state.ID, '/') {
+		return nil, fmt.Errorf("invalid container id %q", state.ID)
+	}
+	return &state, nil
+}
+
+// pinNetns bind mounts the network namespace of the container in state at
+// dir/<id>, so it outlives the container process, and records the interface
+// name pairs to move back in dir/<id>.devices.
+func pinNetns(dir string, state *specs.State, pairs []string) error {
+	if state.Pid <= 0 {
+		return fmt.Errorf("invalid container pid %d", state.Pid)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	pin := filepath.Join(dir, state.ID)
+	if err := os.WriteFile(pin, nil, 0600); err != nil {
+		return err
+	}
+	ns := "/proc/" + strconv.Itoa(state.Pid) + "/ns/net"
+	if err := syscall.Mount(ns, pin, "", syscall.MS_BIND, ""); err != nil {
+		os.Remove(pin)
+		return fmt.Errorf("pin %s: %w", ns, err)
+	}
+	data, err := json.Marshal(pairs)
+	if err == nil {
+		err = os.WriteFile(pin+".devices", data, 0600)
+	}
+	if err != nil {
+		syscall.Unmount(pin, syscall.MNT_DETACH)
+		os.Remove(pin)
+		return err
+	}
+	return nil
+}
+
+// releaseNetnsPin moves the interfaces recorded by pinNetns for container id
+// back to the namespace of this process and drops the pin. It does nothing if
+// the namespace is not pinned.
+func releaseNetnsPin(dir, id string) error {
+	pin := filepath.Join(dir, id)
+	data, err := os.ReadFile(pin + ".devices")
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var pairs []string
+	if err := json.Unmarshal(data, &pairs); err != nil {
+		return fmt.Errorf("decode %s.devices: %w", pin, err)
+	}
+
+	var errs []error
+	for i := 0; i+1 < len(pairs); i += 2 {
+		errs = append(errs, moveNetDeviceBack(pin, pairs[i], pairs[i+1]))
+	}
+	if err := syscall.Unmount(pin, syscall.MNT_DETACH); err != nil && !errors.Is(err, syscall.EINVAL) {
+		errs = append(errs, fmt.Errorf("unmount %s: %w", pin, err))
+	}
+	errs = append(errs, os.Remove(pin), os.Remove(pin+".devices"))
+	return errors.Join(errs...)
+}
+
+// moveNetDeviceBack moves interface ctrName out of the network namespace
+// pinned at pin, renamed back to hostName. veth interfaces, which are
+// destroyed along with the namespace, and interfaces no longer there are
+// left alone.
+func moveNetDeviceBack(pin, ctrName, hostName string) error {
+	ip := func(args ...string) *exec.Cmd {
+		return exec.Command("nsenter", append([]string{"--net=" + pin, "ip"}, args...)...)
+	}
+	info, err := ip("-d", "-o", "link", "show", "dev", ctrName).Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && strings.Contains(string(exitErr.Stderr), "does not exist") {
+			return nil
+		}
+		return fmt.Errorf("ip link show dev %s: %w%s", ctrName, err, commandStderr(err))
+	}
+	if strings.Contains(string(info), " veth ") {
+		return nil
+	}
+	steps := [][]string{{"link", "set", "dev", ctrName, "down"}}
+	if ctrName != hostName {
+		steps = append(steps, []string{"link", "set", "dev", ctrName, "name", hostName})
+	}
+	steps = append(steps, []string{"link", "set", "dev", hostName, "netns", strconv.Itoa(os.Getpid())})
+	for _, step := range steps {
+		if out, err := ip(step...).CombinedOutput(); err != nil {
+			return fmt.Errorf("ip %s: %w: %s", strings.Join(step, " "), err, strings.TrimSpace(string(out)))
+		}
+	}
+	return nil
+}
+
+// commandStderr returns ": " and the trimmed stderr captured in err by
+// exec.Cmd.Output, or "" if there is none.
+func commandStderr(err error) string {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || len(bytes.TrimSpace(exitErr.Stderr)) == 0 {
+		return ""
+	}
+	return ": " + string(bytes.TrimSpace(exitErr.Stderr))
+}
+
+// cleanupNetnsPin releases the network namespace pinned for container id by
+// WithNetworkDevicesMoveBack when creating the container failed with err, as
+// the poststop hook releasing it only runs on delete.
+func cleanupNetnsPin(id string, err error) {
+	// The pin, if any, belongs to the existing container
+	if errors.Is(err, ErrContainerExists) {
+		return
+	}
+	_ = releaseNetnsPin(netnsPinDir, id)
+}
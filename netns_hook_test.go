@@ -0,0 +1,36 @@
+//go:build linux
+
+package crun
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadHookState(t *testing.T) {
+	// Values that fooled line-based parsing: nested ids, commas and quotes
+	state, err := readHookState(strings.NewReader(`{"ociVersion":"1.0.0","annotations":{"id":"other","x":"a,\"pid\":1"},"id":"web","status":"created","pid":4242,"bundle":"/b"}`))
+	if err != nil {
+		t.Fatalf("readHookState failed: %v", err)
+	}
+	if state.ID != "web" || state.Pid != 4242 {
+		t.Errorf("state = {%q, %d}, want {web, 4242}", state.ID, state.Pid)
+	}
+
+	for _, in := range []string{"", "{", `{"pid":1}`, `{"id":"../x","pid":1}`} {
+		if _, err := readHookState(strings.NewReader(in)); err == nil {
+			t.Errorf("readHookState(%q) succeeded, want error", in)
+		}
+	}
+}
+
+func TestReleaseNetnsPinNotPinned(t *testing.T) {
+	if err := releaseNetnsPin(t.TempDir(), "web"); err != nil {
+		t.Errorf("releaseNetnsPin without a pin = %v, want nil", err)
+	}
+}
+
+func TestNetnsHookMainNotHook(t *testing.T) {
+	// Returns when the process was not started as a hook
+	NetnsHookMain()
+}
@@ -0,0 +1,131 @@
+//go:build linux
+
+package crun
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+// WithRootfsCopy copies baseDir into a fresh temporary directory and returns a
+// WithRootPath option pointing at the copy, plus a cleanup function that removes it.
+// Each call gets an independent writable rootfs, so changes made by the container
+// never reach baseDir. This trades speed for isolation; prefer WithSharedRootfs
+// with tmpfs mounts when a read-only root is acceptable.
+func WithRootfsCopy(baseDir string) (SpecOption, func() error, error) {
+	dir, err := os.MkdirTemp("", "crun-rootfs-*")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() error { return os.RemoveAll(dir) }
+
+	if err := copyTree(baseDir, dir); err != nil {
+		_ = cleanup()
+		return nil, nil, fmt.Errorf("libcrun: copy rootfs %q: %w", baseDir, err)
+	}
+	return WithRootPath(dir), cleanup, nil
+}
+
+// copyTree recursively copies src into the existing directory dst, preserving
+// modes, ownership (when permitted), symlinks and special files.
+func copyTree(src, dst string) error {
+	// Directory modes are applied last so read-only directories can be filled first
+	type dirMode struct {
+		path string
+		mode fs.FileMode
+	}
+	var dirs []dirMode
+
+	err := filepath.WalkDir(src, func(path string, _ fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(src, path)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, rel)
+
+		info, err := os.Lstat(path)
+		if err != nil {
+			return err
+		}
+		st, _ := info.Sys().(*syscall.Stat_t)
+
+		switch mode := info.Mode(); {
+		case mode.IsDir():
+			if rel != "." {
+				if err := os.Mkdir(target, 0700); err != nil {
+					return err
+				}
+			}
+		case mode&fs.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			if err := os.Symlink(link, target); err != nil {
+				return err
+			}
+		case mode.IsRegular():
+			if err := copyFile(path, target); err != nil {
+				return err
+			}
+		default:
+			// Device nodes, FIFOs and sockets
+			if st == nil {
+				return fmt.Errorf("unsupported file %q", path)
+			}
+			if err := syscall.Mknod(target, st.Mode, int(st.Rdev)); err != nil {
+				return err
+			}
+		}
+
+		if st != nil {
+			// Ownership can only be preserved when running privileged
+			if err := os.Lchown(target, int(st.Uid), int(st.Gid)); err != nil && !os.IsPermission(err) {
+				return err
+			}
+		}
+		perm := info.Mode() & (fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky)
+		switch {
+		case info.IsDir():
+			dirs = append(dirs, dirMode{target, perm})
+		case info.Mode()&fs.ModeSymlink == 0:
+			return os.Chmod(target, perm)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := os.Chmod(dirs[i].path, dirs[i].mode); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,74 @@
+//go:build linux
+
+package crun
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+func TestWithRootfsCopy(t *testing.T) {
+	base := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(base, "etc"), 0755); err != nil {
+		t.Fatalf("Failed to create base dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(base, "etc", "hostname"), []byte("base\n"), 0644); err != nil {
+		t.Fatalf("Failed to write base file: %v", err)
+	}
+	if err := os.Symlink("etc/hostname", filepath.Join(base, "link")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+
+	opt, cleanup, err := WithRootfsCopy(base)
+	if err != nil {
+		t.Fatalf("WithRootfsCopy failed: %v", err)
+	}
+
+	sp := &specs.Spec{}
+	opt(sp)
+	if sp.Root == nil || sp.Root.Path == "" || sp.Root.Path == base {
+		t.Fatalf("Root path = %v, want a fresh copy", sp.Root)
+	}
+	copyDir := sp.Root.Path
+
+	// Symlinks are preserved as links
+	if link, err := os.Readlink(filepath.Join(copyDir, "link")); err != nil || link != "etc/hostname" {
+		t.Errorf("Readlink = %q, %v, want etc/hostname", link, err)
+	}
+
+	// Writes in the copy must not affect the base
+	if err := os.WriteFile(filepath.Join(copyDir, "etc", "hostname"), []byte("copy\n"), 0644); err != nil {
+		t.Fatalf("Failed to write copy file: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(copyDir, "new-file"), []byte("x"), 0644); err != nil {
+		t.Fatalf("Failed to create file in copy: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(base, "etc", "hostname"))
+	if err != nil {
+		t.Fatalf("Failed to read base file: %v", err)
+	}
+	if string(data) != "base\n" {
+		t.Errorf("Base file = %q, want %q", data, "base\n")
+	}
+	if _, err := os.Stat(filepath.Join(base, "new-file")); !os.IsNotExist(err) {
+		t.Errorf("new-file should not exist in base, stat err = %v", err)
+	}
+
+	if err := cleanup(); err != nil {
+		t.Fatalf("cleanup failed: %v", err)
+	}
+	if _, err := os.Stat(copyDir); !os.IsNotExist(err) {
+		t.Errorf("Copy dir should be removed after cleanup, stat err = %v", err)
+	}
+}
+
+func TestWithRootfsCopyMissingBase(t *testing.T) {
+	_, _, err := WithRootfsCopy(filepath.Join(t.TempDir(), "missing"))
+	if err == nil {
+		t.Fatal("WithRootfsCopy should fail for a missing base dir")
+	}
+}
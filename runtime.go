@@ -57,7 +57,7 @@
 // Use WithXxx options to configure container specs ergonomically:
 //   - [WithRootPath], [WithArgs], [WithEnv], [WithCwd] - basic process config
 //   - [WithMemoryLimit], [WithCPUShares], [WithCPUQuota], [WithPidsLimit] - resource limits
-//   - [WithMount], [WithHostname], [WithAnnotation] - container config
+//   - [WithMount], [WithHostname], [WithAnnotation], [WithAnnotations] - container config
 //   - [WithNetworkNamespace], [WithMountNamespace], [WithHostNetwork] - namespace control
 //
 // # Error Handling
@@ -103,13 +103,22 @@ package crun
 */
 import "C"
 import (
+	"context"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"io"
 	"os"
+	"os/signal"
+	"path/filepath"
 	"runtime"
 	"runtime/cgo"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
 	"unsafe"
 )
 
@@ -153,16 +162,21 @@ type RuntimeConfig struct {
 	NoNewKeyring  bool
 	ForceNoCgroup bool
 	NoPivot       bool
+
+	// CreateStateRoot creates StateRoot (mode 0700) if it does not exist.
+	CreateStateRoot bool
 }
 
 // RuntimeContext is the per-operation environment used by libcrun.
 type RuntimeContext struct {
-	c  *C.libcrun_context_t
-	mu sync.Mutex // protects c.id during concurrent operations
+	c *C.libcrun_context_t // never modified after creation; see contextWithID
 }
 
 // NewRuntimeContext creates a new RuntimeContext. Call Close() when done.
 func NewRuntimeContext(cfg RuntimeConfig) (*RuntimeContext, error) {
+	if err := prepareStateRoot(cfg); err != nil {
+		return nil, err
+	}
 	c := C.go_crun_new_context()
 	if c == nil {
 		return nil, errors.New("libcrun: failed to allocate context")
@@ -196,11 +210,33 @@ func NewRuntimeContext(cfg RuntimeConfig) (*RuntimeContext, error) {
 	return rc, nil
 }
 
+// prepareStateRoot validates cfg.StateRoot and creates it if requested.
+func prepareStateRoot(cfg RuntimeConfig) error {
+	if cfg.StateRoot == "" {
+		return nil
+	}
+	if !filepath.IsAbs(cfg.StateRoot) {
+		return fmt.Errorf("libcrun: state root %q must be an absolute path", cfg.StateRoot)
+	}
+	if !cfg.CreateStateRoot {
+		return nil
+	}
+	if fi, err := os.Stat(cfg.StateRoot); err == nil && !fi.IsDir() {
+		return fmt.Errorf("libcrun: state root %q exists and is not a directory", cfg.StateRoot)
+	}
+	if err := os.MkdirAll(cfg.StateRoot, 0700); err != nil {
+		return fmt.Errorf("libcrun: create state root: %w", err)
+	}
+	return nil
+}
+
 // Close releases C-side allocations associated with the RuntimeContext.
 func (x *RuntimeContext) Close() error {
 	if x == nil || x.c == nil {
 		return nil
 	}
+	// The finalizer is only a safety net for a missed Close
+	runtime.SetFinalizer(x, nil)
 	C.go_crun_free_context(x.c)
 	x.c = nil
 	return nil
@@ -215,19 +251,36 @@ func (rc *RuntimeContext) Get(id string) *Container {
 // RunOptions controls container run behavior.
 type RunOptions struct {
 	Prefork bool
-}
 
-func runFlags(o RunOptions) C.uint {
-	var f C.uint
-	if o.Prefork {
-		f |= C.LIBCRUN_RUN_OPTIONS_PREFORK
-	}
-	return f
+	// Detach leaves the container running in the background for this call
+	// even if RuntimeConfig.Detach is not set: Run returns once the container
+	// has started, without waiting for it or deleting it, and the RunResult of
+	// RunWithIOOptions reports exit code 0 once it has started instead of the
+	// container's exit code (use Container.Wait to wait for it to exit).
+	Detach bool
+
+	// AutoRemove makes the Wait of the RunResult of RunWithIOOptions delete
+	// the container once it has exited, like docker run --rm, so it cannot
+	// be leaked. It cannot be combined with Detach.
+	AutoRemove bool
+
+	bundle     string // RunBundle's bundle directory, instead of RuntimeConfig.Bundle
+	createOnly bool   // Create: only create the container, ignoring BeforeStart
+
+	// BeforeStart, when set, is called by Run and RunWithIOOptions after the
+	// container has been created but before it is started, e.g. to attach a
+	// network interface. Returning an error deletes the container and aborts
+	// the run.
+	BeforeStart func(*Container) error
 }
 
 // CreateOptions controls container creation (distinct flag set from Run).
 type CreateOptions struct {
 	Prefork bool
+
+	// Detach sets the libcrun detach flag for this call even if
+	// RuntimeConfig.Detach is not set.
+	Detach bool
 }
 
 func createFlags(o CreateOptions) C.uint {
@@ -239,10 +292,87 @@ func createFlags(o CreateOptions) C.uint {
 }
 
 // IOConfig configures container I/O streams for RunWithIO.
+//
+// Once the container has exited and all output has been copied, Wait flushes
+// the output writers: a writer implementing Flush() error (e.g. bufio.Writer)
+// is flushed, otherwise one implementing Sync() error (e.g. *os.File) is synced.
+// All output is therefore visible in the writers as soon as Wait returns.
 type IOConfig struct {
-	Stdin  io.Reader // If nil, container stdin reads from /dev/null
-	Stdout io.Writer // If nil, container stdout is discarded
-	Stderr io.Writer // If nil, container stderr is discarded
+	Stdin  io.Reader // If nil, container stdin reads from /dev/null, see InheritStdio
+	Stdout io.Writer // If nil, container stdout is discarded, see InheritStdio
+	Stderr io.Writer // If nil, container stderr is discarded, see InheritStdio
+
+	// Combined receives stdout and stderr interleaved in arrival order, like 2>&1.
+	// Both streams share a single pipe. Stdout and Stderr must be nil when set.
+	Combined io.Writer
+
+	// Tagged multiplexes stdout and stderr over a single pipe using small framed
+	// chunks, which are dispatched to Stdout and Stderr in the order a relay
+	// process reads them from the container's two pipes. Writes to the two
+	// streams are therefore only roughly interleaved: output written close
+	// together may be reordered across streams (never within one). Cannot be
+	// combined with Combined.
+	Tagged bool
+
+	// StdinFd, StdoutFd and StderrFd hand a file descriptor of the caller
+	// (e.g. a log file or a socket) directly to the container, bypassing the
+	// pipe and the copy through Go. The descriptor is duplicated, so the caller
+	// keeps ownership of it and may close it once RunWithIO returns. A value
+	// <= 0 leaves the stream to the fields above, so 0 cannot be passed; each
+	// cannot be combined with the Reader or Writer of the same stream, with
+	// Combined or with Tagged.
+	StdinFd  int
+	StdoutFd int
+	StderrFd int
+
+	// LogFile, if set, receives the lines of stdout and stderr, each with a
+	// timestamp and the stream it came from, in LogFormat (LogFormatJSON if
+	// empty), like Docker's json-file logging driver. The file is appended
+	// to. When LogMaxSize is positive, the file is rotated before it grows
+	// over LogMaxSize bytes, keeping LogMaxFiles files in total (LogFile,
+	// LogFile.1, ...; at least 1, which truncates it). LogFile cannot be
+	// combined with Stdout, Stderr, Combined, StdoutFd or StderrFd.
+	LogFile     string
+	LogFormat   LogFormat
+	LogMaxSize  int64
+	LogMaxFiles int
+
+	// InheritStdio hands the caller's own stdin, stdout and stderr to the
+	// container for each stream left unset above, instead of /dev/null, like
+	// docker run without -a. It cannot be combined with Combined, Tagged or
+	// LogFile, which take over both output streams.
+	InheritStdio bool
+}
+
+// validateFds checks that the fd fields do not conflict with the other fields.
+func (c *IOConfig) validateFds() error {
+	switch {
+	case c.StdinFd > 0 && c.Stdin != nil:
+		return errors.New("libcrun: IOConfig.StdinFd cannot be used with Stdin")
+	case c.StdoutFd > 0 && c.Stdout != nil:
+		return errors.New("libcrun: IOConfig.StdoutFd cannot be used with Stdout")
+	case c.StderrFd > 0 && c.Stderr != nil:
+		return errors.New("libcrun: IOConfig.StderrFd cannot be used with Stderr")
+	case (c.StdoutFd > 0 || c.StderrFd > 0) && c.Combined != nil:
+		return errors.New("libcrun: IOConfig.Combined cannot be used with StdoutFd or StderrFd")
+	case (c.StdoutFd > 0 || c.StderrFd > 0) && c.Tagged:
+		return errors.New("libcrun: IOConfig.Tagged cannot be used with StdoutFd or StderrFd")
+	case c.LogFile != "" && (c.Stdout != nil || c.Stderr != nil || c.Combined != nil || c.StdoutFd > 0 || c.StderrFd > 0):
+		return errors.New("libcrun: IOConfig.LogFile cannot be used with other stdout or stderr settings")
+	case c.InheritStdio && (c.Combined != nil || c.Tagged || c.LogFile != ""):
+		return errors.New("libcrun: IOConfig.InheritStdio cannot be used with Combined, Tagged or LogFile")
+	}
+	return nil
+}
+
+// dupFd duplicates fd above stderr, so the child's redirection of its stdio
+// can neither clash with nor close the caller's descriptor.
+func dupFd(fd int, name string) (*os.File, error) {
+	nfd, _, errno := syscall.Syscall(syscall.SYS_FCNTL, uintptr(fd), syscall.F_DUPFD_CLOEXEC, 3)
+	if errno != 0 {
+		return nil, fmt.Errorf("libcrun: IOConfig.%s %d: %w", name, fd, errno)
+	}
+	return os.NewFile(nfd, name), nil
 }
 
 // RunResult holds the result of a container run with I/O.
@@ -251,35 +381,168 @@ type RunResult struct {
 	Wait      func() (int, error) // blocks until container exits, returns exit code
 }
 
-// setContextID sets the container ID on the context for create/run operations.
-func (x *RuntimeContext) setContextID(id string) {
-	if x.c.id != nil {
-		C.free(unsafe.Pointer(x.c.id))
+// WaitTimeout is like Wait but gives up after d, reporting timedOut instead of
+// blocking forever. The container is not killed on timeout: the caller decides
+// whether to kill it, and can call Wait or WaitTimeout again to keep waiting.
+func (r *RunResult) WaitTimeout(d time.Duration) (exitCode int, timedOut bool, err error) {
+	type waitResult struct {
+		exitCode int
+		err      error
+	}
+	done := make(chan waitResult, 1)
+	go func() {
+		exitCode, err := r.Wait()
+		done <- waitResult{exitCode, err}
+	}()
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case res := <-done:
+		return res.exitCode, false, res.err
+	case <-timer.C:
+		return -1, true, nil
 	}
-	x.c.id = C.CString(id)
 }
 
-// Run creates and starts the container in one operation.
-// Returns a Container handle for further operations.
-// WARNING: This method may hang if the container writes to stdout/stderr without
-// proper I/O handling. Consider using RunWithIO for reliable operation.
+// prepareRootfs runs the spec's AddRootfsPrepare callbacks. A relative root
+// path is resolved against bundle, or the context bundle if empty, as libcrun
+// does.
+func (x *RuntimeContext) prepareRootfs(spec *ContainerSpec, bundle string) error {
+	if len(spec.rootfsPrepare) == 0 {
+		return nil
+	}
+	rootfs := C.GoString(spec.c.container_def.root.path)
+	if !filepath.IsAbs(rootfs) {
+		if bundle == "" {
+			bundle = "."
+			if x.c.bundle != nil {
+				bundle = C.GoString(x.c.bundle)
+			}
+		}
+		abs, err := filepath.Abs(filepath.Join(bundle, rootfs))
+		if err != nil {
+			return fmt.Errorf("libcrun: prepare rootfs: %w", err)
+		}
+		rootfs = abs
+	}
+	for _, fn := range spec.rootfsPrepare {
+		if err := fn(rootfs); err != nil {
+			return fmt.Errorf("libcrun: prepare rootfs: %w", err)
+		}
+	}
+	return nil
+}
+
+// contextWithID returns a copy of the context with its id set, for create/run
+// operations, which take the container ID from the context. Using a per-call
+// copy keeps concurrent operations from racing on the shared id field. The
+// copy shares every other field with x.c, so only release must free it.
+func (x *RuntimeContext) contextWithID(id string) (ctx *C.libcrun_context_t, release func()) {
+	ctx = (*C.libcrun_context_t)(C.malloc(C.sizeof_libcrun_context_t))
+	*ctx = *x.c
+	ctx.id = C.CString(id)
+	return ctx, func() {
+		C.free(unsafe.Pointer(ctx.id))
+		C.free(unsafe.Pointer(ctx))
+	}
+}
+
+// Run creates and starts the container, waits for it to exit and deletes it,
+// like crun run. The container's stdin, stdout and stderr are /dev/null, so
+// its output can never block it or the caller; use RunWithIO to provide
+// input or read its output. When detached (RunOptions.Detach or
+// RuntimeConfig.Detach), Run returns as soon as the container has started and
+// leaves deleting it to the caller.
 func (x *RuntimeContext) Run(id string, spec *ContainerSpec, o RunOptions) (*Container, error) {
-	if x == nil || x.c == nil || spec == nil || spec.c == nil {
-		return nil, errors.New("libcrun: invalid runtime context or container spec")
+	result, err := x.runWithIO(id, spec, &IOConfig{}, o)
+	if err != nil {
+		return nil, err
 	}
-	x.setContextID(id)
-	var err C.libcrun_error_t
-	rc := C.libcrun_container_run(x.c, spec.c, runFlags(o), &err)
-	if rc < 0 {
-		return nil, fromLibcrunErr(&err)
+	// Detached, this only reaps the process that created the container
+	if _, err := result.Wait(); err != nil {
+		return nil, err
+	}
+	if o.Detach || bool(x.c.detach) {
+		return result.Container, nil
+	}
+	if err := result.Container.Delete(true); err != nil {
+		return nil, err
 	}
-	return &Container{ID: id, runtime: x}, nil
+	return result.Container, nil
+}
+
+// ForwardSignals relays the given signals received by this process to the
+// container's init process instead of their default action, so that e.g.
+// Ctrl-C stops a container run in the foreground rather than the caller.
+// Without signals, SIGINT, SIGTERM and SIGHUP are forwarded. Call stop to
+// restore their previous handling, typically once Wait returns.
+func (r *RunResult) ForwardSignals(signals ...os.Signal) (stop func()) {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP}
+	}
+	ch := make(chan os.Signal, len(signals))
+	signal.Notify(ch, signals...)
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			case sig := <-ch:
+				// The container may have exited in the meantime
+				_ = r.Container.Kill(signalFromOS(sig))
+			}
+		}
+	}()
+
+	return sync.OnceFunc(func() {
+		signal.Stop(ch)
+		close(done)
+		wg.Wait()
+	})
+}
+
+// signalNames maps the signals worth forwarding to the names libcrun parses.
+var signalNames = map[syscall.Signal]Signal{
+	syscall.SIGINT:   SIGINT,
+	syscall.SIGTERM:  SIGTERM,
+	syscall.SIGHUP:   SIGHUP,
+	syscall.SIGQUIT:  "SIGQUIT",
+	syscall.SIGUSR1:  SIGUSR1,
+	syscall.SIGUSR2:  SIGUSR2,
+	syscall.SIGWINCH: "SIGWINCH",
+	syscall.SIGCONT:  SIGCONT,
+	syscall.SIGALRM:  "SIGALRM",
+}
+
+// signalFromOS converts sig to a Signal, by number if it has no known name.
+func signalFromOS(sig os.Signal) Signal {
+	s, ok := sig.(syscall.Signal)
+	if !ok {
+		return Signal(sig.String())
+	}
+	if name, ok := signalNames[s]; ok {
+		return name
+	}
+	return Signal(strconv.Itoa(int(s)))
 }
 
 // RunWithIO creates and starts the container with isolated I/O streams using pipes.
 // This method forks before calling libcrun, allowing each container to have
 // its own stdin/stdout/stderr. Multiple containers can run in parallel.
 // Use Wait() on the returned RunResult to block until the container exits.
+// Creation errors are returned before the container starts, e.g. one matching
+// ErrContainerExists if the ID is in use.
+//
+// The I/O streams are copied by goroutines started before RunWithIO returns,
+// so the container never blocks on a full pipe however late Wait is called.
+// Wait only reaps the container and waits for the copies to finish: the
+// writers may be written to until Wait returns, and are not to be read before.
 //
 // NOTE: This method uses OS pipes for I/O, NOT a real pseudo-terminal (PTY).
 // The container spec's Terminal field should be set to false when using this method.
@@ -300,16 +563,69 @@ func (x *RuntimeContext) Run(id string, spec *ContainerSpec, o RunOptions) (*Con
 //
 // See the crungo example for a complete implementation of TTY support.
 func (x *RuntimeContext) RunWithIO(id string, spec *ContainerSpec, ioCfg *IOConfig) (*RunResult, error) {
+	return x.RunWithIOOptions(id, spec, ioCfg, RunOptions{})
+}
+
+// RunWithIOOptions is like RunWithIO but honors RunOptions. When o.BeforeStart
+// is set the container is created, the callback is invoked with the created
+// container, and only then is the container started; the I/O pipes are already
+// attached at that point.
+func (x *RuntimeContext) RunWithIOOptions(id string, spec *ContainerSpec, ioCfg *IOConfig, o RunOptions) (*RunResult, error) {
+	return x.runWithIO(id, spec, ioCfg, o)
+}
+
+// runWithIO implements RunWithIOOptions.
+func (x *RuntimeContext) runWithIO(id string, spec *ContainerSpec, ioCfg *IOConfig, o RunOptions) (*RunResult, error) {
 	if x == nil || x.c == nil || spec == nil || spec.c == nil {
 		return nil, errors.New("libcrun: invalid runtime context or container spec")
 	}
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	if err := x.prepareRootfs(spec, o.bundle); err != nil {
+		return nil, err
+	}
+	spec, releaseSpec, specErr := spec.forContainer(id, bool(x.c.systemd_cgroup))
+	if specErr != nil {
+		return nil, specErr
+	}
+	defer releaseSpec()
 	if ioCfg == nil {
 		ioCfg = &IOConfig{}
 	}
+	if ioCfg.Combined != nil && (ioCfg.Stdout != nil || ioCfg.Stderr != nil) {
+		return nil, errors.New("libcrun: IOConfig.Combined cannot be used with Stdout or Stderr")
+	}
+	if ioCfg.Tagged && ioCfg.Combined != nil {
+		return nil, errors.New("libcrun: IOConfig.Tagged cannot be used with Combined")
+	}
+	if err := ioCfg.validateFds(); err != nil {
+		return nil, err
+	}
+	if o.AutoRemove && (o.Detach || bool(x.c.detach)) {
+		return nil, errors.New("libcrun: RunOptions.AutoRemove cannot be used with Detach")
+	}
+
+	// The log file is closed by Wait once the output is copied, or on failure
+	var ctrLog *containerLog
+	logHandedOff := false
+	if ioCfg.LogFile != "" {
+		var err error
+		if ctrLog, err = openContainerLog(ioCfg); err != nil {
+			return nil, err
+		}
+		ioCfg = ctrLog.ioConfig(ioCfg)
+		defer func() {
+			if !logHandedOff {
+				ctrLog.Close()
+			}
+		}()
+	}
 
 	// Create pipes for I/O (before locking to minimize lock time)
 	var stdinR, stdinW, stdoutR, stdoutW, stderrR, stderrW *os.File
-	var logR, logW *os.File
+	var logR, logW, muxR, muxW, readyR, readyW, devNull *os.File
+	var stdinDup, stdoutDup, stderrDup *os.File
 	var err error
 
 	// Helper to close all opened pipes on error
@@ -338,6 +654,30 @@ func (x *RuntimeContext) RunWithIO(id string, spec *ContainerSpec, ioCfg *IOConf
 		if logW != nil {
 			logW.Close()
 		}
+		if muxR != nil {
+			muxR.Close()
+		}
+		if muxW != nil {
+			muxW.Close()
+		}
+		if readyR != nil {
+			readyR.Close()
+		}
+		if readyW != nil {
+			readyW.Close()
+		}
+		if devNull != nil {
+			devNull.Close()
+		}
+		if stdinDup != nil {
+			stdinDup.Close()
+		}
+		if stdoutDup != nil {
+			stdoutDup.Close()
+		}
+		if stderrDup != nil {
+			stderrDup.Close()
+		}
 	}
 
 	// Stdin pipe (Go writes to stdinW, child reads from stdinR)
@@ -348,53 +688,143 @@ func (x *RuntimeContext) RunWithIO(id string, spec *ContainerSpec, ioCfg *IOConf
 			return nil, err
 		}
 		stdinFd = C.int(stdinR.Fd())
+	} else if ioCfg.StdinFd > 0 {
+		if stdinDup, err = dupFd(ioCfg.StdinFd, "StdinFd"); err != nil {
+			closePipes()
+			return nil, err
+		}
+		stdinFd = C.int(stdinDup.Fd())
+	} else if ioCfg.InheritStdio {
+		if stdinDup, err = dupFd(syscall.Stdin, "InheritStdio"); err != nil {
+			closePipes()
+			return nil, err
+		}
+		stdinFd = C.int(stdinDup.Fd())
 	}
 
 	// Stdout pipe (child writes to stdoutW, Go reads from stdoutR)
+	// With Combined, the same pipe is also used for stderr
 	stdoutFd := C.int(-1)
-	if ioCfg.Stdout != nil {
+	stdoutDst := ioCfg.Stdout
+	if ioCfg.Combined != nil {
+		stdoutDst = ioCfg.Combined
+	}
+	if stdoutDst != nil && !ioCfg.Tagged {
 		stdoutR, stdoutW, err = os.Pipe()
 		if err != nil {
 			closePipes()
 			return nil, err
 		}
 		stdoutFd = C.int(stdoutW.Fd())
+	} else if ioCfg.StdoutFd > 0 {
+		if stdoutDup, err = dupFd(ioCfg.StdoutFd, "StdoutFd"); err != nil {
+			closePipes()
+			return nil, err
+		}
+		stdoutFd = C.int(stdoutDup.Fd())
+	} else if ioCfg.InheritStdio {
+		if stdoutDup, err = dupFd(syscall.Stdout, "InheritStdio"); err != nil {
+			closePipes()
+			return nil, err
+		}
+		stdoutFd = C.int(stdoutDup.Fd())
 	}
 
 	// Stderr pipe (child writes to stderrW, Go reads from stderrR)
 	stderrFd := C.int(-1)
-	if ioCfg.Stderr != nil {
+	if ioCfg.Combined != nil {
+		stderrFd = stdoutFd
+	} else if ioCfg.Stderr != nil && !ioCfg.Tagged {
 		stderrR, stderrW, err = os.Pipe()
 		if err != nil {
 			closePipes()
 			return nil, err
 		}
 		stderrFd = C.int(stderrW.Fd())
+	} else if ioCfg.StderrFd > 0 {
+		if stderrDup, err = dupFd(ioCfg.StderrFd, "StderrFd"); err != nil {
+			closePipes()
+			return nil, err
+		}
+		stderrFd = C.int(stderrDup.Fd())
+	} else if ioCfg.InheritStdio {
+		if stderrDup, err = dupFd(syscall.Stderr, "InheritStdio"); err != nil {
+			closePipes()
+			return nil, err
+		}
+		stderrFd = C.int(stderrDup.Fd())
+	}
+
+	// Tagged pipe (child relay writes framed stdout/stderr, Go demultiplexes)
+	muxFd := C.int(-1)
+	if ioCfg.Tagged && (ioCfg.Stdout != nil || ioCfg.Stderr != nil) {
+		muxR, muxW, err = os.Pipe()
+		if err != nil {
+			closePipes()
+			return nil, err
+		}
+		muxFd = C.int(muxW.Fd())
+	}
+
+	// Output nobody reads goes to /dev/null rather than the caller's stdio,
+	// unless the tagged relay replaces both streams
+	if muxFd < 0 && (stdoutFd < 0 || stderrFd < 0) {
+		devNull, err = os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+		if err != nil {
+			closePipes()
+			return nil, err
+		}
+		if stdoutFd < 0 {
+			stdoutFd = C.int(devNull.Fd())
+		}
+		if stderrFd < 0 {
+			stderrFd = C.int(devNull.Fd())
+		}
 	}
 
 	// Log pipe (child writes structured logs, Go reads and forwards to handler)
 	// Only create if a log handler is registered
+	// The handler is referenced until the log goroutine is done with it
 	logFd := C.int(-1)
-	handler := getLogHandler()
-	if handler != nil {
+	logRef := acquireLogHandler()
+	if logRef != nil {
 		logR, logW, err = os.Pipe()
 		if err != nil {
+			releaseLogHandler(logRef)
 			closePipes()
 			return nil, err
 		}
 		logFd = C.int(logW.Fd())
 	}
 
-	// Lock to protect context ID during fork (fork copies the context)
-	x.mu.Lock()
-	x.setContextID(id)
+	// Ready pipe (child reports the create result before the container is started)
+	readyR, readyW, err = os.Pipe()
+	if err != nil {
+		releaseLogHandler(logRef)
+		closePipes()
+		return nil, err
+	}
 
-	// Call C function to fork and run
+	// The forked child gets its own copy of the per-call context
+	ctx, release := x.contextWithID(id)
+	if o.Detach {
+		ctx.detach = true
+	}
+	if o.bundle != "" {
+		cbundle := C.CString(o.bundle)
+		defer C.free(unsafe.Pointer(cbundle))
+		ctx.bundle = cbundle
+	}
+
+	// Call C function to fork and create. The container is started from here
+	// once created, so that creation errors (e.g. ErrContainerExists) are
+	// reported, which a forked libcrun_container_run could only report
+	// through its exit code
 	var childPid C.pid_t
 	var cerr C.libcrun_error_t
-	rc := C.go_crun_run_with_pipes(x.c, spec.c, runFlags(RunOptions{}),
-		stdinFd, stdoutFd, stderrFd, logFd, &childPid, &cerr)
-	x.mu.Unlock()
+	rc := C.go_crun_create_with_pipes(ctx, spec.c, createFlags(CreateOptions{Prefork: o.Prefork}),
+		stdinFd, stdoutFd, stderrFd, logFd, muxFd, C.int(readyW.Fd()), &childPid, &cerr)
+	release()
 
 	// Close child-side fds in Go (Go owns all fds, C doesn't close them)
 	if stdinR != nil {
@@ -409,6 +839,24 @@ func (x *RuntimeContext) RunWithIO(id string, spec *ContainerSpec, ioCfg *IOConf
 	if logW != nil {
 		logW.Close()
 	}
+	if muxW != nil {
+		muxW.Close()
+	}
+	if readyW != nil {
+		readyW.Close()
+	}
+	if devNull != nil {
+		devNull.Close()
+	}
+	if stdinDup != nil {
+		stdinDup.Close()
+	}
+	if stdoutDup != nil {
+		stdoutDup.Close()
+	}
+	if stderrDup != nil {
+		stderrDup.Close()
+	}
 
 	if rc < 0 {
 		// Cleanup remaining pipes on error
@@ -424,6 +872,13 @@ func (x *RuntimeContext) RunWithIO(id string, spec *ContainerSpec, ioCfg *IOConf
 		if logR != nil {
 			logR.Close()
 		}
+		if muxR != nil {
+			muxR.Close()
+		}
+		if readyR != nil {
+			readyR.Close()
+		}
+		releaseLogHandler(logRef)
 		return nil, fromLibcrunErr(&cerr)
 	}
 
@@ -439,12 +894,12 @@ func (x *RuntimeContext) RunWithIO(id string, spec *ContainerSpec, ioCfg *IOConf
 		}()
 	}
 
-	if ioCfg.Stdout != nil && stdoutR != nil {
+	if stdoutDst != nil && stdoutR != nil {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
 			defer stdoutR.Close()
-			_, _ = io.Copy(ioCfg.Stdout, stdoutR)
+			_, _ = io.Copy(stdoutDst, stdoutR)
 		}()
 	}
 
@@ -457,18 +912,30 @@ func (x *RuntimeContext) RunWithIO(id string, spec *ContainerSpec, ioCfg *IOConf
 		}()
 	}
 
+	if muxR != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer muxR.Close()
+			readTaggedPipe(muxR, ioCfg.Stdout, ioCfg.Stderr)
+		}()
+	}
+
 	// Start log reader goroutine if handler is set
-	if handler != nil && logR != nil {
+	if logRef != nil && logR != nil {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
+			defer releaseLogHandler(logRef)
 			defer logR.Close()
-			readLogPipe(logR, handler)
+			readLogPipe(logR, logRef.handler)
 		}()
 	}
 
-	// Create Wait function
-	waitFn := func() (int, error) {
+	// Create Wait function. It may be called more than once (e.g. after
+	// WaitTimeout timed out), so the child is only reaped once
+	ctr := &Container{ID: id, runtime: x}
+	waitFn := sync.OnceValues(func() (int, error) {
 		var exitCode C.int
 		var werr C.libcrun_error_t
 		wrc := C.go_crun_wait(childPid, &exitCode, &werr)
@@ -477,28 +944,124 @@ func (x *RuntimeContext) RunWithIO(id string, spec *ContainerSpec, ioCfg *IOConf
 		}
 		// Wait for I/O goroutines to finish
 		wg.Wait()
+		err := flushWriters(stdoutDst, ioCfg.Stderr)
+		if ctrLog != nil {
+			err = errors.Join(err, ctrLog.Close())
+		}
+		if o.AutoRemove {
+			err = errors.Join(err, ctr.Delete(true))
+		}
+		if err != nil {
+			return int(exitCode), err
+		}
 		return int(exitCode), nil
+	})
+
+	var startErr error
+	if o.createOnly {
+		startErr = awaitCreate(ctr, readyR)
+	} else {
+		startErr = x.startAfterHook(ctr, readyR, o.BeforeStart)
+	}
+	if startErr != nil {
+		// The child exits once the container is gone; the I/O goroutines
+		// finish on their own when the pipes hit EOF
+		var exitCode C.int
+		var werr C.libcrun_error_t
+		if C.go_crun_wait(childPid, &exitCode, &werr) < 0 {
+			_ = fromLibcrunErr(&werr)
+		}
+		return nil, startErr
 	}
 
+	logHandedOff = true
 	return &RunResult{
-		Container: &Container{ID: id, runtime: x},
+		Container: ctr,
 		Wait:      waitFn,
 	}, nil
 }
 
+// flushWriters flushes or syncs each non-nil writer. Sync errors from files
+// that cannot be synced (pipes, terminals) are ignored.
+func flushWriters(writers ...io.Writer) error {
+	var errs []error
+	for _, w := range writers {
+		switch f := w.(type) {
+		case interface{ Flush() error }:
+			if err := f.Flush(); err != nil {
+				errs = append(errs, fmt.Errorf("libcrun: flush output: %w", err))
+			}
+		case interface{ Sync() error }:
+			if err := f.Sync(); err != nil && !errors.Is(err, syscall.EINVAL) && !errors.Is(err, syscall.ENOTSUP) {
+				errs = append(errs, fmt.Errorf("libcrun: sync output: %w", err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// awaitCreate waits for the forked create to finish and returns its error.
+func awaitCreate(ctr *Container, ready io.ReadCloser) error {
+	err := readCreateResult(ready)
+	ready.Close()
+	if err != nil {
+		cleanupNetnsPin(ctr.ID, err)
+	}
+	return err
+}
+
+// startAfterHook waits for the forked create to finish, runs hook, if any, on
+// the created container and starts it. On hook or start failure the container
+// is deleted.
+func (x *RuntimeContext) startAfterHook(ctr *Container, ready io.ReadCloser, hook func(*Container) error) error {
+	if err := awaitCreate(ctr, ready); err != nil {
+		return err
+	}
+
+	if hook != nil {
+		if err := hook(ctr); err != nil {
+			_ = ctr.Delete(true)
+			return fmt.Errorf("libcrun: before start hook: %w", err)
+		}
+	}
+	if err := x.startContainer(ctr.ID); err != nil {
+		_ = ctr.Delete(true)
+		return err
+	}
+	return nil
+}
+
 // Create creates the container (does not start).
 // Returns a Container handle for further operations.
+//
+// Like Run, libcrun runs in a forked child, as creating the container from a
+// multithreaded process can deadlock it, and the container's stdin, stdout and
+// stderr are /dev/null. Unless detached, the child stays around until the
+// container exits, to reap it and record its exit code for ExitCode, and is
+// reaped in turn by a goroutine.
 func (x *RuntimeContext) Create(id string, spec *ContainerSpec, o CreateOptions) (*Container, error) {
-	if x == nil || x.c == nil || spec == nil || spec.c == nil {
-		return nil, errors.New("libcrun: invalid runtime context or container spec")
+	result, err := x.runWithIO(id, spec, &IOConfig{},
+		RunOptions{Prefork: o.Prefork, Detach: o.Detach, createOnly: true})
+	if err != nil {
+		return nil, err
 	}
-	x.setContextID(id)
-	var err C.libcrun_error_t
-	rc := C.libcrun_container_create(x.c, spec.c, createFlags(o), &err)
-	if rc < 0 {
-		return nil, fromLibcrunErr(&err)
+	go func() { _, _ = result.Wait() }()
+	return result.Container, nil
+}
+
+// EnsureCreated creates the container unless one with the same ID already
+// exists, for callers that retry creation (e.g. reconcile loops). It reports
+// whether the container was created by this call. An existing container is
+// returned as is, whatever its state and spec.
+func (x *RuntimeContext) EnsureCreated(id string, spec *ContainerSpec) (ctr *Container, created bool, err error) {
+	ctr, err = x.Create(id, spec, CreateOptions{})
+	if errors.Is(err, ErrContainerExists) {
+		return x.Get(id), false, nil
 	}
-	return &Container{ID: id, runtime: x}, nil
+	if err != nil {
+		return nil, false, err
+	}
+	return ctr, true, nil
 }
 
 // List returns Container handles for all containers under the configured state root.
@@ -545,6 +1108,26 @@ func (x *RuntimeContext) ListIDs() ([]string, error) {
 	return out, nil
 }
 
+// DeleteAll deletes every container under the configured state root. It does
+// not stop at the first failure: it returns the number of containers deleted
+// and one error per container that could not be deleted.
+func (x *RuntimeContext) DeleteAll(force bool) (int, []error) {
+	ids, err := x.ListIDs()
+	if err != nil {
+		return 0, []error{err}
+	}
+	deleted := 0
+	var errs []error
+	for _, id := range ids {
+		if err := x.deleteContainer(id, force); err != nil {
+			errs = append(errs, fmt.Errorf("libcrun: delete container %q: %w", id, err))
+			continue
+		}
+		deleted++
+	}
+	return deleted, errs
+}
+
 // internal methods for Container to use
 
 func (x *RuntimeContext) deleteContainer(id string, force bool) error {
@@ -623,6 +1206,151 @@ func (x *RuntimeContext) execJSON(id string, processJSON string) error {
 	return nil
 }
 
+// execStream forks and runs libcrun exec with stdout/stderr connected to pipes.
+// The returned readers are owned by the caller. Cancelling ctx kills the exec'd
+// process (via the pid file written by libcrun), or the forked child if the
+// process has not been started yet.
+func (x *RuntimeContext) execStream(ctx context.Context, id string, processJSON string) (io.ReadCloser, io.ReadCloser, func() (int, error), error) {
+	if x == nil || x.c == nil {
+		return nil, nil, nil, errors.New("libcrun: invalid runtime context")
+	}
+
+	pidDir, err := os.MkdirTemp("", "crun-exec-*")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	pidFile := filepath.Join(pidDir, "pid")
+
+	var stdoutR, stdoutW, stderrR, stderrW, logR, logW *os.File
+	closeAll := func() {
+		for _, f := range []*os.File{stdoutR, stdoutW, stderrR, stderrW, logR, logW} {
+			if f != nil {
+				f.Close()
+			}
+		}
+		os.RemoveAll(pidDir)
+	}
+
+	if stdoutR, stdoutW, err = os.Pipe(); err != nil {
+		closeAll()
+		return nil, nil, nil, err
+	}
+	if stderrR, stderrW, err = os.Pipe(); err != nil {
+		closeAll()
+		return nil, nil, nil, err
+	}
+	logFd := C.int(-1)
+	logRef := acquireLogHandler()
+	if logRef != nil {
+		if logR, logW, err = os.Pipe(); err != nil {
+			releaseLogHandler(logRef)
+			closeAll()
+			return nil, nil, nil, err
+		}
+		logFd = C.int(logW.Fd())
+	}
+
+	cid := C.CString(id)
+	cjson := C.CString(processJSON)
+	cpidFile := C.CString(pidFile)
+	defer C.free(unsafe.Pointer(cid))
+	defer C.free(unsafe.Pointer(cjson))
+	defer C.free(unsafe.Pointer(cpidFile))
+
+	var childPid C.pid_t
+	var cerr C.libcrun_error_t
+	rc := C.go_crun_exec_with_pipes(x.c, cid, cjson, -1, C.int(stdoutW.Fd()), C.int(stderrW.Fd()),
+		logFd, cpidFile, &childPid, &cerr)
+
+	// Close child-side fds in Go (Go owns all fds, C doesn't close them)
+	stdoutW.Close()
+	stderrW.Close()
+	stdoutW, stderrW = nil, nil
+	if logW != nil {
+		logW.Close()
+		logW = nil
+	}
+
+	if rc < 0 {
+		releaseLogHandler(logRef)
+		closeAll()
+		return nil, nil, nil, fromLibcrunErr(&cerr)
+	}
+
+	var wg sync.WaitGroup
+	if logRef != nil && logR != nil {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer releaseLogHandler(logRef)
+			defer logR.Close()
+			readLogPipe(logR, logRef.handler)
+		}()
+	}
+
+	// killMu orders the kill on ctx cancellation against the exit, so that
+	// ctx.Err() is only reported if the process was killed before it exited.
+	// The pidfd, when supported, also catches an exit not yet reaped by wait.
+	var killMu sync.Mutex
+	var exited, killed bool
+	pidfd, pidfdErr := pidfdOpen(int(childPid))
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			killMu.Lock()
+			if !exited {
+				if pidfdErr == nil {
+					exited, _ = pidfdWait(pidfd, 0)
+				}
+				if !exited {
+					killExecProcess(pidFile, int(childPid))
+					killed = true
+				}
+			}
+			killMu.Unlock()
+		case <-done:
+		}
+	}()
+
+	waitFn := sync.OnceValues(func() (int, error) {
+		var exitCode C.int
+		var werr C.libcrun_error_t
+		wrc := C.go_crun_wait(childPid, &exitCode, &werr)
+		killMu.Lock()
+		exited = true
+		wasKilled := killed
+		if pidfdErr == nil {
+			syscall.Close(pidfd)
+		}
+		killMu.Unlock()
+		close(done)
+		wg.Wait()
+		os.RemoveAll(pidDir)
+		if wrc < 0 {
+			return -1, fromLibcrunErr(&werr)
+		}
+		if wasKilled {
+			return int(exitCode), ctx.Err()
+		}
+		return int(exitCode), nil
+	})
+
+	return stdoutR, stderrR, waitFn, nil
+}
+
+// killExecProcess sends SIGKILL to the process recorded in pidFile, falling
+// back to the forked libcrun child when the pid file is not written yet.
+func killExecProcess(pidFile string, childPid int) {
+	if data, err := os.ReadFile(pidFile); err == nil {
+		if pid, err := strconv.Atoi(strings.TrimSpace(string(data))); err == nil && pid > 0 {
+			_ = syscall.Kill(pid, syscall.SIGKILL)
+			return
+		}
+	}
+	_ = syscall.Kill(childPid, syscall.SIGKILL)
+}
+
 func (x *RuntimeContext) pauseContainer(id string) error {
 	if x == nil || x.c == nil {
 		return errors.New("libcrun: invalid runtime context")
@@ -632,7 +1360,11 @@ func (x *RuntimeContext) pauseContainer(id string) error {
 	var err C.libcrun_error_t
 	rc := C.go_crun_pause(x.c, cid, &err)
 	if rc < 0 {
-		return fromLibcrunErr(&err)
+		perr := fromLibcrunErr(&err)
+		if isFreezerUnsupported(perr) && isCgroupV2() {
+			return x.freezeContainerCgroup(id, true, perr)
+		}
+		return perr
 	}
 	return nil
 }
@@ -646,11 +1378,60 @@ func (x *RuntimeContext) unpauseContainer(id string) error {
 	var err C.libcrun_error_t
 	rc := C.go_crun_unpause(x.c, cid, &err)
 	if rc < 0 {
-		return fromLibcrunErr(&err)
+		perr := fromLibcrunErr(&err)
+		if isFreezerUnsupported(perr) && isCgroupV2() {
+			return x.freezeContainerCgroup(id, false, perr)
+		}
+		return perr
 	}
 	return nil
 }
 
+// freezeContainerCgroup is the cgroup v2 fallback for pause/unpause when libcrun
+// reports the freezer as unsupported: it writes cgroup.freeze directly.
+// cause is returned if the container has no cgroup to freeze.
+func (x *RuntimeContext) freezeContainerCgroup(id string, freeze bool, cause error) error {
+	path, err := x.containerCgroupPath(id)
+	if err != nil {
+		return err
+	}
+	if path == "" {
+		return cause
+	}
+	return setCgroupFreeze(cgroupRoot, path, freeze)
+}
+
+func (x *RuntimeContext) containerCgroupPath(id string) (string, error) {
+	if x == nil || x.c == nil {
+		return "", errors.New("libcrun: invalid runtime context")
+	}
+	cid := C.CString(id)
+	defer C.free(unsafe.Pointer(cid))
+	var err C.libcrun_error_t
+	buf := C.go_crun_cgroup_path(x.c.state_root, cid, &err)
+	if buf == nil {
+		return "", fromLibcrunErr(&err)
+	}
+	defer C.free(unsafe.Pointer(buf))
+	return C.GoString(buf), nil
+}
+
+// containerStateDir returns the libcrun state directory of the container.
+func (x *RuntimeContext) containerStateDir(id string) (string, error) {
+	if x == nil || x.c == nil {
+		return "", errors.New("libcrun: invalid runtime context")
+	}
+	cid := C.CString(id)
+	defer C.free(unsafe.Pointer(cid))
+	var err C.libcrun_error_t
+	dir := C.go_crun_state_dir(x.c.state_root, cid, &err)
+	if dir == nil {
+		return "", fromLibcrunErr(&err)
+	}
+	defer C.free(unsafe.Pointer(dir))
+	return C.GoString(dir), nil
+}
+
 func (x *RuntimeContext) killAllContainer(id string, signal Signal) error {
 	if x == nil || x.c == nil {
 		return errors.New("libcrun: invalid runtime context")
@@ -697,6 +1478,36 @@ func (x *RuntimeContext) isContainerRunning(id string) (bool, error) {
 	return rc > 0, nil
 }
 
+// exitCodeRecordTimeout bounds how long ExitCode waits for the child that
+// created a stopped container to record its exit code.
+const exitCodeRecordTimeout = time.Second
+
+func (x *RuntimeContext) containerExitCode(id string) (int, error) {
+	if x == nil || x.c == nil {
+		return -1, errors.New("libcrun: invalid runtime context")
+	}
+	cid := C.CString(id)
+	defer C.free(unsafe.Pointer(cid))
+	deadline := time.Now().Add(exitCodeRecordTimeout)
+	for {
+		var code C.int
+		var err C.libcrun_error_t
+		rc := C.go_crun_exit_code(x.c.state_root, cid, &code, &err)
+		switch {
+		case rc < 0:
+			return -1, fromLibcrunErr(&err)
+		case rc == 2 && time.Now().Before(deadline):
+			// The child that created the container records it once it reaps
+			// the exited init
+			time.Sleep(stopPollInterval)
+		case rc > 0:
+			return -1, ErrExitCodeUnavailable
+		default:
+			return int(code), nil
+		}
+	}
+}
+
 func (x *RuntimeContext) containerPIDs(id string, recurse bool) ([]int, error) {
 	if x == nil || x.c == nil {
 		return nil, errors.New("libcrun: invalid runtime context")
@@ -742,30 +1553,115 @@ type LogEntry struct {
 // LogHandler is the callback type for receiving libcrun logs.
 type LogHandler func(entry LogEntry)
 
+// logHandlerRef is a reference-counted log handler registration. Runs that
+// forward child logs hold a reference for as long as their log goroutine is
+// active, and libcrun callbacks for as long as they run the handler, so
+// replacing the handler never frees a handle still in use.
+type logHandlerRef struct {
+	handler LogHandler
+	handle  cgo.Handle
+	refs    int    // protected by logHandleMu
+	stop    func() // called once unused (nil if nothing to stop)
+}
+
 var (
 	logHandleMu sync.Mutex
-	logHandler  LogHandler // current handler (nil = no handler)
-	logHandle   cgo.Handle // handle for C callback (0 when no handler)
+	logHandle   cgo.Handle     // handle for C callback (0 when no handler)
+	logRef      *logHandlerRef // current registration (nil = no handler)
+
+	// logRefs maps the handles of registrations still referenced to them
+	logRefs = make(map[cgo.Handle]*logHandlerRef)
 )
 
 //export goLogCallback
 func goLogCallback(handle C.uintptr_t, errno C.int, msg *C.char, verbosity C.int) {
-	h := cgo.Handle(handle)
-	handler := h.Value().(LogHandler)
-	if handler != nil {
-		handler(LogEntry{
-			Errno:     int(errno),
-			Message:   C.GoString(msg),
-			Verbosity: int(verbosity),
-		})
+	logCallback(cgo.Handle(handle), LogEntry{
+		Errno:     int(errno),
+		Message:   C.GoString(msg),
+		Verbosity: int(verbosity),
+	})
+}
+
+// logCallback passes entry to the registration of handle, which libcrun read
+// before calling back and may have been replaced since. An entry for a
+// registration already released is dropped.
+func logCallback(handle cgo.Handle, entry LogEntry) {
+	logHandleMu.Lock()
+	ref := logRefs[handle]
+	if ref != nil {
+		ref.refs++
+	}
+	logHandleMu.Unlock()
+	if ref == nil {
+		return
 	}
+	defer releaseLogHandler(ref)
+	ref.handler(entry)
 }
 
-// getLogHandler returns the current log handler (thread-safe).
-func getLogHandler() LogHandler {
+// logWarning reports a warning raised by the Go bindings to the current log
+// handler. It is dropped when no handler is set.
+func logWarning(msg string) {
+	ref := acquireLogHandler()
+	if ref == nil {
+		return
+	}
+	defer releaseLogHandler(ref)
+	ref.handler(LogEntry{Message: msg, Verbosity: VerbosityWarning})
+}
+
+// acquireLogHandler returns a reference to the current log handler registration,
+// or nil if none is set. Each non-nil result must be passed to releaseLogHandler.
+func acquireLogHandler() *logHandlerRef {
+	logHandleMu.Lock()
+	defer logHandleMu.Unlock()
+	if logRef == nil {
+		return nil
+	}
+	logRef.refs++
+	return logRef
+}
+
+// releaseLogHandler drops a reference obtained from acquireLogHandler.
+func releaseLogHandler(r *logHandlerRef) {
+	if r == nil {
+		return
+	}
 	logHandleMu.Lock()
 	defer logHandleMu.Unlock()
-	return logHandler
+	r.unrefLocked()
+}
+
+// unrefLocked drops a reference and deletes the cgo handle once unused.
+// Must be called with logHandleMu held.
+func (r *logHandlerRef) unrefLocked() {
+	r.refs--
+	if r.refs == 0 {
+		delete(logRefs, r.handle)
+		r.handle.Delete()
+		if r.stop != nil {
+			r.stop()
+		}
+	}
+}
+
+// swapLogHandlerLocked installs handler (or clears it if nil) as the current
+// registration and returns the previous one, whose reference the caller must
+// drop with unrefLocked once C no longer points at it. stop, if not nil, is
+// called once the new registration is no longer referenced. Must be called
+// with logHandleMu held.
+func swapLogHandlerLocked(handler LogHandler, stop func()) *logHandlerRef {
+	prev := logRef
+	logRef = nil
+	logHandle = 0
+
+	if handler != nil {
+		// The registration itself holds one reference
+		logRef = &logHandlerRef{handler: handler, handle: cgo.NewHandle(handler), refs: 1, stop: stop}
+		logRefs[logRef.handle] = logRef
+		logHandle = logRef.handle
+	}
+	return prev
 }
 
 // readLogPipe reads structured log entries from a pipe and calls the handler.
@@ -801,6 +1697,71 @@ func readLogPipe(r io.Reader, handler LogHandler) {
 	}
 }
 
+// readCreateResult decodes the create result reported by the forked child.
+// Wire format: [failed:4][errno:4][msg_len:4][message:msg_len]
+func readCreateResult(r io.Reader) error {
+	var hdr struct {
+		Failed int32
+		Errno  int32
+		MsgLen uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &hdr); err != nil {
+		return errors.New("libcrun: child process failed before reporting create result")
+	}
+	msg := make([]byte, hdr.MsgLen)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return errors.New("libcrun: child process failed before reporting create result")
+	}
+	if hdr.Failed == 0 {
+		return nil
+	}
+	message := string(msg)
+	return &Error{
+		Code:    classifyError(message, int(hdr.Errno)),
+		Message: message,
+		Status:  int(hdr.Errno),
+	}
+}
+
+// Stream identifiers used in the tagged output wire format.
+const (
+	taggedStdout = 1
+	taggedStderr = 2
+)
+
+// readTaggedPipe demultiplexes framed container output and writes each chunk
+// to stdout or stderr in the order it was framed. A nil writer discards its stream.
+// Wire format: [stream:1][len:4][data:len]
+func readTaggedPipe(r io.Reader, stdout, stderr io.Writer) {
+	var hdr [5]byte
+	var buf []byte
+	for {
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			return // pipe closed or error
+		}
+		n := binary.LittleEndian.Uint32(hdr[1:])
+		if uint32(cap(buf)) < n {
+			buf = make([]byte, n)
+		}
+		buf = buf[:n]
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return
+		}
+
+		var w io.Writer
+		switch hdr[0] {
+		case taggedStdout:
+			w = stdout
+		case taggedStderr:
+			w = stderr
+		}
+		// Keep draining on write errors so the container never blocks on output
+		if w != nil {
+			_, _ = w.Write(buf)
+		}
+	}
+}
+
 // SetLogHandler sets a Go function to receive all libcrun log messages.
 // Pass nil to disable custom logging (reverts to stderr output).
 //
@@ -809,7 +1770,7 @@ func readLogPipe(r io.Reader, handler LogHandler) {
 //   - Forked child processes (RunWithIO) via a log pipe
 //
 // Note: The handler is called synchronously, so it should be fast and
-// non-blocking. For expensive operations, consider using a buffered channel.
+// non-blocking. For expensive operations, use SetLogHandlerAsync.
 //
 // Example:
 //
@@ -818,23 +1779,80 @@ func readLogPipe(r io.Reader, handler LogHandler) {
 //	    log.Printf("[libcrun] %s", entry.Message)
 //	})
 func SetLogHandler(handler LogHandler) {
-	logHandleMu.Lock()
-	defer logHandleMu.Unlock()
+	setLogHandler(handler, nil)
+}
+
+// defaultLogBufferSize is the SetLogHandlerAsync buffer size used when the
+// requested one is not positive.
+const defaultLogBufferSize = 1024
+
+// logDropped counts the entries dropped by async log handlers.
+var logDropped atomic.Uint64
+
+// LogStats reports log handler statistics.
+type LogStats struct {
+	// Dropped is the number of entries discarded because the buffer of an
+	// async handler was full, since the process started.
+	Dropped uint64
+}
+
+// LogHandlerStats returns the log handler statistics.
+func LogHandlerStats() LogStats {
+	return LogStats{Dropped: logDropped.Load()}
+}
+
+// SetLogHandlerAsync is like SetLogHandler, but runs handler on a dedicated
+// goroutine fed by a buffer of bufferSize entries (a default size if not
+// positive), so a slow handler never blocks libcrun or the reading of child
+// logs. Entries arriving while the buffer is full are dropped and counted in
+// LogHandlerStats. Entries still buffered when the handler is replaced are
+// delivered before its goroutine exits.
+func SetLogHandlerAsync(handler LogHandler, bufferSize int) {
+	if handler == nil {
+		setLogHandler(nil, nil)
+		return
+	}
+	setLogHandler(newAsyncLogHandler(handler, bufferSize))
+}
 
-	// Release previous handle if set
-	if logHandle != 0 {
-		logHandle.Delete()
-		logHandle = 0
+// newAsyncLogHandler returns a non-blocking handler queueing entries for
+// handler, and a function stopping the delivery goroutine once the returned
+// handler is no longer called.
+func newAsyncLogHandler(handler LogHandler, bufferSize int) (LogHandler, func()) {
+	if bufferSize <= 0 {
+		bufferSize = defaultLogBufferSize
+	}
+	entries := make(chan LogEntry, bufferSize)
+	go func() {
+		for entry := range entries {
+			handler(entry)
+		}
+	}()
+	enqueue := func(entry LogEntry) {
+		select {
+		case entries <- entry:
+		default:
+			logDropped.Add(1)
+		}
 	}
-	logHandler = nil
+	return enqueue, func() { close(entries) }
+}
 
+// setLogHandler installs handler in libcrun, calling stop once the
+// registration is replaced and no longer referenced.
+func setLogHandler(handler LogHandler, stop func()) {
+	logHandleMu.Lock()
+	defer logHandleMu.Unlock()
+
+	prev := swapLogHandlerLocked(handler, stop)
 	if handler == nil {
 		C.go_crun_reset_log_handler()
-		return
+	} else {
+		C.go_crun_set_log_handler(C.uintptr_t(logHandle))
 	}
 
-	// Store handler and create cgo handle for C callback
-	logHandler = handler
-	logHandle = cgo.NewHandle(handler)
-	C.go_crun_set_log_handler(C.uintptr_t(logHandle))
+	// Release the previous registration; in-flight runs keep it alive
+	if prev != nil {
+		prev.unrefLocked()
+	}
 }
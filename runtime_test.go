@@ -3,7 +3,20 @@
 package crun
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"runtime/cgo"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"testing"
+	"time"
 )
 
 func TestRuntimeConfigDefaults(t *testing.T) {
@@ -21,6 +34,46 @@ func TestRuntimeConfigDefaults(t *testing.T) {
 	}
 }
 
+func TestNewRuntimeContextCreateStateRoot(t *testing.T) {
+	stateRoot := filepath.Join(t.TempDir(), "nested", "state")
+
+	rc, err := NewRuntimeContext(RuntimeConfig{
+		StateRoot:       stateRoot,
+		CreateStateRoot: true,
+	})
+	if err != nil {
+		t.Fatalf("NewRuntimeContext failed: %v", err)
+	}
+	defer rc.Close()
+
+	fi, err := os.Stat(stateRoot)
+	if err != nil {
+		t.Fatalf("State root not created: %v", err)
+	}
+	if !fi.IsDir() {
+		t.Error("State root should be a directory")
+	}
+	if fi.Mode().Perm() != 0700 {
+		t.Errorf("State root mode = %o, want 0700", fi.Mode().Perm())
+	}
+}
+
+func TestNewRuntimeContextStateRootValidation(t *testing.T) {
+	// Relative state root is rejected
+	if _, err := NewRuntimeContext(RuntimeConfig{StateRoot: "relative/state"}); err == nil {
+		t.Error("NewRuntimeContext should fail for a relative state root")
+	}
+
+	// Existing non-directory is rejected
+	file := filepath.Join(t.TempDir(), "file")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatalf("Failed to create file: %v", err)
+	}
+	if _, err := NewRuntimeContext(RuntimeConfig{StateRoot: file, CreateStateRoot: true}); err == nil {
+		t.Error("NewRuntimeContext should fail when the state root is a file")
+	}
+}
+
 func TestSetLogHandler(t *testing.T) {
 	// Set a handler
 	SetLogHandler(func(entry LogEntry) {
@@ -84,3 +137,437 @@ func TestLogEntry(t *testing.T) {
 	}
 }
 
+// streamRecorder records writes from both streams in a single ordered log.
+type streamRecorder struct {
+	name string
+	log  *[]string
+}
+
+func (w streamRecorder) Write(p []byte) (int, error) {
+	*w.log = append(*w.log, w.name+":"+string(p))
+	return len(p), nil
+}
+
+func TestReadTaggedPipe(t *testing.T) {
+	frames := []struct {
+		stream byte
+		data   string
+	}{
+		{taggedStdout, "out 1\n"},
+		{taggedStderr, "err 1\n"},
+		{taggedStdout, "out 2\n"},
+		{taggedStdout, "out 3\n"},
+		{taggedStderr, "err 2\n"},
+		{9, "unknown stream\n"},
+		{taggedStdout, "out 4\n"},
+	}
+
+	var buf bytes.Buffer
+	for _, f := range frames {
+		buf.WriteByte(f.stream)
+		_ = binary.Write(&buf, binary.LittleEndian, uint32(len(f.data)))
+		buf.WriteString(f.data)
+	}
+	// A truncated trailing frame must be ignored
+	buf.Write([]byte{taggedStderr, 10, 0, 0, 0, 'x'})
+
+	var got []string
+	readTaggedPipe(&buf, streamRecorder{"stdout", &got}, streamRecorder{"stderr", &got})
+
+	want := []string{
+		"stdout:out 1\n",
+		"stderr:err 1\n",
+		"stdout:out 2\n",
+		"stdout:out 3\n",
+		"stderr:err 2\n",
+		"stdout:out 4\n",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("readTaggedPipe order = %q, want %q", got, want)
+	}
+}
+
+func TestReadTaggedPipeNilWriter(t *testing.T) {
+	var buf bytes.Buffer
+	for _, stream := range []byte{taggedStderr, taggedStdout} {
+		buf.WriteByte(stream)
+		_ = binary.Write(&buf, binary.LittleEndian, uint32(2))
+		buf.WriteString("ok")
+	}
+
+	var out bytes.Buffer
+	readTaggedPipe(&buf, &out, nil)
+	if out.String() != "ok" {
+		t.Errorf("stdout = %q, want %q", out.String(), "ok")
+	}
+}
+
+func writeCreateResult(buf *bytes.Buffer, failed, errno int32, msg string) {
+	_ = binary.Write(buf, binary.LittleEndian, failed)
+	_ = binary.Write(buf, binary.LittleEndian, errno)
+	_ = binary.Write(buf, binary.LittleEndian, uint32(len(msg)))
+	buf.WriteString(msg)
+}
+
+func TestReadCreateResult(t *testing.T) {
+	var ok bytes.Buffer
+	writeCreateResult(&ok, 0, 0, "")
+	if err := readCreateResult(&ok); err != nil {
+		t.Errorf("readCreateResult(success) = %v, want nil", err)
+	}
+
+	var failed bytes.Buffer
+	writeCreateResult(&failed, 1, 17, "container `test` already exists")
+	err := readCreateResult(&failed)
+	var cerr *Error
+	if !errors.As(err, &cerr) {
+		t.Fatalf("readCreateResult(failure) = %v, want *Error", err)
+	}
+	if cerr.Code != ErrAlreadyExists || cerr.Status != 17 {
+		t.Errorf("Error = %+v, want Code=ErrAlreadyExists Status=17", cerr)
+	}
+
+	// Child died before reporting anything
+	if err := readCreateResult(bytes.NewReader(nil)); err == nil {
+		t.Error("readCreateResult(empty) = nil, want error")
+	}
+}
+
+// swapLogHandlerForTest swaps the registration without touching the C side.
+func swapLogHandlerForTest(handler LogHandler) {
+	logHandleMu.Lock()
+	defer logHandleMu.Unlock()
+	if prev := swapLogHandlerLocked(handler, nil); prev != nil {
+		prev.unrefLocked()
+	}
+}
+
+func TestLogHandlerRefCounting(t *testing.T) {
+	var calls atomic.Int64
+	swapLogHandlerForTest(func(LogEntry) { calls.Add(1) })
+	defer swapLogHandlerForTest(nil)
+
+	ref := acquireLogHandler()
+	if ref == nil {
+		t.Fatal("acquireLogHandler returned nil with a handler set")
+	}
+
+	// Replacing the handler must not free the handle still held by ref
+	swapLogHandlerForTest(nil)
+	if acquireLogHandler() != nil {
+		t.Error("acquireLogHandler should return nil after clearing")
+	}
+	ref.handle.Value().(LogHandler)(LogEntry{})
+	if calls.Load() != 1 {
+		t.Errorf("handler calls = %d, want 1", calls.Load())
+	}
+	if ref.refs != 1 {
+		t.Errorf("refs = %d, want 1", ref.refs)
+	}
+
+	releaseLogHandler(ref)
+	if ref.refs != 0 {
+		t.Errorf("refs = %d, want 0 after release", ref.refs)
+	}
+}
+
+func TestLogHandlerSwapStress(t *testing.T) {
+	var calls atomic.Int64
+	handler := func(LogEntry) { calls.Add(1) }
+	swapLogHandlerForTest(handler)
+	defer swapLogHandlerForTest(nil)
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+
+	// Simulated runs: hold a reference while forwarding log entries
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				ref := acquireLogHandler()
+				if ref == nil {
+					continue
+				}
+				for j := 0; j < 10; j++ {
+					// Value panics if the handle was deleted while referenced
+					ref.handle.Value().(LogHandler)(LogEntry{Message: "stress"})
+				}
+				releaseLogHandler(ref)
+			}
+		}()
+	}
+
+	// Keep swapping until the simulated runs have made progress
+	for i := 0; i < 1000 || calls.Load() < 100; i++ {
+		if i%3 == 0 {
+			swapLogHandlerForTest(nil)
+		} else {
+			swapLogHandlerForTest(handler)
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	if calls.Load() == 0 {
+		t.Error("handler was never called")
+	}
+}
+
+// currentLogHandle returns the handle libcrun would call back with.
+func currentLogHandle() cgo.Handle {
+	logHandleMu.Lock()
+	defer logHandleMu.Unlock()
+	return logHandle
+}
+
+func TestLogCallbackSwapStress(t *testing.T) {
+	var calls atomic.Int64
+	handler := func(LogEntry) { calls.Add(1) }
+	swapLogHandlerForTest(handler)
+	defer swapLogHandlerForTest(nil)
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+
+	// Simulated in-process libcrun calls: call back with the handle read
+	// before the handler may have been swapped
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				if h := currentLogHandle(); h != 0 {
+					runtime.Gosched()
+					logCallback(h, LogEntry{Message: "stress"})
+				}
+			}
+		}()
+	}
+
+	// Most callbacks find their handle already swapped out, so only the
+	// number of swaps is bounded
+	for i := 0; i < 1000; i++ {
+		if i%3 == 0 {
+			swapLogHandlerForTest(nil)
+		} else {
+			swapLogHandlerForTest(handler)
+		}
+	}
+	close(stop)
+	wg.Wait()
+
+	logHandleMu.Lock()
+	defer logHandleMu.Unlock()
+	if len(logRefs) > 1 {
+		t.Errorf("registrations = %d, want at most the current one", len(logRefs))
+	}
+}
+
+func TestAsyncLogHandlerSwapDuringCallbacks(t *testing.T) {
+	var calls atomic.Int64
+	swapAsync := func() {
+		handler, stop := newAsyncLogHandler(func(LogEntry) { calls.Add(1) }, 16)
+		logHandleMu.Lock()
+		defer logHandleMu.Unlock()
+		if prev := swapLogHandlerLocked(handler, stop); prev != nil {
+			prev.unrefLocked()
+		}
+	}
+	swapAsync()
+	defer swapLogHandlerForTest(nil)
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				// Enqueueing on a stopped handler's closed channel would panic
+				if h := currentLogHandle(); h != 0 {
+					runtime.Gosched()
+					logCallback(h, LogEntry{Message: "stress"})
+				}
+			}
+		}()
+	}
+
+	for i := 0; i < 1000; i++ {
+		swapAsync()
+	}
+	close(stop)
+	wg.Wait()
+
+	// The callbacks above may all have missed their handle; the handler
+	// left installed must still deliver or drop
+	logCallback(currentLogHandle(), LogEntry{Message: "last"})
+	deadline := time.Now().Add(5 * time.Second)
+	for calls.Load()+int64(LogHandlerStats().Dropped) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if calls.Load()+int64(LogHandlerStats().Dropped) == 0 {
+		t.Error("no entry was delivered or dropped")
+	}
+}
+
+func writeLogEntry(buf *bytes.Buffer, verbosity int32, msg string) {
+	_ = binary.Write(buf, binary.LittleEndian, int32(0))
+	_ = binary.Write(buf, binary.LittleEndian, verbosity)
+	_ = binary.Write(buf, binary.LittleEndian, uint32(len(msg)))
+	buf.WriteString(msg)
+}
+
+func TestAsyncLogHandlerDropsWhenFull(t *testing.T) {
+	const entries, bufferSize = 1000, 10
+
+	release := make(chan struct{})
+	var calls atomic.Int64
+	slow := func(LogEntry) {
+		<-release
+		calls.Add(1)
+	}
+	handler, stop := newAsyncLogHandler(slow, bufferSize)
+
+	var buf bytes.Buffer
+	for i := 0; i < entries; i++ {
+		writeLogEntry(&buf, int32(VerbosityDebug), "chatty")
+	}
+
+	before := LogHandlerStats().Dropped
+	done := make(chan struct{})
+	go func() {
+		readLogPipe(&buf, handler)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("readLogPipe blocked on a slow async handler")
+	}
+
+	// At most the buffer plus the entry held by the blocked handler get through
+	dropped := LogHandlerStats().Dropped - before
+	if dropped < entries-bufferSize-1 {
+		t.Errorf("Dropped = %d, want at least %d", dropped, entries-bufferSize-1)
+	}
+
+	close(release)
+	stop()
+	deadline := time.Now().Add(5 * time.Second)
+	for calls.Load()+int64(dropped) < entries && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := calls.Load() + int64(dropped); got != entries {
+		t.Errorf("delivered + dropped = %d, want %d", got, entries)
+	}
+}
+
+func TestRunResultWaitTimeout(t *testing.T) {
+	exited := make(chan struct{})
+	r := &RunResult{Wait: sync.OnceValues(func() (int, error) {
+		<-exited
+		return 3, nil
+	})}
+
+	if _, timedOut, err := r.WaitTimeout(10 * time.Millisecond); !timedOut || err != nil {
+		t.Fatalf("WaitTimeout = timedOut %v, err %v, want timeout", timedOut, err)
+	}
+
+	close(exited)
+	exitCode, timedOut, err := r.WaitTimeout(5 * time.Second)
+	if timedOut || err != nil || exitCode != 3 {
+		t.Errorf("WaitTimeout = (%d, %v, %v), want (3, false, nil)", exitCode, timedOut, err)
+	}
+	if exitCode, err := r.Wait(); exitCode != 3 || err != nil {
+		t.Errorf("Wait = (%d, %v), want (3, nil)", exitCode, err)
+	}
+}
+
+func TestSignalFromOS(t *testing.T) {
+	tests := []struct {
+		sig  os.Signal
+		want Signal
+	}{
+		{syscall.SIGINT, SIGINT},
+		{syscall.SIGTERM, SIGTERM},
+		{syscall.SIGWINCH, "SIGWINCH"},
+		{syscall.Signal(40), "40"},
+	}
+	for _, tt := range tests {
+		if got := signalFromOS(tt.sig); got != tt.want {
+			t.Errorf("signalFromOS(%v) = %q, want %q", tt.sig, got, tt.want)
+		}
+	}
+}
+
+type failingFlusher struct{ bytes.Buffer }
+
+func (failingFlusher) Flush() error { return errors.New("flush failed") }
+
+func TestFlushWriters(t *testing.T) {
+	var buf bytes.Buffer
+	bw := bufio.NewWriter(&buf)
+	bw.WriteString("buffered")
+
+	// Syncing a pipe fails with EINVAL, which must be ignored
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+
+	if err := flushWriters(bw, nil, w); err != nil {
+		t.Fatalf("flushWriters failed: %v", err)
+	}
+	if buf.String() != "buffered" {
+		t.Errorf("buffer = %q, want flushed output", buf.String())
+	}
+
+	if err := flushWriters(&failingFlusher{}); err == nil {
+		t.Error("flushWriters should report Flush errors")
+	}
+}
+
+func TestIOConfigValidateFds(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     IOConfig
+		wantErr bool
+	}{
+		{name: "fds only", cfg: IOConfig{StdinFd: 3, StdoutFd: 4, StderrFd: 5}},
+		{name: "fd and writer on different streams", cfg: IOConfig{StdoutFd: 4, Stderr: &bytes.Buffer{}}},
+		{name: "zero fds are unset", cfg: IOConfig{Stdout: &bytes.Buffer{}, Tagged: true}},
+		{name: "stdin fd and reader", cfg: IOConfig{StdinFd: 3, Stdin: &bytes.Buffer{}}, wantErr: true},
+		{name: "stdout fd and writer", cfg: IOConfig{StdoutFd: 4, Stdout: &bytes.Buffer{}}, wantErr: true},
+		{name: "stderr fd and writer", cfg: IOConfig{StderrFd: 5, Stderr: &bytes.Buffer{}}, wantErr: true},
+		{name: "fd and combined", cfg: IOConfig{StderrFd: 5, Combined: &bytes.Buffer{}}, wantErr: true},
+		{name: "fd and tagged", cfg: IOConfig{StdoutFd: 4, Stderr: &bytes.Buffer{}, Tagged: true}, wantErr: true},
+		{name: "inherit with writer and fd", cfg: IOConfig{InheritStdio: true, Stdout: &bytes.Buffer{}, StderrFd: 5}},
+		{name: "inherit and combined", cfg: IOConfig{InheritStdio: true, Combined: &bytes.Buffer{}}, wantErr: true},
+		{name: "inherit and tagged", cfg: IOConfig{InheritStdio: true, Stdout: &bytes.Buffer{}, Tagged: true}, wantErr: true},
+		{name: "inherit and log file", cfg: IOConfig{InheritStdio: true, LogFile: "ctr.log"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		if err := tt.cfg.validateFds(); (err != nil) != tt.wantErr {
+			t.Errorf("%s: validateFds() error = %v, wantErr %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
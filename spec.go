@@ -7,8 +7,13 @@ package crun
 */
 import "C"
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
 	"runtime"
+	"sync"
 	"unsafe"
 
 	specs "github.com/opencontainers/runtime-spec/specs-go"
@@ -18,6 +23,10 @@ import (
 // This is the spec holder - create a Container via RuntimeContext.Create/Run.
 type ContainerSpec struct {
 	c *C.libcrun_container_t
+
+	rootfsPrepare []func(rootfs string) error // AddRootfsPrepare callbacks
+
+	cgroupParent string // SetCgroupParent parent
 }
 
 // LoadContainerSpecFromFile loads an OCI spec from file.
@@ -38,6 +47,21 @@ func LoadContainerSpecFromFile(path string) (*ContainerSpec, error) {
 func LoadContainerSpecFromJSON(def string) (*ContainerSpec, error) {
 	cdef := C.CString(def)
 	defer C.free(unsafe.Pointer(cdef))
+	return loadContainerSpecFromCString(cdef)
+}
+
+// loadContainerSpecFromJSON is LoadContainerSpecFromJSON for a marshalled spec,
+// copying it to C once without an intermediate Go string.
+func loadContainerSpecFromJSON(def []byte) (*ContainerSpec, error) {
+	cdef := (*C.char)(C.malloc(C.size_t(len(def) + 1)))
+	defer C.free(unsafe.Pointer(cdef))
+	buf := unsafe.Slice((*byte)(unsafe.Pointer(cdef)), len(def)+1)
+	copy(buf, def)
+	buf[len(def)] = 0
+	return loadContainerSpecFromCString(cdef)
+}
+
+func loadContainerSpecFromCString(cdef *C.char) (*ContainerSpec, error) {
 	var err C.libcrun_error_t
 	ctr := C.libcrun_container_load_from_memory(cdef, &err)
 	if ctr == nil {
@@ -48,13 +72,117 @@ func LoadContainerSpecFromJSON(def string) (*ContainerSpec, error) {
 	return c, nil
 }
 
+// specBufferPool holds the buffers NewContainerSpec marshals specs into.
+var specBufferPool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// maxPooledSpecBuffer is the largest buffer returned to specBufferPool, so an
+// occasional huge spec does not stay pinned in memory.
+const maxPooledSpecBuffer = 1 << 20
+
 // NewContainerSpec creates a ContainerSpec from a typed specs.Spec.
 func NewContainerSpec(sp *specs.Spec) (*ContainerSpec, error) {
-	b, err := json.Marshal(sp)
-	if err != nil {
+	buf := specBufferPool.Get().(*bytes.Buffer)
+	defer func() {
+		if buf.Cap() <= maxPooledSpecBuffer {
+			buf.Reset()
+			specBufferPool.Put(buf)
+		}
+	}()
+	if err := json.NewEncoder(buf).Encode(sp); err != nil {
 		return nil, err
 	}
-	return LoadContainerSpecFromJSON(string(b))
+	// The buffer is copied to C memory, so it can be reused once loaded
+	return loadContainerSpecFromJSON(buf.Bytes())
+}
+
+// AddRootfsPrepare registers fn to populate the root filesystem (e.g. drop in
+// config files or secrets) before the container is created. fn receives the
+// absolute rootfs path and is called by Create, Run and RunWithIO each time the
+// spec is used, so it should be idempotent. A non-nil error aborts the run.
+// Callbacks run in the order they were added. The spec must not be in use.
+//
+// This is a method rather than a WithRootfsPrepare SpecOption: spec options
+// only edit the OCI spec, which cannot carry Go callbacks.
+func (c *ContainerSpec) AddRootfsPrepare(fn func(rootfs string) error) {
+	c.rootfsPrepare = append(c.rootfsPrepare, fn)
+}
+
+// SetCgroupParent places the container's cgroup under parent without fixing
+// its full path, which is derived from the container ID by Create, Run and
+// RunWithIO. With RuntimeConfig.SystemdCgroup, parent is a slice (e.g.
+// "machine.slice") and the container gets a crungo-<id>.scope in it; otherwise
+// it is a cgroupfs path and the container gets <parent>/<id>. It is ignored if
+// linux.cgroupsPath is set. The spec must not be in use.
+//
+// This is a method rather than a WithCgroupParent SpecOption: the parent is not
+// part of the OCI spec, whose linux.cgroupsPath is only set per container.
+func (c *ContainerSpec) SetCgroupParent(parent string) {
+	c.cgroupParent = parent
+}
+
+// forContainer returns the spec to create container id from and a func to
+// release it once the container is created. Without a cgroup parent this is c
+// itself; otherwise it is a private copy of c with linux.cgroupsPath set to the
+// container's path under the parent, so c can be used concurrently.
+func (c *ContainerSpec) forContainer(id string, systemd bool) (*ContainerSpec, func(), error) {
+	noop := func() {}
+	if c.cgroupParent == "" {
+		return c, noop, nil
+	}
+	linux := c.c.container_def.linux
+	if linux == nil {
+		return nil, nil, invalidSpecError("linux is missing, required by SetCgroupParent")
+	}
+	if linux.cgroups_path != nil && *linux.cgroups_path != 0 {
+		return c, noop, nil
+	}
+
+	var cp *ContainerSpec
+	var err error
+	switch {
+	case c.c.config_file_content != nil:
+		cp, err = loadContainerSpecFromCString(c.c.config_file_content)
+	case c.c.config_file != nil:
+		cp, err = LoadContainerSpecFromFile(C.GoString(c.c.config_file))
+	default:
+		err = errors.New("libcrun: spec has no JSON source")
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	cpLinux := cp.c.container_def.linux
+	C.free(unsafe.Pointer(cpLinux.cgroups_path))
+	cpLinux.cgroups_path = C.CString(cgroupPathForParent(c.cgroupParent, id, systemd))
+	return cp, func() { _ = cp.Close() }, nil
+}
+
+// Validate checks the fields libcrun needs to start the container: Root with
+// a non-empty Path, Process with non-empty Args and an absolute Cwd. The
+// returned error matches ErrInvalidContainerSpec and names the problem. It is
+// called by Create, Run and RunWithIO, so malformed specs fail before forking.
+func (c *ContainerSpec) Validate() error {
+	if c == nil || c.c == nil || c.c.container_def == nil {
+		return invalidSpecError("spec is not loaded")
+	}
+	def := c.c.container_def
+	if def.root == nil || def.root.path == nil || *def.root.path == 0 {
+		return invalidSpecError("root.path is empty")
+	}
+	proc := def.process
+	if proc == nil {
+		return invalidSpecError("process is missing")
+	}
+	if proc.args_len == 0 {
+		return invalidSpecError("process.args is empty")
+	}
+	if proc.cwd == nil || !filepath.IsAbs(C.GoString(proc.cwd)) {
+		return invalidSpecError(fmt.Sprintf("process.cwd %q is not an absolute path", C.GoString(proc.cwd)))
+	}
+	return nil
+}
+
+func invalidSpecError(problem string) error {
+	return &Error{Code: ErrInvalidSpec, Message: "libcrun: invalid container spec: " + problem, cause: errors.New(problem)}
 }
 
 // Close releases the heavy spec memory associated with the ContainerSpec.
@@ -62,6 +190,8 @@ func (c *ContainerSpec) Close() error {
 	if c == nil || c.c == nil {
 		return nil
 	}
+	// The finalizer is only a safety net for a missed Close
+	runtime.SetFinalizer(c, nil)
 	C.go_crun_free_container(c.c)
 	c.c = nil
 	return nil
@@ -78,4 +208,3 @@ func Spec(rootless bool) (string, error) {
 	defer C.free(unsafe.Pointer(buf))
 	return C.GoStringN(buf, ln), nil
 }
-
@@ -3,7 +3,21 @@
 package crun
 
 import (
+	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/user"
+	"path"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 )
@@ -61,7 +75,9 @@ const (
 )
 
 // NewSpec creates a new ContainerSpec with the given options applied.
-// Set rootless=true for an unprivileged container template.
+// Set rootless=true for an unprivileged container template. If the resulting
+// process has no RLIMIT_NOFILE, it gets DefaultNoFileLimit rather than
+// inheriting the caller's limit; use WithNoFileLimit to change it.
 func NewSpec(rootless bool, opts ...SpecOption) (*ContainerSpec, error) {
 	sp, err := DefaultSpec(rootless)
 	if err != nil {
@@ -70,9 +86,29 @@ func NewSpec(rootless bool, opts ...SpecOption) (*ContainerSpec, error) {
 	for _, opt := range opts {
 		opt(sp)
 	}
+	applyDefaultNoFileLimit(sp)
 	return NewContainerSpec(sp)
 }
 
+// DefaultNoFileLimit is the soft and hard RLIMIT_NOFILE NewSpec applies when
+// none is set, the same as libcrun's template.
+const DefaultNoFileLimit = 1024
+
+// applyDefaultNoFileLimit sets RLIMIT_NOFILE to DefaultNoFileLimit if the
+// process has none, since a huge inherited limit slows down programs that
+// close every fd before forking.
+func applyDefaultNoFileLimit(sp *specs.Spec) {
+	if sp.Process == nil {
+		return
+	}
+	for _, rl := range sp.Process.Rlimits {
+		if rl.Type == "RLIMIT_NOFILE" {
+			return
+		}
+	}
+	setRlimit(sp.Process, "RLIMIT_NOFILE", DefaultNoFileLimit, DefaultNoFileLimit)
+}
+
 // WithRootPath sets the root filesystem path.
 func WithRootPath(path string) SpecOption {
 	return func(sp *specs.Spec) {
@@ -83,6 +119,67 @@ func WithRootPath(path string) SpecOption {
 	}
 }
 
+// WithSharedRootfs sets the root filesystem path and marks it read-only, so one
+// base rootfs can be shared by many containers at the same time without copies.
+// Writable state must be provided through tmpfs or overlay mounts (e.g. WithMount
+// with fstype "tmpfs" on /tmp), since nothing can be written to the shared root.
+func WithSharedRootfs(path string) SpecOption {
+	return func(sp *specs.Spec) {
+		if sp.Root == nil {
+			sp.Root = &specs.Root{}
+		}
+		sp.Root.Path = path
+		sp.Root.Readonly = true
+	}
+}
+
+// WithReadonlyRootfs mounts the root filesystem read-only.
+func WithReadonlyRootfs() SpecOption {
+	return func(sp *specs.Spec) {
+		if sp.Root == nil {
+			sp.Root = &specs.Root{}
+		}
+		sp.Root.Readonly = true
+	}
+}
+
+// WithReadonlyRootfsWithDefaults mounts the root filesystem read-only and adds
+// tmpfs mounts on the paths most programs expect to be writable (/tmp, /run
+// and /var/tmp). Paths that already have a mount in the spec are left untouched.
+func WithReadonlyRootfsWithDefaults() SpecOption {
+	return func(sp *specs.Spec) {
+		WithReadonlyRootfs()(sp)
+		for _, dest := range []string{"/tmp", "/run", "/var/tmp"} {
+			if hasMount(sp, dest) {
+				continue
+			}
+			mode := "mode=1777"
+			if dest == "/run" {
+				mode = "mode=755"
+			}
+			sp.Mounts = append(sp.Mounts, specs.Mount{
+				Destination: dest,
+				Type:        "tmpfs",
+				Source:      "tmpfs",
+				Options:     []string{"nosuid", "nodev", mode},
+			})
+		}
+	}
+}
+
+// systemdCgroupPrefix is the scope prefix used for containers placed with
+// SetCgroupParent under systemd.
+const systemdCgroupPrefix = "crungo"
+
+// cgroupPathForParent returns the linux.cgroupsPath of container id placed
+// under parent.
+func cgroupPathForParent(parent, id string, systemd bool) string {
+	if systemd {
+		return parent + ":" + systemdCgroupPrefix + ":" + id
+	}
+	return path.Join("/", parent, id)
+}
+
 // WithArgs sets the process arguments.
 func WithArgs(args ...string) SpecOption {
 	return func(sp *specs.Spec) {
@@ -93,6 +190,96 @@ func WithArgs(args ...string) SpecOption {
 	}
 }
 
+// WithShellCommand sets the process arguments by splitting a single command line
+// using POSIX shell quoting rules (single quotes, double quotes, backslash escapes).
+// No expansion of variables or globs is performed.
+// Example: WithShellCommand(`sh -c 'echo hi'`) sets Args to ["sh", "-c", "echo hi"].
+func WithShellCommand(cmdline string) (SpecOption, error) {
+	args, err := splitShellWords(cmdline)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, errors.New("libcrun: empty command line")
+	}
+	return WithArgs(args...), nil
+}
+
+// WithCommandString sets the process arguments from a command held as a single
+// string, e.g. in a config-driven container definition, split like
+// WithShellCommand. It fails on unbalanced quotes or an empty command.
+func WithCommandString(cmd string) (SpecOption, error) {
+	args, err := splitShellWords(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) == 0 {
+		return nil, errors.New("libcrun: empty command")
+	}
+	return WithArgs(args...), nil
+}
+
+// ociVersionPattern matches x.y.z versions with an optional pre-release or
+// build suffix, e.g. "1.2.0" or "1.0.2-dev".
+var ociVersionPattern = regexp.MustCompile(`^\d+\.\d+\.\d+([-+][0-9A-Za-z.+-]+)?$`)
+
+// WithOCIVersion sets the ociVersion of the spec, for tools that expect a
+// specific version. SupportedOCIVersion returns the newest one libcrun supports.
+// Returns an error if version is not of the form x.y.z.
+func WithOCIVersion(version string) (SpecOption, error) {
+	if !ociVersionPattern.MatchString(version) {
+		return nil, fmt.Errorf("libcrun: invalid OCI version %q: must be of the form x.y.z", version)
+	}
+	return func(sp *specs.Spec) {
+		sp.Version = version
+	}, nil
+}
+
+// InitPath is where WithInit mounts the init binary inside the container.
+const InitPath = "/dev/init"
+
+// initCandidates are the minimal inits FindInit looks for, in order. The ones
+// usually shipped statically linked come first, as distributions often build
+// plain tini dynamically.
+var initCandidates = []string{"docker-init", "tini-static", "catatonit", "tini"}
+
+// FindInit returns the path of a minimal init usable with WithInit, looking
+// for docker-init, tini-static, catatonit and tini in PATH.
+func FindInit() (string, error) {
+	for _, name := range initCandidates {
+		if path, err := exec.LookPath(name); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("libcrun: no init found in PATH (tried %s)", strings.Join(initCandidates, ", "))
+}
+
+// WithInit runs the container process under a minimal init, which reaps the
+// zombies left by orphaned children and forwards signals to the process.
+// libcrun has no init of its own, so the binary at initPath on the host (e.g.
+// from FindInit) is bind mounted read-only at InitPath and prepended to the
+// process arguments, followed by "--". The init must be statically linked,
+// since it runs from inside the container rootfs, and must accept the
+// "init -- command" form, as tini and catatonit do.
+// It must be applied after WithArgs; applying it twice has no further effect.
+func WithInit(initPath string) SpecOption {
+	return func(sp *specs.Spec) {
+		if sp.Process == nil {
+			sp.Process = &specs.Process{}
+		}
+		if len(sp.Process.Args) > 0 && sp.Process.Args[0] == InitPath {
+			return
+		}
+		sp.Process.Args = append([]string{InitPath, "--"}, sp.Process.Args...)
+		sp.Mounts = append(sp.Mounts, specs.Mount{
+			Source:      initPath,
+			Destination: InitPath,
+			Type:        "bind",
+			Options:     []string{"bind", "ro", "nosuid", "nodev"},
+		})
+	}
+}
+
 // WithContainerTTY sets whether to allocate a TTY for the container's init process.
 // Set to false for non-interactive processes (most common for tests/automation).
 // Note: When true, you must also provide a console socket via RuntimeConfig.ConsoleSocket.
@@ -105,6 +292,21 @@ func WithContainerTTY(enabled bool) SpecOption {
 	}
 }
 
+// WithConsoleSize sets the initial size of the container's pseudo-terminal.
+// It only takes effect when a TTY is allocated (see WithContainerTTY), and avoids
+// the PTY starting at 0x0 until the first resize.
+func WithConsoleSize(rows, cols uint) SpecOption {
+	return func(sp *specs.Spec) {
+		if sp.Process == nil {
+			sp.Process = &specs.Process{}
+		}
+		sp.Process.ConsoleSize = &specs.Box{
+			Height: rows,
+			Width:  cols,
+		}
+	}
+}
+
 // WithEnv adds an environment variable.
 func WithEnv(key, value string) SpecOption {
 	return func(sp *specs.Spec) {
@@ -115,6 +317,61 @@ func WithEnv(key, value string) SpecOption {
 	}
 }
 
+// WithEnvPassthrough adds the host's value of each of keys, as read when the
+// option is applied. Keys not set on the host are skipped.
+func WithEnvPassthrough(keys ...string) SpecOption {
+	return func(sp *specs.Spec) {
+		for _, key := range keys {
+			if val, ok := os.LookupEnv(key); ok {
+				WithEnv(key, val)(sp)
+			}
+		}
+	}
+}
+
+// WithEnvPattern adds every host environment variable whose name matches glob
+// (path.Match syntax, e.g. "AWS_*"), as set when the option is applied.
+func WithEnvPattern(glob string) (SpecOption, error) {
+	if _, err := path.Match(glob, ""); err != nil {
+		return nil, fmt.Errorf("libcrun: invalid env pattern %q: %w", glob, err)
+	}
+	return func(sp *specs.Spec) {
+		for _, kv := range os.Environ() {
+			key, val, _ := strings.Cut(kv, "=")
+			if ok, _ := path.Match(glob, key); ok {
+				WithEnv(key, val)(sp)
+			}
+		}
+	}, nil
+}
+
+// WithSortedEnv sorts the process environment by name and keeps only the last
+// value of each variable, so specs built from unordered sources (e.g. maps)
+// are identical across runs. Options are applied in order: put it after the
+// options setting the environment.
+func WithSortedEnv() SpecOption {
+	return func(sp *specs.Spec) {
+		if sp.Process == nil || len(sp.Process.Env) == 0 {
+			return
+		}
+		last := make(map[string]string, len(sp.Process.Env))
+		for _, kv := range sp.Process.Env {
+			key, _, _ := strings.Cut(kv, "=")
+			last[key] = kv
+		}
+		env := make([]string, 0, len(last))
+		for _, kv := range last {
+			env = append(env, kv)
+		}
+		slices.SortFunc(env, func(a, b string) int {
+			keyA, _, _ := strings.Cut(a, "=")
+			keyB, _, _ := strings.Cut(b, "=")
+			return strings.Compare(keyA, keyB)
+		})
+		sp.Process.Env = env
+	}
+}
+
 // WithMemoryLimit sets the memory limit in bytes.
 func WithMemoryLimit(bytes int64) SpecOption {
 	return func(sp *specs.Spec) {
@@ -126,6 +383,64 @@ func WithMemoryLimit(bytes int64) SpecOption {
 	}
 }
 
+// WithMemoryHigh sets the cgroup v2 memory.high soft limit in bytes (-1 for
+// "max"): above it the container is throttled and reclaimed from rather than
+// OOM-killed, unlike the hard WithMemoryLimit. It is written to the unified
+// resources, which only apply on a cgroup v2 host: libcrun rejects them on
+// cgroup v1.
+func WithMemoryHigh(bytes int64) SpecOption {
+	return withUnifiedResource("memory.high", cgroupLimitValue(bytes))
+}
+
+// WithMemoryLow sets the cgroup v2 memory.low best-effort protection in bytes
+// (-1 for "max"): memory below it is only reclaimed when no unprotected memory
+// is left. Like WithMemoryHigh, it only applies on a cgroup v2 host.
+func WithMemoryLow(bytes int64) SpecOption {
+	return withUnifiedResource("memory.low", cgroupLimitValue(bytes))
+}
+
+// withUnifiedResource sets a cgroup v2 file in the unified resources.
+func withUnifiedResource(key, value string) SpecOption {
+	return func(sp *specs.Spec) {
+		ensureLinuxResources(sp)
+		if sp.Linux.Resources.Unified == nil {
+			sp.Linux.Resources.Unified = make(map[string]string)
+		}
+		sp.Linux.Resources.Unified[key] = value
+	}
+}
+
+// WithResourcesJSON sets the container's resources from a JSON object in the
+// OCI linux.resources format, e.g. `{"memory":{"limit":268435456}}`, replacing
+// any resources set by earlier options. Returns an error if the JSON is
+// invalid or has unknown fields.
+func WithResourcesJSON(data string) (SpecOption, error) {
+	res, err := parseResourcesJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	return func(sp *specs.Spec) {
+		if sp.Linux == nil {
+			sp.Linux = &specs.Linux{}
+		}
+		sp.Linux.Resources = res
+	}, nil
+}
+
+// parseResourcesJSON decodes resources in the OCI linux.resources format.
+func parseResourcesJSON(data string) (*specs.LinuxResources, error) {
+	dec := json.NewDecoder(strings.NewReader(data))
+	dec.DisallowUnknownFields()
+	var res specs.LinuxResources
+	if err := dec.Decode(&res); err != nil {
+		return nil, fmt.Errorf("libcrun: invalid resources JSON: %w", err)
+	}
+	if dec.More() {
+		return nil, errors.New("libcrun: invalid resources JSON: trailing data")
+	}
+	return &res, nil
+}
+
 // WithCPUShares sets the CPU shares.
 func WithCPUShares(shares uint64) SpecOption {
 	return func(sp *specs.Spec) {
@@ -148,6 +463,42 @@ func WithCPUQuota(quota int64) SpecOption {
 	}
 }
 
+// WithCPUBurst sets the CPU burst in microseconds: how much unused quota the
+// container may bank and spend on top of its quota in a later period, e.g.
+// for bursty workloads. It is written to cgroup v2 cpu.max.burst, which needs
+// Linux 5.14 or newer, and only makes sense together with a CPU quota.
+func WithCPUBurst(burst uint64) SpecOption {
+	return func(sp *specs.Spec) {
+		ensureLinuxResources(sp)
+		if sp.Linux.Resources.CPU == nil {
+			sp.Linux.Resources.CPU = &specs.LinuxCPU{}
+		}
+		sp.Linux.Resources.CPU.Burst = &burst
+	}
+}
+
+// cpuPeriod is the CFS period, in microseconds, used by WithCPUsFraction.
+const cpuPeriod = 100000
+
+// WithCPUsFraction limits the container to the given number of CPUs (e.g. 1.5)
+// by setting the CPU quota against a fixed 100000µs period.
+// Non-positive values leave the CPU limit unchanged.
+func WithCPUsFraction(cpus float64) SpecOption {
+	return func(sp *specs.Spec) {
+		if cpus <= 0 {
+			return
+		}
+		ensureLinuxResources(sp)
+		if sp.Linux.Resources.CPU == nil {
+			sp.Linux.Resources.CPU = &specs.LinuxCPU{}
+		}
+		quota := int64(cpus * cpuPeriod)
+		period := uint64(cpuPeriod)
+		sp.Linux.Resources.CPU.Quota = &quota
+		sp.Linux.Resources.CPU.Period = &period
+	}
+}
+
 // WithPidsLimit sets the pids limit.
 func WithPidsLimit(limit int64) SpecOption {
 	return func(sp *specs.Spec) {
@@ -155,7 +506,7 @@ func WithPidsLimit(limit int64) SpecOption {
 		if sp.Linux.Resources.Pids == nil {
 			sp.Linux.Resources.Pids = &specs.LinuxPids{}
 		}
-		sp.Linux.Resources.Pids.Limit = limit
+		sp.Linux.Resources.Pids.Limit = &limit
 	}
 }
 
@@ -175,6 +526,48 @@ func WithMountNamespace(path string) SpecOption {
 	}
 }
 
+// WithNamespacesFromPid makes the container join the namespaces of the
+// process pid, like nsenter: each type's path is set to /proc/<pid>/ns/<ns>.
+// Without types, the network, IPC, UTS, PID and mount namespaces are joined.
+// Returns an error if a namespace of the process does not exist.
+func WithNamespacesFromPid(pid int, types ...specs.LinuxNamespaceType) (SpecOption, error) {
+	return namespacesFromPid("/proc", pid, types)
+}
+
+func namespacesFromPid(procRoot string, pid int, types []specs.LinuxNamespaceType) (SpecOption, error) {
+	if len(types) == 0 {
+		types = []specs.LinuxNamespaceType{specs.NetworkNamespace, specs.IPCNamespace, specs.UTSNamespace, specs.PIDNamespace, specs.MountNamespace}
+	}
+	paths := make(map[specs.LinuxNamespaceType]string, len(types))
+	for _, typ := range types {
+		name, ok := nsProcNames[typ]
+		if !ok {
+			return nil, fmt.Errorf("libcrun: unknown namespace type %q", typ)
+		}
+		nsPath := path.Join(procRoot, strconv.Itoa(pid), "ns", name)
+		if _, err := os.Lstat(nsPath); err != nil {
+			return nil, fmt.Errorf("libcrun: cannot join %s namespace of pid %d: %w", typ, pid, err)
+		}
+		paths[typ] = nsPath
+	}
+	return func(sp *specs.Spec) {
+		for _, typ := range types {
+			SetOrReplaceLinuxNamespace(sp, typ, paths[typ])
+		}
+	}, nil
+}
+
+// WithCgroupNamespace runs the container in its own cgroup namespace, so it
+// sees its cgroup as the root of the hierarchy. libcrun only sets this up
+// correctly on cgroup v2; on a cgroup v1 host a warning is sent to the log
+// handler (see SetLogHandler).
+func WithCgroupNamespace() SpecOption {
+	return func(sp *specs.Spec) {
+		warnIfCgroupV1(cgroupRoot)
+		SetOrReplaceLinuxNamespace(sp, specs.CgroupNamespace, "")
+	}
+}
+
 // WithHostname sets the container hostname.
 func WithHostname(name string) SpecOption {
 	return func(sp *specs.Spec) {
@@ -194,6 +587,290 @@ func WithMount(source, dest, fstype string, options []string) SpecOption {
 	}
 }
 
+// WithMounts appends mounts to the spec, in order. Mounts are performed in
+// the order they appear in the spec, after the template defaults.
+func WithMounts(mounts ...specs.Mount) SpecOption {
+	return func(sp *specs.Spec) {
+		sp.Mounts = append(sp.Mounts, mounts...)
+	}
+}
+
+// WithIDMappedMount bind-mounts the host path source at dest through an
+// idmapped mount: file owners are shifted by uidMaps and gidMaps (ContainerID
+// is the ID seen in the container, HostID the one on disk), so host files can
+// be shared with a user namespace container without chowning them. Idmapped
+// mounts need Linux 5.12 or newer and a filesystem supporting them (most local
+// filesystems; tmpfs since 6.3).
+func WithIDMappedMount(source, dest string, uidMaps, gidMaps []specs.LinuxIDMapping) SpecOption {
+	return WithMounts(specs.Mount{
+		Destination: dest,
+		Type:        "bind",
+		Source:      source,
+		Options:     []string{"rbind", "idmap"},
+		UIDMappings: uidMaps,
+		GIDMappings: gidMaps,
+	})
+}
+
+// WithMountBefore inserts m before the first mount whose destination is dest,
+// e.g. to mount a tmpfs before the mounts nested inside it. m is appended if
+// no mount targets dest.
+func WithMountBefore(dest string, m specs.Mount) SpecOption {
+	return func(sp *specs.Spec) {
+		i := slices.IndexFunc(sp.Mounts, func(existing specs.Mount) bool {
+			return existing.Destination == dest
+		})
+		if i < 0 {
+			i = len(sp.Mounts)
+		}
+		sp.Mounts = slices.Insert(sp.Mounts, i, m)
+	}
+}
+
+// bindPropagations are the values accepted by bind-propagation in ParseMountSpec.
+var bindPropagations = []string{"shared", "slave", "private", "rshared", "rslave", "rprivate"}
+
+// ParseMountSpec parses a mount in the comma-separated key=value syntax of
+// Docker's --mount flag, e.g. "type=bind,source=/x,destination=/y,readonly".
+// Supported keys:
+//   - type: bind, volume (the default) or tmpfs
+//   - source (or src): the host path, required for bind and volume
+//   - destination (or dst, target): the absolute path in the container
+//   - readonly (or ro): mount read-only, optionally "=true" or "=false"
+//   - bind-propagation: shared, slave, private, rshared, rslave or rprivate
+//   - tmpfs-size, tmpfs-mode: size in bytes and octal mode of a tmpfs
+//   - options: extra mount options, separated by colons
+//
+// Named volumes are not managed by this package: a volume mount is a bind
+// mount of its source, which must be an absolute host path.
+func ParseMountSpec(s string) (specs.Mount, error) {
+	r := csv.NewReader(strings.NewReader(s))
+	fields, err := r.Read()
+	if err != nil {
+		return specs.Mount{}, fmt.Errorf("libcrun: invalid mount spec %q: %w", s, err)
+	}
+
+	mountType := "volume"
+	var source, dest, propagation, size, mode string
+	var readonly bool
+	var extra []string
+	for _, field := range fields {
+		key, value, hasValue := strings.Cut(strings.TrimSpace(field), "=")
+		key = strings.ToLower(key)
+		if !hasValue && key != "readonly" && key != "ro" {
+			return specs.Mount{}, fmt.Errorf("libcrun: invalid mount spec %q: %q requires a value", s, key)
+		}
+		switch key {
+		case "type":
+			mountType = value
+		case "source", "src":
+			source = value
+		case "destination", "dst", "target":
+			dest = value
+		case "readonly", "ro":
+			readonly = true
+			if hasValue {
+				if readonly, err = strconv.ParseBool(value); err != nil {
+					return specs.Mount{}, fmt.Errorf("libcrun: invalid mount spec %q: invalid readonly value %q", s, value)
+				}
+			}
+		case "bind-propagation":
+			if !slices.Contains(bindPropagations, value) {
+				return specs.Mount{}, fmt.Errorf("libcrun: invalid mount spec %q: bind-propagation must be one of %s", s, strings.Join(bindPropagations, ", "))
+			}
+			propagation = value
+		case "tmpfs-size":
+			size = value
+		case "tmpfs-mode":
+			mode = value
+		case "options":
+			for _, opt := range strings.Split(value, ":") {
+				if opt != "" {
+					extra = append(extra, opt)
+				}
+			}
+		default:
+			return specs.Mount{}, fmt.Errorf("libcrun: invalid mount spec %q: unknown key %q", s, key)
+		}
+	}
+
+	if dest == "" {
+		return specs.Mount{}, fmt.Errorf("libcrun: invalid mount spec %q: destination is required", s)
+	}
+	if !strings.HasPrefix(dest, "/") {
+		return specs.Mount{}, fmt.Errorf("libcrun: invalid mount spec %q: destination must be an absolute path", s)
+	}
+
+	m := specs.Mount{Destination: dest}
+	switch mountType {
+	case "bind", "volume":
+		if !strings.HasPrefix(source, "/") {
+			return specs.Mount{}, fmt.Errorf("libcrun: invalid mount spec %q: %s source must be an absolute host path", s, mountType)
+		}
+		if size != "" || mode != "" {
+			return specs.Mount{}, fmt.Errorf("libcrun: invalid mount spec %q: tmpfs options require type=tmpfs", s)
+		}
+		m.Type = "bind"
+		m.Source = source
+		m.Options = []string{"rbind"}
+		if propagation != "" {
+			m.Options = append(m.Options, propagation)
+		}
+	case "tmpfs":
+		if source != "" {
+			return specs.Mount{}, fmt.Errorf("libcrun: invalid mount spec %q: tmpfs mounts take no source", s)
+		}
+		if propagation != "" {
+			return specs.Mount{}, fmt.Errorf("libcrun: invalid mount spec %q: bind-propagation requires type=bind", s)
+		}
+		m.Type = "tmpfs"
+		m.Source = "tmpfs"
+		m.Options = []string{"nosuid", "nodev"}
+		if size != "" {
+			if _, err := strconv.ParseUint(size, 10, 64); err != nil {
+				return specs.Mount{}, fmt.Errorf("libcrun: invalid mount spec %q: invalid tmpfs-size %q", s, size)
+			}
+			m.Options = append(m.Options, "size="+size)
+		}
+		if mode != "" {
+			if _, err := strconv.ParseUint(mode, 8, 32); err != nil {
+				return specs.Mount{}, fmt.Errorf("libcrun: invalid mount spec %q: invalid tmpfs-mode %q", s, mode)
+			}
+			m.Options = append(m.Options, "mode="+mode)
+		}
+	default:
+		return specs.Mount{}, fmt.Errorf("libcrun: invalid mount spec %q: type must be bind, volume or tmpfs", s)
+	}
+
+	if readonly {
+		m.Options = append(m.Options, "ro")
+	}
+	m.Options = append(m.Options, extra...)
+	return m, nil
+}
+
+// WithMountSpec adds a mount given in the syntax of Docker's --mount flag.
+// See ParseMountSpec for the supported keys.
+func WithMountSpec(s string) (SpecOption, error) {
+	m, err := ParseMountSpec(s)
+	if err != nil {
+		return nil, err
+	}
+	return WithMounts(m), nil
+}
+
+// ParseDeviceSpec parses a device in the syntax of Docker's --device flag,
+// hostPath[:containerPath][:permissions], e.g. "/dev/fuse:/dev/fuse:rwm". The
+// container path defaults to the host path and the cgroup permissions, a
+// combination of r (read), w (write) and m (mknod), to "rwm". The host node is
+// stat'ed for the type and numbers of the returned device, whose Path is the
+// container path; the permissions are returned alongside it.
+func ParseDeviceSpec(s string) (specs.LinuxDevice, string, error) {
+	hostPath, containerPath, perms, err := splitDeviceSpec(s)
+	if err != nil {
+		return specs.LinuxDevice{}, "", err
+	}
+
+	var st syscall.Stat_t
+	if err := syscall.Stat(hostPath, &st); err != nil {
+		return specs.LinuxDevice{}, "", fmt.Errorf("libcrun: invalid device spec %q: %w", s, &os.PathError{Op: "stat", Path: hostPath, Err: err})
+	}
+	var typ string
+	switch st.Mode & syscall.S_IFMT {
+	case syscall.S_IFCHR:
+		typ = "c"
+	case syscall.S_IFBLK:
+		typ = "b"
+	default:
+		return specs.LinuxDevice{}, "", fmt.Errorf("libcrun: invalid device spec %q: %s is not a device", s, hostPath)
+	}
+	rdev := uint64(st.Rdev)
+	mode := os.FileMode(st.Mode & 0o777)
+	uid, gid := st.Uid, st.Gid
+	return specs.LinuxDevice{
+		Path:     containerPath,
+		Type:     typ,
+		Major:    int64((rdev>>8)&0xfff | (rdev>>32)&^0xfff),
+		Minor:    int64(rdev&0xff | (rdev>>12)&^0xff),
+		FileMode: &mode,
+		UID:      &uid,
+		GID:      &gid,
+	}, perms, nil
+}
+
+// splitDeviceSpec splits a --device value into its host path, container path
+// and permissions, applying the defaults.
+func splitDeviceSpec(s string) (hostPath, containerPath, perms string, err error) {
+	parts := strings.Split(s, ":")
+	perms = "rwm"
+	switch len(parts) {
+	case 1:
+		hostPath = parts[0]
+	case 2:
+		// The second field is the permissions if it is not a path
+		hostPath = parts[0]
+		if validDevicePerms(parts[1]) {
+			perms = parts[1]
+		} else {
+			containerPath = parts[1]
+		}
+	case 3:
+		hostPath, containerPath, perms = parts[0], parts[1], parts[2]
+	default:
+		return "", "", "", fmt.Errorf("libcrun: invalid device spec %q: too many fields", s)
+	}
+	if containerPath == "" {
+		containerPath = hostPath
+	}
+	if !strings.HasPrefix(hostPath, "/") || !strings.HasPrefix(containerPath, "/") {
+		return "", "", "", fmt.Errorf("libcrun: invalid device spec %q: paths must be absolute", s)
+	}
+	if !validDevicePerms(perms) {
+		return "", "", "", fmt.Errorf("libcrun: invalid device spec %q: permissions must be a combination of r, w and m", s)
+	}
+	return hostPath, containerPath, perms, nil
+}
+
+// validDevicePerms reports whether perms is a non-empty combination of r, w
+// and m, each at most once.
+func validDevicePerms(perms string) bool {
+	if perms == "" || len(perms) > 3 {
+		return false
+	}
+	for i, c := range perms {
+		if !strings.ContainsRune("rwm", c) || strings.ContainsRune(perms[i+1:], c) {
+			return false
+		}
+	}
+	return true
+}
+
+// WithDeviceSpec exposes a host device given in the syntax of Docker's
+// --device flag to the container: the device node is created in the
+// container and the device cgroup allows it with the given permissions. See
+// ParseDeviceSpec for the syntax.
+func WithDeviceSpec(s string) (SpecOption, error) {
+	dev, perms, err := ParseDeviceSpec(s)
+	if err != nil {
+		return nil, err
+	}
+	return func(sp *specs.Spec) {
+		ensureLinuxResources(sp)
+		sp.Linux.Devices = slices.DeleteFunc(sp.Linux.Devices, func(d specs.LinuxDevice) bool {
+			return d.Path == dev.Path
+		})
+		sp.Linux.Devices = append(sp.Linux.Devices, dev)
+		major, minor := dev.Major, dev.Minor
+		sp.Linux.Resources.Devices = append(sp.Linux.Resources.Devices, specs.LinuxDeviceCgroup{
+			Allow:  true,
+			Type:   dev.Type,
+			Major:  &major,
+			Minor:  &minor,
+			Access: perms,
+		})
+	}, nil
+}
+
 // WithAnnotation adds an annotation to the spec.
 func WithAnnotation(key, value string) SpecOption {
 	return func(sp *specs.Spec) {
@@ -204,6 +881,64 @@ func WithAnnotation(key, value string) SpecOption {
 	}
 }
 
+// WithAnnotations merges a set of annotations into the spec.
+// Existing keys are overwritten by the values in annotations.
+func WithAnnotations(annotations map[string]string) SpecOption {
+	return func(sp *specs.Spec) {
+		if sp.Annotations == nil {
+			sp.Annotations = make(map[string]string, len(annotations))
+		}
+		for k, v := range annotations {
+			sp.Annotations[k] = v
+		}
+	}
+}
+
+// WithAnnotationsFromLabels merges labels into the spec annotations, prefixing each key.
+// Example: WithAnnotationsFromLabels("io.kubernetes.pod.", labels) turns "app" into "io.kubernetes.pod.app".
+func WithAnnotationsFromLabels(prefix string, labels map[string]string) SpecOption {
+	return func(sp *specs.Spec) {
+		if sp.Annotations == nil {
+			sp.Annotations = make(map[string]string, len(labels))
+		}
+		for k, v := range labels {
+			sp.Annotations[prefix+k] = v
+		}
+	}
+}
+
+// ImageAnnotationPrefix is the annotation namespace used by WithImageLabels.
+const ImageAnnotationPrefix = "org.opencontainers.image."
+
+// WithImageLabels copies OCI image config labels into the spec annotations to
+// preserve provenance metadata. Labels already in the org.opencontainers.image.*
+// namespace (e.g. org.opencontainers.image.source) keep their key; other labels
+// are placed under it, so "maintainer" becomes "org.opencontainers.image.maintainer".
+func WithImageLabels(labels map[string]string) SpecOption {
+	return func(sp *specs.Spec) {
+		if sp.Annotations == nil {
+			sp.Annotations = make(map[string]string, len(labels))
+		}
+		for k, v := range labels {
+			if !strings.HasPrefix(k, ImageAnnotationPrefix) {
+				k = ImageAnnotationPrefix + k
+			}
+			sp.Annotations[k] = v
+		}
+	}
+}
+
+// StopSignalAnnotation holds the signal Container.Stop sends before escalating
+// to SIGKILL, mirroring the StopSignal field of an OCI image config.
+const StopSignalAnnotation = ImageAnnotationPrefix + "stopSignal"
+
+// WithStopSignal sets the signal Container.Stop sends to request a graceful
+// shutdown, e.g. the image's StopSignal. Names ("SIGQUIT", "QUIT") and
+// numbers are accepted, as for Container.Kill.
+func WithStopSignal(sig Signal) SpecOption {
+	return WithAnnotation(StopSignalAnnotation, string(sig))
+}
+
 // WithUser sets the user (UID and GID) for the container process.
 func WithUser(uid, gid uint32) SpecOption {
 	return func(sp *specs.Spec) {
@@ -215,6 +950,184 @@ func WithUser(uid, gid uint32) SpecOption {
 	}
 }
 
+// WithUserByName runs the container process as the user name of the
+// container's /etc/passwd, read from rootfs: UID, GID and HOME are set from
+// its entry. Returns an error if the user does not exist. Symlinks in rootfs
+// are not followed outside of it.
+func WithUserByName(rootfs, name string) (SpecOption, error) {
+	fields, err := lookupRootfsEntry(rootfs, "etc/passwd", name, 6)
+	if err != nil {
+		return nil, err
+	}
+	uid, err := strconv.ParseUint(fields[2], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("libcrun: invalid uid %q for user %q in /etc/passwd", fields[2], name)
+	}
+	gid, err := strconv.ParseUint(fields[3], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("libcrun: invalid gid %q for user %q in /etc/passwd", fields[3], name)
+	}
+	home := fields[5]
+	return func(sp *specs.Spec) {
+		WithUser(uint32(uid), uint32(gid))(sp)
+		sp.Process.Env = slices.DeleteFunc(sp.Process.Env, func(kv string) bool {
+			return strings.HasPrefix(kv, "HOME=")
+		})
+		WithEnv("HOME", home)(sp)
+	}, nil
+}
+
+// WithGroupByName adds the group name of the container's /etc/group, read
+// from rootfs, to the additional groups of the container process. Returns an
+// error if the group does not exist. Symlinks in rootfs are not followed
+// outside of it.
+func WithGroupByName(rootfs, name string) (SpecOption, error) {
+	fields, err := lookupRootfsEntry(rootfs, "etc/group", name, 3)
+	if err != nil {
+		return nil, err
+	}
+	gid, err := strconv.ParseUint(fields[2], 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("libcrun: invalid gid %q for group %q in /etc/group", fields[2], name)
+	}
+	return func(sp *specs.Spec) {
+		if sp.Process == nil {
+			sp.Process = &specs.Process{}
+		}
+		if !slices.Contains(sp.Process.User.AdditionalGids, uint32(gid)) {
+			sp.Process.User.AdditionalGids = append(sp.Process.User.AdditionalGids, uint32(gid))
+		}
+	}, nil
+}
+
+// lookupRootfsEntry returns the colon-separated fields of the entry for name
+// in file (etc/passwd or etc/group) of rootfs, which must have at least
+// minFields fields.
+func lookupRootfsEntry(rootfs, file, name string, minFields int) ([]string, error) {
+	root, err := os.OpenRoot(rootfs)
+	if err != nil {
+		return nil, err
+	}
+	defer root.Close()
+	data, err := root.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("libcrun: failed to read /%s: %w", file, err)
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Split(line, ":")
+		if fields[0] == name && len(fields) >= minFields {
+			return fields, nil
+		}
+	}
+	return nil, fmt.Errorf("libcrun: %q not found in /%s", name, file)
+}
+
+// WithUmask sets the umask of the container's init process.
+// Returns an error if mask is outside the 0-0777 range.
+func WithUmask(mask uint32) (SpecOption, error) {
+	if mask > 0o777 {
+		return nil, fmt.Errorf("libcrun: invalid umask %#o: must be within 0777", mask)
+	}
+	return func(sp *specs.Spec) {
+		if sp.Process == nil {
+			sp.Process = &specs.Process{}
+		}
+		m := mask
+		sp.Process.User.Umask = &m
+	}, nil
+}
+
+// WithScheduler sets the scheduling policy of the container's init process.
+// priority is only meaningful for the realtime policies SCHED_FIFO and SCHED_RR,
+// where it must be within 1-99; it must be zero for every other policy.
+func WithScheduler(policy specs.LinuxSchedulerPolicy, priority int32, flags ...specs.LinuxSchedulerFlag) (SpecOption, error) {
+	switch policy {
+	case specs.SchedFIFO, specs.SchedRR:
+		if priority < 1 || priority > 99 {
+			return nil, fmt.Errorf("libcrun: invalid priority %d for %s: must be within 1-99", priority, policy)
+		}
+	default:
+		if priority != 0 {
+			return nil, fmt.Errorf("libcrun: invalid priority %d for %s: only SCHED_FIFO and SCHED_RR accept a priority", priority, policy)
+		}
+	}
+	return func(sp *specs.Spec) {
+		if sp.Process == nil {
+			sp.Process = &specs.Process{}
+		}
+		sp.Process.Scheduler = &specs.Scheduler{
+			Policy:   policy,
+			Priority: priority,
+			Flags:    flags,
+		}
+	}, nil
+}
+
+// WithIOPriority sets the I/O scheduling class and priority of the container process.
+// class must be one of IOPRIO_CLASS_RT, IOPRIO_CLASS_BE or IOPRIO_CLASS_IDLE, and
+// priority must be within 0 (highest) to 7 (lowest).
+func WithIOPriority(class specs.IOPriorityClass, priority int) (SpecOption, error) {
+	switch class {
+	case specs.IOPRIO_CLASS_RT, specs.IOPRIO_CLASS_BE, specs.IOPRIO_CLASS_IDLE:
+	default:
+		return nil, fmt.Errorf("libcrun: invalid I/O priority class %q", class)
+	}
+	if priority < 0 || priority > 7 {
+		return nil, fmt.Errorf("libcrun: invalid I/O priority %d: must be within 0-7", priority)
+	}
+	return func(sp *specs.Spec) {
+		if sp.Process == nil {
+			sp.Process = &specs.Process{}
+		}
+		sp.Process.IOPriority = &specs.LinuxIOPriority{
+			Class:    class,
+			Priority: priority,
+		}
+	}, nil
+}
+
+// WithCoreDumps enables or disables core dumps for the container process by
+// setting RLIMIT_CORE to unlimited or zero.
+//
+// Where the cores are written is set by kernel.core_pattern, which is not
+// namespaced and so cannot be set through the spec's sysctls: it is host
+// configuration, global to every process on the host, that the caller manages.
+func WithCoreDumps(enable bool) SpecOption {
+	return func(sp *specs.Spec) {
+		if sp.Process == nil {
+			sp.Process = &specs.Process{}
+		}
+		var limit uint64
+		if enable {
+			limit = ^uint64(0) // RLIM_INFINITY
+		}
+		setRlimit(sp.Process, "RLIMIT_CORE", limit, limit)
+	}
+}
+
+// WithNoFileLimit sets the soft and hard RLIMIT_NOFILE, the maximum number of
+// open files, of the container process.
+func WithNoFileLimit(soft, hard uint64) SpecOption {
+	return func(sp *specs.Spec) {
+		if sp.Process == nil {
+			sp.Process = &specs.Process{}
+		}
+		setRlimit(sp.Process, "RLIMIT_NOFILE", hard, soft)
+	}
+}
+
+// setRlimit sets the given rlimit on the process, replacing any existing entry.
+func setRlimit(p *specs.Process, typ string, hard, soft uint64) {
+	for i := range p.Rlimits {
+		if p.Rlimits[i].Type == typ {
+			p.Rlimits[i].Hard = hard
+			p.Rlimits[i].Soft = soft
+			return
+		}
+	}
+	p.Rlimits = append(p.Rlimits, specs.POSIXRlimit{Type: typ, Hard: hard, Soft: soft})
+}
+
 // WithCwd sets the working directory for the container process.
 func WithCwd(path string) SpecOption {
 	return func(sp *specs.Spec) {
@@ -233,10 +1146,294 @@ func WithHostNetwork() SpecOption {
 	}
 }
 
+// WithAutoUserNamespace runs the container in a new user namespace with the
+// standard rootless mapping for the current user: container root maps to the
+// current UID/GID, and container IDs 1-65536 map to the user's subordinate
+// ranges from /etc/subuid and /etc/subgid. Existing mappings are replaced.
+func WithAutoUserNamespace() (SpecOption, error) {
+	return autoUserNamespace("/etc/subuid", "/etc/subgid", uint32(os.Getuid()), uint32(os.Getgid()))
+}
+
+func autoUserNamespace(subuidPath, subgidPath string, uid, gid uint32) (SpecOption, error) {
+	name := ""
+	if u, err := user.LookupId(strconv.FormatUint(uint64(uid), 10)); err == nil {
+		name = u.Username
+	}
+	uidMappings, err := autoIDMappings(subuidPath, name, uid)
+	if err != nil {
+		return nil, err
+	}
+	gidMappings, err := autoIDMappings(subgidPath, name, uid)
+	if err != nil {
+		return nil, err
+	}
+	// The subgid file is keyed by user, but container root maps to the primary group
+	gidMappings[0].HostID = gid
+
+	return func(sp *specs.Spec) {
+		SetOrReplaceLinuxNamespace(sp, specs.UserNamespace, "")
+		sp.Linux.UIDMappings = uidMappings
+		sp.Linux.GIDMappings = gidMappings
+	}, nil
+}
+
+// WithNetworkDevice moves the host network interface name into the container's
+// network namespace, renaming it to containerName. If containerName is empty
+// the interface keeps its host name.
+func WithNetworkDevice(name, containerName string) SpecOption {
+	return func(sp *specs.Spec) {
+		if sp.Linux == nil {
+			sp.Linux = &specs.Linux{}
+		}
+		if sp.Linux.NetDevices == nil {
+			sp.Linux.NetDevices = make(map[string]specs.LinuxNetDevice)
+		}
+		sp.Linux.NetDevices[name] = specs.LinuxNetDevice{Name: containerName}
+	}
+}
+
+// netnsPinDir holds the bind mounts that keep container network namespaces
+// alive until the poststop hook of WithNetworkDevicesMoveBack has run.
+const netnsPinDir = "/run/libcrun-go/netns"
+
+// WithNetworkDevicesMoveBack moves the interfaces configured with
+// WithNetworkDevice back to the host when the container is deleted, so a
+// physical NIC is not lost with the container's network namespace. veth
+// interfaces are left alone and are destroyed along with the namespace.
+//
+// A createRuntime hook pins the network namespace with a bind mount under
+// /run/libcrun-go/netns and a poststop hook renames each interface back to
+// its host name and returns it to the runtime namespace. The hooks run the
+// current executable, which must call NetnsHookMain at the start of main, so
+// the container must be deleted by such a program. They require root and the
+// ip and nsenter tools on the host. Apply this option after the
+// WithNetworkDevice options it covers.
+func WithNetworkDevicesMoveBack() SpecOption {
+	return func(sp *specs.Spec) {
+		if sp.Linux == nil || len(sp.Linux.NetDevices) == 0 {
+			return
+		}
+		names := make([]string, 0, len(sp.Linux.NetDevices))
+		for name := range sp.Linux.NetDevices {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		// Pin arguments are followed by (container name, host name) pairs
+		pin := []string{netnsHookArg0, "pin", netnsPinDir}
+		for _, name := range names {
+			ctrName := sp.Linux.NetDevices[name].Name
+			if ctrName == "" {
+				ctrName = name
+			}
+			pin = append(pin, ctrName, name)
+		}
+
+		exe, err := os.Executable()
+		if err != nil {
+			exe = "/proc/self/exe"
+		}
+		if sp.Hooks == nil {
+			sp.Hooks = &specs.Hooks{}
+		}
+		sp.Hooks.CreateRuntime = append(sp.Hooks.CreateRuntime, specs.Hook{Path: exe, Args: pin})
+		sp.Hooks.Poststop = append(sp.Hooks.Poststop, specs.Hook{
+			Path: exe,
+			Args: []string{netnsHookArg0, "release", netnsPinDir},
+		})
+	}
+}
+
+// WithPersonality sets the execution domain of the container process.
+// domain is typically specs.PerLinux or specs.PerLinux32 (e.g. to run 32-bit
+// binaries with a 32-bit uname); flags are passed through to libcrun as-is.
+// libcrun applies this via the personality(2) syscall before executing the process.
+func WithPersonality(domain specs.LinuxPersonalityDomain, flags ...specs.LinuxPersonalityFlag) SpecOption {
+	return func(sp *specs.Spec) {
+		if sp.Linux == nil {
+			sp.Linux = &specs.Linux{}
+		}
+		sp.Linux.Personality = &specs.LinuxPersonality{
+			Domain: domain,
+			Flags:  flags,
+		}
+	}
+}
+
+// WithSeccompDefault sets the action taken for syscalls no seccomp rule
+// matches, e.g. specs.ActErrno for an allow-list. The seccomp profile is
+// created if needed, with the host architectures.
+func WithSeccompDefault(action specs.LinuxSeccompAction) SpecOption {
+	return func(sp *specs.Spec) {
+		ensureSeccomp(sp, action).DefaultAction = action
+	}
+}
+
+// WithSeccompRule adds a seccomp rule applying action to the given syscalls,
+// e.g. WithSeccompRule(specs.ActErrno, "mount", "umount2") to block them. If
+// the spec has no seccomp profile, one is created that allows every other
+// syscall, with the host architectures.
+func WithSeccompRule(action specs.LinuxSeccompAction, syscalls ...string) SpecOption {
+	return func(sp *specs.Spec) {
+		seccomp := ensureSeccomp(sp, specs.ActAllow)
+		seccomp.Syscalls = append(seccomp.Syscalls, specs.LinuxSyscall{
+			Names:  syscalls,
+			Action: action,
+		})
+	}
+}
+
+// ensureSeccomp returns the seccomp profile of sp, creating it with
+// defaultAction and the host architectures if needed.
+func ensureSeccomp(sp *specs.Spec, defaultAction specs.LinuxSeccompAction) *specs.LinuxSeccomp {
+	if sp.Linux == nil {
+		sp.Linux = &specs.Linux{}
+	}
+	if sp.Linux.Seccomp == nil {
+		sp.Linux.Seccomp = &specs.LinuxSeccomp{DefaultAction: defaultAction}
+	}
+	if len(sp.Linux.Seccomp.Architectures) == 0 {
+		sp.Linux.Seccomp.Architectures = seccompArches(unameMachine())
+	}
+	return sp.Linux.Seccomp
+}
+
+// seccompArches returns the seccomp architectures of the uname machine,
+// including the compat ones its kernel can run, or nil if it is unknown.
+func seccompArches(machine string) []specs.Arch {
+	switch machine {
+	case "x86_64":
+		return []specs.Arch{specs.ArchX86_64, specs.ArchX86, specs.ArchX32}
+	case "i386", "i686":
+		return []specs.Arch{specs.ArchX86}
+	case "aarch64":
+		return []specs.Arch{specs.ArchAARCH64, specs.ArchARM}
+	case "armv7l", "armv6l":
+		return []specs.Arch{specs.ArchARM}
+	case "ppc64le":
+		return []specs.Arch{specs.ArchPPC64LE}
+	case "s390x":
+		return []specs.Arch{specs.ArchS390X, specs.ArchS390}
+	case "riscv64":
+		return []specs.Arch{specs.ArchRISCV64}
+	}
+	return nil
+}
+
+// unameMachine returns the machine field of uname(2), "" on error.
+func unameMachine() string {
+	var uts syscall.Utsname
+	if err := syscall.Uname(&uts); err != nil {
+		return ""
+	}
+	var b []byte
+	for _, c := range uts.Machine {
+		if c == 0 {
+			break
+		}
+		b = append(b, byte(c))
+	}
+	return string(b)
+}
+
+// WithMaskedPaths masks the given paths in the container (bind-mounting
+// /dev/null or an empty tmpfs over them). The paths are merged into the
+// existing list, so the template defaults are kept and duplicates are skipped.
+func WithMaskedPaths(paths ...string) SpecOption {
+	return func(sp *specs.Spec) {
+		if sp.Linux == nil {
+			sp.Linux = &specs.Linux{}
+		}
+		sp.Linux.MaskedPaths = appendUnique(sp.Linux.MaskedPaths, paths...)
+	}
+}
+
+// WithReadonlyPaths makes the given paths read-only in the container. The paths
+// are merged into the existing list, so the template defaults are kept and
+// duplicates are skipped.
+func WithReadonlyPaths(paths ...string) SpecOption {
+	return func(sp *specs.Spec) {
+		if sp.Linux == nil {
+			sp.Linux = &specs.Linux{}
+		}
+		sp.Linux.ReadonlyPaths = appendUnique(sp.Linux.ReadonlyPaths, paths...)
+	}
+}
+
+// WithoutMaskedPath unmasks path, removing it from the masked paths, e.g. the
+// template's defaults.
+func WithoutMaskedPath(path string) SpecOption {
+	return func(sp *specs.Spec) {
+		if sp.Linux != nil {
+			sp.Linux.MaskedPaths = slices.DeleteFunc(sp.Linux.MaskedPaths, func(p string) bool { return p == path })
+		}
+	}
+}
+
+// WithoutReadonlyPath removes path from the read-only paths, e.g. the
+// template's defaults.
+func WithoutReadonlyPath(path string) SpecOption {
+	return func(sp *specs.Spec) {
+		if sp.Linux != nil {
+			sp.Linux.ReadonlyPaths = slices.DeleteFunc(sp.Linux.ReadonlyPaths, func(p string) bool { return p == path })
+		}
+	}
+}
+
+// WithClearMaskedPaths removes all masked paths, including the template's
+// defaults, e.g. for a privileged debugging container.
+func WithClearMaskedPaths() SpecOption {
+	return func(sp *specs.Spec) {
+		if sp.Linux != nil {
+			sp.Linux.MaskedPaths = nil
+		}
+	}
+}
+
+// WithClearReadonlyPaths removes all read-only paths, including the
+// template's defaults, e.g. for a privileged debugging container.
+func WithClearReadonlyPaths() SpecOption {
+	return func(sp *specs.Spec) {
+		if sp.Linux != nil {
+			sp.Linux.ReadonlyPaths = nil
+		}
+	}
+}
+
+// appendUnique appends the values not already present in list.
+func appendUnique(list []string, values ...string) []string {
+	for _, v := range values {
+		if !slices.Contains(list, v) {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
 // WithCapability adds a Linux capability to the container process.
 // The capability is added to all capability sets (Bounding, Effective, Inheritable, Permitted, Ambient).
 // Example: WithCapability(CapNetRaw) to allow raw socket creation (needed for ping).
 func WithCapability(cap Capability) SpecOption {
+	return WithCapabilityInSets(cap, CapSetBounding, CapSetEffective, CapSetInheritable, CapSetPermitted, CapSetAmbient)
+}
+
+// CapSet identifies one of the capability sets of a process.
+type CapSet int
+
+// Process capability sets.
+const (
+	CapSetBounding CapSet = iota
+	CapSetEffective
+	CapSetInheritable
+	CapSetPermitted
+	CapSetAmbient
+)
+
+// WithCapabilityInSets adds a Linux capability to the given capability sets
+// only, e.g. to Bounding and Permitted but not Ambient (which the kernel only
+// honors for capabilities that are also Permitted and Inheritable).
+// The capability is not duplicated in sets already containing it.
+func WithCapabilityInSets(cap Capability, sets ...CapSet) SpecOption {
 	return func(sp *specs.Spec) {
 		if sp.Process == nil {
 			sp.Process = &specs.Process{}
@@ -246,20 +1443,55 @@ func WithCapability(cap Capability) SpecOption {
 		}
 		capStr := string(cap)
 		c := sp.Process.Capabilities
-		if !containsString(c.Bounding, capStr) {
-			c.Bounding = append(c.Bounding, capStr)
+		for _, set := range sets {
+			var list *[]string
+			switch set {
+			case CapSetBounding:
+				list = &c.Bounding
+			case CapSetEffective:
+				list = &c.Effective
+			case CapSetInheritable:
+				list = &c.Inheritable
+			case CapSetPermitted:
+				list = &c.Permitted
+			case CapSetAmbient:
+				list = &c.Ambient
+			default:
+				continue
+			}
+			if !containsString(*list, capStr) {
+				*list = append(*list, capStr)
+			}
 		}
-		if !containsString(c.Effective, capStr) {
-			c.Effective = append(c.Effective, capStr)
-		}
-		if !containsString(c.Inheritable, capStr) {
-			c.Inheritable = append(c.Inheritable, capStr)
+	}
+}
+
+// defaultCapabilities is the Docker default capability set.
+var defaultCapabilities = []Capability{
+	CapChown, CapDacOverride, CapFowner, CapFsetid, CapKill, CapSetgid, CapSetuid,
+	CapSetpcap, CapNetBindService, CapNetRaw, CapSysChroot, CapMknod, CapAuditWrite,
+	CapSetfcap,
+}
+
+// WithDefaultCapabilities replaces the process capabilities with the Docker
+// default set (CAP_CHOWN, CAP_DAC_OVERRIDE, CAP_FOWNER, CAP_FSETID, CAP_KILL,
+// CAP_SETGID, CAP_SETUID, CAP_SETPCAP, CAP_NET_BIND_SERVICE, CAP_NET_RAW,
+// CAP_SYS_CHROOT, CAP_MKNOD, CAP_AUDIT_WRITE, CAP_SETFCAP) in the Bounding,
+// Effective and Permitted sets, and clears the Inheritable and Ambient sets.
+// Apply WithCapability after it to grant more.
+func WithDefaultCapabilities() SpecOption {
+	return func(sp *specs.Spec) {
+		if sp.Process == nil {
+			sp.Process = &specs.Process{}
 		}
-		if !containsString(c.Permitted, capStr) {
-			c.Permitted = append(c.Permitted, capStr)
+		caps := make([]string, len(defaultCapabilities))
+		for i, c := range defaultCapabilities {
+			caps[i] = string(c)
 		}
-		if !containsString(c.Ambient, capStr) {
-			c.Ambient = append(c.Ambient, capStr)
+		sp.Process.Capabilities = &specs.LinuxCapabilities{
+			Bounding:  caps,
+			Effective: slices.Clone(caps),
+			Permitted: slices.Clone(caps),
 		}
 	}
 }
@@ -273,6 +1505,73 @@ func containsString(slice []string, s string) bool {
 	return false
 }
 
+// splitShellWords splits s into words following POSIX shell quoting rules.
+func splitShellWords(s string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\n':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case ch == '\\':
+			if i+1 >= len(s) {
+				return nil, fmt.Errorf("libcrun: trailing backslash in command line %q", s)
+			}
+			i++
+			word.WriteByte(s[i])
+			inWord = true
+		case ch == '\'':
+			end := strings.IndexByte(s[i+1:], '\'')
+			if end < 0 {
+				return nil, fmt.Errorf("libcrun: unterminated single quote in command line %q", s)
+			}
+			word.WriteString(s[i+1 : i+1+end])
+			i += end + 1
+			inWord = true
+		case ch == '"':
+			closed := false
+			for i++; i < len(s); i++ {
+				if s[i] == '"' {
+					closed = true
+					break
+				}
+				// Inside double quotes, backslash only escapes \, ", $ and `
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("\\\"$`", s[i+1]) >= 0 {
+					i++
+				}
+				word.WriteByte(s[i])
+			}
+			if !closed {
+				return nil, fmt.Errorf("libcrun: unterminated double quote in command line %q", s)
+			}
+			inWord = true
+		default:
+			word.WriteByte(ch)
+			inWord = true
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+func hasMount(sp *specs.Spec, dest string) bool {
+	for _, m := range sp.Mounts {
+		if m.Destination == dest {
+			return true
+		}
+	}
+	return false
+}
+
 func ensureLinuxResources(sp *specs.Spec) {
 	if sp.Linux == nil {
 		sp.Linux = &specs.Linux{}
@@ -284,18 +1583,58 @@ func ensureLinuxResources(sp *specs.Spec) {
 
 // DefaultSpec returns a typed OCI spec using libcrun's baseline template,
 // unmarshalled into specs-go. Set rootless=true for an unprivileged template.
+// Among other defaults, the template masks /proc/acpi, /proc/asound,
+// /proc/kcore, /proc/keys, /proc/latency_stats, /proc/timer_list,
+// /proc/timer_stats, /proc/sched_debug, /sys/firmware and /proc/scsi, and
+// makes /proc/bus, /proc/fs, /proc/irq, /proc/sys and /proc/sysrq-trigger
+// read-only; WithMaskedPaths and WithReadonlyPaths add to these lists.
+// The template is generated by libcrun once and cached; every call returns a
+// fresh copy that the caller may modify.
 func DefaultSpec(rootless bool) (*specs.Spec, error) {
-	js, err := Spec(rootless)
+	js, err := defaultSpecTemplate(rootless)
 	if err != nil {
 		return nil, err
 	}
 	var sp specs.Spec
-	if err := json.Unmarshal([]byte(js), &sp); err != nil {
+	if err := json.Unmarshal(js, &sp); err != nil {
 		return nil, err
 	}
 	return &sp, nil
 }
 
+// specTemplateKey identifies a cached baseline template. The rootless template
+// embeds the caller's IDs in its user namespace mappings.
+type specTemplateKey struct {
+	rootless bool
+	uid, gid int
+}
+
+var (
+	specTemplatesMu sync.Mutex
+	specTemplates   = make(map[specTemplateKey][]byte)
+)
+
+// defaultSpecTemplate returns libcrun's baseline template JSON, generating it
+// on first use. Failures are not cached.
+func defaultSpecTemplate(rootless bool) ([]byte, error) {
+	key := specTemplateKey{rootless: rootless}
+	if rootless {
+		key.uid, key.gid = os.Geteuid(), os.Getegid()
+	}
+
+	specTemplatesMu.Lock()
+	defer specTemplatesMu.Unlock()
+	if js, ok := specTemplates[key]; ok {
+		return js, nil
+	}
+	js, err := Spec(rootless)
+	if err != nil {
+		return nil, err
+	}
+	specTemplates[key] = []byte(js)
+	return specTemplates[key], nil
+}
+
 // SetOrReplaceLinuxNamespace sets or replaces a Linux namespace entry on the Spec.
 // If path != "", it attaches an existing namespace (e.g. "/proc/<pid>/ns/net").
 // If path == "", it means "create a fresh namespace" of that type.
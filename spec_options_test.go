@@ -3,6 +3,11 @@
 package crun
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
 	"testing"
 
 	specs "github.com/opencontainers/runtime-spec/specs-go"
@@ -18,6 +23,60 @@ func TestSpecOptionWithRootPath(t *testing.T) {
 	}
 }
 
+func TestSpecOptionWithSharedRootfs(t *testing.T) {
+	sp := &specs.Spec{}
+	opt := WithSharedRootfs("/shared/rootfs")
+	opt(sp)
+
+	if sp.Root == nil || sp.Root.Path != "/shared/rootfs" {
+		t.Fatalf("WithSharedRootfs failed: got %v", sp.Root)
+	}
+	if !sp.Root.Readonly {
+		t.Error("Root should be readonly")
+	}
+}
+
+func TestSpecOptionWithReadonlyRootfsWithDefaults(t *testing.T) {
+	sp := &specs.Spec{
+		Mounts: []specs.Mount{
+			{Destination: "/proc", Type: "proc", Source: "proc"},
+			{Destination: "/tmp", Type: "none", Source: "/host/tmp", Options: []string{"bind"}},
+		},
+	}
+	opt := WithReadonlyRootfsWithDefaults()
+	opt(sp)
+
+	if sp.Root == nil || !sp.Root.Readonly {
+		t.Fatal("Root should be readonly")
+	}
+
+	mounts := make(map[string]specs.Mount)
+	for _, m := range sp.Mounts {
+		if _, dup := mounts[m.Destination]; dup {
+			t.Errorf("Duplicate mount for %s", m.Destination)
+		}
+		mounts[m.Destination] = m
+	}
+
+	// Existing /tmp mount is preserved
+	if mounts["/tmp"].Type != "none" {
+		t.Errorf("/tmp mount type = %q, want none (existing mount preserved)", mounts["/tmp"].Type)
+	}
+	for _, dest := range []string{"/run", "/var/tmp"} {
+		m, ok := mounts[dest]
+		if !ok {
+			t.Errorf("Missing tmpfs mount for %s", dest)
+			continue
+		}
+		if m.Type != "tmpfs" {
+			t.Errorf("%s mount type = %q, want tmpfs", dest, m.Type)
+		}
+	}
+	if len(sp.Mounts) != 4 {
+		t.Errorf("Mounts length = %d, want 4", len(sp.Mounts))
+	}
+}
+
 func TestSpecOptionWithArgs(t *testing.T) {
 	sp := &specs.Spec{}
 	opt := WithArgs("/bin/sh", "-c", "echo hello")
@@ -34,6 +93,77 @@ func TestSpecOptionWithArgs(t *testing.T) {
 	}
 }
 
+func TestSpecOptionWithShellCommand(t *testing.T) {
+	tests := []struct {
+		cmdline string
+		want    []string
+	}{
+		{`sh -c 'echo hi'`, []string{"sh", "-c", "echo hi"}},
+		{`echo "hello world" foo`, []string{"echo", "hello world", "foo"}},
+		{`ls my\ dir`, []string{"ls", "my dir"}},
+		{`echo "a \"quoted\" \n"`, []string{"echo", `a "quoted" \n`}},
+		{`echo '' x`, []string{"echo", "", "x"}},
+		{"  spaced\targs  ", []string{"spaced", "args"}},
+		{`echo a'b c'"d e"f`, []string{"echo", "ab cd ef"}},
+		{`echo \'not quoted\'`, []string{"echo", "'not", "quoted'"}},
+		{`sh -c 'echo "$HOME"'`, []string{"sh", "-c", `echo "$HOME"`}},
+	}
+
+	for _, tt := range tests {
+		opt, err := WithShellCommand(tt.cmdline)
+		if err != nil {
+			t.Errorf("WithShellCommand(%q) failed: %v", tt.cmdline, err)
+			continue
+		}
+		sp := &specs.Spec{}
+		opt(sp)
+		if !reflect.DeepEqual(sp.Process.Args, tt.want) {
+			t.Errorf("WithShellCommand(%q) Args = %q, want %q", tt.cmdline, sp.Process.Args, tt.want)
+		}
+	}
+}
+
+func TestSpecOptionWithShellCommandErrors(t *testing.T) {
+	for _, cmdline := range []string{`echo 'unterminated`, `echo "unterminated`, `echo trailing\`, "   "} {
+		if _, err := WithShellCommand(cmdline); err == nil {
+			t.Errorf("WithShellCommand(%q) should fail", cmdline)
+		}
+	}
+}
+
+func TestSpecOptionWithCommandString(t *testing.T) {
+	tests := []struct {
+		cmd     string
+		want    []string
+		wantErr bool
+	}{
+		{cmd: `sh -c 'echo hi'`, want: []string{"sh", "-c", "echo hi"}},
+		{cmd: `printf "%s\n" "two words"`, want: []string{"printf", `%s\n`, "two words"}},
+		{cmd: `cat my\ file`, want: []string{"cat", "my file"}},
+		{cmd: `echo 'unterminated`, wantErr: true},
+		{cmd: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		opt, err := WithCommandString(tt.cmd)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("WithCommandString(%q) should fail", tt.cmd)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("WithCommandString(%q) failed: %v", tt.cmd, err)
+			continue
+		}
+		sp := &specs.Spec{}
+		opt(sp)
+		if !reflect.DeepEqual(sp.Process.Args, tt.want) {
+			t.Errorf("WithCommandString(%q) Args = %q, want %q", tt.cmd, sp.Process.Args, tt.want)
+		}
+	}
+}
+
 func TestSpecOptionWithContainerTTY(t *testing.T) {
 	// Test enabling TTY
 	sp := &specs.Spec{}
@@ -57,6 +187,22 @@ func TestSpecOptionWithContainerTTY(t *testing.T) {
 	}
 }
 
+func TestSpecOptionWithConsoleSize(t *testing.T) {
+	sp := &specs.Spec{}
+	opt := WithConsoleSize(24, 80)
+	opt(sp)
+
+	if sp.Process == nil || sp.Process.ConsoleSize == nil {
+		t.Fatal("ConsoleSize is nil")
+	}
+	if sp.Process.ConsoleSize.Height != 24 {
+		t.Errorf("Height = %d, want 24", sp.Process.ConsoleSize.Height)
+	}
+	if sp.Process.ConsoleSize.Width != 80 {
+		t.Errorf("Width = %d, want 80", sp.Process.ConsoleSize.Width)
+	}
+}
+
 func TestSpecOptionWithEnv(t *testing.T) {
 	sp := &specs.Spec{Process: &specs.Process{}}
 	opt1 := WithEnv("FOO", "bar")
@@ -75,6 +221,67 @@ func TestSpecOptionWithEnv(t *testing.T) {
 	}
 }
 
+func TestSpecOptionWithEnvPassthrough(t *testing.T) {
+	t.Setenv("LIBCRUN_GO_TEST_PROXY", "http://proxy:3128")
+	t.Setenv("LIBCRUN_GO_TEST_EMPTY", "")
+	t.Setenv("LIBCRUN_GO_TEST_ABSENT", "")
+	os.Unsetenv("LIBCRUN_GO_TEST_ABSENT")
+
+	sp := &specs.Spec{}
+	WithEnvPassthrough("LIBCRUN_GO_TEST_PROXY", "LIBCRUN_GO_TEST_ABSENT", "LIBCRUN_GO_TEST_EMPTY")(sp)
+
+	want := []string{"LIBCRUN_GO_TEST_PROXY=http://proxy:3128", "LIBCRUN_GO_TEST_EMPTY="}
+	if sp.Process == nil || !reflect.DeepEqual(sp.Process.Env, want) {
+		t.Errorf("Env = %v, want %v", sp.Process, want)
+	}
+}
+
+func TestSpecOptionWithEnvPattern(t *testing.T) {
+	t.Setenv("LIBCRUN_GO_TEST_AWS_REGION", "eu-west-1")
+	t.Setenv("LIBCRUN_GO_TEST_AWS_PROFILE", "dev")
+	t.Setenv("LIBCRUN_GO_TEST_OTHER", "x")
+
+	opt, err := WithEnvPattern("LIBCRUN_GO_TEST_AWS_*")
+	if err != nil {
+		t.Fatalf("WithEnvPattern failed: %v", err)
+	}
+	sp := &specs.Spec{}
+	opt(sp)
+
+	got := slices.Clone(sp.Process.Env)
+	slices.Sort(got)
+	want := []string{"LIBCRUN_GO_TEST_AWS_PROFILE=dev", "LIBCRUN_GO_TEST_AWS_REGION=eu-west-1"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Env = %v, want %v", got, want)
+	}
+
+	if _, err := WithEnvPattern("AWS_["); err == nil {
+		t.Error("WithEnvPattern with a malformed pattern succeeded, want error")
+	}
+}
+
+func TestSpecOptionWithSortedEnv(t *testing.T) {
+	sp := &specs.Spec{}
+	WithEnv("ZED", "1")(sp)
+	WithEnv("PATH", "/bin")(sp)
+	WithEnv("A_B", "x")(sp)
+	WithEnv("ZED", "2")(sp)
+	WithEnv("A", "y=z")(sp)
+	WithSortedEnv()(sp)
+
+	want := []string{"A=y=z", "A_B=x", "PATH=/bin", "ZED=2"}
+	if !reflect.DeepEqual(sp.Process.Env, want) {
+		t.Errorf("Env = %q, want %q", sp.Process.Env, want)
+	}
+
+	// A spec without a process is left alone
+	empty := &specs.Spec{}
+	WithSortedEnv()(empty)
+	if empty.Process != nil {
+		t.Errorf("Process = %+v, want nil", empty.Process)
+	}
+}
+
 func TestSpecOptionWithMemoryLimit(t *testing.T) {
 	sp := &specs.Spec{}
 	opt := WithMemoryLimit(512 * 1024 * 1024)
@@ -88,6 +295,57 @@ func TestSpecOptionWithMemoryLimit(t *testing.T) {
 	}
 }
 
+func TestSpecOptionWithMemoryHighAndLow(t *testing.T) {
+	sp := &specs.Spec{}
+	WithMemoryHigh(256 * 1024 * 1024)(sp)
+	WithMemoryLow(64 * 1024 * 1024)(sp)
+
+	if sp.Linux == nil || sp.Linux.Resources == nil {
+		t.Fatal("Linux resources not initialized")
+	}
+	want := map[string]string{
+		"memory.high": "268435456",
+		"memory.low":  "67108864",
+	}
+	if !reflect.DeepEqual(sp.Linux.Resources.Unified, want) {
+		t.Errorf("Unified = %v, want %v", sp.Linux.Resources.Unified, want)
+	}
+
+	// -1 lifts the limit
+	WithMemoryHigh(-1)(sp)
+	if got := sp.Linux.Resources.Unified["memory.high"]; got != "max" {
+		t.Errorf("memory.high = %q, want max", got)
+	}
+}
+
+func TestSpecOptionWithResourcesJSON(t *testing.T) {
+	opt, err := WithResourcesJSON(`{"memory":{"limit":268435456},"cpu":{"shares":512,"quota":50000,"period":100000}}`)
+	if err != nil {
+		t.Fatalf("WithResourcesJSON failed: %v", err)
+	}
+	sp := &specs.Spec{}
+	WithPidsLimit(10)(sp)
+	opt(sp)
+
+	res := sp.Linux.Resources
+	if res.Memory == nil || res.Memory.Limit == nil || *res.Memory.Limit != 268435456 {
+		t.Errorf("Memory = %+v, want limit 268435456", res.Memory)
+	}
+	if res.CPU == nil || res.CPU.Shares == nil || *res.CPU.Shares != 512 ||
+		res.CPU.Quota == nil || *res.CPU.Quota != 50000 || res.CPU.Period == nil || *res.CPU.Period != 100000 {
+		t.Errorf("CPU = %+v, want shares 512, quota 50000, period 100000", res.CPU)
+	}
+	if res.Pids != nil {
+		t.Errorf("Pids = %+v, want the earlier resources replaced", res.Pids)
+	}
+
+	for _, data := range []string{`{"memory":`, `{"memory":{"limit":"lots"}}`, `{"memroy":{}}`, `{} {}`} {
+		if _, err := WithResourcesJSON(data); err == nil {
+			t.Errorf("WithResourcesJSON(%q) succeeded, want error", data)
+		}
+	}
+}
+
 func TestSpecOptionWithCPUShares(t *testing.T) {
 	sp := &specs.Spec{}
 	opt := WithCPUShares(512)
@@ -114,16 +372,56 @@ func TestSpecOptionWithCPUQuota(t *testing.T) {
 	}
 }
 
+func TestSpecOptionWithCPUBurst(t *testing.T) {
+	sp := &specs.Spec{}
+	WithCPUQuota(50000)(sp)
+	WithCPUBurst(20000)(sp)
+
+	if sp.Linux == nil || sp.Linux.Resources == nil || sp.Linux.Resources.CPU == nil {
+		t.Fatal("Linux resources not initialized")
+	}
+	cpu := sp.Linux.Resources.CPU
+	if cpu.Burst == nil || *cpu.Burst != 20000 {
+		t.Errorf("CPU burst = %v, want %d", cpu.Burst, 20000)
+	}
+	if cpu.Quota == nil || *cpu.Quota != 50000 {
+		t.Errorf("CPU quota = %v, want it kept at %d", cpu.Quota, 50000)
+	}
+}
+
+func TestSpecOptionWithCPUsFraction(t *testing.T) {
+	sp := &specs.Spec{}
+	opt := WithCPUsFraction(0.5)
+	opt(sp)
+
+	if sp.Linux == nil || sp.Linux.Resources == nil || sp.Linux.Resources.CPU == nil {
+		t.Fatal("Linux resources not initialized")
+	}
+	cpu := sp.Linux.Resources.CPU
+	if cpu.Quota == nil || *cpu.Quota != 50000 {
+		t.Errorf("CPU quota = %v, want 50000", cpu.Quota)
+	}
+	if cpu.Period == nil || *cpu.Period != 100000 {
+		t.Errorf("CPU period = %v, want 100000", cpu.Period)
+	}
+
+	sp = &specs.Spec{}
+	WithCPUsFraction(0)(sp)
+	if sp.Linux != nil {
+		t.Errorf("Linux = %+v, want unchanged spec for zero CPUs", sp.Linux)
+	}
+}
+
 func TestSpecOptionWithPidsLimit(t *testing.T) {
 	sp := &specs.Spec{}
 	opt := WithPidsLimit(100)
 	opt(sp)
 
-	if sp.Linux == nil || sp.Linux.Resources == nil || sp.Linux.Resources.Pids == nil {
+	if sp.Linux == nil || sp.Linux.Resources == nil || sp.Linux.Resources.Pids == nil || sp.Linux.Resources.Pids.Limit == nil {
 		t.Fatal("Linux resources not initialized")
 	}
-	if sp.Linux.Resources.Pids.Limit != 100 {
-		t.Errorf("Pids limit = %d, want %d", sp.Linux.Resources.Pids.Limit, 100)
+	if *sp.Linux.Resources.Pids.Limit != 100 {
+		t.Errorf("Pids limit = %d, want %d", *sp.Linux.Resources.Pids.Limit, 100)
 	}
 }
 
@@ -137,6 +435,222 @@ func TestSpecOptionWithHostname(t *testing.T) {
 	}
 }
 
+func mountDestinations(mounts []specs.Mount) []string {
+	dests := make([]string, len(mounts))
+	for i, m := range mounts {
+		dests[i] = m.Destination
+	}
+	return dests
+}
+
+func TestSpecOptionWithMounts(t *testing.T) {
+	sp := &specs.Spec{Mounts: []specs.Mount{{Destination: "/proc"}}}
+	WithMounts(specs.Mount{Destination: "/a"}, specs.Mount{Destination: "/b"})(sp)
+	WithMounts(specs.Mount{Destination: "/c"})(sp)
+
+	want := []string{"/proc", "/a", "/b", "/c"}
+	if got := mountDestinations(sp.Mounts); !reflect.DeepEqual(got, want) {
+		t.Errorf("Mount destinations = %v, want %v", got, want)
+	}
+}
+
+func TestSpecOptionWithMountBefore(t *testing.T) {
+	sp := &specs.Spec{Mounts: []specs.Mount{
+		{Destination: "/proc"},
+		{Destination: "/data/cache"},
+		{Destination: "/sys"},
+	}}
+	WithMountBefore("/data/cache", specs.Mount{Destination: "/data", Type: "tmpfs"})(sp)
+	WithMountBefore("/missing", specs.Mount{Destination: "/last"})(sp)
+
+	want := []string{"/proc", "/data", "/data/cache", "/sys", "/last"}
+	if got := mountDestinations(sp.Mounts); !reflect.DeepEqual(got, want) {
+		t.Errorf("Mount destinations = %v, want %v", got, want)
+	}
+	if sp.Mounts[1].Type != "tmpfs" {
+		t.Errorf("Inserted mount type = %q, want tmpfs", sp.Mounts[1].Type)
+	}
+}
+
+func TestParseMountSpec(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		want    specs.Mount
+		wantErr bool
+	}{
+		{
+			name:  "bind",
+			input: "type=bind,source=/x,destination=/y",
+			want:  specs.Mount{Type: "bind", Source: "/x", Destination: "/y", Options: []string{"rbind"}},
+		},
+		{
+			name:  "bind readonly with propagation",
+			input: "type=bind,src=/x,dst=/y,readonly,bind-propagation=rslave",
+			want:  specs.Mount{Type: "bind", Source: "/x", Destination: "/y", Options: []string{"rbind", "rslave", "ro"}},
+		},
+		{
+			name:  "readonly false",
+			input: "type=bind,source=/x,target=/y,ro=false",
+			want:  specs.Mount{Type: "bind", Source: "/x", Destination: "/y", Options: []string{"rbind"}},
+		},
+		{
+			name:  "volume is the default type",
+			input: "source=/var/lib/data,destination=/data",
+			want:  specs.Mount{Type: "bind", Source: "/var/lib/data", Destination: "/data", Options: []string{"rbind"}},
+		},
+		{
+			name:  "tmpfs",
+			input: "type=tmpfs,destination=/tmp,tmpfs-size=65536,tmpfs-mode=1777",
+			want:  specs.Mount{Type: "tmpfs", Source: "tmpfs", Destination: "/tmp", Options: []string{"nosuid", "nodev", "size=65536", "mode=1777"}},
+		},
+		{
+			name:  "extra options",
+			input: "type=tmpfs,dst=/run,options=noexec:noatime",
+			want:  specs.Mount{Type: "tmpfs", Source: "tmpfs", Destination: "/run", Options: []string{"nosuid", "nodev", "noexec", "noatime"}},
+		},
+		{
+			name:  "quoted value with comma",
+			input: `type=bind,"source=/a,b",destination=/y`,
+			want:  specs.Mount{Type: "bind", Source: "/a,b", Destination: "/y", Options: []string{"rbind"}},
+		},
+		{name: "missing destination", input: "type=bind,source=/x", wantErr: true},
+		{name: "relative destination", input: "type=bind,source=/x,destination=y", wantErr: true},
+		{name: "bind without source", input: "type=bind,destination=/y", wantErr: true},
+		{name: "named volume", input: "type=volume,source=myvol,destination=/y", wantErr: true},
+		{name: "tmpfs with source", input: "type=tmpfs,source=/x,destination=/y", wantErr: true},
+		{name: "tmpfs with propagation", input: "type=tmpfs,destination=/y,bind-propagation=shared", wantErr: true},
+		{name: "bind with tmpfs size", input: "type=bind,source=/x,destination=/y,tmpfs-size=1", wantErr: true},
+		{name: "unknown type", input: "type=nfs,source=/x,destination=/y", wantErr: true},
+		{name: "unknown key", input: "type=bind,source=/x,destination=/y,consistency=cached", wantErr: true},
+		{name: "bad propagation", input: "type=bind,source=/x,destination=/y,bind-propagation=up", wantErr: true},
+		{name: "bad readonly", input: "type=bind,source=/x,destination=/y,readonly=maybe", wantErr: true},
+		{name: "bad tmpfs mode", input: "type=tmpfs,destination=/y,tmpfs-mode=999", wantErr: true},
+		{name: "key without value", input: "type=bind,source,destination=/y", wantErr: true},
+		{name: "empty", input: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMountSpec(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMountSpec(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseMountSpec(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpecOptionWithMountSpec(t *testing.T) {
+	opt, err := WithMountSpec("type=bind,source=/x,destination=/y,readonly")
+	if err != nil {
+		t.Fatalf("WithMountSpec failed: %v", err)
+	}
+	sp := &specs.Spec{}
+	opt(sp)
+	if len(sp.Mounts) != 1 || sp.Mounts[0].Destination != "/y" {
+		t.Fatalf("Mounts = %+v, want one mount on /y", sp.Mounts)
+	}
+
+	if _, err := WithMountSpec("type=bind,destination=/y"); err == nil {
+		t.Error("Expected error for a bind mount without source")
+	}
+}
+
+func TestSpecOptionWithIDMappedMount(t *testing.T) {
+	uidMaps := []specs.LinuxIDMapping{{ContainerID: 0, HostID: 100000, Size: 65536}}
+	gidMaps := []specs.LinuxIDMapping{{ContainerID: 0, HostID: 200000, Size: 65536}}
+	sp := &specs.Spec{}
+	WithIDMappedMount("/srv/data", "/data", uidMaps, gidMaps)(sp)
+
+	if len(sp.Mounts) != 1 {
+		t.Fatalf("Mounts = %+v, want one mount", sp.Mounts)
+	}
+	m := sp.Mounts[0]
+	if m.Source != "/srv/data" || m.Destination != "/data" || m.Type != "bind" {
+		t.Errorf("Mount = %+v, want a bind mount of /srv/data on /data", m)
+	}
+	if !reflect.DeepEqual(m.UIDMappings, uidMaps) {
+		t.Errorf("UIDMappings = %+v, want %+v", m.UIDMappings, uidMaps)
+	}
+	if !reflect.DeepEqual(m.GIDMappings, gidMaps) {
+		t.Errorf("GIDMappings = %+v, want %+v", m.GIDMappings, gidMaps)
+	}
+	if !slices.Contains(m.Options, "rbind") {
+		t.Errorf("Options = %v, want rbind", m.Options)
+	}
+}
+
+func TestParseDeviceSpec(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		wantPath  string
+		wantPerms string
+		wantErr   bool
+	}{
+		{name: "host path only", input: "/dev/null", wantPath: "/dev/null", wantPerms: "rwm"},
+		{name: "container path", input: "/dev/null:/dev/mynull", wantPath: "/dev/mynull", wantPerms: "rwm"},
+		{name: "permissions without container path", input: "/dev/null:rw", wantPath: "/dev/null", wantPerms: "rw"},
+		{name: "path:path:perms", input: "/dev/null:/dev/mynull:rm", wantPath: "/dev/mynull", wantPerms: "rm"},
+		{name: "bad permissions", input: "/dev/null:/dev/null:rwx", wantErr: true},
+		{name: "repeated permission", input: "/dev/null:/dev/null:rr", wantErr: true},
+		{name: "empty permissions", input: "/dev/null:/dev/null:", wantErr: true},
+		{name: "relative container path", input: "/dev/null:null", wantErr: true},
+		{name: "relative host path", input: "null", wantErr: true},
+		{name: "too many fields", input: "/dev/null:/dev/null:rw:x", wantErr: true},
+		{name: "missing host device", input: "/dev/does-not-exist", wantErr: true},
+		{name: "not a device", input: "/", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dev, perms, err := ParseDeviceSpec(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseDeviceSpec(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if dev.Path != tt.wantPath || perms != tt.wantPerms {
+				t.Errorf("ParseDeviceSpec(%q) = %q, %q; want %q, %q", tt.input, dev.Path, perms, tt.wantPath, tt.wantPerms)
+			}
+			// /dev/null is the character device 1:3
+			if dev.Type != "c" || dev.Major != 1 || dev.Minor != 3 {
+				t.Errorf("ParseDeviceSpec(%q) device = %s %d:%d, want c 1:3", tt.input, dev.Type, dev.Major, dev.Minor)
+			}
+		})
+	}
+}
+
+func TestSpecOptionWithDeviceSpec(t *testing.T) {
+	opt, err := WithDeviceSpec("/dev/null:/dev/mynull:rw")
+	if err != nil {
+		t.Fatalf("WithDeviceSpec failed: %v", err)
+	}
+	sp := &specs.Spec{}
+	opt(sp)
+	opt(sp) // the device is not duplicated
+
+	if len(sp.Linux.Devices) != 1 || sp.Linux.Devices[0].Path != "/dev/mynull" {
+		t.Fatalf("Devices = %+v, want one device on /dev/mynull", sp.Linux.Devices)
+	}
+	rules := sp.Linux.Resources.Devices
+	if len(rules) == 0 {
+		t.Fatal("No device cgroup rule added")
+	}
+	rule := rules[len(rules)-1]
+	if !rule.Allow || rule.Type != "c" || rule.Major == nil || *rule.Major != 1 || rule.Minor == nil || *rule.Minor != 3 || rule.Access != "rw" {
+		t.Errorf("Device cgroup rule = %+v, want allow c 1:3 rw", rule)
+	}
+
+	if _, err := WithDeviceSpec("/dev/null:/dev/null:x"); err == nil {
+		t.Error("Expected error for invalid permissions")
+	}
+}
+
 func TestSpecOptionWithMount(t *testing.T) {
 	sp := &specs.Spec{}
 	opt := WithMount("/host/data", "/container/data", "none", []string{"bind", "ro"})
@@ -173,6 +687,71 @@ func TestSpecOptionWithAnnotation(t *testing.T) {
 	}
 }
 
+func TestSpecOptionWithAnnotations(t *testing.T) {
+	sp := &specs.Spec{Annotations: map[string]string{"a": "old", "b": "keep"}}
+	opt := WithAnnotations(map[string]string{"a": "new", "c": "added"})
+	opt(sp)
+
+	want := map[string]string{"a": "new", "b": "keep", "c": "added"}
+	if len(sp.Annotations) != len(want) {
+		t.Fatalf("Annotations length = %d, want %d", len(sp.Annotations), len(want))
+	}
+	for k, v := range want {
+		if sp.Annotations[k] != v {
+			t.Errorf("Annotations[%q] = %q, want %q", k, sp.Annotations[k], v)
+		}
+	}
+
+	// Nil map should be allocated
+	sp2 := &specs.Spec{}
+	WithAnnotations(map[string]string{"x": "y"})(sp2)
+	if sp2.Annotations["x"] != "y" {
+		t.Errorf("Annotations[x] = %q, want y", sp2.Annotations["x"])
+	}
+}
+
+func TestSpecOptionWithAnnotationsFromLabels(t *testing.T) {
+	sp := &specs.Spec{Annotations: map[string]string{"io.example.app": "old"}}
+	opt := WithAnnotationsFromLabels("io.example.", map[string]string{"app": "web", "tier": "frontend"})
+	opt(sp)
+
+	if sp.Annotations["io.example.app"] != "web" {
+		t.Errorf("Annotations[io.example.app] = %q, want web", sp.Annotations["io.example.app"])
+	}
+	if sp.Annotations["io.example.tier"] != "frontend" {
+		t.Errorf("Annotations[io.example.tier] = %q, want frontend", sp.Annotations["io.example.tier"])
+	}
+	if _, ok := sp.Annotations["app"]; ok {
+		t.Error("Unprefixed key app should not be present")
+	}
+}
+
+func TestSpecOptionWithImageLabels(t *testing.T) {
+	sp := &specs.Spec{}
+	opt := WithImageLabels(map[string]string{
+		"org.opencontainers.image.source": "https://example.com/repo",
+		"maintainer":                      "team@example.com",
+	})
+	opt(sp)
+
+	want := map[string]string{
+		"org.opencontainers.image.source":     "https://example.com/repo",
+		"org.opencontainers.image.maintainer": "team@example.com",
+	}
+	if !reflect.DeepEqual(sp.Annotations, want) {
+		t.Errorf("Annotations = %v, want %v", sp.Annotations, want)
+	}
+}
+
+func TestSpecOptionWithStopSignal(t *testing.T) {
+	sp := &specs.Spec{}
+	WithStopSignal("SIGQUIT")(sp)
+
+	if got := sp.Annotations[StopSignalAnnotation]; got != "SIGQUIT" {
+		t.Errorf("Annotations[%q] = %q, want %q", StopSignalAnnotation, got, "SIGQUIT")
+	}
+}
+
 func TestSpecOptionWithNetworkNamespace(t *testing.T) {
 	sp := &specs.Spec{}
 	opt := WithNetworkNamespace("/proc/1/ns/net")
@@ -190,6 +769,66 @@ func TestSpecOptionWithNetworkNamespace(t *testing.T) {
 	}
 }
 
+func TestSpecOptionWithNamespacesFromPid(t *testing.T) {
+	pid := os.Getpid()
+	opt, err := WithNamespacesFromPid(pid)
+	if err != nil {
+		t.Fatalf("WithNamespacesFromPid failed: %v", err)
+	}
+	sp := &specs.Spec{}
+	opt(sp)
+
+	if sp.Linux == nil || len(sp.Linux.Namespaces) != 5 {
+		t.Fatalf("Namespaces = %v, want the 5 default namespaces", sp.Linux)
+	}
+	for _, ns := range sp.Linux.Namespaces {
+		want := fmt.Sprintf("/proc/%d/ns/%s", pid, nsProcNames[ns.Type])
+		if ns.Path != want {
+			t.Errorf("%s namespace path = %q, want %q", ns.Type, ns.Path, want)
+		}
+	}
+
+	// Only the requested namespaces are joined, replacing existing entries
+	opt, err = WithNamespacesFromPid(pid, specs.NetworkNamespace)
+	if err != nil {
+		t.Fatalf("WithNamespacesFromPid(network) failed: %v", err)
+	}
+	sp = &specs.Spec{Linux: &specs.Linux{Namespaces: []specs.LinuxNamespace{
+		{Type: specs.NetworkNamespace},
+		{Type: specs.MountNamespace},
+	}}}
+	opt(sp)
+	if len(sp.Linux.Namespaces) != 2 {
+		t.Fatalf("Namespaces = %v, want 2", sp.Linux.Namespaces)
+	}
+	if ns := sp.Linux.Namespaces[0]; ns.Path != fmt.Sprintf("/proc/%d/ns/net", pid) {
+		t.Errorf("network namespace path = %q", ns.Path)
+	}
+	if ns := sp.Linux.Namespaces[1]; ns.Path != "" {
+		t.Errorf("mount namespace path = %q, want empty", ns.Path)
+	}
+
+	if _, err := namespacesFromPid(t.TempDir(), pid, nil); err == nil {
+		t.Error("namespacesFromPid with missing namespaces succeeded, want error")
+	}
+	if _, err := WithNamespacesFromPid(pid, "bogus"); err == nil {
+		t.Error("WithNamespacesFromPid with an unknown type succeeded, want error")
+	}
+}
+
+func TestSpecOptionWithCgroupNamespace(t *testing.T) {
+	sp := &specs.Spec{}
+	opt := WithCgroupNamespace()
+	opt(sp)
+
+	if sp.Linux == nil || len(sp.Linux.Namespaces) != 1 {
+		t.Fatal("Namespace not added")
+	}
+	if ns := sp.Linux.Namespaces[0]; ns.Type != specs.CgroupNamespace || ns.Path != "" {
+		t.Errorf("Namespace = %+v, want a new cgroup namespace", ns)
+	}
+}
+
 func TestSetOrReplaceLinuxNamespace(t *testing.T) {
 	sp := &specs.Spec{}
 
@@ -267,6 +906,324 @@ func TestSpecOptionWithUser(t *testing.T) {
 	}
 }
 
+// passwdFixture creates a rootfs with /etc/passwd and /etc/group.
+func passwdFixture(t *testing.T) string {
+	t.Helper()
+	rootfs := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(rootfs, "etc"), 0755); err != nil {
+		t.Fatalf("Failed to create etc: %v", err)
+	}
+	files := map[string]string{
+		"etc/passwd": "root:x:0:0:root:/root:/bin/sh\nappuser:x:1000:1001:App:/home/app:/bin/sh\nbroken:x:oops:1:::\n",
+		"etc/group":  "root:x:0:\nvideo:x:44:appuser\ndocker:x:999:\n",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(rootfs, name), []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+	}
+	return rootfs
+}
+
+func TestSpecOptionWithUserByName(t *testing.T) {
+	rootfs := passwdFixture(t)
+
+	opt, err := WithUserByName(rootfs, "appuser")
+	if err != nil {
+		t.Fatalf("WithUserByName failed: %v", err)
+	}
+	sp := &specs.Spec{Process: &specs.Process{Env: []string{"PATH=/bin", "HOME=/root"}}}
+	opt(sp)
+	if sp.Process.User.UID != 1000 || sp.Process.User.GID != 1001 {
+		t.Errorf("User = %d:%d, want 1000:1001", sp.Process.User.UID, sp.Process.User.GID)
+	}
+	if want := []string{"PATH=/bin", "HOME=/home/app"}; !reflect.DeepEqual(sp.Process.Env, want) {
+		t.Errorf("Env = %q, want %q", sp.Process.Env, want)
+	}
+
+	for _, name := range []string{"nobody", "app", "broken"} {
+		if _, err := WithUserByName(rootfs, name); err == nil {
+			t.Errorf("WithUserByName(%q) succeeded, want error", name)
+		}
+	}
+	if _, err := WithUserByName(t.TempDir(), "root"); err == nil {
+		t.Error("WithUserByName without /etc/passwd succeeded, want error")
+	}
+}
+
+func TestSpecOptionWithGroupByName(t *testing.T) {
+	rootfs := passwdFixture(t)
+
+	sp := &specs.Spec{}
+	for _, name := range []string{"video", "docker", "video"} {
+		opt, err := WithGroupByName(rootfs, name)
+		if err != nil {
+			t.Fatalf("WithGroupByName(%q) failed: %v", name, err)
+		}
+		opt(sp)
+	}
+	if want := []uint32{44, 999}; !reflect.DeepEqual(sp.Process.User.AdditionalGids, want) {
+		t.Errorf("AdditionalGids = %v, want %v", sp.Process.User.AdditionalGids, want)
+	}
+
+	if _, err := WithGroupByName(rootfs, "wheel"); err == nil {
+		t.Error("WithGroupByName for a missing group succeeded, want error")
+	}
+}
+
+func TestLookupRootfsEntryStaysInRootfs(t *testing.T) {
+	rootfs := t.TempDir()
+	if err := os.Symlink("/etc", filepath.Join(rootfs, "etc")); err != nil {
+		t.Fatalf("Failed to create symlink: %v", err)
+	}
+	if _, err := WithUserByName(rootfs, "root"); err == nil {
+		t.Error("WithUserByName read the host /etc/passwd through a symlink")
+	}
+}
+
+func TestSpecOptionWithUmask(t *testing.T) {
+	sp := &specs.Spec{}
+	opt, err := WithUmask(0o022)
+	if err != nil {
+		t.Fatalf("WithUmask failed: %v", err)
+	}
+	opt(sp)
+
+	if sp.Process == nil || sp.Process.User.Umask == nil {
+		t.Fatal("Umask is nil")
+	}
+	if *sp.Process.User.Umask != 0o022 {
+		t.Errorf("Umask = %#o, want 022", *sp.Process.User.Umask)
+	}
+}
+
+func TestSpecOptionWithUmaskOutOfRange(t *testing.T) {
+	opt, err := WithUmask(0o1000)
+	if err == nil {
+		t.Fatal("WithUmask should fail for a mask above 0777")
+	}
+	if opt != nil {
+		t.Error("WithUmask should return a nil option on error")
+	}
+}
+
+func TestSpecOptionWithScheduler(t *testing.T) {
+	sp := &specs.Spec{}
+	opt, err := WithScheduler(specs.SchedFIFO, 50, specs.SchedFlagResetOnFork)
+	if err != nil {
+		t.Fatalf("WithScheduler failed: %v", err)
+	}
+	opt(sp)
+
+	if sp.Process == nil || sp.Process.Scheduler == nil {
+		t.Fatal("Scheduler is nil")
+	}
+	s := sp.Process.Scheduler
+	if s.Policy != specs.SchedFIFO {
+		t.Errorf("Policy = %q, want %q", s.Policy, specs.SchedFIFO)
+	}
+	if s.Priority != 50 {
+		t.Errorf("Priority = %d, want 50", s.Priority)
+	}
+	if len(s.Flags) != 1 || s.Flags[0] != specs.SchedFlagResetOnFork {
+		t.Errorf("Flags = %v, want [%s]", s.Flags, specs.SchedFlagResetOnFork)
+	}
+}
+
+func TestSpecOptionWithSchedulerInvalidPriority(t *testing.T) {
+	tests := []struct {
+		policy   specs.LinuxSchedulerPolicy
+		priority int32
+	}{
+		{specs.SchedIdle, 10},
+		{specs.SchedOther, 1},
+		{specs.SchedFIFO, 0},
+		{specs.SchedRR, 100},
+	}
+
+	for _, tt := range tests {
+		if _, err := WithScheduler(tt.policy, tt.priority); err == nil {
+			t.Errorf("WithScheduler(%s, %d) should fail", tt.policy, tt.priority)
+		}
+	}
+
+	if _, err := WithScheduler(specs.SchedIdle, 0); err != nil {
+		t.Errorf("WithScheduler(SCHED_IDLE, 0) failed: %v", err)
+	}
+}
+
+func TestSpecOptionWithIOPriority(t *testing.T) {
+	sp := &specs.Spec{}
+	opt, err := WithIOPriority(specs.IOPRIO_CLASS_BE, 4)
+	if err != nil {
+		t.Fatalf("WithIOPriority failed: %v", err)
+	}
+	opt(sp)
+
+	if sp.Process == nil || sp.Process.IOPriority == nil {
+		t.Fatal("IOPriority is nil")
+	}
+	if sp.Process.IOPriority.Class != specs.IOPRIO_CLASS_BE {
+		t.Errorf("Class = %q, want %q", sp.Process.IOPriority.Class, specs.IOPRIO_CLASS_BE)
+	}
+	if sp.Process.IOPriority.Priority != 4 {
+		t.Errorf("Priority = %d, want 4", sp.Process.IOPriority.Priority)
+	}
+}
+
+func TestSpecOptionWithIOPriorityInvalid(t *testing.T) {
+	if _, err := WithIOPriority(specs.IOPRIO_CLASS_BE, 8); err == nil {
+		t.Error("WithIOPriority should fail for priority 8")
+	}
+	if _, err := WithIOPriority(specs.IOPRIO_CLASS_IDLE, -1); err == nil {
+		t.Error("WithIOPriority should fail for priority -1")
+	}
+	if _, err := WithIOPriority("IOPRIO_CLASS_BOGUS", 0); err == nil {
+		t.Error("WithIOPriority should fail for an unknown class")
+	}
+}
+
+func TestSpecOptionWithNoFileLimit(t *testing.T) {
+	// The default applies only when no RLIMIT_NOFILE is set
+	sp := &specs.Spec{Process: &specs.Process{
+		Rlimits: []specs.POSIXRlimit{{Type: "RLIMIT_CORE"}},
+	}}
+	applyDefaultNoFileLimit(sp)
+	want := []specs.POSIXRlimit{
+		{Type: "RLIMIT_CORE"},
+		{Type: "RLIMIT_NOFILE", Hard: DefaultNoFileLimit, Soft: DefaultNoFileLimit},
+	}
+	if !reflect.DeepEqual(sp.Process.Rlimits, want) {
+		t.Errorf("Rlimits = %+v, want %+v", sp.Process.Rlimits, want)
+	}
+
+	WithNoFileLimit(4096, 65536)(sp)
+	applyDefaultNoFileLimit(sp)
+	want[1] = specs.POSIXRlimit{Type: "RLIMIT_NOFILE", Hard: 65536, Soft: 4096}
+	if !reflect.DeepEqual(sp.Process.Rlimits, want) {
+		t.Errorf("Rlimits after WithNoFileLimit = %+v, want %+v", sp.Process.Rlimits, want)
+	}
+}
+
+func TestSpecOptionWithCoreDumps(t *testing.T) {
+	sp := &specs.Spec{Process: &specs.Process{
+		Rlimits: []specs.POSIXRlimit{{Type: "RLIMIT_CORE", Hard: 0, Soft: 0}},
+	}}
+	WithCoreDumps(true)(sp)
+
+	if len(sp.Process.Rlimits) != 1 {
+		t.Fatalf("Rlimits = %v, want a single RLIMIT_CORE entry", sp.Process.Rlimits)
+	}
+	rl := sp.Process.Rlimits[0]
+	if rl.Type != "RLIMIT_CORE" || rl.Hard != ^uint64(0) || rl.Soft != ^uint64(0) {
+		t.Errorf("Rlimit = %+v, want unlimited RLIMIT_CORE", rl)
+	}
+	if sp.Hooks != nil {
+		t.Errorf("Hooks = %+v, want none", sp.Hooks)
+	}
+}
+
+func TestSpecOptionWithCoreDumpsDisabled(t *testing.T) {
+	sp := &specs.Spec{}
+	WithCoreDumps(false)(sp)
+
+	if sp.Process == nil || len(sp.Process.Rlimits) != 1 {
+		t.Fatal("RLIMIT_CORE not set")
+	}
+	if rl := sp.Process.Rlimits[0]; rl.Type != "RLIMIT_CORE" || rl.Hard != 0 || rl.Soft != 0 {
+		t.Errorf("Rlimit = %+v, want zero RLIMIT_CORE", rl)
+	}
+}
+
+func TestSpecOptionWithAutoUserNamespace(t *testing.T) {
+	dir := t.TempDir()
+	subuid := filepath.Join(dir, "subuid")
+	subgid := filepath.Join(dir, "subgid")
+	if err := os.WriteFile(subuid, []byte("4242:100000:65536\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(subgid, []byte("4242:200000:65536\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	opt, err := autoUserNamespace(subuid, subgid, 4242, 4343)
+	if err != nil {
+		t.Fatalf("autoUserNamespace failed: %v", err)
+	}
+	sp := &specs.Spec{Linux: &specs.Linux{
+		UIDMappings: []specs.LinuxIDMapping{{ContainerID: 0, HostID: 4242, Size: 1}},
+	}}
+	opt(sp)
+
+	if !reflect.DeepEqual(sp.Linux.Namespaces, []specs.LinuxNamespace{{Type: specs.UserNamespace}}) {
+		t.Errorf("Namespaces = %+v, want a new user namespace", sp.Linux.Namespaces)
+	}
+	wantUID := []specs.LinuxIDMapping{
+		{ContainerID: 0, HostID: 4242, Size: 1},
+		{ContainerID: 1, HostID: 100000, Size: 65536},
+	}
+	if !reflect.DeepEqual(sp.Linux.UIDMappings, wantUID) {
+		t.Errorf("UIDMappings = %+v, want %+v", sp.Linux.UIDMappings, wantUID)
+	}
+	wantGID := []specs.LinuxIDMapping{
+		{ContainerID: 0, HostID: 4343, Size: 1},
+		{ContainerID: 1, HostID: 200000, Size: 65536},
+	}
+	if !reflect.DeepEqual(sp.Linux.GIDMappings, wantGID) {
+		t.Errorf("GIDMappings = %+v, want %+v", sp.Linux.GIDMappings, wantGID)
+	}
+
+	if _, err := autoUserNamespace(filepath.Join(dir, "missing"), subgid, 4242, 4343); err == nil {
+		t.Error("autoUserNamespace should fail without a subuid file")
+	}
+}
+
+func TestSpecOptionWithNetworkDevice(t *testing.T) {
+	sp := &specs.Spec{}
+	WithNetworkDevice("eth1", "")(sp)
+	WithNetworkDevice("enp3s0", "data0")(sp)
+
+	want := map[string]specs.LinuxNetDevice{
+		"eth1":   {},
+		"enp3s0": {Name: "data0"},
+	}
+	if sp.Linux == nil || !reflect.DeepEqual(sp.Linux.NetDevices, want) {
+		t.Errorf("NetDevices = %+v, want %+v", sp.Linux, want)
+	}
+}
+
+func TestSpecOptionWithNetworkDevicesMoveBack(t *testing.T) {
+	sp := &specs.Spec{}
+	WithNetworkDevice("eth1", "")(sp)
+	WithNetworkDevice("enp3s0", "data0")(sp)
+	WithNetworkDevicesMoveBack()(sp)
+
+	if sp.Hooks == nil || len(sp.Hooks.CreateRuntime) != 1 || len(sp.Hooks.Poststop) != 1 {
+		t.Fatalf("Hooks = %+v, want one createRuntime and one poststop hook", sp.Hooks)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatalf("os.Executable failed: %v", err)
+	}
+	pin := sp.Hooks.CreateRuntime[0]
+	if want := []string{netnsHookArg0, "pin", netnsPinDir, "data0", "enp3s0", "eth1", "eth1"}; pin.Path != exe || !reflect.DeepEqual(pin.Args, want) {
+		t.Errorf("createRuntime hook = %s %q, want %s %q", pin.Path, pin.Args, exe, want)
+	}
+	release := sp.Hooks.Poststop[0]
+	if want := []string{netnsHookArg0, "release", netnsPinDir}; release.Path != exe || !reflect.DeepEqual(release.Args, want) {
+		t.Errorf("poststop hook = %s %q, want %s %q", release.Path, release.Args, exe, want)
+	}
+}
+
+func TestSpecOptionWithNetworkDevicesMoveBackNoDevices(t *testing.T) {
+	sp := &specs.Spec{}
+	WithNetworkDevicesMoveBack()(sp)
+
+	if sp.Hooks != nil {
+		t.Errorf("Hooks = %+v, want none without network devices", sp.Hooks)
+	}
+}
+
 func TestSpecOptionWithCwd(t *testing.T) {
 	sp := &specs.Spec{}
 	opt := WithCwd("/app")
@@ -280,6 +1237,64 @@ func TestSpecOptionWithCwd(t *testing.T) {
 	}
 }
 
+func TestSpecOptionWithInit(t *testing.T) {
+	sp := &specs.Spec{}
+	WithArgs("/bin/sh", "-c", "sleep 1 &")(sp)
+	WithInit("/usr/bin/tini-static")(sp)
+	WithInit("/usr/bin/tini-static")(sp)
+
+	want := []string{InitPath, "--", "/bin/sh", "-c", "sleep 1 &"}
+	if !reflect.DeepEqual(sp.Process.Args, want) {
+		t.Errorf("Args = %v, want %v", sp.Process.Args, want)
+	}
+	if len(sp.Mounts) != 1 {
+		t.Fatalf("Expected 1 mount, got %d", len(sp.Mounts))
+	}
+	m := sp.Mounts[0]
+	if m.Source != "/usr/bin/tini-static" || m.Destination != InitPath {
+		t.Errorf("Mount = %s -> %s, want /usr/bin/tini-static -> %s", m.Source, m.Destination, InitPath)
+	}
+	if !slices.Contains(m.Options, "ro") {
+		t.Errorf("Init mount options = %v, want ro", m.Options)
+	}
+}
+
+func TestSpecOptionWithOCIVersion(t *testing.T) {
+	opt, err := WithOCIVersion("1.0.2-dev")
+	if err != nil {
+		t.Fatalf("WithOCIVersion failed: %v", err)
+	}
+	sp := &specs.Spec{Version: "1.2.0"}
+	opt(sp)
+	if sp.Version != "1.0.2-dev" {
+		t.Errorf("Version = %q, want 1.0.2-dev", sp.Version)
+	}
+
+	for _, v := range []string{"", "1", "1.2", "v1.2.0", "1.2.x", "1.2.0 "} {
+		if _, err := WithOCIVersion(v); err == nil {
+			t.Errorf("WithOCIVersion(%q) succeeded, want error", v)
+		}
+	}
+}
+
+func TestCgroupPathForParent(t *testing.T) {
+	tests := []struct {
+		parent  string
+		systemd bool
+		want    string
+	}{
+		{parent: "machine.slice", systemd: true, want: "machine.slice:crungo:web"},
+		{parent: "/libcrun-go", want: "/libcrun-go/web"},
+		{parent: "libcrun-go/", want: "/libcrun-go/web"},
+		{parent: "a/b", want: "/a/b/web"},
+	}
+	for _, tt := range tests {
+		if got := cgroupPathForParent(tt.parent, "web", tt.systemd); got != tt.want {
+			t.Errorf("cgroupPathForParent(%q, systemd=%v) = %q, want %q", tt.parent, tt.systemd, got, tt.want)
+		}
+	}
+}
+
 func TestSpecOptionWithHostNetwork(t *testing.T) {
 	sp := &specs.Spec{
 		Linux: &specs.Linux{
@@ -307,6 +1322,111 @@ func TestSpecOptionWithHostNetwork(t *testing.T) {
 	}
 }
 
+func TestSpecOptionWithPersonality(t *testing.T) {
+	sp := &specs.Spec{}
+	opt := WithPersonality(specs.PerLinux)
+	opt(sp)
+
+	if sp.Linux == nil || sp.Linux.Personality == nil {
+		t.Fatal("Personality is nil")
+	}
+	if sp.Linux.Personality.Domain != specs.PerLinux {
+		t.Errorf("Domain = %q, want %q", sp.Linux.Personality.Domain, specs.PerLinux)
+	}
+	if len(sp.Linux.Personality.Flags) != 0 {
+		t.Errorf("Flags = %v, want empty", sp.Linux.Personality.Flags)
+	}
+
+	// Flags are passed through
+	WithPersonality(specs.PerLinux32, "ADDR_NO_RANDOMIZE")(sp)
+	if sp.Linux.Personality.Domain != specs.PerLinux32 {
+		t.Errorf("Domain = %q, want %q", sp.Linux.Personality.Domain, specs.PerLinux32)
+	}
+	if len(sp.Linux.Personality.Flags) != 1 || sp.Linux.Personality.Flags[0] != "ADDR_NO_RANDOMIZE" {
+		t.Errorf("Flags = %v, want [ADDR_NO_RANDOMIZE]", sp.Linux.Personality.Flags)
+	}
+}
+
+func TestSpecOptionWithSeccompDefault(t *testing.T) {
+	sp := &specs.Spec{}
+	WithSeccompDefault(specs.ActErrno)(sp)
+
+	if sp.Linux == nil || sp.Linux.Seccomp == nil {
+		t.Fatal("Seccomp is nil")
+	}
+	if sp.Linux.Seccomp.DefaultAction != specs.ActErrno {
+		t.Errorf("DefaultAction = %q, want %q", sp.Linux.Seccomp.DefaultAction, specs.ActErrno)
+	}
+
+	// The default action of an existing profile is replaced, its rules kept
+	WithSeccompRule(specs.ActAllow, "read")(sp)
+	WithSeccompDefault(specs.ActKillProcess)(sp)
+	if sp.Linux.Seccomp.DefaultAction != specs.ActKillProcess {
+		t.Errorf("DefaultAction = %q, want %q", sp.Linux.Seccomp.DefaultAction, specs.ActKillProcess)
+	}
+	if len(sp.Linux.Seccomp.Syscalls) != 1 {
+		t.Errorf("Syscalls = %v, want 1 rule", sp.Linux.Seccomp.Syscalls)
+	}
+}
+
+func TestSpecOptionWithSeccompRule(t *testing.T) {
+	sp := &specs.Spec{}
+	WithSeccompRule(specs.ActErrno, "mount", "umount2")(sp)
+
+	if sp.Linux == nil || sp.Linux.Seccomp == nil {
+		t.Fatal("Seccomp is nil")
+	}
+	seccomp := sp.Linux.Seccomp
+	if seccomp.DefaultAction != specs.ActAllow {
+		t.Errorf("DefaultAction = %q, want %q", seccomp.DefaultAction, specs.ActAllow)
+	}
+	if len(seccomp.Syscalls) != 1 {
+		t.Fatalf("Syscalls = %v, want 1 rule", seccomp.Syscalls)
+	}
+	rule := seccomp.Syscalls[0]
+	if rule.Action != specs.ActErrno {
+		t.Errorf("Action = %q, want %q", rule.Action, specs.ActErrno)
+	}
+	if len(rule.Names) != 2 || rule.Names[0] != "mount" || rule.Names[1] != "umount2" {
+		t.Errorf("Names = %v, want [mount umount2]", rule.Names)
+	}
+
+	// Rules accumulate
+	WithSeccompRule(specs.ActKillProcess, "reboot")(sp)
+	if len(seccomp.Syscalls) != 2 || seccomp.Syscalls[1].Names[0] != "reboot" {
+		t.Errorf("Syscalls = %v, want the reboot rule appended", seccomp.Syscalls)
+	}
+}
+
+func TestSpecOptionSeccompHostArches(t *testing.T) {
+	want := seccompArches(unameMachine())
+	if want == nil {
+		t.Skipf("Skipping: no seccomp architecture known for %q", unameMachine())
+	}
+
+	sp := &specs.Spec{}
+	WithSeccompRule(specs.ActErrno, "mount")(sp)
+	if !reflect.DeepEqual(sp.Linux.Seccomp.Architectures, want) {
+		t.Errorf("Architectures = %v, want %v", sp.Linux.Seccomp.Architectures, want)
+	}
+
+	// Architectures already set are kept
+	sp = &specs.Spec{Linux: &specs.Linux{Seccomp: &specs.LinuxSeccomp{
+		Architectures: []specs.Arch{specs.ArchX86},
+	}}}
+	WithSeccompDefault(specs.ActErrno)(sp)
+	if got := sp.Linux.Seccomp.Architectures; len(got) != 1 || got[0] != specs.ArchX86 {
+		t.Errorf("Architectures = %v, want [%s]", got, specs.ArchX86)
+	}
+
+	if got := seccompArches("x86_64"); len(got) == 0 || got[0] != specs.ArchX86_64 {
+		t.Errorf("seccompArches(x86_64) = %v, want %s first", got, specs.ArchX86_64)
+	}
+	if got := seccompArches("aarch64"); len(got) == 0 || got[0] != specs.ArchAARCH64 {
+		t.Errorf("seccompArches(aarch64) = %v, want %s first", got, specs.ArchAARCH64)
+	}
+}
+
 func TestSpecOptionWithCapability(t *testing.T) {
 	sp := &specs.Spec{}
 	opt := WithCapability(CapNetRaw)
@@ -337,6 +1457,46 @@ func TestSpecOptionWithCapability(t *testing.T) {
 	}
 }
 
+func TestSpecOptionWithCapabilityInSets(t *testing.T) {
+	sp := &specs.Spec{}
+	opt := WithCapabilityInSets(CapNetAdmin, CapSetBounding, CapSetPermitted, CapSetBounding)
+	opt(sp)
+	opt(sp)
+
+	c := sp.Process.Capabilities
+	want := []string{string(CapNetAdmin)}
+	if !reflect.DeepEqual(c.Bounding, want) {
+		t.Errorf("Bounding = %v, want %v", c.Bounding, want)
+	}
+	if !reflect.DeepEqual(c.Permitted, want) {
+		t.Errorf("Permitted = %v, want %v", c.Permitted, want)
+	}
+	if len(c.Effective) != 0 || len(c.Inheritable) != 0 || len(c.Ambient) != 0 {
+		t.Errorf("Effective = %v, Inheritable = %v, Ambient = %v, want all empty", c.Effective, c.Inheritable, c.Ambient)
+	}
+}
+
+func TestSpecOptionWithDefaultCapabilities(t *testing.T) {
+	sp := &specs.Spec{}
+	WithCapability(CapSysAdmin)(sp)
+	WithDefaultCapabilities()(sp)
+
+	want := []string{
+		"CAP_CHOWN", "CAP_DAC_OVERRIDE", "CAP_FOWNER", "CAP_FSETID", "CAP_KILL",
+		"CAP_SETGID", "CAP_SETUID", "CAP_SETPCAP", "CAP_NET_BIND_SERVICE", "CAP_NET_RAW",
+		"CAP_SYS_CHROOT", "CAP_MKNOD", "CAP_AUDIT_WRITE", "CAP_SETFCAP",
+	}
+	c := sp.Process.Capabilities
+	for name, set := range map[string][]string{"Bounding": c.Bounding, "Effective": c.Effective, "Permitted": c.Permitted} {
+		if !reflect.DeepEqual(set, want) {
+			t.Errorf("%s = %v, want %v", name, set, want)
+		}
+	}
+	if len(c.Inheritable) != 0 || len(c.Ambient) != 0 {
+		t.Errorf("Inheritable = %v, Ambient = %v, want both empty", c.Inheritable, c.Ambient)
+	}
+}
+
 func TestSpecOptionWithCapabilityNoDuplicates(t *testing.T) {
 	sp := &specs.Spec{}
 
@@ -3,6 +3,11 @@
 package crun
 
 import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"runtime"
+	"slices"
 	"strings"
 	"testing"
 
@@ -82,6 +87,116 @@ func TestNewContainerSpec(t *testing.T) {
 	}
 }
 
+func TestContainerSpecValidate(t *testing.T) {
+	valid := func() *specs.Spec {
+		return &specs.Spec{
+			Version: "1.0.0",
+			Root:    &specs.Root{Path: "/tmp/rootfs"},
+			Process: &specs.Process{Args: []string{"/bin/sh"}, Cwd: "/"},
+		}
+	}
+	tests := []struct {
+		name   string
+		mutate func(sp *specs.Spec)
+	}{
+		{"missing root", func(sp *specs.Spec) { sp.Root = nil }},
+		{"empty root path", func(sp *specs.Spec) { sp.Root.Path = "" }},
+		{"missing process", func(sp *specs.Spec) { sp.Process = nil }},
+		{"empty args", func(sp *specs.Spec) { sp.Process.Args = nil }},
+		{"relative cwd", func(sp *specs.Spec) { sp.Process.Cwd = "tmp" }},
+	}
+
+	spec, err := NewContainerSpec(valid())
+	if err != nil {
+		t.Fatalf("NewContainerSpec failed: %v", err)
+	}
+	if err := spec.Validate(); err != nil {
+		t.Errorf("Validate(valid) = %v, want nil", err)
+	}
+	spec.Close()
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sp := valid()
+			tt.mutate(sp)
+			spec, err := NewContainerSpec(sp)
+			if err != nil {
+				t.Skipf("libcrun rejected the spec while loading: %v", err)
+			}
+			defer spec.Close()
+			if err := spec.Validate(); !errors.Is(err, ErrInvalidContainerSpec) {
+				t.Errorf("Validate() = %v, want ErrInvalidContainerSpec", err)
+			}
+		})
+	}
+}
+
+func TestCreateValidatesSpec(t *testing.T) {
+	rc, err := NewRuntimeContext(RuntimeConfig{
+		StateRoot:       filepath.Join(t.TempDir(), "state"),
+		CreateStateRoot: true,
+	})
+	if err != nil {
+		t.Fatalf("NewRuntimeContext failed: %v", err)
+	}
+	defer rc.Close()
+
+	spec, err := NewContainerSpec(&specs.Spec{
+		Version: "1.0.0",
+		Root:    &specs.Root{Path: "/tmp/rootfs"},
+		Process: &specs.Process{Cwd: "/"},
+	})
+	if err != nil {
+		t.Fatalf("NewContainerSpec failed: %v", err)
+	}
+	defer spec.Close()
+
+	if err := spec.Validate(); !errors.Is(err, ErrInvalidContainerSpec) {
+		t.Errorf("Validate() = %v, want ErrInvalidContainerSpec", err)
+	}
+	if _, err := rc.Create("test-invalid", spec, CreateOptions{}); !errors.Is(err, ErrInvalidContainerSpec) {
+		t.Errorf("Create() = %v, want ErrInvalidContainerSpec", err)
+	}
+}
+
+func TestContainerSpecAddRootfsPrepare(t *testing.T) {
+	rc, err := NewRuntimeContext(RuntimeConfig{StateRoot: t.TempDir()})
+	if err != nil {
+		t.Fatalf("NewRuntimeContext failed: %v", err)
+	}
+	defer rc.Close()
+
+	spec, err := NewSpec(false, WithRootPath("rootfs"))
+	if err != nil {
+		t.Fatalf("NewSpec failed: %v", err)
+	}
+	defer spec.Close()
+
+	var calls []string
+	spec.AddRootfsPrepare(func(rootfs string) error {
+		calls = append(calls, "first:"+rootfs)
+		return nil
+	})
+	spec.AddRootfsPrepare(func(rootfs string) error {
+		calls = append(calls, "second:"+rootfs)
+		return nil
+	})
+
+	// A relative root is resolved against the bundle being run
+	if err := rc.prepareRootfs(spec, "/bundle"); err != nil {
+		t.Fatalf("prepareRootfs failed: %v", err)
+	}
+	if want := []string{"first:/bundle/rootfs", "second:/bundle/rootfs"}; !slices.Equal(calls, want) {
+		t.Errorf("calls = %q, want %q", calls, want)
+	}
+
+	errPrepare := errors.New("prepare failed")
+	spec.AddRootfsPrepare(func(string) error { return errPrepare })
+	if err := rc.prepareRootfs(spec, "/bundle"); !errors.Is(err, errPrepare) {
+		t.Errorf("prepareRootfs = %v, want %v", err, errPrepare)
+	}
+}
+
 func TestContainerSpecClose(t *testing.T) {
 	js, err := Spec(true)
 	if err != nil {
@@ -110,3 +225,189 @@ func TestContainerSpecClose(t *testing.T) {
 	}
 }
 
+func TestCloseThenGC(t *testing.T) {
+	// Closed handles must not be freed again by their finalizers, nor must
+	// unclosed ones be freed twice: run with -race or GODEBUG=clobberfree=1
+	// to make a double free more likely to crash.
+	for i := 0; i < 100; i++ {
+		spec, err := NewSpec(true)
+		if err != nil {
+			t.Fatalf("NewSpec failed: %v", err)
+		}
+		rc, err := NewRuntimeContext(RuntimeConfig{StateRoot: t.TempDir()})
+		if err != nil {
+			t.Fatalf("NewRuntimeContext failed: %v", err)
+		}
+		if i%2 == 0 {
+			spec.Close()
+			rc.Close()
+		}
+	}
+	runtime.GC()
+	runtime.GC()
+}
+
+
+func TestDefaultSpecReturnsCopies(t *testing.T) {
+	a, err := DefaultSpec(false)
+	if err != nil {
+		t.Fatalf("DefaultSpec failed: %v", err)
+	}
+	if len(a.Process.Env) == 0 || len(a.Mounts) == 0 || len(a.Linux.MaskedPaths) == 0 {
+		t.Fatal("template is missing the env, mounts or masked paths this test mutates")
+	}
+	a.Process.Args = []string{"/modified"}
+	a.Hostname = "modified"
+	// Mutate in place: these would leak into later specs if backing arrays
+	// or maps were shared with the cached template
+	a.Process.Env[0] = "MODIFIED=1"
+	a.Mounts[0].Destination = "/modified"
+	a.Linux.MaskedPaths[0] = "/modified"
+	if a.Annotations == nil {
+		a.Annotations = map[string]string{}
+	}
+	a.Annotations["modified"] = "1"
+
+	b, err := DefaultSpec(false)
+	if err != nil {
+		t.Fatalf("DefaultSpec failed: %v", err)
+	}
+	if b.Hostname == "modified" || (len(b.Process.Args) > 0 && b.Process.Args[0] == "/modified") {
+		t.Error("DefaultSpec returned a spec sharing state with a previous result")
+	}
+	if b.Process.Env[0] == "MODIFIED=1" || b.Mounts[0].Destination == "/modified" ||
+		b.Linux.MaskedPaths[0] == "/modified" || b.Annotations["modified"] != "" {
+		t.Error("DefaultSpec returned a spec sharing slices or maps with a previous result")
+	}
+}
+
+func TestMaskedAndReadonlyPathsMergeTemplate(t *testing.T) {
+	sp, err := DefaultSpec(false)
+	if err != nil {
+		t.Fatalf("DefaultSpec failed: %v", err)
+	}
+	if !slices.Contains(sp.Linux.MaskedPaths, "/proc/kcore") || !slices.Contains(sp.Linux.ReadonlyPaths, "/proc/sys") {
+		t.Fatalf("template paths = %v / %v, want libcrun defaults", sp.Linux.MaskedPaths, sp.Linux.ReadonlyPaths)
+	}
+	masked := len(sp.Linux.MaskedPaths)
+	readonly := len(sp.Linux.ReadonlyPaths)
+
+	WithMaskedPaths("/proc/kcore", "/secret", "/secret")(sp)
+	WithReadonlyPaths("/proc/sys", "/etc/app")(sp)
+
+	if len(sp.Linux.MaskedPaths) != masked+1 || !slices.Contains(sp.Linux.MaskedPaths, "/secret") {
+		t.Errorf("MaskedPaths = %v, want template paths plus /secret once", sp.Linux.MaskedPaths)
+	}
+	if len(sp.Linux.ReadonlyPaths) != readonly+1 || !slices.Contains(sp.Linux.ReadonlyPaths, "/etc/app") {
+		t.Errorf("ReadonlyPaths = %v, want template paths plus /etc/app", sp.Linux.ReadonlyPaths)
+	}
+}
+
+func TestRemoveMaskedAndReadonlyPaths(t *testing.T) {
+	sp, err := DefaultSpec(true)
+	if err != nil {
+		t.Fatalf("DefaultSpec failed: %v", err)
+	}
+	if len(sp.Linux.MaskedPaths) == 0 || !slices.Contains(sp.Linux.ReadonlyPaths, "/proc/sys") {
+		t.Fatalf("template paths = %v / %v, want libcrun defaults", sp.Linux.MaskedPaths, sp.Linux.ReadonlyPaths)
+	}
+	readonly := slices.Clone(sp.Linux.ReadonlyPaths)
+
+	WithClearMaskedPaths()(sp)
+	if len(sp.Linux.MaskedPaths) != 0 {
+		t.Errorf("MaskedPaths = %v, want empty", sp.Linux.MaskedPaths)
+	}
+
+	WithoutReadonlyPath("/proc/sys")(sp)
+	want := slices.DeleteFunc(readonly, func(p string) bool { return p == "/proc/sys" })
+	if !slices.Equal(sp.Linux.ReadonlyPaths, want) {
+		t.Errorf("ReadonlyPaths = %v, want %v", sp.Linux.ReadonlyPaths, want)
+	}
+
+	WithMaskedPaths("/secret", "/other")(sp)
+	WithoutMaskedPath("/secret")(sp)
+	if !slices.Equal(sp.Linux.MaskedPaths, []string{"/other"}) {
+		t.Errorf("MaskedPaths = %v, want [/other]", sp.Linux.MaskedPaths)
+	}
+
+	WithClearReadonlyPaths()(sp)
+	if len(sp.Linux.ReadonlyPaths) != 0 {
+		t.Errorf("ReadonlyPaths = %v, want empty", sp.Linux.ReadonlyPaths)
+	}
+
+	// A spec without a linux section is left alone
+	WithoutMaskedPath("/proc/kcore")(&specs.Spec{})
+}
+
+// BenchmarkNewSpec compares NewSpec, which reuses the cached baseline template,
+// with regenerating the template in libcrun for every spec.
+// Run with: go test -run=^$ -bench=NewSpec -benchmem
+func BenchmarkNewSpec(b *testing.B) {
+	opts := []SpecOption{
+		WithRootPath("/rootfs"),
+		WithArgs("/bin/true"),
+		WithMemoryLimit(64 * 1024 * 1024),
+	}
+
+	b.Run("Cached", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			spec, err := NewSpec(false, opts...)
+			if err != nil {
+				b.Fatal(err)
+			}
+			spec.Close()
+		}
+	})
+
+	b.Run("Uncached", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			js, err := Spec(false)
+			if err != nil {
+				b.Fatal(err)
+			}
+			var sp specs.Spec
+			if err := json.Unmarshal([]byte(js), &sp); err != nil {
+				b.Fatal(err)
+			}
+			for _, opt := range opts {
+				opt(&sp)
+			}
+			spec, err := LoadContainerSpecFromJSON(mustMarshal(b, &sp))
+			if err != nil {
+				b.Fatal(err)
+			}
+			spec.Close()
+		}
+	})
+}
+
+func mustMarshal(b *testing.B, v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		b.Fatal(err)
+	}
+	return string(data)
+}
+
+// BenchmarkNewContainerSpec measures the cost of turning a typed spec into a
+// libcrun container, including its JSON encoding.
+// Run with: go test -run=^$ -bench=NewContainerSpec -benchmem
+func BenchmarkNewContainerSpec(b *testing.B) {
+	sp, err := DefaultSpec(false)
+	if err != nil {
+		b.Fatalf("DefaultSpec failed: %v", err)
+	}
+	WithRootPath("/rootfs")(sp)
+	WithArgs("/bin/true")(sp)
+
+	b.ReportAllocs()
+	for b.Loop() {
+		spec, err := NewContainerSpec(sp)
+		if err != nil {
+			b.Fatal(err)
+		}
+		spec.Close()
+	}
+}
@@ -40,5 +40,18 @@ type ContainerState struct {
 	Bundle      string            `json:"bundle"`
 	Annotations map[string]string `json:"annotations,omitempty"`
 	Created     time.Time         `json:"created,omitempty"`
+
+	// Started is when the container's init process started, derived from
+	// /proc/<pid>/stat. It is zero if the process is not running.
+	Started time.Time `json:"-"`
+}
+
+// Uptime returns how long the container's init process has been running,
+// or 0 if it is not running.
+func (s *ContainerState) Uptime() time.Duration {
+	if s.Started.IsZero() {
+		return 0
+	}
+	return time.Since(s.Started)
 }
 
@@ -89,3 +89,15 @@ func TestContainerStateUnmarshal(t *testing.T) {
 	}
 }
 
+
+func TestContainerStateUptime(t *testing.T) {
+	var s ContainerState
+	if got := s.Uptime(); got != 0 {
+		t.Errorf("Uptime() = %v, want 0 when not started", got)
+	}
+
+	s.Started = time.Now().Add(-time.Minute)
+	if got := s.Uptime(); got < time.Minute {
+		t.Errorf("Uptime() = %v, want >= 1m", got)
+	}
+}
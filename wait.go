@@ -0,0 +1,142 @@
+//go:build linux
+
+package crun
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// sysPidfdOpen is the pidfd_open(2) syscall number, the same on every
+// architecture since it was added after the syscall tables were unified.
+const sysPidfdOpen = 434
+
+// Wait blocks until the container's init process exits. It returns right away
+// if the container is already stopped. Use ExitCode or RunResult.Wait for the
+// exit code.
+func (c *Container) Wait() error {
+	_, err := c.waitExit(-1)
+	return err
+}
+
+// WaitReady blocks until the container is ready according to probe, a
+// command run in the container every interval until it exits with code 0. It
+// returns ctx.Err() if ctx is done first, e.g. to bound the wait with a
+// timeout, and the exec error if the probe cannot be run at all, e.g. because
+// the container has stopped. interval must be positive.
+func (c *Container) WaitReady(ctx context.Context, probe []string, interval time.Duration) error {
+	if interval <= 0 {
+		return fmt.Errorf("libcrun: wait ready: interval %v is not positive", interval)
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		err := c.ExecCmd(probe...).Context(ctx).Run()
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		var exitErr *ExitError
+		if !errors.As(err, &exitErr) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// waitExit waits up to timeout (forever if negative) for the container's init
+// process to exit, and reports whether it did.
+func (c *Container) waitExit(timeout time.Duration) (bool, error) {
+	state, err := c.State()
+	if err != nil {
+		return false, err
+	}
+	if state.Status == StatusStopped || state.Pid <= 0 {
+		return true, nil
+	}
+
+	fd, err := pidfdOpen(state.Pid)
+	if err != nil {
+		// Kernels before 5.3 have no pidfd, fall back to polling
+		return c.pollExit(timeout)
+	}
+	defer syscall.Close(fd)
+
+	// The pid may have been reused between State and pidfdOpen: only trust
+	// the pidfd if the container is still running now that it is open
+	running, err := c.IsRunning()
+	if err != nil || !running {
+		return err == nil, err
+	}
+	return pidfdWait(fd, timeout)
+}
+
+// pollExit polls IsRunning until the container exits or timeout elapses.
+func (c *Container) pollExit(timeout time.Duration) (bool, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		running, err := c.IsRunning()
+		if err != nil {
+			return false, err
+		}
+		if !running {
+			return true, nil
+		}
+		if timeout >= 0 && time.Now().After(deadline) {
+			return false, nil
+		}
+		time.Sleep(stopPollInterval)
+	}
+}
+
+// pidfdOpen returns a pidfd referring to pid.
+func pidfdOpen(pid int) (int, error) {
+	fd, _, errno := syscall.Syscall(sysPidfdOpen, uintptr(pid), 0, 0)
+	if errno != 0 {
+		return -1, errno
+	}
+	return int(fd), nil
+}
+
+// pidfdWait waits up to timeout (forever if negative) for the process behind
+// fd to exit, which makes the pidfd readable, and reports whether it did.
+func pidfdWait(fd int, timeout time.Duration) (bool, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		var ts *syscall.Timespec
+		if timeout >= 0 {
+			t := syscall.NsecToTimespec(max(time.Until(deadline), 0).Nanoseconds())
+			ts = &t
+		}
+		fds := [1]struct {
+			fd      int32
+			events  int16
+			revents int16
+		}{{fd: int32(fd), events: pollIn}}
+		n, _, errno := syscall.Syscall6(syscall.SYS_PPOLL, uintptr(unsafe.Pointer(&fds[0])), 1, uintptr(unsafe.Pointer(ts)), 0, 0, 0)
+		switch {
+		case errno == syscall.EINTR:
+			continue
+		case errno != 0:
+			return false, errno
+		case n > 0:
+			return true, nil
+		case timeout >= 0 && !time.Now().Before(deadline):
+			return false, nil
+		}
+	}
+}
+
+// pollIn is POLLIN, which the syscall package does not define.
+const pollIn = 0x1
@@ -0,0 +1,62 @@
+//go:build linux
+
+package crun
+
+import (
+	"context"
+	"os/exec"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestPidfdWait(t *testing.T) {
+	cmd := exec.Command("sleep", "0.1")
+	if err := cmd.Start(); err != nil {
+		t.Fatalf("Failed to start sleep: %v", err)
+	}
+	defer cmd.Wait()
+
+	fd, err := pidfdOpen(cmd.Process.Pid)
+	if err == syscall.ENOSYS {
+		t.Skip("Skipping: pidfd_open not supported by the kernel")
+	}
+	if err != nil {
+		t.Fatalf("Failed to open pidfd: %v", err)
+	}
+	defer syscall.Close(fd)
+
+	exited, err := pidfdWait(fd, 0)
+	if err != nil {
+		t.Fatalf("pidfdWait failed: %v", err)
+	}
+	if exited {
+		t.Fatal("Expected process to still be running")
+	}
+
+	start := time.Now()
+	exited, err = pidfdWait(fd, 5*time.Second)
+	if err != nil {
+		t.Fatalf("pidfdWait failed: %v", err)
+	}
+	if !exited {
+		t.Fatal("Expected process to have exited")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("pidfdWait returned %v after start, expected about 100ms", elapsed)
+	}
+
+	// An exited process stays readable
+	if exited, err := pidfdWait(fd, -1); err != nil || !exited {
+		t.Errorf("pidfdWait after exit = %v, %v; want true, nil", exited, err)
+	}
+}
+
+func TestWaitReadyRejectsInterval(t *testing.T) {
+	var c Container
+	for _, interval := range []time.Duration{0, -time.Second} {
+		if err := c.WaitReady(context.Background(), []string{"true"}, interval); err == nil {
+			t.Errorf("WaitReady(interval=%v) succeeded, want error", interval)
+		}
+	}
+}